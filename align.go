@@ -0,0 +1,79 @@
+package disko
+
+// maxAlignment is the largest grain that Alignment will return.  IO sizes
+// that would need a larger grain (some devices report nonsense) are ignored.
+const maxAlignment = 64 * Mebibyte
+
+// Alignment returns the grain that partitions on d should start on and be
+// sized in, and the byte offset of the first aligned position.  The grain is
+// the least common multiple of a Mebibyte and the disk's preferred IO size:
+// OptimalIOSize (the stripe width of a RAID volume), or MinimumIOSize, or
+// PhysicalBlockSize, whichever is the first usable one.  A partition start
+// is aligned if start % grain == offset.
+func (d *Disk) Alignment() (grain, offset uint64) {
+	grain = Mebibyte
+
+	for _, io := range []uint{d.OptimalIOSize, d.MinimumIOSize, d.PhysicalBlockSize} {
+		if io == 0 || (d.SectorSize != 0 && io%d.SectorSize != 0) {
+			continue
+		}
+
+		if g := lcm(Mebibyte, uint64(io)); g <= maxAlignment {
+			grain = g
+			break
+		}
+	}
+
+	return grain, uint64(d.AlignmentOffset) % grain
+}
+
+// AlignUp returns the first aligned position on d at or after n.
+func (d *Disk) AlignUp(n uint64) uint64 {
+	grain, offset := d.Alignment()
+
+	if n <= offset {
+		return offset
+	}
+
+	return ((n-offset+grain-1)/grain)*grain + offset
+}
+
+// AlignDown returns the last aligned position on d at or before n, or 0 if
+// there is none.
+func (d *Disk) AlignDown(n uint64) uint64 {
+	grain, offset := d.Alignment()
+
+	if n < offset {
+		return 0
+	}
+
+	return ((n-offset)/grain)*grain + offset
+}
+
+// PhysicallyAligned returns true if n is on a physical block boundary of d.
+// Partitions that do not start on one pay for read-modify-write cycles on
+// every write that crosses it.
+func (d *Disk) PhysicallyAligned(n uint64) bool {
+	block := uint64(d.PhysicalBlockSize)
+	if block == 0 {
+		block = uint64(d.SectorSize)
+	}
+
+	if block == 0 {
+		return true
+	}
+
+	return n%block == uint64(d.AlignmentOffset)%block
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+func lcm(a, b uint64) uint64 {
+	return a / gcd(a, b) * b
+}
@@ -0,0 +1,148 @@
+package disko_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+)
+
+func TestAlignment(t *testing.T) {
+	const kib = 1024
+
+	tables := []struct {
+		disk   disko.Disk
+		grain  uint64
+		offset uint64
+	}{
+		{disko.Disk{SectorSize: 512}, disko.Mebibyte, 0},
+		{disko.Disk{SectorSize: 512, PhysicalBlockSize: 4 * kib}, disko.Mebibyte, 0},
+		// RAID5 of 4 disks with a 64KiB chunk: stripe width 192KiB.
+		{disko.Disk{SectorSize: 512, PhysicalBlockSize: 4 * kib, MinimumIOSize: 64 * kib,
+			OptimalIOSize: 192 * kib}, 3 * disko.Mebibyte, 0},
+		// 512e drive with the first aligned sector at 7.
+		{disko.Disk{SectorSize: 512, PhysicalBlockSize: 4 * kib, AlignmentOffset: 3584},
+			disko.Mebibyte, 3584},
+		// nonsense optimal IO size falls back to the minimum IO size.
+		{disko.Disk{SectorSize: 512, MinimumIOSize: 4 * kib, OptimalIOSize: 33553920},
+			disko.Mebibyte, 0},
+		{disko.Disk{SectorSize: 4096, OptimalIOSize: 1000}, disko.Mebibyte, 0},
+	}
+
+	for _, table := range tables {
+		grain, offset := table.disk.Alignment()
+		if grain != table.grain || offset != table.offset {
+			t.Errorf("Alignment(%+v) returned (%d, %d), expected (%d, %d)",
+				table.disk, grain, offset, table.grain, table.offset)
+		}
+	}
+}
+
+func TestAlignUpDown(t *testing.T) {
+	ast := assert.New(t)
+	d := disko.Disk{SectorSize: 512, PhysicalBlockSize: 4096, OptimalIOSize: 192 * 1024}
+
+	ast.Equal(uint64(0), d.AlignUp(0))
+	ast.Equal(3*disko.Mebibyte, d.AlignUp(1))
+	ast.Equal(3*disko.Mebibyte, d.AlignUp(3*disko.Mebibyte))
+	ast.Equal(3*disko.Mebibyte, d.AlignDown(6*disko.Mebibyte-1))
+	ast.Equal(6*disko.Mebibyte, d.AlignDown(6*disko.Mebibyte))
+
+	d.AlignmentOffset = 3584
+	ast.Equal(3*disko.Mebibyte+3584, d.AlignUp(disko.Mebibyte))
+	ast.Equal(uint64(3584), d.AlignDown(3*disko.Mebibyte))
+	ast.Equal(uint64(0), d.AlignDown(100))
+}
+
+func TestPhysicallyAligned(t *testing.T) {
+	ast := assert.New(t)
+
+	d := disko.Disk{SectorSize: 512, PhysicalBlockSize: 4096}
+	ast.True(d.PhysicallyAligned(disko.Mebibyte))
+	ast.False(d.PhysicallyAligned(63 * 512))
+
+	d.AlignmentOffset = 3584
+	ast.True(d.PhysicallyAligned(63 * 512))
+
+	ast.True((&disko.Disk{}).PhysicallyAligned(7))
+}
+
+func TestFreeSpacesAligned(t *testing.T) {
+	ast := assert.New(t)
+	d := disko.Disk{
+		Size:          1024 * disko.Mebibyte,
+		SectorSize:    512,
+		OptimalIOSize: 192 * 1024,
+		Table:         disko.GPT,
+		Partitions:    disko.PartitionSet{},
+	}
+
+	fs := d.FreeSpaces()
+	if !ast.Len(fs, 1) {
+		return
+	}
+
+	ast.Equal(3*disko.Mebibyte, fs[0].Start)
+	ast.Equal(1023*disko.Mebibyte-1, fs[0].Last)
+
+	pSet, err := d.Allocate([]disko.PartitionRequest{
+		{Name: "a", MinSize: "10MiB"},
+		{Name: "b", Grow: true},
+	})
+	if !ast.Nil(err) {
+		return
+	}
+
+	a, b := pSet[1], pSet[2]
+	ast.Equal(3*disko.Mebibyte, a.Start)
+	ast.Equal(12*disko.Mebibyte, a.Size())
+	ast.Equal(15*disko.Mebibyte, b.Start)
+	ast.Zero(b.Size() % (3 * disko.Mebibyte))
+}
+
+func TestCheckPartitionRanges(t *testing.T) {
+	ast := assert.New(t)
+
+	// a RAID volume with a 3MiB stripe puts partitions on 3MiB boundaries.
+	d := disko.Disk{Path: "/dev/sdz", Size: 1024 * disko.Mebibyte, SectorSize: 512,
+		OptimalIOSize: 3 * 1024 * 1024, Table: disko.GPT}
+
+	part := func(num uint, start, last uint64) disko.PartitionSet {
+		return disko.PartitionSet{num: {Number: num, Start: start, Last: last}}
+	}
+
+	ast.ErrorIs(d.CheckPartitionRanges(part(1, disko.Mebibyte, 100*disko.Mebibyte-1)), disko.ErrOutOfRange)
+	ast.NoError(d.CheckPartitionRanges(part(1, 3*disko.Mebibyte, 1023*disko.Mebibyte-1)))
+	ast.ErrorIs(d.CheckPartitionRanges(part(1, 3*disko.Mebibyte, 1023*disko.Mebibyte)), disko.ErrOutOfRange)
+	ast.ErrorIs(d.CheckPartitionRanges(part(1, 6*disko.Mebibyte, 3*disko.Mebibyte)), disko.ErrOutOfRange)
+	ast.ErrorIs(d.CheckPartitionRanges(part(129, 3*disko.Mebibyte, 6*disko.Mebibyte-1)), disko.ErrOutOfRange)
+
+	d.Table = disko.MBR
+	ast.ErrorIs(d.CheckPartitionRanges(part(5, 3*disko.Mebibyte, 6*disko.Mebibyte-1)), disko.ErrOutOfRange)
+}
+
+func TestCheckPartitionRangesGrownDisk(t *testing.T) {
+	ast := assert.New(t)
+
+	// a 1GiB disk grown to 2GiB whose backup GPT is still at 1GiB.
+	d := disko.Disk{Path: "/dev/sdz", Size: 2048 * disko.Mebibyte, SectorSize: 512, Table: disko.GPT}
+	d.GPT.LastUsableLBA = 1024*disko.Mebibyte/512 - 34
+
+	part := func(start, last uint64) disko.PartitionSet {
+		return disko.PartitionSet{1: {Number: 1, Start: start, Last: last}}
+	}
+
+	ast.NoError(d.CheckPartitionRanges(part(disko.Mebibyte, 1023*disko.Mebibyte-1)))
+	ast.ErrorIs(d.CheckPartitionRanges(part(disko.Mebibyte, 1500*disko.Mebibyte-1)), disko.ErrOutOfRange)
+	ast.ErrorIs(d.CheckPartitionRanges(part(1100*disko.Mebibyte, 1200*disko.Mebibyte-1)), disko.ErrOutOfRange)
+
+	// FreeSpaces and CheckPartitionResize agree on where the disk ends.
+	fs := d.FreeSpaces()
+	if ast.Len(fs, 1) {
+		ast.NoError(d.CheckPartitionRanges(part(fs[0].Start, fs[0].Last)))
+		ast.ErrorIs(d.CheckPartitionRanges(part(fs[0].Start, fs[0].Last+disko.Mebibyte)), disko.ErrOutOfRange)
+	}
+
+	p := disko.Partition{Number: 1, Start: disko.Mebibyte, Last: 1500*disko.Mebibyte - 1}
+	ast.ErrorIs(d.CheckPartitionResize(p), disko.ErrOutOfRange)
+}
@@ -0,0 +1,243 @@
+package disko
+
+import (
+	"fmt"
+)
+
+// PartitionRequest is a partition to be placed by Disk.Allocate.
+type PartitionRequest struct {
+	// Name is the partition name.
+	Name string
+
+	// Type is the partition type.
+	Type PartType
+
+	// Number is the preferred partition number. Zero picks the lowest free
+	// number.
+	Number uint
+
+	// MinSize is the size of a fixed partition or the smallest size of a
+	// growable one.  It may be empty for a growable partition.
+	MinSize SizeExpr
+
+	// MaxSize is the largest size of a growable partition. Empty means no
+	// limit.
+	MaxSize SizeExpr
+
+	// Grow lets the partition grow past MinSize into the free space it is
+	// placed in.  Growable partitions in the same free space share it
+	// equally, up to their MaxSize.
+	Grow bool
+}
+
+const (
+	maxPartNumMBR = 4
+	maxPartNumGPT = 128
+)
+
+// allocSlot is a free space and the requests placed in it.
+type allocSlot struct {
+	start, end uint64 // end is exclusive
+	used       uint64
+	reqs       []int
+}
+
+// Allocate places the requests in the free space of the disk and returns
+// the new partitions, ready for System.CreatePartitions. Each request goes
+// in the first free space its MinSize fits in, after any earlier requests
+// placed there.  Partitions start on and are sized in the disk's Alignment
+// grain.  The disk itself is not modified.
+//
+//nolint:funlen,gocognit
+func (d *Disk) Allocate(reqs []PartitionRequest) (PartitionSet, error) {
+	align, _ := d.Alignment()
+
+	nums, err := d.allocNumbers(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*allocSlot{}
+
+	for _, fs := range d.FreeSpaces() {
+		start := d.AlignUp(fs.Start)
+		end := d.AlignDown(fs.Last + 1)
+
+		if end > start {
+			slots = append(slots, &allocSlot{start: start, end: end})
+		}
+	}
+
+	mins := make([]uint64, len(reqs))
+	maxes := make([]uint64, len(reqs))
+
+	for i, r := range reqs {
+		if r.MinSize == "" && !r.Grow {
+			return nil, &PartitionError{Disk: d.Path, Number: nums[i], Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("'%s' is neither growable nor has a MinSize", r.Name)}
+		}
+
+		if r.MaxSize != "" {
+			if maxes[i], err = r.MaxSize.ForPartition(*d, FreeSpace{}); err != nil {
+				return nil, &PartitionError{Disk: d.Path, Number: nums[i], Err: err,
+					Detail: fmt.Sprintf("'%s' MaxSize", r.Name)}
+			}
+		}
+
+		placed := false
+
+		for _, s := range slots {
+			if s.start+s.used >= s.end {
+				continue
+			}
+
+			mins[i] = align
+			if r.MinSize != "" {
+				avail := FreeSpace{Start: s.start + s.used, Last: s.end - 1}
+				if mins[i], err = r.MinSize.ForPartition(*d, avail); err != nil {
+					continue
+				}
+			}
+
+			if s.used+mins[i] > s.end-s.start {
+				continue
+			}
+
+			s.used += mins[i]
+			s.reqs = append(s.reqs, i)
+			placed = true
+
+			break
+		}
+
+		if !placed {
+			return nil, &PartitionError{Disk: d.Path, Number: nums[i], Err: ErrNoSpace,
+				Detail: fmt.Sprintf("'%s' of size %s does not fit in the free space", r.Name, r.MinSize)}
+		}
+
+		if maxes[i] != 0 && maxes[i] < mins[i] {
+			return nil, &PartitionError{Disk: d.Path, Number: nums[i], Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("'%s' MaxSize %d is less than MinSize %d", r.Name, maxes[i], mins[i])}
+		}
+	}
+
+	pSet := PartitionSet{}
+
+	for _, s := range slots {
+		sizes := growSizes(reqs, s, mins, maxes, align)
+		start := s.start
+
+		for _, i := range s.reqs {
+			pSet[nums[i]] = Partition{
+				Start:  start,
+				Last:   start + sizes[i] - 1,
+				Type:   reqs[i].Type,
+				Name:   reqs[i].Name,
+				Number: nums[i],
+			}
+			start += sizes[i]
+		}
+	}
+
+	return pSet, nil
+}
+
+// growSizes returns the sizes of the requests in slot s, sharing the space
+// that is left after the minimum sizes between the growable requests.
+func growSizes(reqs []PartitionRequest, s *allocSlot, mins, maxes []uint64, align uint64) map[int]uint64 {
+	sizes := map[int]uint64{}
+	growers := []int{}
+
+	for _, i := range s.reqs {
+		sizes[i] = mins[i]
+		if reqs[i].Grow {
+			growers = append(growers, i)
+		}
+	}
+
+	slack := (s.end - s.start) - s.used
+
+	for len(growers) != 0 && slack >= align {
+		share := ((slack / uint64(len(growers))) / align) * align
+		if share == 0 {
+			share = align
+		}
+
+		next := []int{}
+
+		for _, i := range growers {
+			add := share
+			if add > slack {
+				add = slack
+			}
+
+			if maxes[i] != 0 && sizes[i]+add >= maxes[i] {
+				add = maxes[i] - sizes[i]
+			} else {
+				next = append(next, i)
+			}
+
+			sizes[i] += add
+			slack -= add
+		}
+
+		growers = next
+	}
+
+	return sizes
+}
+
+// allocNumbers returns the partition number for each request.
+func (d *Disk) allocNumbers(reqs []PartitionRequest) ([]uint, error) {
+	maxNum := uint(maxPartNumGPT)
+	if d.Table == MBR {
+		maxNum = maxPartNumMBR
+	}
+
+	used := map[uint]bool{}
+	for n := range d.Partitions {
+		used[n] = true
+	}
+
+	nums := make([]uint, len(reqs))
+
+	for i, r := range reqs {
+		if r.Number == 0 {
+			continue
+		}
+
+		if r.Number > maxNum {
+			return nil, &PartitionError{Disk: d.Path, Number: r.Number, Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("number must be 1-%d for %s", maxNum, d.Table)}
+		}
+
+		if used[r.Number] {
+			return nil, &PartitionError{Disk: d.Path, Number: r.Number, Err: ErrPartitionExists}
+		}
+
+		used[r.Number] = true
+		nums[i] = r.Number
+	}
+
+	next := uint(1)
+
+	for i := range reqs {
+		if nums[i] != 0 {
+			continue
+		}
+
+		for next <= maxNum && used[next] {
+			next++
+		}
+
+		if next > maxNum {
+			return nil, fmt.Errorf("no free partition number on %s for '%s': %w",
+				d.Path, reqs[i].Name, ErrOutOfRange)
+		}
+
+		used[next] = true
+		nums[i] = next
+	}
+
+	return nums, nil
+}
@@ -0,0 +1,127 @@
+package disko_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+func allocDisk() disko.Disk {
+	return disko.Disk{
+		Name:       "sda",
+		Path:       "/dev/sda",
+		Size:       1024 * disko.Mebibyte,
+		SectorSize: 512,
+		Table:      disko.GPT,
+		Partitions: disko.PartitionSet{
+			2: {Number: 2, Start: 101 * disko.Mebibyte, Last: 201*disko.Mebibyte - 1, Type: partid.LinuxFS},
+		},
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	ast := assert.New(t)
+	d := allocDisk()
+
+	pSet, err := d.Allocate([]disko.PartitionRequest{
+		{Name: "efi", Type: partid.EFI, MinSize: "50MiB"},
+		{Name: "boot", Type: partid.LinuxFS, MinSize: "80MiB"},
+		{Name: "root", Type: partid.LinuxFS, MinSize: "100MiB", MaxSize: "300MiB", Grow: true},
+		{Name: "data", Type: partid.LinuxLVM, Grow: true},
+		{Name: "swap", Type: partid.LinuxFS, Number: 9, MinSize: "10MiB"},
+	})
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.Len(pSet, 5)
+
+	// efi fits before partition 2, boot does not.
+	ast.Equal(uint(1), pSet[1].Number)
+	ast.Equal("efi", pSet[1].Name)
+	ast.Equal(disko.Mebibyte, pSet[1].Start)
+	ast.Equal(51*disko.Mebibyte-1, pSet[1].Last)
+
+	boot, root, data, swap := pSet[3], pSet[4], pSet[5], pSet[9]
+	ast.Equal("boot", boot.Name)
+	ast.Equal(201*disko.Mebibyte, boot.Start)
+	ast.Equal(80*disko.Mebibyte, boot.Size())
+
+	// root follows boot and stops growing at its MaxSize.
+	ast.Equal(boot.Last+1, root.Start)
+	ast.Equal(300*disko.Mebibyte, root.Size())
+
+	// data and swap are small enough to go before partition 2, where data
+	// grows into what swap leaves.
+	ast.Equal(pSet[1].Last+1, data.Start)
+	ast.Equal(data.Last+1, swap.Start)
+	ast.Equal(10*disko.Mebibyte, swap.Size())
+	ast.Equal(101*disko.Mebibyte, swap.Last+1)
+
+	ast.Equal([]disko.FreeSpace{{Start: root.Last + 1, Last: 1023*disko.Mebibyte - 1}}, freeAfter(d, pSet))
+
+	for _, p := range pSet {
+		ast.Zero(p.Start % disko.Mebibyte)
+		ast.Zero((p.Last + 1) % disko.Mebibyte)
+	}
+}
+
+// freeAfter returns the free spaces left on d once pSet is added.
+func freeAfter(d disko.Disk, pSet disko.PartitionSet) []disko.FreeSpace {
+	for n, p := range pSet {
+		d.Partitions[n] = p
+	}
+
+	return d.FreeSpaces()
+}
+
+func TestAllocateShare(t *testing.T) {
+	ast := assert.New(t)
+	d := disko.Disk{Path: "/dev/sdb", Size: 1024 * disko.Mebibyte, SectorSize: 512, Table: disko.GPT}
+
+	pSet, err := d.Allocate([]disko.PartitionRequest{
+		{Name: "a", Grow: true},
+		{Name: "b", Grow: true},
+	})
+	if !ast.Nil(err) {
+		return
+	}
+
+	a, b := pSet[1], pSet[2]
+	ast.Equal(a.Last+1, b.Start)
+	ast.InDelta(a.Size(), b.Size(), float64(disko.Mebibyte))
+}
+
+func TestAllocateErrors(t *testing.T) {
+	d := allocDisk()
+
+	for _, v := range []struct {
+		reqs     []disko.PartitionRequest
+		expected error
+	}{
+		{[]disko.PartitionRequest{{Name: "big", MinSize: "2GiB"}}, disko.ErrNoSpace},
+		{[]disko.PartitionRequest{{Name: "dup", Number: 2, MinSize: "1MiB"}}, disko.ErrPartitionExists},
+		{[]disko.PartitionRequest{{Name: "oob", Number: 129, MinSize: "1MiB"}}, disko.ErrOutOfRange},
+		{[]disko.PartitionRequest{{Name: "nosize"}}, disko.ErrOutOfRange},
+		{[]disko.PartitionRequest{{Name: "inverted", MinSize: "10MiB", MaxSize: "5MiB", Grow: true}}, disko.ErrOutOfRange},
+	} {
+		if _, err := d.Allocate(v.reqs); !errors.Is(err, v.expected) {
+			t.Errorf("%s: expected %v, got %v", v.reqs[0].Name, v.expected, err)
+		}
+	}
+
+	mbr := allocDisk()
+	mbr.Table = disko.MBR
+
+	reqs := []disko.PartitionRequest{}
+	for i := 0; i < 4; i++ {
+		reqs = append(reqs, disko.PartitionRequest{MinSize: "1MiB"})
+	}
+
+	if _, err := mbr.Allocate(reqs); !errors.Is(err, disko.ErrOutOfRange) {
+		t.Errorf("expected ErrOutOfRange with 5 MBR partitions, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package disko
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// TableBackup is a saved partition table.  It holds the raw sectors the
+// table lives in along with a decoded copy of the table for humans and
+// tools.  Restoring only uses the raw sectors.
+type TableBackup struct {
+	// Disk is the path of the disk the table was saved from.
+	Disk string `json:"disk"`
+
+	// Identity is the identity of the disk the table was saved from.
+	Identity DiskIdentity `json:"identity"`
+
+	// Size is the size of the disk in bytes.
+	Size uint64 `json:"size"`
+
+	// SectorSize is the sector size of the table.
+	SectorSize uint `json:"sectorSize"`
+
+	// Table is the type of the table.
+	Table TableType `json:"table"`
+
+	// DiskGUID is the GUID of a GPT disk.
+	DiskGUID string `json:"diskGuid,omitempty"`
+
+	// Partitions are the partitions in the table.
+	Partitions PartitionSet `json:"partitions"`
+
+	// Attributes are the non-zero GPT attribute flags by partition number.
+	Attributes map[uint]uint64 `json:"attributes,omitempty"`
+
+	// Head is the start of the disk: the MBR and, for GPT, the primary
+	// header and partition entry array.
+	Head []byte `json:"head"`
+
+	// Tail is the end of the disk where a GPT keeps its backup header and
+	// partition entry array.
+	Tail []byte `json:"tail"`
+}
+
+// Check returns an error if b cannot be restored onto d: an error wrapping
+// ErrOutOfRange if d is not the size or sector size of the disk b was taken
+// from, or an error if b is damaged.
+func (b TableBackup) Check(d Disk) error {
+	if d.Size != b.Size {
+		return fmt.Errorf("cannot restore table of %s (size %d) onto %s (size %d): %w",
+			b.Disk, b.Size, d.Path, d.Size, ErrOutOfRange)
+	}
+
+	if d.SectorSize != 0 && b.Table == GPT && d.SectorSize != b.SectorSize {
+		return fmt.Errorf("cannot restore table with sector size %d onto %s with sector size %d: %w",
+			b.SectorSize, d.Path, d.SectorSize, ErrOutOfRange)
+	}
+
+	if len(b.Head) == 0 || uint64(len(b.Head)+len(b.Tail)) > b.Size {
+		return fmt.Errorf("backup of %s is damaged: bad head or tail length", b.Disk)
+	}
+
+	if b.Table != TableNone && (len(b.Head) < 0x200 || !bytes.Equal(b.Head[0x1FE:0x200], []byte{0x55, 0xAA})) {
+		return fmt.Errorf("backup of %s is damaged: no MBR signature", b.Disk)
+	}
+
+	return nil
+}
+
+// RestoredDisk returns d as it is once b has been restored onto it, with the
+// table of b in place of its own.  It is for Systems that keep the state of
+// their disks rather than write to them.
+func (b TableBackup) RestoredDisk(d Disk) (Disk, error) {
+	d.Table = b.Table
+	d.TableProblems = nil
+	d.Partitions = PartitionSet{}
+
+	for n, p := range b.Partitions {
+		d.Partitions[n] = p
+	}
+
+	if b.Table != GPT {
+		d.GPT = GPTHeader{}
+		return d, nil
+	}
+
+	id, err := StringToGUID(b.DiskGUID)
+	if err != nil {
+		return d, fmt.Errorf("backup of %s has a bad disk guid %q: %w", b.Disk, b.DiskGUID, err)
+	}
+
+	d.GPT.DiskGUID = id
+
+	return d, nil
+}
+
+// SaveTableBackup writes b to the file at path as JSON.
+func SaveTableBackup(path string, b TableBackup) error {
+	const mode = 0600
+
+	jbytes, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(jbytes, '\n'), mode)
+}
+
+// LoadTableBackup reads a TableBackup written by SaveTableBackup.
+func LoadTableBackup(path string) (TableBackup, error) {
+	b := TableBackup{}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return b, err
+	}
+
+	if err := json.Unmarshal(content, &b); err != nil {
+		return b, fmt.Errorf("failed to parse table backup %s: %w", path, err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,87 @@
+package disko_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+// gptBackup returns a backup of a GPT with one partition on a disk of size
+// bytes.
+func gptBackup(size uint64) disko.TableBackup {
+	head := make([]byte, 34*512)
+	head[0x1FE], head[0x1FF] = 0x55, 0xAA
+
+	return disko.TableBackup{
+		Disk:       "/dev/sdz",
+		Size:       size,
+		SectorSize: 512,
+		Table:      disko.GPT,
+		DiskGUID:   "6E8D0C56-3B41-4B7A-9A3B-6F8B2E0C1D7A",
+		Partitions: disko.PartitionSet{
+			1: {Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS},
+		},
+		Head: head,
+		Tail: make([]byte, 33*512),
+	}
+}
+
+func TestTableBackupCheck(t *testing.T) {
+	ast := assert.New(t)
+
+	b := gptBackup(1024 * disko.Mebibyte)
+	d := disko.Disk{Path: "/dev/sdz", Size: b.Size, SectorSize: 512}
+
+	ast.NoError(b.Check(d))
+
+	d.Size += disko.Mebibyte
+	ast.ErrorIs(b.Check(d), disko.ErrOutOfRange)
+
+	d.Size, d.SectorSize = b.Size, 4096
+	ast.ErrorIs(b.Check(d), disko.ErrOutOfRange)
+
+	d.SectorSize = 512
+	b.Head = b.Head[:0x100]
+	ast.Error(b.Check(d))
+}
+
+func TestTableBackupRestoredDisk(t *testing.T) {
+	ast := assert.New(t)
+
+	b := gptBackup(1024 * disko.Mebibyte)
+	d := disko.Disk{Path: "/dev/sdz", Size: b.Size, SectorSize: 512, Table: disko.TableNone,
+		TableProblems: []disko.TableProblem{{Kind: disko.ProblemPrimaryHeader}}}
+
+	restored, err := b.RestoredDisk(d)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Equal(disko.GPT, restored.Table)
+	ast.Equal(b.DiskGUID, restored.GPT.DiskGUID.String())
+	ast.Equal(b.Partitions, restored.Partitions)
+	ast.Empty(restored.TableProblems)
+
+	b.DiskGUID = "bad"
+	_, err = b.RestoredDisk(d)
+	ast.Error(err)
+}
+
+func TestTableBackupSaveLoad(t *testing.T) {
+	ast := assert.New(t)
+
+	b := gptBackup(1024 * disko.Mebibyte)
+	bpath := path.Join(t.TempDir(), "backup.json")
+
+	if !ast.NoError(disko.SaveTableBackup(bpath, b)) {
+		return
+	}
+
+	loaded, err := disko.LoadTableBackup(bpath)
+	if ast.NoError(err) {
+		ast.Equal(b, loaded)
+	}
+}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"sort"
+	"os"
 
 	"github.com/urfave/cli/v2"
 	"machinerun.io/disko"
@@ -25,31 +26,114 @@ var diskCommands = cli.Command{
 			Name:   "dump",
 			Usage:  "Scan disks on the system and dump data (json)",
 			Action: diskScan,
+			Flags:  []cli.Flag{&filterFlag, &tolerantFlag},
 		},
 		{
 			Name:   "show",
 			Usage:  "Scan disks on the system and dump data (human)",
 			Action: diskShow,
+			Flags:  []cli.Flag{&formatFlag, &filterFlag, &tolerantFlag},
 		},
 		{
 			Name: "wipe",
 			Usage: ("Quickly wipe disks on the system. Zero any existing " +
 				"beginning and end of disk and any existing partitions"),
 			Action: diskWipe,
+			Flags:  []cli.Flag{&forceFlag},
+		},
+		{
+			Name:      "grow-part",
+			Usage:     "Grow a partition into the free space after it (like growpart)",
+			ArgsUsage: "disk number",
+			Action:    diskGrowPart,
+		},
+		{
+			Name:      "set-guid",
+			Usage:     "Set the GPT disk GUID of a disk, or a random one if none is given",
+			ArgsUsage: "disk [guid]",
+			Action:    diskSetGUID,
+		},
+		{
+			Name:      "relocate-backup",
+			Usage:     "Move the backup GPT of a grown disk to the end of the disk",
+			ArgsUsage: "disk",
+			Action:    diskRelocateBackup,
+		},
+		{
+			Name:      "check",
+			Usage:     "Print the problems with the GPT of a disk",
+			ArgsUsage: "disk",
+			Action:    diskCheck,
+		},
+		{
+			Name:      "repair",
+			Usage:     "Rebuild the GPT of a disk from the copy of it that is valid",
+			ArgsUsage: "disk",
+			Action:    diskRepair,
+		},
+		{
+			Name:      "backup",
+			Usage:     "Save the partition table of a disk to a file",
+			ArgsUsage: "disk file",
+			Action:    diskBackup,
+		},
+		{
+			Name:      "restore",
+			Usage:     "Restore a partition table saved with backup onto a disk",
+			ArgsUsage: "disk file",
+			Action:    diskRestore,
+		},
+		{
+			Name:      "diff",
+			Usage:     "Show the differences between two disk dumps",
+			ArgsUsage: "before.json after.json",
+			Action:    diskDiff,
+		},
+		{
+			Name:   "watch",
+			Usage:  "Print disks as they are added, removed or changed",
+			Action: diskWatch,
+			Flags:  []cli.Flag{&filterFlag},
 		},
 	},
 }
 
+// scanSystem returns the System to scan with, a tolerant one if asked.
+func scanSystem(c *cli.Context) disko.System {
+	if c.Bool("tolerant") {
+		return linux.System(linux.WithTolerantScan())
+	}
+
+	return linux.System()
+}
+
+// tolerateScanErrors reports and drops the errors of the disks a tolerant
+// scan could not scan.
+func tolerateScanErrors(err error) error {
+	var scanErrs disko.ScanErrors
+	if !errors.As(err, &scanErrs) {
+		return err
+	}
+
+	for _, p := range scanErrs.Paths() {
+		fmt.Fprintf(os.Stderr, "skipped %s: %s\n", p, scanErrs[p])
+	}
+
+	return nil
+}
+
 func diskScan(c *cli.Context) error {
 	var err error
 	var jbytes []byte
 
-	mysys := linux.System()
-	matchAll := func(d disko.Disk) bool {
-		return true
+	mysys := scanSystem(c)
+
+	filter, err := disko.ParseDiskFilter(c.String("filter"))
+	if err != nil {
+		return err
 	}
 
-	if c.Args().Len() == 1 {
+	if c.Args().Len() == 1 && c.String("filter") == "" {
 		// a single argument will only output 1 disk, not an array of one disk.
 		disk, err := mysys.ScanDisk(c.Args().First())
 		if err != nil {
@@ -67,12 +151,12 @@ func diskScan(c *cli.Context) error {
 
 	var disks disko.DiskSet
 	if c.Args().Len() == 0 {
-		disks, err = mysys.ScanAllDisks(matchAll)
+		disks, err = mysys.ScanAllDisks(filter)
 	} else {
-		disks, err = mysys.ScanDisks(matchAll, c.Args().Slice()...)
+		disks, err = mysys.ScanDisks(filter, c.Args().Slice()...)
 	}
 
-	if err != nil {
+	if err = tolerateScanErrors(err); err != nil {
 		return err
 	}
 
@@ -86,34 +170,24 @@ func diskScan(c *cli.Context) error {
 }
 
 func diskShow(c *cli.Context) error {
-	mysys := linux.System()
-	disks, err := getDiskSet(mysys, c.Args().Slice()...)
+	mysys := scanSystem(c)
 
+	filter, err := disko.ParseDiskFilter(c.String("filter"))
 	if err != nil {
 		return err
 	}
 
-	oDisks := []string{}
-	for _, d := range disks {
-		oDisks = append(oDisks, d.Name)
-	}
-
-	sort.Strings(oDisks)
-
-	for _, n := range oDisks {
-		d := disks[n]
-		fmt.Printf("%s\n%s\n", d.String(), d.Details())
+	disks, err := getDiskSetFilter(mysys, filter, c.Args().Slice()...)
+	if err = tolerateScanErrors(err); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func getDiskSet(mysys disko.System, paths ...string) (disko.DiskSet, error) {
-	matchAll := func(d disko.Disk) bool {
-		return true
+	renderer, err := disko.NewRenderer(c.String("format"))
+	if err != nil {
+		return err
 	}
 
-	return getDiskSetFilter(mysys, matchAll, paths...)
+	return renderer.RenderDisks(os.Stdout, disks)
 }
 
 func getDiskSetFilter(mysys disko.System, matcher disko.DiskFilter, paths ...string) (disko.DiskSet, error) {
@@ -126,12 +200,12 @@ func getDiskSetFilter(mysys disko.System, matcher disko.DiskFilter, paths ...str
 
 func diskWipe(c *cli.Context) error {
 	mysys := linux.System()
+	if c.Bool("force") {
+		mysys = linux.System(linux.WithForce())
+	}
 
 	// only match read-write disks here.
-	disks, err := getDiskSetFilter(
-		mysys,
-		func(d disko.Disk) bool { return !d.ReadOnly },
-		c.Args().Slice()...)
+	disks, err := getDiskSetFilter(mysys, disko.Not(disko.IsReadOnly()), c.Args().Slice()...)
 
 	if err != nil {
 		return err
@@ -146,6 +220,193 @@ func diskWipe(c *cli.Context) error {
 	return nil
 }
 
+func diskGrowPart(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide disk and partition number")
+	}
+
+	var number uint
+	if _, err := fmt.Sscanf(c.Args().Get(1), "%d", &number); err != nil {
+		return fmt.Errorf("bad partition number %q: %w", c.Args().Get(1), err)
+	}
+
+	mysys := linux.System()
+
+	disk, err := mysys.ScanDisk(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	p, err := disko.GrowPartitionToFill(mysys, disk, number)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("partition %d of %s now ends at %d (%d MiB)\n", number, disk.Path, p.Last, p.Size()/disko.Mebibyte)
+
+	return nil
+}
+
+func diskSetGUID(c *cli.Context) error {
+	if c.Args().Len() < 1 || c.Args().Len() > 2 {
+		return fmt.Errorf("must provide disk and optionally guid")
+	}
+
+	var id disko.GUID
+
+	if c.Args().Len() == 2 { //nolint:gomnd
+		var err error
+		if id, err = disko.StringToGUID(c.Args().Get(1)); err != nil {
+			return fmt.Errorf("bad guid %q: %w", c.Args().Get(1), err)
+		}
+	}
+
+	mysys := linux.System()
+
+	disk, err := mysys.ScanDisk(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	return mysys.SetDiskGUID(disk, id)
+}
+
+func diskRelocateBackup(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("must provide disk")
+	}
+
+	mysys := linux.System()
+
+	disk, err := mysys.ScanDisk(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	return mysys.RelocateBackupGPT(disk)
+}
+
+func diskCheck(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("must provide disk")
+	}
+
+	disk, err := linux.System().ScanDisk(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	for _, p := range disk.TableProblems {
+		fmt.Printf("%s\n", p)
+	}
+
+	return nil
+}
+
+func diskRepair(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("must provide disk")
+	}
+
+	mysys := linux.System()
+
+	disk, err := mysys.ScanDisk(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	return mysys.RepairPartitionTable(disk)
+}
+
+func diskBackup(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide disk and backup file")
+	}
+
+	disk, err := linux.System().ScanDisk(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	backup, err := linux.BackupPartitionTable(disk)
+	if err != nil {
+		return err
+	}
+
+	return disko.SaveTableBackup(c.Args().Get(1), backup)
+}
+
+func diskRestore(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide disk and backup file")
+	}
+
+	mysys := linux.System()
+
+	disk, err := mysys.ScanDisk(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	backup, err := disko.LoadTableBackup(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	return mysys.RestorePartitionTable(disk, backup)
+}
+
+func diskDiff(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide before and after dump files")
+	}
+
+	sets := [2]disko.DiskSet{}
+
+	for i, fname := range c.Args().Slice() {
+		content, err := os.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(content, &sets[i]); err != nil {
+			return fmt.Errorf("failed to parse disk dump %s: %w", fname, err)
+		}
+	}
+
+	fmt.Print(disko.Diff{Disks: disko.DiffDisks(sets[0], sets[1])}.String())
+
+	return nil
+}
+
+func diskWatch(c *cli.Context) error {
+	filter, err := disko.ParseDiskFilter(c.String("filter"))
+	if err != nil {
+		return err
+	}
+
+	events, err := linux.Watch(c.Context, filter)
+	if err != nil {
+		return err
+	}
+
+	for ev := range events {
+		if ev.Err != nil {
+			fmt.Printf("%s %s: %s\n", ev.Type, ev.Disk.Path, ev.Err)
+			continue
+		}
+
+		if ev.Partition != 0 {
+			fmt.Printf("%s %s partition %d\n", ev.Type, ev.Disk.Path, ev.Partition)
+			continue
+		}
+
+		fmt.Printf("%s %s\n", ev.Type, ev.Disk)
+	}
+
+	return nil
+}
+
 func diskNewPartition(c *cli.Context) error {
 	mysys := linux.System()
 	fname := c.Args().First()
@@ -160,23 +421,14 @@ func diskNewPartition(c *cli.Context) error {
 		return fmt.Errorf("failed to scan %s: %s", fname, err)
 	}
 
-	fs := disk.FreeSpaces()
-	if len(fs) != 1 {
-		return fmt.Errorf("expected 1 free space, found %d", fs)
-	}
-
-	myGUID := disko.GenGUID()
-
-	part := disko.Partition{
-		Start:  fs[0].Start,
-		Last:   fs[0].Last,
-		Type:   partid.LinuxLVM,
-		Name:   "smoser1",
-		ID:     myGUID,
-		Number: uint(1),
+	pSet, err := disk.Allocate([]disko.PartitionRequest{
+		{Name: "smoser1", Type: partid.LinuxLVM, Grow: true},
+	})
+	if err != nil {
+		return err
 	}
 
-	if err := mysys.CreatePartition(disk, part); err != nil {
+	if err := mysys.CreatePartitions(disk, pSet); err != nil {
 		return err
 	}
 
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+	"machinerun.io/disko"
+	"machinerun.io/disko/linux"
+)
+
+//nolint:gochecknoglobals
+var fsCommands = cli.Command{
+	Name:  "fs",
+	Usage: "filesystem commands",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "mkfs",
+			Usage:     "Create a filesystem (ext2, ext3, ext4, xfs, btrfs, vfat, swap) on a device",
+			ArgsUsage: "device type",
+			Action:    fsMkfs,
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "label", Usage: "Label of the filesystem"},
+				&cli.StringFlag{Name: "uuid", Usage: "UUID of the filesystem"},
+				&cli.StringSliceFlag{Name: "feature", Usage: "Feature to turn on (or off with ^)"},
+				&forceFlag,
+			},
+		},
+		{
+			Name:      "label",
+			Usage:     "Change the label of the filesystem on a device",
+			ArgsUsage: "device label",
+			Action:    fsLabel,
+		},
+		{
+			Name:      "check",
+			Usage:     "Check the filesystem on a device without changing it",
+			ArgsUsage: "device",
+			Action:    fsCheck,
+		},
+		{
+			Name:      "grow",
+			Usage:     "Grow the filesystem on a device to the size of the device",
+			ArgsUsage: "device",
+			Action:    fsGrow,
+		},
+	},
+}
+
+func fsMkfs(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide device and type")
+	}
+
+	fsm := linux.FSManager()
+	if c.Bool("force") {
+		fsm = linux.FSManager(linux.WithForce())
+	}
+
+	return fsm.CreateFS(c.Args().Get(0), disko.FSType(c.Args().Get(1)), disko.FSOptions{
+		Label:    c.String("label"),
+		UUID:     c.String("uuid"),
+		Features: c.StringSlice("feature"),
+	})
+}
+
+func fsLabel(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide device and label")
+	}
+
+	return linux.FSManager().SetFSLabel(c.Args().Get(0), c.Args().Get(1))
+}
+
+func fsCheck(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("must provide device")
+	}
+
+	return linux.FSManager().CheckFS(c.Args().First())
+}
+
+func fsGrow(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("must provide device")
+	}
+
+	return linux.FSManager().GrowFS(c.Args().First())
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/urfave/cli/v2"
 	"machinerun.io/disko"
@@ -19,10 +20,22 @@ var lvmCommands = cli.Command{
 			Usage:  "Scan system and dump disko VGs.  Optionally give a vg name.",
 			Action: lvmDumpVGs,
 		},
+		{
+			Name:   "show-vgs",
+			Usage:  "Scan system and show VGs, their PVs and LVs.  Optionally give a vg name.",
+			Action: lvmShowVGs,
+			Flags:  []cli.Flag{&formatFlag},
+		},
+		{
+			Name:      "diff-vgs",
+			Usage:     "Show the differences between two dump-vgs outputs",
+			ArgsUsage: "before.json after.json",
+			Action:    lvmDiffVGs,
+		},
 	},
 }
 
-func lvmDumpVGs(c *cli.Context) error {
+func scanVGs(c *cli.Context) (disko.VGSet, error) {
 	var filter disko.VGFilter
 
 	if c.Args().Len() == 0 {
@@ -30,12 +43,28 @@ func lvmDumpVGs(c *cli.Context) error {
 	} else if c.Args().Len() == 1 {
 		filter = func(v disko.VG) bool { return v.Name == c.Args().First() }
 	} else {
-		return fmt.Errorf("too many args. Really just want 1. Got %d", c.Args().Len())
+		return nil, fmt.Errorf("too many args. Really just want 1. Got %d", c.Args().Len())
 	}
 
-	vmgr := linux.VolumeManager()
+	return linux.VolumeManager().ScanVGs(filter)
+}
+
+func lvmShowVGs(c *cli.Context) error {
+	vgset, err := scanVGs(c)
+	if err != nil {
+		return err
+	}
 
-	vgset, err := vmgr.ScanVGs(filter)
+	renderer, err := disko.NewRenderer(c.String("format"))
+	if err != nil {
+		return err
+	}
+
+	return renderer.RenderVGs(os.Stdout, vgset)
+}
+
+func lvmDumpVGs(c *cli.Context) error {
+	vgset, err := scanVGs(c)
 	if err != nil {
 		return err
 	}
@@ -49,3 +78,26 @@ func lvmDumpVGs(c *cli.Context) error {
 
 	return nil
 }
+
+func lvmDiffVGs(c *cli.Context) error {
+	if c.Args().Len() != 2 { //nolint:gomnd
+		return fmt.Errorf("must provide before and after dump files")
+	}
+
+	sets := [2]disko.VGSet{}
+
+	for i, fname := range c.Args().Slice() {
+		content, err := os.ReadFile(fname)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(content, &sets[i]); err != nil {
+			return fmt.Errorf("failed to parse vg dump %s: %w", fname, err)
+		}
+	}
+
+	fmt.Print(disko.Diff{VGs: disko.DiffVGs(sets[0], sets[1])}.String())
+
+	return nil
+}
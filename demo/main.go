@@ -1,43 +1,39 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"os"
 	"strings"
 
 	"github.com/urfave/cli/v2"
+	"machinerun.io/disko"
 )
 
 var version string
 
-func printTextTable(data [][]string) {
-	var lengths = make([]int, len(data[0]))
-
-	for _, line := range data {
-		for i, field := range line {
-			if len(field) > lengths[i] {
-				lengths[i] = len(field)
-			}
-		}
-	}
-
-	fmts := make([]string, len(lengths))
-
-	for i, l := range lengths {
-		fmts[i] = fmt.Sprintf("%%-%ds", l)
-	}
+//nolint:gochecknoglobals
+var formatFlag = cli.StringFlag{
+	Name:  "format",
+	Value: "text",
+	Usage: "Output format: " + strings.Join(disko.RenderFormats, ", "),
+}
 
-	pfmt := strings.Join(fmts, " | ") + " |\n"
+//nolint:gochecknoglobals
+var filterFlag = cli.StringFlag{
+	Name:  "filter",
+	Usage: "Only show disks matching a filter expression (type=SSD && size>=200GiB)",
+}
 
-	for _, line := range data {
-		s := make([]interface{}, len(line))
-		for i, v := range line {
-			s[i] = v
-		}
+//nolint:gochecknoglobals
+var tolerantFlag = cli.BoolFlag{
+	Name:  "tolerant",
+	Usage: "Show the disks that could be scanned and report the others instead of failing",
+}
 
-		fmt.Printf(pfmt, s...)
-	}
+//nolint:gochecknoglobals
+var forceFlag = cli.BoolFlag{
+	Name:  "force",
+	Usage: "Change disks or devices even if they are in use",
 }
 
 func main() {
@@ -51,6 +47,7 @@ func main() {
 			&smartpqiCommands,
 			&mpi3mrCommands,
 			&lvmCommands,
+			&fsCommands,
 			&miscCommands,
 		},
 	}
@@ -3,9 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/urfave/cli/v2"
+	"machinerun.io/disko"
 	"machinerun.io/disko/linux"
 	"machinerun.io/disko/megaraid"
 )
@@ -83,9 +85,7 @@ func megaraidDiskSummary(c *cli.Context) error {
 			d.MediaType.String(), d.State})
 	}
 
-	printTextTable(data)
-
-	return nil
+	return disko.WriteTable(os.Stdout, data)
 }
 
 func megaraidDump(c *cli.Context) error {
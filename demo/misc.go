@@ -190,7 +190,12 @@ func miscUpDown(c *cli.Context) error {
 		delPart := func() {
 			if pathExists(partPath) {
 				fmt.Printf("Deleting partition %s %d\n", disk.Path, part.Number)
-				if err := mysys.DeletePartition(disk, part.Number); err != nil {
+				// the disk changed since it was scanned, scan it again.
+				d, err := mysys.ScanDisk(fname)
+				if err == nil {
+					err = mysys.DeletePartition(d, part.Number)
+				}
+				if err != nil {
 					fmt.Printf("that went bad: %s\n", err)
 				}
 			}
@@ -218,6 +223,10 @@ func miscUpDown(c *cli.Context) error {
 			}
 
 			fmt.Printf("[%d] created partition %d\n", i, part.Number)
+
+			if disk, err = mysys.ScanDisk(fname); err != nil {
+				return err
+			}
 		}
 
 		if !pathExists(partPath) {
@@ -315,6 +324,10 @@ func miscUpDown(c *cli.Context) error {
 				return err
 			}
 
+			if disk, err = mysys.ScanDisk(fname); err != nil {
+				return err
+			}
+
 			if pathExists(partPath) {
 				fmt.Printf("After DeletePartition %d, %s did exist.", part.Number, partPath)
 				return fmt.Errorf("should not have existed")
@@ -3,10 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
+	"machinerun.io/disko"
 	"machinerun.io/disko/linux"
 	"machinerun.io/disko/mpi3mr"
 )
@@ -98,8 +100,7 @@ func mpi3mrDiskSummary(c *cli.Context) error {
 			d.Medium, d.State})
 	}
 
-	printTextTable(data)
-	return nil
+	return disko.WriteTable(os.Stdout, data)
 }
 
 func mpi3mrDump(c *cli.Context) error {
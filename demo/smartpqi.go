@@ -3,9 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
 	"strconv"
 
 	"github.com/urfave/cli/v2"
+	"machinerun.io/disko"
 	"machinerun.io/disko/smartpqi"
 )
 
@@ -82,9 +84,7 @@ func smartpqiDiskSummary(c *cli.Context) error {
 		data = append(data, []string{ld.DiskName, name, stype, ld.RAIDLevel})
 	}
 
-	printTextTable(data)
-
-	return nil
+	return disko.WriteTable(os.Stdout, data)
 }
 
 func smartpqiDump(c *cli.Context) error {
@@ -0,0 +1,472 @@
+package disko
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind is what happened to a disk, partition, volume group, PV or LV
+// between two snapshots.
+type ChangeKind string
+
+const (
+	// ChangeAdded is an item that is only in the newer snapshot.
+	ChangeAdded ChangeKind = "added"
+
+	// ChangeRemoved is an item that is only in the older snapshot.
+	ChangeRemoved ChangeKind = "removed"
+
+	// ChangeModified is an item that is in both snapshots but differs.
+	ChangeModified ChangeKind = "changed"
+)
+
+// FieldChange is a field whose value differs between two snapshots.  Added
+// items have an empty Old, removed items an empty New.  Old and New are for
+// people, sizes in them are rounded.  OldValue and NewValue are the values
+// they were made from, a uint64 for sizes and the type of the field
+// otherwise, for callers to compare.
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Old      string      `json:"old,omitempty"`
+	New      string      `json:"new,omitempty"`
+	OldValue interface{} `json:"oldValue,omitempty"`
+	NewValue interface{} `json:"newValue,omitempty"`
+}
+
+// PartitionChange is a partition that was added, removed or changed.  A
+// change of the "size" field is a resize, of "type" a retype and of "name"
+// a rename.
+type PartitionChange struct {
+	Number uint          `json:"number"`
+	Kind   ChangeKind    `json:"kind"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// DiskChange is a disk that was added, removed or changed.  Partitions has
+// the partition changes of a changed disk.
+type DiskChange struct {
+	Name       string            `json:"name"`
+	Kind       ChangeKind        `json:"kind"`
+	Fields     []FieldChange     `json:"fields,omitempty"`
+	Partitions []PartitionChange `json:"partitions,omitempty"`
+}
+
+// PVChange is a physical volume that was added, removed or changed.
+type PVChange struct {
+	Name   string        `json:"name"`
+	Kind   ChangeKind    `json:"kind"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// LVChange is a logical volume that was added, removed or changed.
+type LVChange struct {
+	Name   string        `json:"name"`
+	Kind   ChangeKind    `json:"kind"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// VGChange is a volume group that was added, removed or changed.  PVs and
+// LVs have the PV and LV changes of a changed volume group.
+type VGChange struct {
+	Name   string        `json:"name"`
+	Kind   ChangeKind    `json:"kind"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	PVs    []PVChange    `json:"pvs,omitempty"`
+	LVs    []LVChange    `json:"lvs,omitempty"`
+}
+
+// Diff is the difference between two snapshots of the disks and volume
+// groups of a system.
+type Diff struct {
+	Disks []DiskChange `json:"disks,omitempty"`
+	VGs   []VGChange   `json:"vgs,omitempty"`
+}
+
+// NewDiff returns the differences from the before to the after snapshots.
+// Either VGSet may be nil to compare only disks.
+func NewDiff(beforeDisks, afterDisks DiskSet, beforeVGs, afterVGs VGSet) Diff {
+	return Diff{
+		Disks: DiffDisks(beforeDisks, afterDisks),
+		VGs:   DiffVGs(beforeVGs, afterVGs),
+	}
+}
+
+// IsEmpty returns true if there are no differences.
+func (d Diff) IsEmpty() bool {
+	return len(d.Disks) == 0 && len(d.VGs) == 0
+}
+
+// String returns the differences with one change per line.
+func (d Diff) String() string {
+	var buf strings.Builder
+
+	for _, dc := range d.Disks {
+		writeChange(&buf, "disk "+dc.Name, dc.Kind, dc.Fields)
+
+		for _, pc := range dc.Partitions {
+			writeChange(&buf, fmt.Sprintf("disk %s partition %d", dc.Name, pc.Number), pc.Kind, pc.Fields)
+		}
+	}
+
+	for _, vc := range d.VGs {
+		writeChange(&buf, "vg "+vc.Name, vc.Kind, vc.Fields)
+
+		for _, pc := range vc.PVs {
+			writeChange(&buf, fmt.Sprintf("vg %s pv %s", vc.Name, pc.Name), pc.Kind, pc.Fields)
+		}
+
+		for _, lc := range vc.LVs {
+			writeChange(&buf, fmt.Sprintf("vg %s lv %s", vc.Name, lc.Name), lc.Kind, lc.Fields)
+		}
+	}
+
+	return buf.String()
+}
+
+func writeChange(buf *strings.Builder, what string, kind ChangeKind, fields []FieldChange) {
+	switch kind {
+	case ChangeAdded, ChangeRemoved:
+		vals := make([]string, 0, len(fields))
+
+		for _, f := range fields {
+			v := f.New
+			if kind == ChangeRemoved {
+				v = f.Old
+			}
+
+			vals = append(vals, f.Field+"="+v)
+		}
+
+		fmt.Fprintf(buf, "%s: %s (%s)\n", what, kind, strings.Join(vals, " "))
+	case ChangeModified:
+		for _, f := range fields {
+			fmt.Fprintf(buf, "%s: %s %s -> %s\n", what, f.Field, f.Old, f.New)
+		}
+	}
+}
+
+// DiffDisks returns the changes from the before to the after DiskSet.
+// Disks are matched by name or, for a disk whose name is not in both, by
+// its WWN or serial, as a disk's kernel name can change across a reboot.
+// The change of a disk matched that way has a "name" field.
+func DiffDisks(before, after DiskSet) []DiskChange {
+	var changes []DiskChange
+
+	matches := matchDisks(before, after)
+	matched := map[string]bool{}
+
+	for _, bName := range sortedKeys(before) {
+		b := before[bName]
+
+		aName, ok := matches[bName]
+		if !ok {
+			changes = append(changes,
+				DiskChange{Name: bName, Kind: ChangeRemoved, Fields: diffFields(diskFields(b), nil)})
+
+			continue
+		}
+
+		matched[aName] = true
+		a := after[aName]
+
+		dc := DiskChange{
+			Name:       aName,
+			Kind:       ChangeModified,
+			Fields:     diffFields(diskFields(b), diskFields(a)),
+			Partitions: diffPartitions(b.Partitions, a.Partitions),
+		}
+
+		if bName != aName {
+			dc.Fields = append([]FieldChange{
+				{Field: "name", Old: bName, New: aName, OldValue: bName, NewValue: aName}}, dc.Fields...)
+		}
+
+		if len(dc.Fields) != 0 || len(dc.Partitions) != 0 {
+			changes = append(changes, dc)
+		}
+	}
+
+	for _, aName := range sortedKeys(after) {
+		if !matched[aName] {
+			changes = append(changes,
+				DiskChange{Name: aName, Kind: ChangeAdded, Fields: diffFields(nil, diskFields(after[aName]))})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+
+	return changes
+}
+
+// matchDisks returns the name in after of each disk of before that is in
+// after.  Disks with the same name match.  The rest match on a WWN, then
+// on a serial, that is not empty.
+func matchDisks(before, after DiskSet) map[string]string {
+	matches := map[string]string{}
+	used := map[string]bool{}
+
+	for name := range before {
+		if _, ok := after[name]; ok {
+			matches[name] = name
+			used[name] = true
+		}
+	}
+
+	ids := []func(Disk) string{
+		func(d Disk) string { return d.Identity.WWN },
+		func(d Disk) string { return d.Identity.Serial },
+	}
+
+	for _, id := range ids {
+		for _, bName := range sortedKeys(before) {
+			if _, ok := matches[bName]; ok || id(before[bName]) == "" {
+				continue
+			}
+
+			for _, aName := range sortedKeys(after) {
+				if !used[aName] && id(after[aName]) == id(before[bName]) {
+					matches[bName] = aName
+					used[aName] = true
+
+					break
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+func diffPartitions(before, after PartitionSet) []PartitionChange {
+	nums := []uint{}
+
+	for n := range before {
+		nums = append(nums, n)
+	}
+
+	for n := range after {
+		if _, ok := before[n]; !ok {
+			nums = append(nums, n)
+		}
+	}
+
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	var changes []PartitionChange
+
+	for _, n := range nums {
+		b, inBefore := before[n]
+		a, inAfter := after[n]
+
+		switch {
+		case !inBefore:
+			changes = append(changes,
+				PartitionChange{Number: n, Kind: ChangeAdded, Fields: diffFields(nil, partitionFields(a))})
+		case !inAfter:
+			changes = append(changes,
+				PartitionChange{Number: n, Kind: ChangeRemoved, Fields: diffFields(partitionFields(b), nil)})
+		default:
+			if fields := diffFields(partitionFields(b), partitionFields(a)); len(fields) != 0 {
+				changes = append(changes, PartitionChange{Number: n, Kind: ChangeModified, Fields: fields})
+			}
+		}
+	}
+
+	return changes
+}
+
+// DiffVGs returns the changes from the before to the after VGSet.  Volume
+// groups, PVs and LVs are matched by name.
+func DiffVGs(before, after VGSet) []VGChange {
+	var changes []VGChange
+
+	for _, name := range unionKeys(before, after) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+
+		switch {
+		case !inBefore:
+			changes = append(changes,
+				VGChange{Name: name, Kind: ChangeAdded, Fields: diffFields(nil, vgFields(a))})
+		case !inAfter:
+			changes = append(changes,
+				VGChange{Name: name, Kind: ChangeRemoved, Fields: diffFields(vgFields(b), nil)})
+		default:
+			vc := VGChange{
+				Name:   name,
+				Kind:   ChangeModified,
+				Fields: diffFields(vgFields(b), vgFields(a)),
+				PVs:    diffPVs(b.PVs, a.PVs),
+				LVs:    diffLVs(b.Volumes, a.Volumes),
+			}
+
+			if len(vc.Fields) != 0 || len(vc.PVs) != 0 || len(vc.LVs) != 0 {
+				changes = append(changes, vc)
+			}
+		}
+	}
+
+	return changes
+}
+
+func diffPVs(before, after PVSet) []PVChange {
+	var changes []PVChange
+
+	for _, name := range unionKeys(before, after) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+
+		switch {
+		case !inBefore:
+			changes = append(changes, PVChange{Name: name, Kind: ChangeAdded, Fields: diffFields(nil, pvFields(a))})
+		case !inAfter:
+			changes = append(changes, PVChange{Name: name, Kind: ChangeRemoved, Fields: diffFields(pvFields(b), nil)})
+		default:
+			if fields := diffFields(pvFields(b), pvFields(a)); len(fields) != 0 {
+				changes = append(changes, PVChange{Name: name, Kind: ChangeModified, Fields: fields})
+			}
+		}
+	}
+
+	return changes
+}
+
+func diffLVs(before, after LVSet) []LVChange {
+	var changes []LVChange
+
+	for _, name := range unionKeys(before, after) {
+		b, inBefore := before[name]
+		a, inAfter := after[name]
+
+		switch {
+		case !inBefore:
+			changes = append(changes, LVChange{Name: name, Kind: ChangeAdded, Fields: diffFields(nil, lvFields(a))})
+		case !inAfter:
+			changes = append(changes, LVChange{Name: name, Kind: ChangeRemoved, Fields: diffFields(lvFields(b), nil)})
+		default:
+			if fields := diffFields(lvFields(b), lvFields(a)); len(fields) != 0 {
+				changes = append(changes, LVChange{Name: name, Kind: ChangeModified, Fields: fields})
+			}
+		}
+	}
+
+	return changes
+}
+
+// unionKeys returns the sorted keys that are in either map.
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := sortedKeys(a)
+
+	for _, k := range sortedKeys(b) {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// fieldValue is a compared field: its value as a string and the value it
+// was made from, which is what is compared.
+type fieldValue struct {
+	name  string
+	value string
+	raw   interface{}
+}
+
+// diffFields compares two lists of the same fields in the same order.  A
+// nil list is an item that does not exist, all the fields of the other list
+// are returned.
+func diffFields(before, after []fieldValue) []FieldChange {
+	var changes []FieldChange
+
+	switch {
+	case before == nil:
+		for _, f := range after {
+			changes = append(changes, FieldChange{Field: f.name, New: f.value, NewValue: f.raw})
+		}
+	case after == nil:
+		for _, f := range before {
+			changes = append(changes, FieldChange{Field: f.name, Old: f.value, OldValue: f.raw})
+		}
+	default:
+		for i, f := range before {
+			if a := after[i]; !reflect.DeepEqual(f.raw, a.raw) {
+				changes = append(changes, FieldChange{Field: f.name, Old: f.value, New: a.value,
+					OldValue: f.raw, NewValue: a.raw})
+			}
+		}
+	}
+
+	return changes
+}
+
+func diskFields(d Disk) []fieldValue {
+	return []fieldValue{
+		{"size", sizeString(d.Size), d.Size},
+		{"sectorSize", fmt.Sprintf("%d", d.SectorSize), d.SectorSize},
+		{"table", d.Table.String(), d.Table},
+		{"diskGUID", diskGUIDString(d), diskGUIDString(d)},
+		{"type", d.Type.String(), d.Type},
+		{"attachment", d.Attachment.String(), d.Attachment},
+		{"readOnly", fmt.Sprintf("%t", d.ReadOnly), d.ReadOnly},
+		{"properties", d.Properties.String(), d.Properties.String()},
+		{"serial", d.Identity.Serial, d.Identity.Serial},
+		{"wwn", d.Identity.WWN, d.Identity.WWN},
+		{"model", d.Identity.Model, d.Identity.Model},
+		{"signature", d.Signature.String(), d.Signature},
+	}
+}
+
+// diskGUIDString returns the GPT disk GUID of d, or "" if it has no GPT.
+func diskGUIDString(d Disk) string {
+	if d.Table != GPT {
+		return ""
+	}
+
+	return d.GPT.DiskGUID.String()
+}
+
+func partitionFields(p Partition) []fieldValue {
+	return []fieldValue{
+		{"start", sizeString(p.Start), p.Start},
+		{"size", sizeString(p.Size()), p.Size()},
+		{"type", type2str(p.Type), p.Type},
+		{"name", p.Name, p.Name},
+		{"id", p.ID.String(), p.ID},
+		{"signature", p.Signature.String(), p.Signature},
+		{"attributes", p.Attributes.String(), p.Attributes},
+	}
+}
+
+func vgFields(vg VG) []fieldValue {
+	return []fieldValue{
+		{"uuid", vg.UUID, vg.UUID},
+		{"size", sizeString(vg.Size), vg.Size},
+		{"freeSpace", sizeString(vg.FreeSpace), vg.FreeSpace},
+	}
+}
+
+func pvFields(pv PV) []fieldValue {
+	return []fieldValue{
+		{"uuid", pv.UUID, pv.UUID},
+		{"path", pv.Path, pv.Path},
+		{"size", sizeString(pv.Size), pv.Size},
+		{"freeSize", sizeString(pv.FreeSize), pv.FreeSize},
+	}
+}
+
+func lvFields(lv LV) []fieldValue {
+	return []fieldValue{
+		{"uuid", lv.UUID, lv.UUID},
+		{"path", lv.Path, lv.Path},
+		{"size", sizeString(lv.Size), lv.Size},
+		{"type", lv.Type.String(), lv.Type},
+		{"pool", lv.Pool, lv.Pool},
+		{"encrypted", fmt.Sprintf("%t", lv.Encrypted), lv.Encrypted},
+	}
+}
@@ -0,0 +1,193 @@
+package disko_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+func TestDiffDisksNoChange(t *testing.T) {
+	assert.Nil(t, disko.DiffDisks(renderDisks(), renderDisks()))
+	assert.True(t, disko.NewDiff(renderDisks(), renderDisks(), renderVGs(), renderVGs()).IsEmpty())
+}
+
+func TestDiffDisks(t *testing.T) {
+	ast := assert.New(t)
+	before := renderDisks()
+	after := renderDisks()
+
+	sda := after["sda"]
+	sda.Partitions = disko.PartitionSet{
+		1: {Number: 1, Start: disko.Mebibyte, Last: 61*disko.Mebibyte - 1, Type: partid.LinuxFS, Name: "root"},
+		2: {Number: 2, Start: 61 * disko.Mebibyte, Last: 71*disko.Mebibyte - 1, Type: partid.LinuxLVM, Name: "new"},
+	}
+	after["sda"] = sda
+
+	sdb := after["sdb"]
+	sdb.Size = 80 * disko.Mebibyte
+	after["sdb"] = sdb
+
+	after["sdc"] = disko.Disk{Name: "sdc", Path: "/dev/sdc", Size: 10 * disko.Mebibyte}
+
+	changes := disko.DiffDisks(before, after)
+	if !ast.Len(changes, 3) {
+		return
+	}
+
+	ast.Equal("sda", changes[0].Name)
+	ast.Equal(disko.ChangeModified, changes[0].Kind)
+	ast.Empty(changes[0].Fields)
+	ast.Equal([]disko.PartitionChange{
+		{Number: 1, Kind: disko.ChangeModified, Fields: []disko.FieldChange{
+			{Field: "size", Old: "50MiB", New: "60MiB", OldValue: 50 * disko.Mebibyte, NewValue: 60 * disko.Mebibyte},
+			{Field: "type", Old: "LVM", New: "Linux-FS",
+				OldValue: disko.PartType(partid.LinuxLVM), NewValue: disko.PartType(partid.LinuxFS)},
+			{Field: "name", Old: "data", New: "root", OldValue: "data", NewValue: "root"},
+		}},
+		{Number: 2, Kind: disko.ChangeAdded, Fields: []disko.FieldChange{
+			{Field: "start", New: "61MiB", NewValue: 61 * disko.Mebibyte},
+			{Field: "size", New: "10MiB", NewValue: 10 * disko.Mebibyte},
+			{Field: "type", New: "LVM", NewValue: disko.PartType(partid.LinuxLVM)},
+			{Field: "name", New: "new", NewValue: "new"},
+			{Field: "id", New: disko.GUID{}.String(), NewValue: disko.GUID{}},
+			{Field: "signature", NewValue: disko.Signature{}},
+			{Field: "attributes", NewValue: disko.PartAttrs(0)},
+		}},
+	}, changes[0].Partitions)
+
+	ast.Equal(disko.DiskChange{
+		Name: "sdb", Kind: disko.ChangeModified,
+		Fields: []disko.FieldChange{{Field: "size", Old: "50MiB", New: "80MiB",
+			OldValue: 50 * disko.Mebibyte, NewValue: 80 * disko.Mebibyte}},
+	}, changes[1])
+
+	ast.Equal("sdc", changes[2].Name)
+	ast.Equal(disko.ChangeAdded, changes[2].Kind)
+
+	removed := disko.DiffDisks(after, before)
+	ast.Equal(disko.ChangeRemoved, removed[2].Kind)
+	ast.Equal(disko.FieldChange{Field: "size", Old: "10MiB", OldValue: 10 * disko.Mebibyte}, removed[2].Fields[0])
+}
+
+func TestDiffDisksRawValues(t *testing.T) {
+	ast := assert.New(t)
+	before := renderDisks()
+	after := renderDisks()
+
+	// a change that the rounded size does not show.
+	sdb := after["sdb"]
+	sdb.Size += 512
+	after["sdb"] = sdb
+
+	changes := disko.DiffDisks(before, after)
+	if ast.Len(changes, 1) && ast.Len(changes[0].Fields, 1) {
+		f := changes[0].Fields[0]
+		ast.Equal("size", f.Field)
+		ast.Equal(50*disko.Mebibyte, f.OldValue)
+		ast.Equal(50*disko.Mebibyte+512, f.NewValue)
+	}
+}
+
+func TestDiffDisksIdentity(t *testing.T) {
+	ast := assert.New(t)
+	before := renderDisks()
+	after := renderDisks()
+
+	// sdb comes back as sdd after a reboot, found by its wwn, and sda as
+	// sde, found by its serial.
+	sda, sdb := before["sda"], before["sdb"]
+	sda.Identity.Serial = "S1"
+	sdb.Identity.WWN = "0x5000c500a1b2c3d4"
+	before["sda"], before["sdb"] = sda, sdb
+
+	delete(after, "sda")
+	delete(after, "sdb")
+
+	sda.Name, sda.Path = "sde", "/dev/sde"
+	sdb.Name, sdb.Path = "sdd", "/dev/sdd"
+	sdb.Size = 80 * disko.Mebibyte
+	after["sde"], after["sdd"] = sda, sdb
+
+	// a new disk with no identity is not matched.
+	after["sdf"] = disko.Disk{Name: "sdf", Path: "/dev/sdf", Size: 50 * disko.Mebibyte, SectorSize: 512}
+
+	changes := disko.DiffDisks(before, after)
+	if !ast.Len(changes, 3) {
+		return
+	}
+
+	ast.Equal(disko.DiskChange{
+		Name: "sdd", Kind: disko.ChangeModified,
+		Fields: []disko.FieldChange{
+			{Field: "name", Old: "sdb", New: "sdd", OldValue: "sdb", NewValue: "sdd"},
+			{Field: "size", Old: "50MiB", New: "80MiB", OldValue: 50 * disko.Mebibyte, NewValue: 80 * disko.Mebibyte},
+		},
+	}, changes[0])
+
+	ast.Equal(disko.DiskChange{
+		Name: "sde", Kind: disko.ChangeModified,
+		Fields: []disko.FieldChange{{Field: "name", Old: "sda", New: "sde", OldValue: "sda", NewValue: "sde"}},
+	}, changes[1])
+
+	ast.Equal("sdf", changes[2].Name)
+	ast.Equal(disko.ChangeAdded, changes[2].Kind)
+}
+
+func TestDiffVGs(t *testing.T) {
+	ast := assert.New(t)
+	before := renderVGs()
+	after := renderVGs()
+
+	vg := after["vg0"]
+	vg.FreeSpace -= 4 * disko.Mebibyte
+
+	pool := vg.Volumes["pool"]
+	pool.Size += 4 * disko.Mebibyte
+	vg.Volumes["pool"] = pool
+
+	delete(vg.Volumes, "thin1")
+	after["vg0"] = vg
+
+	changes := disko.DiffVGs(before, after)
+	if !ast.Len(changes, 1) {
+		return
+	}
+
+	ast.Equal(disko.ChangeModified, changes[0].Kind)
+	ast.Equal("freeSpace", changes[0].Fields[0].Field)
+	ast.Empty(changes[0].PVs)
+
+	if ast.Len(changes[0].LVs, 2) {
+		ast.Equal(disko.LVChange{Name: "pool", Kind: disko.ChangeModified,
+			Fields: []disko.FieldChange{{Field: "size", Old: "40MiB", New: "44MiB",
+				OldValue: 40 * disko.Mebibyte, NewValue: 44 * disko.Mebibyte}}}, changes[0].LVs[0])
+		ast.Equal("thin1", changes[0].LVs[1].Name)
+		ast.Equal(disko.ChangeRemoved, changes[0].LVs[1].Kind)
+	}
+}
+
+func TestDiffString(t *testing.T) {
+	before := renderDisks()
+	after := renderDisks()
+
+	delete(after, "sdb")
+
+	sda := after["sda"]
+	sda.Size = 200 * disko.Mebibyte
+	after["sda"] = sda
+
+	diff := disko.NewDiff(before, after, nil, nil)
+
+	assert.Equal(t,
+		"disk sda: size 100MiB -> 200MiB\n"+
+			"disk sdb: removed (size=50MiB sectorSize=512 table=NONE diskGUID= type=HDD "+
+			"attachment=UNKNOWN readOnly=false properties= serial= wwn= model= signature=)\n",
+		diff.String())
+
+	jbytes, err := json.Marshal(diff)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jbytes), `"kind":"removed"`)
+}
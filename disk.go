@@ -240,9 +240,15 @@ type PartType GUID
 type DiskSet map[string]Disk
 
 // Details prints the details of the disks in the disk set ina a tabular
-// format.
+// format. Use a Renderer for other formats.
 func (ds DiskSet) Details() string {
-	return ""
+	var buf strings.Builder
+
+	if err := (TextRenderer{}).RenderDisks(&buf, ds); err != nil {
+		return err.Error()
+	}
+
+	return buf.String()
 }
 
 // Property - a property of a disk such
@@ -317,6 +323,39 @@ func (p *PropertySet) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// DiskIdentity identifies a physical (or RAID virtual) disk independently of
+// the kernel name it happens to get on a boot.  Fields that are not known are
+// empty.
+type DiskIdentity struct {
+	// Serial is the serial number of the disk.
+	Serial string `json:"serial,omitempty"`
+
+	// WWN is the World Wide Name of the disk ("0x5000c500a1b2c3d4"), or the
+	// EUI or NGUID of an NVMe namespace ("eui.0025388b71b0c2d4").
+	WWN string `json:"wwn,omitempty"`
+
+	// Model is the model name of the disk.
+	Model string `json:"model,omitempty"`
+
+	// Vendor is the vendor of the disk.
+	Vendor string `json:"vendor,omitempty"`
+
+	// Firmware is the firmware revision of the disk.
+	Firmware string `json:"firmware,omitempty"`
+
+	// ByID are the /dev/disk/by-id links to the disk.
+	ByID []string `json:"byId,omitempty"`
+
+	// ByPath are the /dev/disk/by-path links to the disk.
+	ByPath []string `json:"byPath,omitempty"`
+}
+
+// IsEmpty returns true if nothing is known about the identity.
+func (i DiskIdentity) IsEmpty() bool {
+	return i.Serial == "" && i.WWN == "" && i.Model == "" && i.Vendor == "" &&
+		i.Firmware == "" && len(i.ByID) == 0 && len(i.ByPath) == 0
+}
+
 // Disk wraps the disk level operations. It provides basic information
 // about the disk including name, device path, size etc.
 type Disk struct {
@@ -333,6 +372,22 @@ type Disk struct {
 	// applicable it will return 0.
 	SectorSize uint `json:"sectorSize"`
 
+	// PhysicalBlockSize is the smallest unit the device can write without a
+	// read-modify-write, or 0 if unknown.
+	PhysicalBlockSize uint `json:"physicalBlockSize,omitempty"`
+
+	// MinimumIOSize is the smallest preferred IO size of the device (the
+	// chunk size of a RAID volume), or 0 if unknown.
+	MinimumIOSize uint `json:"minimumIOSize,omitempty"`
+
+	// OptimalIOSize is the preferred IO size of the device (the stripe width
+	// of a RAID volume), or 0 if unknown.
+	OptimalIOSize uint `json:"optimalIOSize,omitempty"`
+
+	// AlignmentOffset is the number of bytes the start of the device is
+	// offset from its natural alignment.
+	AlignmentOffset uint `json:"alignmentOffset,omitempty"`
+
 	// ReadOnly - cannot be written to.
 	ReadOnly bool `json:"read-only"`
 
@@ -351,19 +406,138 @@ type Disk struct {
 	// TableType is the type of the table
 	Table TableType `json:"table"`
 
+	// GPT is the header of a GPT partition table.  It is zero for other
+	// tables.  A DiskGUID set on a disk with no table is given to the table
+	// that CreatePartitions creates.
+	GPT GPTHeader `json:"gpt"`
+
+	// TableProblems are what is wrong with the partition table.  A GPT
+	// that only one copy of is valid is read from that copy.
+	TableProblems []TableProblem `json:"tableProblems,omitempty"`
+
 	// Properties are a set of properties of this disk.
 	Properties PropertySet `json:"properties"`
 
+	// Identity is the stable identity of the disk.
+	Identity DiskIdentity `json:"identity"`
+
+	// Usage is what uses the whole disk.
+	Usage []Usage `json:"usage,omitempty"`
+
+	// PartitionUsage is what uses the partitions of the disk, by partition
+	// number.  Partitions that are not in use are not in it.
+	PartitionUsage map[uint][]Usage `json:"partitionUsage,omitempty"`
+
+	// Signature is what the whole disk contains.  It is only probed for
+	// disks with no partition table.
+	Signature Signature `json:"signature"`
+
 	// UdevInfo is the disk's udev information.
 	UdevInfo UdevInfo `json:"udevInfo"`
 }
 
+// GPTHeader is what the header of a GPT partition table records about the
+// disk.
+type GPTHeader struct {
+	// DiskGUID identifies the disk.
+	DiskGUID GUID `json:"diskGUID"`
+
+	// FirstUsableLBA is the first sector that partitions may use.
+	FirstUsableLBA uint64 `json:"firstUsableLBA"`
+
+	// LastUsableLBA is the last sector that partitions may use.
+	LastUsableLBA uint64 `json:"lastUsableLBA"`
+
+	// PartitionEntries is the number of entries in the partition array.
+	PartitionEntries uint32 `json:"partitionEntries"`
+
+	// PartitionEntrySize is the size in bytes of a partition entry.
+	PartitionEntrySize uint32 `json:"partitionEntrySize"`
+}
+
+// InUse returns true if the disk or any of its partitions is in use.
+func (d Disk) InUse() bool {
+	if len(d.Usage) != 0 {
+		return true
+	}
+
+	for n := range d.PartitionUsage {
+		if d.PartitionInUse(n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PartitionInUse returns true if partition number n of the disk is in use.
+func (d Disk) PartitionInUse(n uint) bool {
+	return len(d.PartitionUsage[n]) != 0
+}
+
+// UsageKind is how a disk or partition is used.
+type UsageKind string
+
+const (
+	// UsageMount is a mounted filesystem.
+	UsageMount UsageKind = "mount"
+
+	// UsageSwap is active swap.
+	UsageSwap UsageKind = "swap"
+
+	// UsageHolder is a device built on top: a device mapper target (LVM
+	// volume, LUKS mapping, multipath) or an md RAID array.
+	UsageHolder UsageKind = "holder"
+
+	// UsageOpen is a device that something has opened exclusively for no
+	// reason that is otherwise known.
+	UsageOpen UsageKind = "open"
+)
+
+// Usage is something that uses a disk or partition.
+type Usage struct {
+	// Kind is how the device is used.
+	Kind UsageKind `json:"kind"`
+
+	// Target is the mount point (UsageMount), the swap device (UsageSwap) or
+	// the holder device (UsageHolder).
+	Target string `json:"target,omitempty"`
+
+	// Detail is the filesystem type of a mount, or the kind of a holder:
+	// lvm, crypt, multipath, dm or md.
+	Detail string `json:"detail,omitempty"`
+
+	// Via is the holder that the device is used through, for example the
+	// LUKS mapping a mounted filesystem is on.  It is empty for direct use.
+	Via string `json:"via,omitempty"`
+}
+
+func (u Usage) String() string {
+	s := string(u.Kind)
+
+	if u.Target != "" {
+		s += " " + u.Target
+	}
+
+	if u.Detail != "" {
+		s += " (" + u.Detail + ")"
+	}
+
+	if u.Via != "" {
+		s += " via " + u.Via
+	}
+
+	return s
+}
+
 // FreeSpacesWithMin returns a list of freespaces that are minSize long or more.
 func (d *Disk) FreeSpacesWithMin(minSize uint64) []FreeSpace {
-	// Stay out of the first 1Mebibyte
-	// Leave 33 sectors at end (for GPT second header) and round 1MiB down.
-	end := ((d.Size - uint64(d.SectorSize)*33) / Mebibyte) * Mebibyte
-	used := uRanges{{0, 1*Mebibyte - 1}, {end, d.Size}}
+	// Stay out of the first 1Mebibyte and start on an aligned position.
+	// Stay out of the end past the last usable sector (for GPT second
+	// header) and align down.
+	start := d.AlignUp(Mebibyte)
+	end := d.AlignDown(d.usableEnd())
+	used := uRanges{{0, start - 1}, {end, d.Size}}
 
 	for _, p := range d.Partitions {
 		used = append(used, uRange{p.Start, p.Last})
@@ -382,6 +556,123 @@ func (d *Disk) FreeSpacesWithMin(minSize uint64) []FreeSpace {
 	return avail
 }
 
+// usableEnd returns the offset just past the last byte that partitions may
+// use.  That is the end of the last usable LBA of a GPT, which stays short of
+// the end of a disk that has grown until its backup GPT is relocated, or 33
+// sectors short of the end of the disk if that is not known.
+func (d *Disk) usableEnd() uint64 {
+	end := d.Size - uint64(d.SectorSize)*33
+
+	if d.Table == GPT && d.GPT.LastUsableLBA != 0 {
+		if gptEnd := (d.GPT.LastUsableLBA + 1) * uint64(d.SectorSize); gptEnd < end {
+			end = gptEnd
+		}
+	}
+
+	return end
+}
+
+// CheckPartitionResize returns an error wrapping ErrOutOfRange if p, with
+// its new Last, does not end on a sector boundary after it starts and before
+// the last usable byte of the disk.  It is the check that every System
+// applies to ResizePartition.
+func (d *Disk) CheckPartitionResize(p Partition) error {
+	end := d.usableEnd()
+
+	if p.Last <= p.Start || (p.Last+1)%uint64(d.SectorSize) != 0 {
+		return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+			Detail: fmt.Sprintf("Last (%d) must be after start (%d) and end a %d byte sector",
+				p.Last, p.Start, d.SectorSize)}
+	}
+
+	if p.Last >= end {
+		return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+			Detail: fmt.Sprintf("Last (%d) is too high. Must be < %d", p.Last, end)}
+	}
+
+	return nil
+}
+
+// CheckPartitionOverlap returns an error wrapping ErrOverlap if p overlaps
+// a partition of d other than the one with its number.
+func (d *Disk) CheckPartitionOverlap(p Partition) error {
+	nums := make([]uint, 0, len(d.Partitions))
+
+	for n := range d.Partitions {
+		nums = append(nums, n)
+	}
+
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	for _, n := range nums {
+		cur := d.Partitions[n]
+		if n != p.Number && p.Start <= cur.Last && cur.Start <= p.Last {
+			return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOverlap,
+				Detail: fmt.Sprintf("%d-%d overlaps partition %d (%d-%d)",
+					p.Start, p.Last, n, cur.Start, cur.Last)}
+		}
+	}
+
+	return nil
+}
+
+// CheckPartitionRanges returns an error wrapping ErrOutOfRange if a
+// partition of pSet cannot be created on d: its number is not one the table
+// has, it does not start on an aligned position after the first Mebibyte,
+// it does not end before the last usable LBA of a GPT (or the 2TiB limit of
+// an MBR), or it ends before it starts.  It is the check that every System applies.
+func (d *Disk) CheckPartitionRanges(pSet PartitionSet) error {
+	const max32 = 0xFFFFFFFF
+
+	end := d.usableEnd()
+
+	if d.Table == MBR {
+		if mbrEnd := uint64(max32-33) * uint64(d.SectorSize); mbrEnd < end {
+			end = mbrEnd
+		}
+	}
+
+	// the same bounds as FreeSpaces, aligned to the disk's topology.
+	maxEnd := d.AlignDown(end)
+	minStart := d.AlignUp(Mebibyte)
+
+	const minPartNum, maxPartNumMBR, maxPartNumGPT = 1, 4, 128
+
+	maxPartNum := uint(maxPartNumGPT)
+	if d.Table == MBR {
+		maxPartNum = uint(maxPartNumMBR)
+	}
+
+	for _, p := range pSet {
+		if p.Number < uint(minPartNum) || p.Number > maxPartNum {
+			return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("number must be %d-%d for %s", minPartNum, maxPartNum, d.Table)}
+		}
+
+		if p.Start < minStart {
+			return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("start (%d) is too low. Must be >= %d", p.Start, minStart)}
+		}
+
+		if !d.PhysicallyAligned(p.Start) {
+			return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("start (%d) is not on a physical block boundary", p.Start)}
+		}
+
+		if p.Last >= maxEnd {
+			return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("Last (%d) is too high. Must be < %d", p.Last, maxEnd)}
+		}
+
+		if p.Last < p.Start {
+			return &PartitionError{Disk: d.Path, Number: p.Number, Err: ErrOutOfRange,
+				Detail: fmt.Sprintf("Last (%d) is before Start (%d)", p.Last, p.Start)}
+		}
+	}
+
+	return nil
+}
+
 // FreeSpaces returns a list of slots of free spaces on the disk. These slots can
 // be used to create new partitions.
 func (d *Disk) FreeSpaces() []FreeSpace {
@@ -507,6 +798,12 @@ type Partition struct {
 
 	// Number is the number of this partition.
 	Number uint `json:"number"`
+
+	// Signature is what the partition contains, as found by probing it.
+	Signature Signature `json:"signature"`
+
+	// Attributes are the GPT attribute flags of the partition.
+	Attributes PartAttrs `json:"attributes"`
 }
 
 // Size returns the size of the partition in bytes.
@@ -522,6 +819,9 @@ type jPartition struct {
 	Type   string `json:"type"`
 	Name   string `json:"name"`
 	Number uint   `json:"number"`
+
+	Signature  *Signature `json:"signature,omitempty"`
+	Attributes string     `json:"attributes,omitempty"`
 }
 
 // UnmarshalJSON - unserialize from json
@@ -550,19 +850,186 @@ func (p *Partition) UnmarshalJSON(b []byte) error {
 	p.Name = j.Name
 	p.Number = j.Number
 
+	if j.Signature != nil {
+		p.Signature = *j.Signature
+	}
+
+	if p.Attributes, err = StringToPartAttrs(j.Attributes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // MarshalJSON - serialize to json
 func (p Partition) MarshalJSON() ([]byte, error) {
-	return json.Marshal(jPartition{
-		Start:  p.Start,
-		Last:   p.Last,
-		ID:     p.ID.String(),
-		Type:   p.Type.String(),
-		Name:   p.Name,
-		Number: p.Number,
-	})
+	j := jPartition{
+		Start:      p.Start,
+		Last:       p.Last,
+		ID:         p.ID.String(),
+		Type:       p.Type.String(),
+		Name:       p.Name,
+		Number:     p.Number,
+		Attributes: p.Attributes.String(),
+	}
+
+	if !p.Signature.IsEmpty() {
+		j.Signature = &p.Signature
+	}
+
+	return json.Marshal(j)
+}
+
+// PartAttrs are the attribute flags of a GPT partition entry.  Bits 0-2
+// are defined by UEFI for every partition, bits 48-63 by the partition
+// type.  The Discoverable Partitions Specification uses bits 59, 60 and 63
+// for the linux partition types.
+type PartAttrs uint64
+
+const (
+	// AttrRequired marks a partition the platform needs to function.
+	AttrRequired PartAttrs = 1 << 0
+
+	// AttrNoBlockIO tells EFI firmware not to make a block device of the
+	// partition.
+	AttrNoBlockIO PartAttrs = 1 << 1
+
+	// AttrLegacyBIOSBootable marks the partition a legacy BIOS boots from.
+	AttrLegacyBIOSBootable PartAttrs = 1 << 2
+
+	// AttrGrowFS asks that the filesystem is grown to fill the partition.
+	AttrGrowFS PartAttrs = 1 << 59
+
+	// AttrReadOnly asks that the partition is mounted read only.
+	AttrReadOnly PartAttrs = 1 << 60
+
+	// AttrNoAuto asks that the partition is not mounted automatically.
+	AttrNoAuto PartAttrs = 1 << 63
+)
+
+//nolint:gochecknoglobals
+var partAttrNames = []struct {
+	attr PartAttrs
+	name string
+}{
+	{AttrRequired, "required"},
+	{AttrNoBlockIO, "no-block-io"},
+	{AttrLegacyBIOSBootable, "legacy-bios-bootable"},
+	{AttrGrowFS, "grow-fs"},
+	{AttrReadOnly, "read-only"},
+	{AttrNoAuto, "no-auto"},
+}
+
+// String returns the names of the set attributes separated by commas.
+// Bits without a name are given as "bitN".
+func (a PartAttrs) String() string {
+	names := []string{}
+
+	for bit := uint(0); bit < 64; bit++ {
+		attr := PartAttrs(1) << bit
+		if a&attr == 0 {
+			continue
+		}
+
+		name := fmt.Sprintf("bit%d", bit)
+
+		for _, n := range partAttrNames {
+			if n.attr == attr {
+				name = n.name
+				break
+			}
+		}
+
+		names = append(names, name)
+	}
+
+	return strings.Join(names, ",")
+}
+
+// StringToPartAttrs - convert a string as returned by PartAttrs.String to
+// PartAttrs.
+func StringToPartAttrs(s string) (PartAttrs, error) {
+	var attrs PartAttrs
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		attr, err := stringToPartAttr(name)
+		if err != nil {
+			return 0, err
+		}
+
+		attrs |= attr
+	}
+
+	return attrs, nil
+}
+
+func stringToPartAttr(name string) (PartAttrs, error) {
+	for _, n := range partAttrNames {
+		if n.name == name {
+			return n.attr, nil
+		}
+	}
+
+	var bit uint
+	if _, err := fmt.Sscanf(name, "bit%d", &bit); err == nil && bit < 64 && name == fmt.Sprintf("bit%d", bit) {
+		return PartAttrs(1) << bit, nil
+	}
+
+	return 0, fmt.Errorf("unknown partition attribute '%s'", name)
+}
+
+// Signature is what a disk or partition contains: a filesystem, swap, an
+// encrypted volume or a member of a volume manager or RAID.  The Type names
+// are those of blkid ("ext4", "crypto_LUKS", "LVM2_member").  Fields that
+// are not known or do not apply are empty.
+type Signature struct {
+	// Type is the type of the content.
+	Type string `json:"type"`
+
+	// Label is the label or name of the content.
+	Label string `json:"label,omitempty"`
+
+	// UUID is the UUID of the content.
+	UUID string `json:"uuid,omitempty"`
+
+	// Version is the version of the format of the content.
+	Version string `json:"version,omitempty"`
+
+	// ProbeError is why the content could not be probed, as when a sector
+	// of it cannot be read.  The other fields are empty then.
+	ProbeError string `json:"probeError,omitempty"`
+}
+
+// IsEmpty returns true if nothing was found and probing did not fail.
+func (s Signature) IsEmpty() bool {
+	return s.Type == "" && s.ProbeError == ""
+}
+
+func (s Signature) String() string {
+	if s.ProbeError != "" {
+		return "unknown (" + s.ProbeError + ")"
+	}
+
+	if s.IsEmpty() {
+		return ""
+	}
+
+	str := s.Type
+
+	if s.Label != "" {
+		str += fmt.Sprintf(" label=%q", s.Label)
+	}
+
+	if s.UUID != "" {
+		str += " uuid=" + s.UUID
+	}
+
+	return str
 }
 
 func (p PartType) String() string {
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"machinerun.io/disko"
 	"machinerun.io/disko/partid"
 )
@@ -77,6 +78,137 @@ func TestDiskString(t *testing.T) {
 	}
 }
 
+func TestFreeSpacesLastUsable(t *testing.T) {
+	mib := disko.Mebibyte
+
+	// a 100MiB disk whose GPT was written when it was 50MiB.
+	d := disko.Disk{
+		Size:       100 * mib,
+		SectorSize: 512,
+		Table:      disko.GPT,
+		GPT:        disko.GPTHeader{LastUsableLBA: 50*mib/512 - 34},
+		Partitions: disko.PartitionSet{
+			1: disko.Partition{Start: mib, Last: 20*mib - 1, Number: 1},
+		},
+	}
+
+	expected := []disko.FreeSpace{{Start: 20 * mib, Last: 49*mib - 1}}
+	if found := d.FreeSpaces(); fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("FreeSpaces() expected %v found %v", expected, found)
+	}
+
+	// once the backup GPT is at the end, so is the free space.
+	d.GPT.LastUsableLBA = 100*mib/512 - 34
+	expected = []disko.FreeSpace{{Start: 20 * mib, Last: 99*mib - 1}}
+
+	if found := d.FreeSpaces(); fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("FreeSpaces() expected %v found %v", expected, found)
+	}
+
+	// without a last usable LBA, the end of the disk is assumed.
+	d.GPT = disko.GPTHeader{}
+
+	if found := d.FreeSpaces(); fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("FreeSpaces() expected %v found %v", expected, found)
+	}
+}
+
+func TestCheckPartitionResize(t *testing.T) {
+	ast := assert.New(t)
+	mib := disko.Mebibyte
+
+	// a 100MiB disk whose GPT was written when it was 50MiB.
+	d := disko.Disk{
+		Path:       "/dev/sdz",
+		Size:       100 * mib,
+		SectorSize: 512,
+		Table:      disko.GPT,
+		GPT:        disko.GPTHeader{LastUsableLBA: 50*mib/512 - 34},
+	}
+
+	part := func(last uint64) disko.Partition {
+		return disko.Partition{Number: 1, Start: mib, Last: last}
+	}
+
+	ast.NoError(d.CheckPartitionResize(part(40*mib - 1)))
+	ast.ErrorIs(d.CheckPartitionResize(part(60*mib-1)), disko.ErrOutOfRange)
+	ast.ErrorIs(d.CheckPartitionResize(part(40*mib)), disko.ErrOutOfRange)
+	ast.ErrorIs(d.CheckPartitionResize(part(mib-1)), disko.ErrOutOfRange)
+
+	// once the backup GPT is at the end, so is the limit.
+	d.GPT.LastUsableLBA = 100*mib/512 - 34
+	ast.NoError(d.CheckPartitionResize(part(60*mib - 1)))
+	ast.ErrorIs(d.CheckPartitionResize(part(100*mib-1)), disko.ErrOutOfRange)
+}
+
+func TestCheckPartitionOverlap(t *testing.T) {
+	ast := assert.New(t)
+	mib := disko.Mebibyte
+
+	d := disko.Disk{
+		Path: "/dev/sdz",
+		Partitions: disko.PartitionSet{
+			1: {Number: 1, Start: mib, Last: 10*mib - 1},
+			2: {Number: 2, Start: 20 * mib, Last: 30*mib - 1},
+		},
+	}
+
+	ast.NoError(d.CheckPartitionOverlap(disko.Partition{Number: 3, Start: 10 * mib, Last: 20*mib - 1}))
+	ast.NoError(d.CheckPartitionOverlap(disko.Partition{Number: 1, Start: mib, Last: 20*mib - 1}))
+
+	err := d.CheckPartitionOverlap(disko.Partition{Number: 1, Start: mib, Last: 20 * mib})
+	ast.ErrorIs(err, disko.ErrOverlap)
+
+	var perr *disko.PartitionError
+	if ast.ErrorAs(err, &perr) {
+		ast.Equal(uint(1), perr.Number)
+		ast.Contains(perr.Detail, "overlaps partition 2")
+	}
+}
+
+func TestRelocatedLastUsableLBA(t *testing.T) {
+	ast := assert.New(t)
+
+	d := disko.Disk{Size: 100 * disko.Mebibyte, SectorSize: 512, Table: disko.GPT}
+
+	// a new GPT has 128 entries of 128 bytes, 32 sectors of 512 bytes.
+	ast.Equal(uint64(32), d.GPTEntrySectors())
+	ast.Equal(100*disko.Mebibyte/512-34, d.RelocatedLastUsableLBA())
+
+	d.SectorSize = 4096
+	ast.Equal(uint64(4), d.GPTEntrySectors())
+	ast.Equal(100*disko.Mebibyte/4096-6, d.RelocatedLastUsableLBA())
+
+	d.GPT.PartitionEntries, d.GPT.PartitionEntrySize = 256, 128
+	ast.Equal(uint64(8), d.GPTEntrySectors())
+	ast.Equal(100*disko.Mebibyte/4096-10, d.RelocatedLastUsableLBA())
+}
+
+func TestProblemsAfterRepair(t *testing.T) {
+	ast := assert.New(t)
+
+	overlap := disko.TableProblem{Kind: disko.ProblemOverlap, Partition: 2, Detail: "overlaps partition 1"}
+	d := disko.Disk{
+		Path:  "/dev/sdz",
+		Table: disko.GPT,
+		TableProblems: []disko.TableProblem{
+			{Kind: disko.ProblemPrimaryEntries, Detail: "bad crc"},
+			{Kind: disko.ProblemBackupLocation, Detail: "not at the end"},
+			overlap,
+		},
+	}
+
+	left, err := d.ProblemsAfterRepair()
+	if ast.NoError(err) {
+		ast.Equal([]disko.TableProblem{overlap}, left)
+	}
+
+	d.TableProblems = append(d.TableProblems, disko.TableProblem{Kind: disko.ProblemBackupHeader})
+
+	_, err = d.ProblemsAfterRepair()
+	ast.ErrorIs(err, disko.ErrBadPartitionTable)
+}
+
 func TestDiskDetails(t *testing.T) {
 	mib := disko.Mebibyte
 
@@ -222,6 +354,154 @@ func TestPartitionUnserializeJson(t *testing.T) {
 	}
 }
 
+func TestPartitionSignatureJson(t *testing.T) {
+	p := disko.Partition{
+		Start:     3 * disko.Mebibyte,
+		Last:      253*disko.Mebibyte - 1,
+		Type:      partid.LinuxFS,
+		Number:    1,
+		Signature: disko.Signature{Type: "ext4", Label: "root", UUID: "0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a"},
+	}
+
+	jbytes, err := json.Marshal(&p)
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %s", p, err)
+	}
+
+	if !strings.Contains(string(jbytes), `"signature":{"type":"ext4","label":"root",`) {
+		t.Errorf("Did not find signature in json: %s", jbytes)
+	}
+
+	found := disko.Partition{}
+	if err := json.Unmarshal(jbytes, &found); err != nil {
+		t.Fatalf("Failed Unmarshal of %s: %s", jbytes, err)
+	}
+
+	if found != p {
+		t.Errorf("Objects differed. got %#v expected %#v\n", found, p)
+	}
+
+	p.Signature = disko.Signature{}
+
+	jbytes, err = json.Marshal(&p)
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %s", p, err)
+	}
+
+	if strings.Contains(string(jbytes), "signature") {
+		t.Errorf("Found empty signature in json: %s", jbytes)
+	}
+}
+
+func TestPartitionProbeErrorJson(t *testing.T) {
+	p := disko.Partition{
+		Start:     3 * disko.Mebibyte,
+		Last:      253*disko.Mebibyte - 1,
+		Type:      partid.LinuxFS,
+		Number:    1,
+		Signature: disko.Signature{ProbeError: "read /dev/sda1: input/output error"},
+	}
+
+	jbytes, err := json.Marshal(&p)
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %s", p, err)
+	}
+
+	if !strings.Contains(string(jbytes), `"signature":{"type":"","probeError":"read /dev/sda1: input/output error"}`) {
+		t.Errorf("Did not find probe error in json: %s", jbytes)
+	}
+
+	found := disko.Partition{}
+	if err := json.Unmarshal(jbytes, &found); err != nil {
+		t.Fatalf("Failed Unmarshal of %s: %s", jbytes, err)
+	}
+
+	if found != p {
+		t.Errorf("Objects differed. got %#v expected %#v\n", found, p)
+	}
+}
+
+func TestPartitionAttributesJson(t *testing.T) {
+	p := disko.Partition{
+		Start:      3 * disko.Mebibyte,
+		Last:       253*disko.Mebibyte - 1,
+		Type:       partid.LinuxFS,
+		Number:     1,
+		Attributes: disko.AttrRequired | disko.AttrGrowFS | disko.PartAttrs(1)<<48,
+	}
+
+	jbytes, err := json.Marshal(&p)
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %s", p, err)
+	}
+
+	if !strings.Contains(string(jbytes), `"attributes":"required,bit48,grow-fs"`) {
+		t.Errorf("Did not find attributes in json: %s", jbytes)
+	}
+
+	found := disko.Partition{}
+	if err := json.Unmarshal(jbytes, &found); err != nil {
+		t.Fatalf("Failed Unmarshal of %s: %s", jbytes, err)
+	}
+
+	if found != p {
+		t.Errorf("Objects differed. got %#v expected %#v\n", found, p)
+	}
+
+	if err := json.Unmarshal([]byte(`{"id": "", "type": "", "attributes": "required,bogus"}`), &found); err == nil {
+		t.Errorf("Expected error for unknown attribute")
+	}
+}
+
+func TestStringToPartAttrs(t *testing.T) {
+	values := []struct {
+		input    string
+		expected disko.PartAttrs
+	}{
+		{"", 0},
+		{"legacy-bios-bootable", disko.AttrLegacyBIOSBootable},
+		{"no-auto, read-only", disko.AttrNoAuto | disko.AttrReadOnly},
+		{"bit1,bit63", disko.AttrNoBlockIO | disko.AttrNoAuto},
+	}
+
+	for _, v := range values {
+		found, err := disko.StringToPartAttrs(v.input)
+		if err != nil {
+			t.Errorf("StringToPartAttrs(%q) failed: %s", v.input, err)
+		} else if found != v.expected {
+			t.Errorf("StringToPartAttrs(%q) = %s, expected %s", v.input, found, v.expected)
+		}
+	}
+
+	for _, bad := range []string{"bit64", "bit", "bit01", "hidden"} {
+		if _, err := disko.StringToPartAttrs(bad); err == nil {
+			t.Errorf("StringToPartAttrs(%q) did not fail", bad)
+		}
+	}
+
+	if s := (disko.AttrNoBlockIO | disko.AttrNoAuto).String(); s != "no-block-io,no-auto" {
+		t.Errorf("Got %q for String()", s)
+	}
+}
+
+func TestSignatureString(t *testing.T) {
+	values := []struct {
+		sig      disko.Signature
+		expected string
+	}{
+		{disko.Signature{}, ""},
+		{disko.Signature{Type: "swap", Version: "1"}, "swap"},
+		{disko.Signature{Type: "xfs", Label: "my data", UUID: "0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a"},
+			`xfs label="my data" uuid=0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a`},
+	}
+
+	for _, v := range values {
+		if found := v.sig.String(); found != v.expected {
+			t.Errorf("%#v String() gave %q, expected %q", v.sig, found, v.expected)
+		}
+	}
+}
+
 func TestDiskSerializeJson(t *testing.T) {
 	// For readability, Partition serializes ID and Type to string GUIDs
 	// Test that they get there.
@@ -245,6 +525,38 @@ func TestDiskSerializeJson(t *testing.T) {
 	}
 }
 
+func TestDiskIdentitySerializeJson(t *testing.T) {
+	d := disko.Disk{
+		Name:     "sda",
+		Identity: disko.DiskIdentity{Serial: "S662NE0R712345", WWN: "0x5002538f3312a0b1"},
+	}
+
+	jbytes, err := json.Marshal(&d)
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %s", d, err)
+	}
+
+	jstr := string(jbytes)
+	expected := `"identity":{"serial":"S662NE0R712345","wwn":"0x5002538f3312a0b1"}`
+
+	if !strings.Contains(jstr, expected) {
+		t.Errorf("Did not find %s in json: %s", expected, jstr)
+	}
+
+	found := disko.Disk{}
+	if err := json.Unmarshal(jbytes, &found); err != nil {
+		t.Fatalf("Failed to unmarshal %s: %s", jstr, err)
+	}
+
+	if found.Identity.Serial != d.Identity.Serial || found.Identity.WWN != d.Identity.WWN {
+		t.Errorf("Identity %v did not round trip, got %v", d.Identity, found.Identity)
+	}
+
+	if found.Identity.IsEmpty() || !(disko.DiskIdentity{}).IsEmpty() {
+		t.Errorf("IsEmpty is wrong")
+	}
+}
+
 func compareDisk(a *disko.Disk, b *disko.Disk) bool {
 	return (a.Name == b.Name &&
 		a.Path == b.Path &&
@@ -394,3 +706,23 @@ func TestMarshalProperties(t *testing.T) {
 		}
 	}
 }
+
+func TestDiskInUse(t *testing.T) {
+	d := disko.Disk{Name: "sda", Partitions: disko.PartitionSet{1: {Number: 1}, 2: {Number: 2}}}
+
+	if d.InUse() {
+		t.Errorf("disk with no usage is in use")
+	}
+
+	d.PartitionUsage = map[uint][]disko.Usage{2: {{Kind: disko.UsageSwap, Target: "/dev/sda2"}}}
+
+	if !d.InUse() || !d.PartitionInUse(2) || d.PartitionInUse(1) {
+		t.Errorf("expected only partition 2 of %v to be in use", d.PartitionUsage)
+	}
+
+	d = disko.Disk{Name: "sdb", Usage: []disko.Usage{{Kind: disko.UsageOpen}}}
+
+	if !d.InUse() {
+		t.Errorf("disk with usage is not in use")
+	}
+}
@@ -0,0 +1,514 @@
+package dryrun
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"machinerun.io/disko"
+	"machinerun.io/disko/layout"
+)
+
+type dryLVM struct {
+	r *Recorder
+}
+
+var endsWithNum = regexp.MustCompile("[0-9]$")
+
+func copyVG(vg disko.VG) disko.VG {
+	lvs := disko.LVSet{}
+	for n, lv := range vg.Volumes {
+		lvs[n] = lv
+	}
+
+	pvs := disko.PVSet{}
+	for n, pv := range vg.PVs {
+		pvs[n] = pv
+	}
+
+	vg.Volumes = lvs
+	vg.PVs = pvs
+
+	return vg
+}
+
+// load reads the lvm state from the real volume manager the first time it
+// is needed.
+func (r *Recorder) load() error {
+	if r.pvs != nil {
+		return nil
+	}
+
+	pvs, vgs := disko.PVSet{}, disko.VGSet{}
+
+	if r.vmgr != nil {
+		var err error
+
+		if pvs, err = r.vmgr.ScanPVs(func(disko.PV) bool { return true }); err != nil {
+			return err
+		}
+
+		if vgs, err = r.vmgr.ScanVGs(func(disko.VG) bool { return true }); err != nil {
+			return err
+		}
+	}
+
+	r.pvs = disko.PVSet{}
+	for n, pv := range pvs {
+		r.pvs[n] = pv
+	}
+
+	r.vgs = disko.VGSet{}
+	for n, vg := range vgs {
+		r.vgs[n] = copyVG(vg)
+	}
+
+	return nil
+}
+
+// deviceSize returns the size of the disk or partition with kernel name
+// kname in the simulated state.
+func (r *Recorder) deviceSize(kname string) (uint64, error) {
+	disks, err := (&drySystem{r}).ScanAllDisks(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, d := range disks {
+		if d.Name == kname {
+			return d.Size, nil
+		}
+
+		sep := ""
+		if endsWithNum.MatchString(d.Name) {
+			sep = "p"
+		}
+
+		for _, p := range d.Partitions {
+			if fmt.Sprintf("%s%s%d", d.Name, sep, p.Number) == kname {
+				return p.Size(), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("block device %s: %w", kname, disko.ErrDiskNotFound)
+}
+
+func (r *Recorder) findLV(vgName, lvName string) (disko.VG, disko.LV, error) {
+	if err := r.load(); err != nil {
+		return disko.VG{}, disko.LV{}, err
+	}
+
+	vg, ok := r.vgs[vgName]
+	if !ok {
+		return disko.VG{}, disko.LV{}, fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
+	}
+
+	lv, ok := vg.Volumes[lvName]
+	if !ok {
+		return disko.VG{}, disko.LV{}, fmt.Errorf("lv %s/%s: %w", vgName, lvName, disko.ErrNotFound)
+	}
+
+	return vg, lv, nil
+}
+
+func (lvm *dryLVM) ScanPVs(filter disko.PVFilter) (disko.PVSet, error) {
+	if err := lvm.r.load(); err != nil {
+		return nil, err
+	}
+
+	pvs := disko.PVSet{}
+
+	for n, pv := range lvm.r.pvs {
+		if filter == nil || filter(pv) {
+			pvs[n] = pv
+		}
+	}
+
+	return pvs, nil
+}
+
+func (lvm *dryLVM) ScanVGs(filter disko.VGFilter) (disko.VGSet, error) {
+	if err := lvm.r.load(); err != nil {
+		return nil, err
+	}
+
+	vgs := disko.VGSet{}
+
+	for n, vg := range lvm.r.vgs {
+		if filter == nil || filter(vg) {
+			vgs[n] = copyVG(vg)
+		}
+	}
+
+	return vgs, nil
+}
+
+func (lvm *dryLVM) CreatePV(name string) (disko.PV, error) {
+	if err := lvm.r.load(); err != nil {
+		return disko.PV{}, err
+	}
+
+	kname := path.Base(name)
+
+	if _, ok := lvm.r.pvs[kname]; ok {
+		return disko.PV{}, fmt.Errorf("pv %s: %w", kname, disko.ErrExists)
+	}
+
+	size, err := lvm.r.deviceSize(kname)
+	if err != nil {
+		return disko.PV{}, err
+	}
+
+	pv := disko.PV{
+		Name:     kname,
+		Path:     path.Join("/dev", kname),
+		Size:     size,
+		FreeSize: size,
+	}
+
+	lvm.r.pvs[kname] = pv
+	lvm.r.record(layout.Operation{Type: layout.OpCreatePV, Device: kname})
+
+	return pv, nil
+}
+
+func (lvm *dryLVM) DeletePV(pv disko.PV) error {
+	if err := lvm.r.load(); err != nil {
+		return err
+	}
+
+	cur, ok := lvm.r.pvs[pv.Name]
+	if !ok {
+		return fmt.Errorf("pv %s: %w", pv.Name, disko.ErrNotFound)
+	}
+
+	if cur.VGName != "" {
+		return fmt.Errorf("pv %s is in use by vg %s: %w", pv.Name, cur.VGName, disko.ErrBusy)
+	}
+
+	delete(lvm.r.pvs, pv.Name)
+	lvm.r.record(layout.Operation{Type: layout.OpDeletePV, Device: pv.Name})
+
+	return nil
+}
+
+func (lvm *dryLVM) HasPV(name string) bool {
+	if err := lvm.r.load(); err != nil {
+		return false
+	}
+
+	_, ok := lvm.r.pvs[path.Base(name)]
+
+	return ok
+}
+
+// addPVs moves the pvs into vg.
+func (r *Recorder) addPVs(vg *disko.VG, pvs []disko.PV) error {
+	for _, pv := range pvs {
+		cur, ok := r.pvs[pv.Name]
+		if !ok {
+			return fmt.Errorf("pv %s: %w", pv.Name, disko.ErrNotFound)
+		}
+
+		if cur.VGName != "" {
+			return fmt.Errorf("pv %s already in use by vg %s: %w", pv.Name, cur.VGName, disko.ErrBusy)
+		}
+	}
+
+	for _, pv := range pvs {
+		cur := r.pvs[pv.Name]
+		cur.VGName = vg.Name
+		r.pvs[pv.Name] = cur
+
+		vg.PVs[cur.Name] = cur
+		vg.Size += cur.Size
+		vg.FreeSpace += cur.FreeSize
+	}
+
+	return nil
+}
+
+func pvNames(pvs []disko.PV) []string {
+	names := make([]string, 0, len(pvs))
+	for _, pv := range pvs {
+		names = append(names, pv.Name)
+	}
+
+	return names
+}
+
+func (lvm *dryLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
+	if err := lvm.r.load(); err != nil {
+		return disko.VG{}, err
+	}
+
+	if _, ok := lvm.r.vgs[name]; ok {
+		return disko.VG{}, fmt.Errorf("vg %s: %w", name, disko.ErrExists)
+	}
+
+	vg := disko.VG{
+		Name:    name,
+		Volumes: disko.LVSet{},
+		PVs:     disko.PVSet{},
+	}
+
+	if err := lvm.r.addPVs(&vg, pvs); err != nil {
+		return disko.VG{}, err
+	}
+
+	lvm.r.vgs[name] = vg
+	lvm.r.record(layout.Operation{Type: layout.OpCreateVG, VG: name, PVs: pvNames(pvs)})
+
+	return copyVG(vg), nil
+}
+
+func (lvm *dryLVM) ExtendVG(vgName string, pvs ...disko.PV) error {
+	if err := lvm.r.load(); err != nil {
+		return err
+	}
+
+	vg, ok := lvm.r.vgs[vgName]
+	if !ok {
+		return fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
+	}
+
+	if err := lvm.r.addPVs(&vg, pvs); err != nil {
+		return err
+	}
+
+	lvm.r.vgs[vgName] = vg
+	lvm.r.record(layout.Operation{Type: layout.OpExtendVG, VG: vgName, PVs: pvNames(pvs)})
+
+	return nil
+}
+
+func (lvm *dryLVM) RemoveVG(vgName string) error {
+	if err := lvm.r.load(); err != nil {
+		return err
+	}
+
+	vg, ok := lvm.r.vgs[vgName]
+	if !ok {
+		return fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
+	}
+
+	for n := range vg.PVs {
+		pv := lvm.r.pvs[n]
+		pv.VGName = ""
+		pv.FreeSize = pv.Size
+		lvm.r.pvs[n] = pv
+	}
+
+	delete(lvm.r.vgs, vgName)
+	lvm.r.record(layout.Operation{Type: layout.OpRemoveVG, VG: vgName})
+
+	return nil
+}
+
+func (lvm *dryLVM) HasVG(vgName string) bool {
+	if err := lvm.r.load(); err != nil {
+		return false
+	}
+
+	_, ok := lvm.r.vgs[vgName]
+
+	return ok
+}
+
+func (lvm *dryLVM) CryptFormat(vgName string, lvName string, key string) error {
+	vg, lv, err := lvm.r.findLV(vgName, lvName)
+	if err != nil {
+		return err
+	}
+
+	lv.Encrypted = true
+	vg.Volumes[lvName] = lv
+
+	lvm.r.record(layout.Operation{Type: layout.OpCryptFormat, VG: vgName, LV: lvName, Key: key})
+
+	return nil
+}
+
+func (lvm *dryLVM) CryptOpen(vgName string, lvName string, decryptedName string, key string) error {
+	vg, lv, err := lvm.r.findLV(vgName, lvName)
+	if err != nil {
+		return err
+	}
+
+	if !lv.Encrypted {
+		return fmt.Errorf("lv %s/%s is not encrypted", vgName, lvName)
+	}
+
+	lv.DecryptedLVName = decryptedName
+	lv.DecryptedLVPath = path.Join("/dev/mapper", decryptedName)
+	vg.Volumes[lvName] = lv
+
+	lvm.r.record(layout.Operation{
+		Type: layout.OpCryptOpen, VG: vgName, LV: lvName, DecryptedName: decryptedName, Key: key})
+
+	return nil
+}
+
+func (lvm *dryLVM) CryptClose(vgName string, lvName string, decryptedName string) error {
+	vg, lv, err := lvm.r.findLV(vgName, lvName)
+	if err != nil {
+		return err
+	}
+
+	if lv.DecryptedLVName == "" {
+		return fmt.Errorf("lv %s/%s is not open", vgName, lvName)
+	}
+
+	lv.DecryptedLVName = ""
+	lv.DecryptedLVPath = ""
+	vg.Volumes[lvName] = lv
+
+	lvm.r.record(layout.Operation{
+		Type: layout.OpCryptClose, VG: vgName, LV: lvName, DecryptedName: decryptedName})
+
+	return nil
+}
+
+func (lvm *dryLVM) CreateLV(vgName string, name string, size uint64,
+	lvType disko.LVType) (disko.LV, error) {
+	if err := lvm.r.load(); err != nil {
+		return disko.LV{}, err
+	}
+
+	if size%disko.ExtentSize != 0 {
+		return disko.LV{}, fmt.Errorf("%d is not evenly divisible by extent size %d",
+			size, disko.ExtentSize)
+	}
+
+	// THIN volumes are created in <vgname>/<thinpool>.
+	pool := ""
+
+	if lvType == disko.THIN {
+		toks := strings.SplitN(vgName, "/", 2)
+		if len(toks) != 2 {
+			return disko.LV{},
+				fmt.Errorf("%s: vgName input for THIN LV name in format <vgname>/thinDataName", vgName)
+		}
+
+		vgName, pool = toks[0], toks[1]
+	}
+
+	vg, ok := lvm.r.vgs[vgName]
+	if !ok {
+		return disko.LV{}, fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
+	}
+
+	if _, ok := vg.Volumes[name]; ok {
+		return disko.LV{}, fmt.Errorf("lv %s/%s: %w", vgName, name, disko.ErrExists)
+	}
+
+	if pool != "" {
+		if p, ok := vg.Volumes[pool]; !ok || p.Type != disko.THINPOOL {
+			return disko.LV{}, fmt.Errorf("%s/%s is not a thin pool", vgName, pool)
+		}
+	} else {
+		// thin volumes take their space from the pool, not the vg.
+		if vg.FreeSpace < size {
+			return disko.LV{}, fmt.Errorf("vg %s: %w (%d < %d)",
+				vgName, disko.ErrNoSpace, vg.FreeSpace, size)
+		}
+
+		vg.FreeSpace -= size
+	}
+
+	lv := disko.LV{
+		Name:   name,
+		Path:   path.Join("/dev", vgName, name),
+		Size:   size,
+		Type:   lvType,
+		Pool:   pool,
+		VGName: vgName,
+	}
+
+	vg.Volumes[name] = lv
+	lvm.r.vgs[vgName] = vg
+	lvm.r.record(layout.Operation{
+		Type: layout.OpCreateLV, VG: vgName, LV: name, Size: size, LVType: lvType, Pool: pool})
+
+	return lv, nil
+}
+
+func (lvm *dryLVM) RemoveLV(vgName string, lvName string) error {
+	vg, lv, err := lvm.r.findLV(vgName, lvName)
+	if err != nil {
+		return err
+	}
+
+	delete(vg.Volumes, lvName)
+
+	if lv.Type != disko.THIN {
+		vg.FreeSpace += lv.Size
+	}
+
+	lvm.r.vgs[vgName] = vg
+	lvm.r.record(layout.Operation{Type: layout.OpRemoveLV, VG: vgName, LV: lvName})
+
+	return nil
+}
+
+func (lvm *dryLVM) RenameLV(vgName string, lvName string, newLvName string) error {
+	vg, lv, err := lvm.r.findLV(vgName, lvName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := vg.Volumes[newLvName]; ok {
+		return fmt.Errorf("lv %s/%s: %w", vgName, newLvName, disko.ErrExists)
+	}
+
+	delete(vg.Volumes, lvName)
+
+	lv.Name = newLvName
+	lv.Path = path.Join("/dev", vgName, newLvName)
+	vg.Volumes[newLvName] = lv
+
+	lvm.r.record(layout.Operation{Type: layout.OpRenameLV, VG: vgName, LV: lvName, NewLV: newLvName})
+
+	return nil
+}
+
+func (lvm *dryLVM) ExtendLV(vgName string, lvName string, newSize uint64) error {
+	vg, lv, err := lvm.r.findLV(vgName, lvName)
+	if err != nil {
+		return err
+	}
+
+	if newSize%disko.ExtentSize != 0 {
+		return fmt.Errorf("%d is not evenly divisible by extent size %d",
+			newSize, disko.ExtentSize)
+	}
+
+	if newSize < lv.Size {
+		return fmt.Errorf("lv %s/%s cannot be reduced from %d to %d", vgName, lvName, lv.Size, newSize)
+	}
+
+	delta := newSize - lv.Size
+
+	if lv.Type != disko.THIN {
+		if vg.FreeSpace < delta {
+			return fmt.Errorf("vg %s: %w (%d < %d)", vgName, disko.ErrNoSpace, vg.FreeSpace, delta)
+		}
+
+		vg.FreeSpace -= delta
+	}
+
+	lv.Size = newSize
+	vg.Volumes[lvName] = lv
+	lvm.r.vgs[vgName] = vg
+	lvm.r.record(layout.Operation{
+		Type: layout.OpExtendLV, VG: vgName, LV: lvName, Size: newSize, LVType: lv.Type})
+
+	return nil
+}
+
+func (lvm *dryLVM) HasLV(vgName string, name string) bool {
+	_, _, err := lvm.r.findLV(vgName, name)
+	return err == nil
+}
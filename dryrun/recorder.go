@@ -0,0 +1,77 @@
+// Package dryrun - disko.System and disko.VolumeManager implementations that
+// record mutations instead of performing them.
+//
+// A Recorder reads the initial state of the disks and volumes from a real
+// backend and then applies every requested change to an in memory copy of
+// that state. Scans through the Recorder return the simulated state, so code
+// that mutates and re-scans behaves as it would against the real backend.
+// The recorded operations can be serialized to JSON and replayed against a
+// real backend with layout.Plan.Apply.
+package dryrun
+
+import (
+	"machinerun.io/disko"
+	"machinerun.io/disko/layout"
+)
+
+// Recorder simulates changes to a system and records them as operations.
+type Recorder struct {
+	sys  disko.System
+	vmgr disko.VolumeManager
+
+	// disks are the disks that have been changed, by name.
+	disks disko.DiskSet
+
+	// pvs and vgs are the simulated lvm state, loaded from vmgr on first use.
+	pvs disko.PVSet
+	vgs disko.VGSet
+
+	ops []layout.Operation
+}
+
+// New returns a Recorder reading its initial state from sys and vmgr.
+// vmgr may be nil if no volume manager operations will be requested.
+func New(sys disko.System, vmgr disko.VolumeManager) *Recorder {
+	return &Recorder{
+		sys:   sys,
+		vmgr:  vmgr,
+		disks: disko.DiskSet{},
+	}
+}
+
+// System returns a disko.System that records its mutations in the Recorder.
+func (r *Recorder) System() disko.System {
+	return &drySystem{r}
+}
+
+// VolumeManager returns a disko.VolumeManager that records its mutations in
+// the Recorder.
+func (r *Recorder) VolumeManager() disko.VolumeManager {
+	return &dryLVM{r}
+}
+
+// Operations returns the operations recorded so far, in order.
+func (r *Recorder) Operations() []layout.Operation {
+	ops := make([]layout.Operation, len(r.ops))
+	copy(ops, r.ops)
+
+	return ops
+}
+
+// Plan returns the operations recorded so far as a layout.Plan, which can
+// be serialized and applied to a real backend.
+func (r *Recorder) Plan() layout.Plan {
+	return layout.Plan{Operations: r.Operations()}
+}
+
+// Reset discards the recorded operations and the simulated state.
+func (r *Recorder) Reset() {
+	r.disks = disko.DiskSet{}
+	r.pvs = nil
+	r.vgs = nil
+	r.ops = nil
+}
+
+func (r *Recorder) record(op layout.Operation) {
+	r.ops = append(r.ops, op)
+}
@@ -0,0 +1,352 @@
+package dryrun_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/dryrun"
+	"machinerun.io/disko/layout"
+	"machinerun.io/disko/mockos"
+	"machinerun.io/disko/partid"
+)
+
+const spec = `{
+  "disks": [{
+    "id": "a", "path": "/dev/sda",
+    "partitions": [
+      {"name": "efi", "type": "EFI", "size": 536870912},
+      {"name": "data", "type": "LVM"}
+    ]
+  }],
+  "vgs": [{
+    "name": "vg0", "pvs": ["a:data"],
+    "lvs": [
+      {"name": "pool", "type": "THINPOOL", "size": 10737418240},
+      {"name": "thin", "type": "THIN", "pool": "pool", "size": 4194304},
+      {"name": "root", "type": "THICK", "size": 4194304, "encrypt": true, "key": "k", "decryptedName": "root_crypt"}
+    ]
+  }]
+}`
+
+func mockSystem(t *testing.T) disko.System {
+	t.Helper()
+
+	sys, err := mockos.System("testdata/sys.json")
+	if err != nil {
+		t.Fatalf("failed to load mock system: %s", err)
+	}
+
+	return sys
+}
+
+func opTypes(ops []layout.Operation) []layout.OpType {
+	types := []layout.OpType{}
+	for _, op := range ops {
+		types = append(types, op.Type)
+	}
+
+	return types
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	vmgr := mockos.LVM(sys)
+
+	s, err := layout.Parse([]byte(spec))
+	if !ast.Nil(err) {
+		return
+	}
+
+	plan, err := layout.NewPlan(sys, vmgr, s)
+	if !ast.Nil(err) {
+		return
+	}
+
+	rec := dryrun.New(sys, vmgr)
+	if !ast.Nil(plan.Apply(rec.System(), rec.VolumeManager())) {
+		return
+	}
+
+	ast.Equal(opTypes(plan.Operations), opTypes(rec.Operations()))
+
+	// The dry run sees the simulated state...
+	disk, err := rec.System().ScanDisk("/dev/sda")
+	ast.Nil(err)
+	ast.Equal(disko.GPT, disk.Table)
+	ast.Len(disk.Partitions, 2)
+
+	vgs, err := rec.VolumeManager().ScanVGs(nil)
+	ast.Nil(err)
+	ast.Len(vgs["vg0"].Volumes, 3)
+	ast.Equal(vgs["vg0"].Size-10*1024*disko.Mebibyte-disko.ExtentSize, vgs["vg0"].FreeSpace)
+	ast.Equal("root_crypt", vgs["vg0"].Volumes["root"].DecryptedLVName)
+
+	// ... and the real backend was not touched.
+	disk, err = sys.ScanDisk("/dev/sda")
+	ast.Nil(err)
+	ast.Len(disk.Partitions, 0)
+	ast.False(vmgr.HasVG("vg0"))
+
+	// Replaying the serialized operations gives the same result.
+	data, err := json.Marshal(rec.Plan())
+	ast.Nil(err)
+
+	replay := layout.Plan{}
+	ast.Nil(json.Unmarshal(data, &replay))
+	ast.Equal(rec.Plan(), replay)
+
+	if !ast.Nil(replay.Apply(sys, vmgr)) {
+		return
+	}
+
+	disk, err = sys.ScanDisk("/dev/sda")
+	ast.Nil(err)
+	ast.Len(disk.Partitions, 2)
+	ast.True(vmgr.HasLV("vg0", "thin"))
+
+	plan, err = layout.NewPlan(sys, vmgr, s)
+	ast.Nil(err)
+	ast.True(plan.IsEmpty(), "unexpected operations: %s", plan)
+}
+
+func TestSimulatedErrors(t *testing.T) {
+	ast := assert.New(t)
+
+	rec := dryrun.New(mockSystem(t), nil)
+	sys := rec.System()
+	vmgr := rec.VolumeManager()
+
+	disk, err := sys.ScanDisk("/dev/sdb")
+	ast.Nil(err)
+
+	p1 := disko.Partition{Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxLVM}
+	ast.Nil(sys.CreatePartition(disk, p1))
+
+	// overlapping, duplicate and out of range partitions fail.
+	ast.ErrorIs(sys.CreatePartition(disk,
+		disko.Partition{Number: 2, Start: 50 * disko.Mebibyte, Last: 200*disko.Mebibyte - 1}), disko.ErrOverlap)
+	ast.ErrorIs(sys.CreatePartition(disk,
+		disko.Partition{Number: 1, Start: 200 * disko.Mebibyte, Last: 300*disko.Mebibyte - 1}), disko.ErrPartitionExists)
+	ast.ErrorIs(sys.CreatePartition(disk,
+		disko.Partition{Number: 3, Start: 0, Last: disko.Mebibyte - 1}), disko.ErrOutOfRange)
+	ast.ErrorIs(sys.DeletePartition(disk, 5), disko.ErrPartitionNotFound)
+
+	_, err = vmgr.CreatePV("sdb2")
+	ast.ErrorIs(err, disko.ErrDiskNotFound)
+
+	pv, err := vmgr.CreatePV("/dev/sdb1")
+	ast.Nil(err)
+	ast.Equal(p1.Size(), pv.Size)
+
+	_, err = vmgr.CreateVG("vg0", pv)
+	ast.Nil(err)
+
+	_, err = vmgr.CreateLV("vg0", "big", 200*disko.Mebibyte, disko.THICK)
+	ast.ErrorIs(err, disko.ErrNoSpace)
+
+	_, err = vmgr.CreateLV("vg0", "odd", disko.Mebibyte, disko.THICK)
+	ast.NotNil(err)
+
+	_, err = vmgr.CreateLV("vg0", "lv0", disko.ExtentSize, disko.THICK)
+	ast.Nil(err)
+
+	ast.Nil(vmgr.RenameLV("vg0", "lv0", "lv1"))
+	ast.False(vmgr.HasLV("vg0", "lv0"))
+	ast.True(vmgr.HasLV("vg0", "lv1"))
+	ast.NotNil(vmgr.ExtendLV("vg0", "lv1", 0))
+	ast.ErrorIs(vmgr.DeletePV(pv), disko.ErrBusy)
+
+	ast.Nil(vmgr.RemoveVG("vg0"))
+	ast.Nil(vmgr.DeletePV(pv))
+
+	ast.Nil(sys.ResizePartition(disk, 1, 200*disko.Mebibyte-1))
+	ast.ErrorIs(sys.ResizePartition(disk, 1, disk.Size), disko.ErrOutOfRange)
+	ast.ErrorIs(sys.ResizePartition(disk, 2, disk.Size), disko.ErrPartitionNotFound)
+
+	ast.Nil(sys.DeletePartition(disk, 1))
+	ast.Nil(sys.Wipe(disk))
+
+	ast.Equal(
+		[]layout.OpType{
+			layout.OpCreatePartitions, layout.OpCreatePV, layout.OpCreateVG, layout.OpCreateLV,
+			layout.OpRenameLV, layout.OpRemoveVG, layout.OpDeletePV, layout.OpResizePartition,
+			layout.OpDeletePartition, layout.OpWipe,
+		}, opTypes(rec.Operations()))
+
+	rec.Reset()
+	ast.Empty(rec.Operations())
+
+	disk, err = sys.ScanDisk("/dev/sdb")
+	ast.Nil(err)
+	ast.Equal(disko.TableNone, disk.Table)
+}
+
+func TestRecordDiskGUID(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	rec := dryrun.New(sys, nil)
+
+	disk, err := rec.System().ScanDisk("/dev/sdb")
+	if !ast.Nil(err) {
+		return
+	}
+
+	myGUID := disko.GenGUID()
+	disk.GPT.DiskGUID = myGUID
+
+	ast.Nil(rec.System().CreatePartition(disk,
+		disko.Partition{Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS}))
+
+	newGUID := disko.GenGUID()
+	ast.Nil(rec.System().SetDiskGUID(disk, newGUID))
+
+	ops := rec.Operations()
+	if ast.Len(ops, 2) {
+		ast.Equal(myGUID.String(), ops[0].DiskGUID)
+		ast.Equal(layout.OpSetDiskGUID, ops[1].Type)
+		ast.Equal("set-disk-guid /dev/sdb "+newGUID.String(), ops[1].String())
+	}
+
+	// Replaying sets the same guids on the real backend.
+	ast.Nil(rec.Plan().Apply(sys, nil))
+
+	disk, err = sys.ScanDisk("/dev/sdb")
+	if ast.Nil(err) {
+		ast.Equal(newGUID, disk.GPT.DiskGUID)
+	}
+}
+
+func TestRecordSetPartitionAttributes(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	rec := dryrun.New(sys, nil)
+
+	disk, err := rec.System().ScanDisk("/dev/sdb")
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.ErrorIs(rec.System().SetPartitionAttributes(disk, 1, disko.AttrNoAuto), disko.ErrUnsupportedTable)
+
+	ast.Nil(rec.System().CreatePartition(disk, disko.Partition{Number: 1, Start: disko.Mebibyte,
+		Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS, Attributes: disko.AttrRequired}))
+	ast.Nil(rec.System().SetPartitionAttributes(disk, 1, disko.AttrNoAuto|disko.AttrGrowFS))
+	ast.Nil(rec.System().SetPartitionAttributes(disk, 1, 0))
+
+	ops := rec.Operations()
+	if ast.Len(ops, 3) {
+		ast.Equal("set-partition-attributes /dev/sdb 1 grow-fs,no-auto", ops[1].String())
+		ast.Equal("set-partition-attributes /dev/sdb 1", ops[2].String())
+	}
+
+	ast.Nil(rec.Plan().Apply(sys, nil))
+
+	disk, err = sys.ScanDisk("/dev/sdb")
+	if ast.Nil(err) {
+		ast.Equal(disko.PartAttrs(0), disk.Partitions[1].Attributes)
+	}
+}
+
+func TestRecordRelocateBackupGPT(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	rec := dryrun.New(sys, nil)
+
+	disk, err := rec.System().ScanDisk("/dev/sdb")
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.ErrorIs(rec.System().RelocateBackupGPT(disk), disko.ErrUnsupportedTable)
+
+	ast.Nil(rec.System().CreatePartition(disk,
+		disko.Partition{Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS}))
+	ast.Nil(rec.System().RelocateBackupGPT(disk))
+
+	ops := rec.Operations()
+	if ast.Len(ops, 2) {
+		ast.Equal("relocate-backup-gpt /dev/sdb", ops[1].String())
+	}
+
+	ast.Nil(rec.Plan().Apply(sys, nil))
+}
+
+func TestRecordRepairPartitionTable(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	rec := dryrun.New(sys, nil)
+
+	disk, err := rec.System().ScanDisk("/dev/sdb")
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.ErrorIs(rec.System().RepairPartitionTable(disk), disko.ErrUnsupportedTable)
+
+	ast.Nil(rec.System().CreatePartition(disk,
+		disko.Partition{Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS}))
+	ast.Nil(rec.System().RepairPartitionTable(disk))
+
+	ops := rec.Operations()
+	if ast.Len(ops, 2) {
+		ast.Equal("repair-partition-table /dev/sdb", ops[1].String())
+	}
+
+	ast.Nil(rec.Plan().Apply(sys, nil))
+}
+
+func TestRecordRestorePartitionTable(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	rec := dryrun.New(sys, nil)
+
+	disk, err := rec.System().ScanDisk("/dev/sdb")
+	if !ast.Nil(err) {
+		return
+	}
+
+	head := make([]byte, 34*512)
+	head[0x1FE], head[0x1FF] = 0x55, 0xAA
+
+	backup := disko.TableBackup{
+		Disk: disk.Path, Size: disk.Size, SectorSize: 512, Table: disko.GPT, DiskGUID: disko.GenGUID().String(),
+		Partitions: disko.PartitionSet{
+			1: {Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS}},
+		Head: head,
+	}
+
+	ast.Nil(rec.System().RestorePartitionTable(disk, backup))
+
+	ops := rec.Operations()
+	if ast.Len(ops, 1) {
+		ast.Equal("restore-partition-table /dev/sdb 1( 1048576-104857599)", ops[0].String())
+	}
+
+	// the backup goes through the plan's json.
+	content, err := json.Marshal(rec.Plan())
+	if !ast.Nil(err) {
+		return
+	}
+
+	plan := layout.Plan{}
+	if !ast.Nil(json.Unmarshal(content, &plan)) {
+		return
+	}
+
+	ast.Nil(plan.Apply(sys, nil))
+
+	disk, err = sys.ScanDisk("/dev/sdb")
+	if ast.Nil(err) {
+		ast.Equal(backup.Partitions, disk.Partitions)
+		ast.Equal(backup.DiskGUID, disk.GPT.DiskGUID.String())
+	}
+}
@@ -0,0 +1,426 @@
+package dryrun
+
+import (
+	"fmt"
+
+	"machinerun.io/disko"
+	"machinerun.io/disko/layout"
+)
+
+type drySystem struct {
+	r *Recorder
+}
+
+func acceptAll(d disko.Disk) bool {
+	return true
+}
+
+// copyDisk returns d with its own copy of the partitions.
+func copyDisk(d disko.Disk) disko.Disk {
+	parts := disko.PartitionSet{}
+	for n, p := range d.Partitions {
+		parts[n] = p
+	}
+
+	d.Partitions = parts
+
+	return d
+}
+
+// disk returns the simulated state of d.
+func (r *Recorder) disk(d disko.Disk) (disko.Disk, error) {
+	if disk, ok := r.disks[d.Name]; ok {
+		return copyDisk(disk), nil
+	}
+
+	disk, err := r.sys.ScanDisk(d.Path)
+	if err != nil {
+		return disko.Disk{}, err
+	}
+
+	return copyDisk(disk), nil
+}
+
+func (ds *drySystem) ScanAllDisks(filter disko.DiskFilter) (disko.DiskSet, error) {
+	disks, err := ds.r.sys.ScanAllDisks(acceptAll)
+	if err != nil {
+		return nil, err
+	}
+
+	found := disko.DiskSet{}
+
+	for n, d := range disks {
+		if sim, ok := ds.r.disks[n]; ok {
+			d = sim
+		}
+
+		d = copyDisk(d)
+
+		if filter == nil || filter(d) {
+			found[n] = d
+		}
+	}
+
+	return found, nil
+}
+
+func (ds *drySystem) ScanDisks(filter disko.DiskFilter, paths ...string) (disko.DiskSet, error) {
+	found := disko.DiskSet{}
+
+	for _, p := range paths {
+		d, err := ds.ScanDisk(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if filter == nil || filter(d) {
+			found[d.Name] = d
+		}
+	}
+
+	return found, nil
+}
+
+func (ds *drySystem) ScanDisk(path string) (disko.Disk, error) {
+	for _, d := range ds.r.disks {
+		if d.Path == path {
+			return copyDisk(d), nil
+		}
+	}
+
+	d, err := ds.r.sys.ScanDisk(path)
+	if err != nil {
+		return disko.Disk{}, err
+	}
+
+	return copyDisk(d), nil
+}
+
+func (ds *drySystem) CreatePartition(d disko.Disk, p disko.Partition) error {
+	return ds.CreatePartitions(d, disko.PartitionSet{p.Number: p})
+}
+
+func (ds *drySystem) CreatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table != disko.MBR && disk.Table != disko.GPT && disk.Table != disko.TableNone {
+		return fmt.Errorf("cannot add partition disk %s with table type %s: %w",
+			disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	// A disk without a table gets the table asked for by the caller, GPT
+	// unless that is MBR.
+	newTable := disk.Table == disko.TableNone
+	if newTable {
+		disk.Table = disko.GPT
+		if d.Table == disko.MBR {
+			disk.Table = disko.MBR
+		} else {
+			disk.GPT.DiskGUID = d.GPT.DiskGUID
+		}
+	}
+
+	if err := disk.CheckPartitionRanges(pSet); err != nil {
+		return err
+	}
+
+	for _, p := range pSet {
+		if _, ok := disk.Partitions[p.Number]; ok {
+			return &disko.PartitionError{Disk: disk.Path, Number: p.Number, Err: disko.ErrPartitionExists}
+		}
+
+		if err := disk.CheckPartitionOverlap(p); err != nil {
+			return err
+		}
+
+		disk.Partitions[p.Number] = p
+	}
+
+	op := layout.Operation{
+		Type:       layout.OpCreatePartitions,
+		Disk:       disk.Path,
+		Table:      disk.Table,
+		Partitions: copyPartitions(pSet),
+	}
+
+	if newTable && disk.GPT.DiskGUID != (disko.GUID{}) {
+		op.DiskGUID = disk.GPT.DiskGUID.String()
+	}
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(op)
+
+	return nil
+}
+
+func (ds *drySystem) UpdatePartition(d disko.Disk, p disko.Partition) error {
+	return ds.UpdatePartitions(d, disko.PartitionSet{p.Number: p})
+}
+
+func (ds *drySystem) UpdatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table == disko.TableNone {
+		return fmt.Errorf("cannot update partitions on disk %s: it has no partition table: %w",
+			disk.Name, disko.ErrUnsupportedTable)
+	}
+
+	for n, p := range pSet {
+		cur, ok := disk.Partitions[n]
+		if !ok {
+			return &disko.PartitionError{Disk: disk.Path, Number: n, Err: disko.ErrPartitionNotFound,
+				Detail: "cannot update"}
+		}
+
+		// Only the GUID, Type, Name and Attributes get updated.
+		if p.ID != (disko.GUID{}) {
+			cur.ID = p.ID
+		}
+
+		if p.Type != (disko.PartType{}) {
+			cur.Type = p.Type
+		}
+
+		if p.Name != "" {
+			cur.Name = p.Name
+		}
+
+		if p.Attributes != 0 {
+			cur.Attributes = p.Attributes
+		}
+
+		disk.Partitions[n] = cur
+	}
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{
+		Type:       layout.OpUpdatePartitions,
+		Disk:       disk.Path,
+		Partitions: copyPartitions(pSet),
+	})
+
+	return nil
+}
+
+func (ds *drySystem) SetPartitionAttributes(d disko.Disk, number uint, attrs disko.PartAttrs) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot set attributes of partition %d on disk %s: partition table '%s': %w",
+			number, disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	p, ok := disk.Partitions[number]
+	if !ok {
+		return &disko.PartitionError{Disk: disk.Path, Number: number, Err: disko.ErrPartitionNotFound,
+			Detail: "cannot set attributes"}
+	}
+
+	p.Attributes = attrs
+	disk.Partitions[number] = p
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{
+		Type:       layout.OpSetPartitionAttributes,
+		Disk:       disk.Path,
+		Number:     number,
+		Attributes: attrs,
+	})
+
+	return nil
+}
+
+func (ds *drySystem) DeletePartition(d disko.Disk, number uint) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := disk.Partitions[number]; !ok {
+		return &disko.PartitionError{Disk: disk.Path, Number: number, Err: disko.ErrPartitionNotFound}
+	}
+
+	delete(disk.Partitions, number)
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{Type: layout.OpDeletePartition, Disk: disk.Path, Number: number})
+
+	return nil
+}
+
+func (ds *drySystem) ResizePartition(d disko.Disk, number uint, last uint64) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot resize partition %d on disk %s: partition table '%s': %w",
+			number, disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	p, ok := disk.Partitions[number]
+	if !ok {
+		return &disko.PartitionError{Disk: disk.Path, Number: number, Err: disko.ErrPartitionNotFound,
+			Detail: "cannot resize"}
+	}
+
+	p.Last = last
+
+	if err := disk.CheckPartitionResize(p); err != nil {
+		return err
+	}
+
+	if err := disk.CheckPartitionOverlap(p); err != nil {
+		return err
+	}
+
+	disk.Partitions[number] = p
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{
+		Type:       layout.OpResizePartition,
+		Disk:       disk.Path,
+		Partitions: disko.PartitionSet{number: p},
+	})
+
+	return nil
+}
+
+func (ds *drySystem) SetDiskGUID(d disko.Disk, id disko.GUID) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot set the guid of disk %s: partition table '%s': %w",
+			disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	// a zero id is left for the real system to pick.
+	disk.GPT.DiskGUID = id
+
+	op := layout.Operation{Type: layout.OpSetDiskGUID, Disk: disk.Path}
+	if id != (disko.GUID{}) {
+		op.DiskGUID = id.String()
+	}
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(op)
+
+	return nil
+}
+
+func (ds *drySystem) RelocateBackupGPT(d disko.Disk) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot relocate the backup GPT of disk %s: partition table '%s': %w",
+			disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	disk.GPT.LastUsableLBA = disk.RelocatedLastUsableLBA()
+
+	problems := []disko.TableProblem{}
+
+	for _, p := range disk.TableProblems {
+		if p.Kind != disko.ProblemBackupLocation {
+			problems = append(problems, p)
+		}
+	}
+
+	disk.TableProblems = problems
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{Type: layout.OpRelocateBackupGPT, Disk: disk.Path})
+
+	return nil
+}
+
+func (ds *drySystem) RepairPartitionTable(d disko.Disk) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("disk %s has no GPT to repair: %w", disk.Name, disko.ErrUnsupportedTable)
+	}
+
+	problems, err := disk.ProblemsAfterRepair()
+	if err != nil {
+		return err
+	}
+
+	// the repaired backup is at the end of the disk.
+	disk.GPT.LastUsableLBA = disk.RelocatedLastUsableLBA()
+	disk.TableProblems = problems
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{Type: layout.OpRepairPartitionTable, Disk: disk.Path})
+
+	return nil
+}
+
+func (ds *drySystem) RestorePartitionTable(d disko.Disk, b disko.TableBackup) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Check(disk); err != nil {
+		return err
+	}
+
+	if disk, err = b.RestoredDisk(disk); err != nil {
+		return err
+	}
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{
+		Type:       layout.OpRestorePartitionTable,
+		Disk:       disk.Path,
+		Partitions: copyPartitions(b.Partitions),
+		Backup:     &b,
+	})
+
+	return nil
+}
+
+func (ds *drySystem) Wipe(d disko.Disk) error {
+	disk, err := ds.r.disk(d)
+	if err != nil {
+		return err
+	}
+
+	disk.Table = disko.TableNone
+	disk.GPT = disko.GPTHeader{}
+	disk.Partitions = disko.PartitionSet{}
+
+	ds.r.disks[disk.Name] = disk
+	ds.r.record(layout.Operation{Type: layout.OpWipe, Disk: disk.Path})
+
+	return nil
+}
+
+func copyPartitions(pSet disko.PartitionSet) disko.PartitionSet {
+	parts := disko.PartitionSet{}
+	for n, p := range pSet {
+		parts[n] = p
+	}
+
+	return parts
+}
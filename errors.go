@@ -0,0 +1,225 @@
+package disko
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrDiskNotFound is returned when a disk does not exist.
+	ErrDiskNotFound = errors.New("disk not found")
+
+	// ErrPartitionExists is returned when creating a partition with a
+	// number that is already in use.
+	ErrPartitionExists = errors.New("partition already exists")
+
+	// ErrPartitionNotFound is returned when operating on a partition that
+	// does not exist.
+	ErrPartitionNotFound = errors.New("partition does not exist")
+
+	// ErrOutOfRange is returned when a partition number, start or end is
+	// outside of what the disk or its partition table allows.
+	ErrOutOfRange = errors.New("out of range")
+
+	// ErrOverlap is returned when a partition overlaps an existing one.
+	ErrOverlap = errors.New("overlaps existing partition")
+
+	// ErrUnsupportedTable is returned for an operation that is not supported
+	// by the disk's partition table type.
+	ErrUnsupportedTable = errors.New("unsupported partition table")
+
+	// ErrBusy is returned when a device or volume is in use.
+	ErrBusy = errors.New("device or resource busy")
+
+	// ErrToolMissing is returned when a required command is not installed.
+	ErrToolMissing = errors.New("required tool is not installed")
+
+	// ErrExists is returned when creating a pv, vg or lv that already exists.
+	ErrExists = errors.New("already exists")
+
+	// ErrNotFound is returned when a pv, vg or lv does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNoSpace is returned when a disk or volume group does not have
+	// enough free space for a request.
+	ErrNoSpace = errors.New("not enough free space")
+
+	// ErrNoMedium is returned when scanning a removable disk with no medium,
+	// such as an empty card reader.
+	ErrNoMedium = errors.New("no medium found")
+
+	// ErrBadPartitionTable is returned when a disk's partition table cannot
+	// be read.
+	ErrBadPartitionTable = errors.New("unreadable partition table")
+
+	// ErrRAIDController is returned when the RAID controller of a disk
+	// cannot be queried.
+	ErrRAIDController = errors.New("raid controller query failed")
+
+	// ErrInUse is returned when a destructive operation is refused because
+	// the disk or partition is mounted, swap, held by another device or
+	// otherwise open.
+	ErrInUse = errors.New("in use")
+
+	// ErrReadOnly is returned when a write to a read only disk is refused.
+	ErrReadOnly = errors.New("read only")
+
+	// ErrStaleDisk is returned when the disk passed to an operation no
+	// longer matches what is on the disk, because it was scanned before
+	// something else changed it.
+	ErrStaleDisk = errors.New("disk changed since it was scanned")
+
+	// ErrUnsupportedFS is returned for an operation on a device with no
+	// filesystem, or a filesystem the operation does not support.
+	ErrUnsupportedFS = errors.New("unsupported filesystem")
+
+	// ErrCorruptFS is returned when checking a filesystem finds errors.
+	ErrCorruptFS = errors.New("filesystem has errors")
+
+	// ErrNotMounted is returned for an operation that needs the filesystem
+	// to be mounted, such as growing xfs.
+	ErrNotMounted = errors.New("not mounted")
+
+	// ErrSectorSizeMismatch is returned when a disk's partition table was
+	// written for a different sector size than the disk has.
+	ErrSectorSizeMismatch = errors.New("partition table sector size mismatch")
+)
+
+// PartitionError is an error about a single partition of a disk.
+// errors.Is(err, ErrPartitionExists) and friends match on Err.
+type PartitionError struct {
+	// Disk is the path of the disk.
+	Disk string
+
+	// Number is the partition number.
+	Number uint
+
+	// Err is the underlying error, usually one of the Err* values.
+	Err error
+
+	// Detail is an optional explanation of the error.
+	Detail string
+}
+
+func (e *PartitionError) Error() string {
+	msg := fmt.Sprintf("%s partition %d: %s", e.Disk, e.Number, e.Err)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	return msg
+}
+
+func (e *PartitionError) Unwrap() error {
+	return e.Err
+}
+
+// DiskError is an error about an operation on a whole disk.
+// errors.Is(err, ErrInUse) and friends match on Err.
+type DiskError struct {
+	// Disk is the path of the disk.
+	Disk string
+
+	// Op is the operation that failed (Wipe, CreatePartitions...).
+	Op string
+
+	// Err is the underlying error, usually one of the Err* values.
+	Err error
+
+	// Detail is an optional explanation of the error.
+	Detail string
+}
+
+func (e *DiskError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Op, e.Disk, e.Err)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	return msg
+}
+
+func (e *DiskError) Unwrap() error {
+	return e.Err
+}
+
+// CommandError is returned when an external command fails.  It unwraps to
+// ErrToolMissing if the command could not be found and to ErrBusy if the
+// command reported the device as busy.
+type CommandError struct {
+	// Args is the command line that was run.
+	Args []string
+
+	// Stdout is the standard output of the command.
+	Stdout []byte
+
+	// Stderr is the standard error of the command.
+	Stderr []byte
+
+	// RC is the exit code of the command, 127 if it could not be run.
+	RC int
+}
+
+// rcToolMissing is the exit code of a command that was not found.
+const rcToolMissing = 127
+
+func (e *CommandError) Error() string {
+	out, err := e.Stdout, e.Stderr
+
+	if tlen := len(err); tlen == 0 || err[tlen-1] != '\n' {
+		err = append(err[:tlen:tlen], '\n')
+	}
+
+	if tlen := len(out); tlen == 0 || out[tlen-1] != '\n' {
+		out = append(out[:tlen:tlen], '\n')
+	}
+
+	return fmt.Sprintf(
+		"command returned %d:\n cmd: %v\n out: %s err: %s",
+		e.RC, e.Args, out, err)
+}
+
+func (e *CommandError) Unwrap() error {
+	if e.RC == rcToolMissing {
+		return ErrToolMissing
+	}
+
+	if strings.Contains(strings.ToLower(string(e.Stderr)), "busy") {
+		return ErrBusy
+	}
+
+	return nil
+}
+
+// ScanErrors are the errors of the disks that could not be scanned, by
+// path.  It is returned by tolerant scans along with the disks that could.
+// errors.Is(err, ErrNoMedium) and friends match if any of the disks failed
+// with that error.
+type ScanErrors map[string]error
+
+// Paths returns the paths of the disks that failed, sorted.
+func (e ScanErrors) Paths() []string {
+	return sortedKeys(e)
+}
+
+func (e ScanErrors) Error() string {
+	paths := e.Paths()
+	msgs := make([]string, 0, len(paths))
+
+	for _, p := range paths {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", p, e[p]))
+	}
+
+	return fmt.Sprintf("failed to scan %d disks: %s", len(paths), strings.Join(msgs, "; "))
+}
+
+func (e ScanErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+
+	for _, p := range e.Paths() {
+		errs = append(errs, e[p])
+	}
+
+	return errs
+}
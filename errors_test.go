@@ -0,0 +1,108 @@
+package disko_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"machinerun.io/disko"
+)
+
+func TestPartitionErrorIs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w",
+		&disko.PartitionError{Disk: "/dev/sda", Number: 3, Err: disko.ErrPartitionExists})
+
+	if !errors.Is(err, disko.ErrPartitionExists) {
+		t.Errorf("expected %v to be ErrPartitionExists", err)
+	}
+
+	if errors.Is(err, disko.ErrOutOfRange) {
+		t.Errorf("did not expect %v to be ErrOutOfRange", err)
+	}
+
+	var perr *disko.PartitionError
+	if !errors.As(err, &perr) || perr.Number != 3 || perr.Disk != "/dev/sda" {
+		t.Errorf("errors.As gave %#v", perr)
+	}
+
+	expected := "/dev/sda partition 3: partition already exists"
+	if perr.Error() != expected {
+		t.Errorf("Error() gave %q, expected %q", perr.Error(), expected)
+	}
+}
+
+func TestCommandErrorUnwrap(t *testing.T) {
+	values := []struct {
+		err      disko.CommandError
+		expected error
+	}{
+		{disko.CommandError{Args: []string{"sgdisk"}, RC: 127}, disko.ErrToolMissing},
+		{disko.CommandError{Args: []string{"lvm"}, RC: 5, Stderr: []byte("Device or resource busy")}, disko.ErrBusy},
+		{disko.CommandError{Args: []string{"lvm"}, RC: 5, Stderr: []byte("bad thing")}, nil},
+	}
+
+	for _, v := range values {
+		err := v.err
+		found := errors.Unwrap(&err)
+
+		if found != v.expected {
+			t.Errorf("%v unwrapped to %v, expected %v", v.err.Args, found, v.expected)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	var err error = disko.ScanErrors{
+		"/dev/sdc": fmt.Errorf("/dev/sdc: %w", disko.ErrNoMedium),
+		"/dev/sdb": fmt.Errorf("/dev/sdb: %w: bad crc", disko.ErrBadPartitionTable),
+	}
+
+	if !errors.Is(err, disko.ErrNoMedium) || !errors.Is(err, disko.ErrBadPartitionTable) {
+		t.Errorf("expected %v to be ErrNoMedium and ErrBadPartitionTable", err)
+	}
+
+	if errors.Is(err, disko.ErrRAIDController) {
+		t.Errorf("did not expect %v to be ErrRAIDController", err)
+	}
+
+	var serr disko.ScanErrors
+	if !errors.As(fmt.Errorf("wrapped: %w", err), &serr) || len(serr) != 2 {
+		t.Errorf("errors.As gave %#v", serr)
+	}
+
+	expected := ("failed to scan 2 disks: /dev/sdb: /dev/sdb: unreadable partition table: bad crc; " +
+		"/dev/sdc: /dev/sdc: no medium found")
+	if err.Error() != expected {
+		t.Errorf("Error() gave %q, expected %q", err.Error(), expected)
+	}
+}
+
+func TestDiskError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &disko.DiskError{
+		Disk: "/dev/sda", Op: "Wipe", Err: disko.ErrInUse, Detail: "partition 1: mount /boot (ext4)"})
+
+	if !errors.Is(err, disko.ErrInUse) {
+		t.Errorf("expected %v to be ErrInUse", err)
+	}
+
+	if errors.Is(err, disko.ErrStaleDisk) {
+		t.Errorf("did not expect %v to be ErrStaleDisk", err)
+	}
+
+	var derr *disko.DiskError
+	if !errors.As(err, &derr) || derr.Op != "Wipe" || derr.Disk != "/dev/sda" {
+		t.Errorf("errors.As gave %#v", derr)
+	}
+
+	expected := "Wipe /dev/sda: in use: partition 1: mount /boot (ext4)"
+	if derr.Error() != expected {
+		t.Errorf("Error() gave %q, expected %q", derr.Error(), expected)
+	}
+
+	derr = &disko.DiskError{Disk: "/dev/sdb", Op: "CreatePartitions", Err: disko.ErrReadOnly}
+	expected = "CreatePartitions /dev/sdb: read only"
+
+	if derr.Error() != expected {
+		t.Errorf("Error() gave %q, expected %q", derr.Error(), expected)
+	}
+}
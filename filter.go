@@ -0,0 +1,507 @@
+package disko
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// AnyDisk is a DiskFilter that accepts every disk.
+func AnyDisk(d Disk) bool {
+	return true
+}
+
+// And returns a DiskFilter that accepts a disk if all of filters do.
+func And(filters ...DiskFilter) DiskFilter {
+	return func(d Disk) bool {
+		for _, f := range filters {
+			if !f(d) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Or returns a DiskFilter that accepts a disk if any of filters does.
+func Or(filters ...DiskFilter) DiskFilter {
+	return func(d Disk) bool {
+		for _, f := range filters {
+			if f(d) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Not returns a DiskFilter that accepts a disk if filter does not.
+func Not(filter DiskFilter) DiskFilter {
+	return func(d Disk) bool {
+		return !filter(d)
+	}
+}
+
+// SizeBetween returns a DiskFilter that accepts disks of at least min and at
+// most max bytes.  A max of 0 means no upper limit.
+func SizeBetween(min, max uint64) DiskFilter {
+	return func(d Disk) bool {
+		return d.Size >= min && (max == 0 || d.Size <= max)
+	}
+}
+
+// TypeIs returns a DiskFilter that accepts disks of any of types.
+func TypeIs(types ...DiskType) DiskFilter {
+	return func(d Disk) bool {
+		for _, t := range types {
+			if d.Type == t {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// AttachmentIs returns a DiskFilter that accepts disks with any of the
+// attachments.
+func AttachmentIs(attachments ...AttachmentType) DiskFilter {
+	return func(d Disk) bool {
+		for _, a := range attachments {
+			if d.Attachment == a {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// HasProperty returns a DiskFilter that accepts disks with Property p.
+func HasProperty(p Property) DiskFilter {
+	return func(d Disk) bool {
+		return d.Properties[p]
+	}
+}
+
+// HasTable returns a DiskFilter that accepts disks with a partition table.
+func HasTable() DiskFilter {
+	return func(d Disk) bool {
+		return d.Table != TableNone
+	}
+}
+
+// NoPartitions returns a DiskFilter that accepts disks with no partitions.
+func NoPartitions() DiskFilter {
+	return func(d Disk) bool {
+		return len(d.Partitions) == 0
+	}
+}
+
+// IsReadOnly returns a DiskFilter that accepts read-only disks.
+func IsReadOnly() DiskFilter {
+	return func(d Disk) bool {
+		return d.ReadOnly
+	}
+}
+
+// SerialMatches returns a DiskFilter that accepts disks whose serial number
+// matches the shell glob pattern (see path.Match).
+func SerialMatches(pattern string) DiskFilter {
+	return globFilter(pattern, func(d Disk) string { return d.Identity.Serial })
+}
+
+// ModelMatches returns a DiskFilter that accepts disks whose model matches
+// the shell glob pattern (see path.Match).
+func ModelMatches(pattern string) DiskFilter {
+	return globFilter(pattern, func(d Disk) string { return d.Identity.Model })
+}
+
+// globFilter accepts disks where the string returned by field matches
+// pattern.  An invalid pattern matches nothing.
+func globFilter(pattern string, field func(Disk) string) DiskFilter {
+	return func(d Disk) bool {
+		matched, err := path.Match(pattern, field(d))
+		return err == nil && matched
+	}
+}
+
+// ParseDiskFilter parses a filter expression into a DiskFilter.  An
+// expression is made of comparisons joined with '&&' and '||', negated with
+// '!' and grouped with parentheses:
+//
+//	type=SSD && size>=200GiB && !prop=EPHEMERAL
+//	(attach=RAID || attach=SCSI) && parts=0
+//	model="SAMSUNG MZ7*" || serial=S66*
+//
+// The keys are:
+//
+//	type      DiskType (HDD, SSD, NVME, FILE)             = !=
+//	attach    AttachmentType (RAID, ATA, PCIE...)         = !=
+//	prop      Property the disk has (EPHEMERAL)           = !=
+//	table     TableType (GPT, MBR, NONE)                  = !=
+//	size      size in bytes or with a unit (200GiB)       = != < <= > >=
+//	parts     number of partitions                        = != < <= > >=
+//	name      kernel name, a glob                         = !=
+//	serial    serial number, a glob                       = !=
+//	model     model, a glob                               = !=
+//	wwn       WWN, a glob                                 = !=
+//	ro        read-only, alone or compared to true/false  = !=
+//
+// Names and values are case insensitive except for globs.  Values with
+// spaces or operator characters are double quoted.  The empty expression
+// accepts every disk.
+func ParseDiskFilter(expr string) (DiskFilter, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(toks) == 0 {
+		return AnyDisk, nil
+	}
+
+	p := &filterParser{toks: toks}
+
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.toks) {
+		return nil, p.errorf("unexpected '%s'", p.toks[p.pos].text)
+	}
+
+	return filter, nil
+}
+
+// kinds of filterToken.
+const (
+	tokWord = iota
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+// lexFilter splits a filter expression into tokens.
+//
+//nolint:funlen
+func lexFilter(expr string) ([]filterToken, error) {
+	const special = "()!&|=<>\""
+
+	toks := []filterToken{}
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		two := ""
+
+		if i+1 < len(expr) {
+			two = expr[i : i+2]
+		}
+
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case two == "&&":
+			toks = append(toks, filterToken{tokAnd, two, i})
+			i += 2
+		case two == "||":
+			toks = append(toks, filterToken{tokOr, two, i})
+			i += 2
+		case two == "!=", two == "<=", two == ">=", two == "==":
+			toks = append(toks, filterToken{tokOp, two, i})
+			i += 2
+		case c == '=' || c == '<' || c == '>':
+			toks = append(toks, filterToken{tokOp, string(c), i})
+			i++
+		case c == '!':
+			toks = append(toks, filterToken{tokNot, "!", i})
+			i++
+		case c == '(':
+			toks = append(toks, filterToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, filterToken{tokRParen, ")", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("filter '%s': unterminated quote at %d", expr, i)
+			}
+
+			toks = append(toks, filterToken{tokWord, expr[i+1 : i+1+end], i})
+			i += end + 2
+		case c == '&' || c == '|':
+			return nil, fmt.Errorf("filter '%s': single '%c' at %d, use '%c%c'", expr, c, i, c, c)
+		default:
+			start := i
+			for i < len(expr) && !unicode.IsSpace(rune(expr[i])) && !strings.ContainsRune(special, rune(expr[i])) {
+				i++
+			}
+
+			toks = append(toks, filterToken{tokWord, expr[start:i], start})
+		}
+	}
+
+	return toks, nil
+}
+
+// filterParser is a recursive descent parser for filter expressions.
+type filterParser struct {
+	toks []filterToken
+	pos  int
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	at := "end"
+	if p.pos < len(p.toks) {
+		at = strconv.Itoa(p.toks[p.pos].pos)
+	}
+
+	return fmt.Errorf("filter: %s at %s", fmt.Sprintf(format, args...), at)
+}
+
+func (p *filterParser) peek(kind int) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].kind == kind
+}
+
+func (p *filterParser) parseOr() (DiskFilter, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []DiskFilter{f}
+
+	for p.peek(tokOr) {
+		p.pos++
+
+		if f, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return Or(filters...), nil
+}
+
+func (p *filterParser) parseAnd() (DiskFilter, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	filters := []DiskFilter{f}
+
+	for p.peek(tokAnd) {
+		p.pos++
+
+		if f, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, f)
+	}
+
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+
+	return And(filters...), nil
+}
+
+func (p *filterParser) parseUnary() (DiskFilter, error) {
+	switch {
+	case p.peek(tokNot):
+		p.pos++
+
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return Not(f), nil
+	case p.peek(tokLParen):
+		p.pos++
+
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.peek(tokRParen) {
+			return nil, p.errorf("expected ')'")
+		}
+
+		p.pos++
+
+		return f, nil
+	case p.peek(tokWord):
+		return p.parseComparison()
+	}
+
+	if p.pos == len(p.toks) {
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	return nil, p.errorf("unexpected '%s'", p.toks[p.pos].text)
+}
+
+func (p *filterParser) parseComparison() (DiskFilter, error) {
+	key := strings.ToLower(p.toks[p.pos].text)
+	p.pos++
+
+	if !p.peek(tokOp) {
+		// a key on its own is a boolean test.
+		if key == "ro" {
+			return IsReadOnly(), nil
+		}
+
+		return nil, p.errorf("expected a comparison after '%s'", key)
+	}
+
+	op := p.toks[p.pos].text
+	p.pos++
+
+	if !p.peek(tokWord) {
+		return nil, p.errorf("expected a value after '%s%s'", key, op)
+	}
+
+	value := p.toks[p.pos].text
+	p.pos++
+
+	if op == "==" {
+		op = "="
+	}
+
+	f, err := newComparison(key, op, value)
+	if err != nil {
+		p.pos -= 3
+		return nil, p.errorf("%s", err)
+	}
+
+	return f, nil
+}
+
+// newComparison returns the DiskFilter for 'key op value'.
+//
+//nolint:funlen,gocognit
+func newComparison(key, op, value string) (DiskFilter, error) {
+	var f DiskFilter
+
+	switch key {
+	case "size", "parts":
+		var n uint64
+
+		if key == "size" {
+			if !SizeExpr(value).IsFixed() {
+				return nil, fmt.Errorf("invalid size '%s'", value)
+			}
+
+			n, _ = SizeExpr(value).Resolve(0, 0, 0, 1)
+		} else {
+			var err error
+			if n, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid number of partitions '%s'", value)
+			}
+		}
+
+		get := func(d Disk) uint64 { return d.Size }
+		if key == "parts" {
+			get = func(d Disk) uint64 { return uint64(len(d.Partitions)) }
+		}
+
+		return compareUint(op, n, get)
+	case "type":
+		upper := strings.ToUpper(value)
+		if StringToDiskType(upper).String() != upper {
+			return nil, fmt.Errorf("unknown disk type '%s'", value)
+		}
+
+		f = TypeIs(StringToDiskType(upper))
+	case "attach":
+		upper := strings.ToUpper(value)
+		if StringToAttachmentType(upper).String() != upper {
+			return nil, fmt.Errorf("unknown attachment '%s'", value)
+		}
+
+		f = AttachmentIs(StringToAttachmentType(upper))
+	case "prop":
+		f = HasProperty(Property(strings.ToUpper(value)))
+	case "table":
+		upper := strings.ToUpper(value)
+		if StringToTableType(upper).String() != upper {
+			return nil, fmt.Errorf("unknown table type '%s'", value)
+		}
+
+		ttype := StringToTableType(upper)
+		f = func(d Disk) bool { return d.Table == ttype }
+	case "ro":
+		ro, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean '%s'", value)
+		}
+
+		f = func(d Disk) bool { return d.ReadOnly == ro }
+	case "name", "serial", "model", "wwn":
+		if _, err := path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob '%s'", value)
+		}
+
+		fields := map[string]func(Disk) string{
+			"name":   func(d Disk) string { return d.Name },
+			"serial": func(d Disk) string { return d.Identity.Serial },
+			"model":  func(d Disk) string { return d.Identity.Model },
+			"wwn":    func(d Disk) string { return d.Identity.WWN },
+		}
+		f = globFilter(value, fields[key])
+	default:
+		return nil, fmt.Errorf("unknown key '%s'", key)
+	}
+
+	switch op {
+	case "=":
+		return f, nil
+	case "!=":
+		return Not(f), nil
+	}
+
+	return nil, fmt.Errorf("'%s' cannot be compared with '%s'", key, op)
+}
+
+// compareUint returns a DiskFilter comparing get(d) to n with op.
+func compareUint(op string, n uint64, get func(Disk) uint64) (DiskFilter, error) {
+	cmps := map[string]func(a uint64) bool{
+		"=":  func(a uint64) bool { return a == n },
+		"!=": func(a uint64) bool { return a != n },
+		"<":  func(a uint64) bool { return a < n },
+		"<=": func(a uint64) bool { return a <= n },
+		">":  func(a uint64) bool { return a > n },
+		">=": func(a uint64) bool { return a >= n },
+	}
+
+	cmp, ok := cmps[op]
+	if !ok {
+		return nil, fmt.Errorf("unknown comparison '%s'", op)
+	}
+
+	return func(d Disk) bool { return cmp(get(d)) }, nil
+}
@@ -0,0 +1,135 @@
+package disko_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+)
+
+const (
+	gib = 1024 * disko.Mebibyte
+	tib = 1024 * gib
+)
+
+func filterDisks() map[string]disko.Disk {
+	return map[string]disko.Disk{
+		"ssd": {
+			Name: "sda", Size: 480 * gib, Type: disko.SSD, Attachment: disko.ATA,
+			Table: disko.GPT, Partitions: disko.PartitionSet{1: {Number: 1}},
+			Identity: disko.DiskIdentity{Serial: "S662NE0R712345", Model: "SAMSUNG MZ7L3960HCJR-00AK1"},
+		},
+		"raid": {
+			Name: "sdb", Size: 4 * tib, Type: disko.HDD, Attachment: disko.RAID,
+			Identity: disko.DiskIdentity{WWN: "0x62cf89bd43a7af80679aa6b751349581"},
+		},
+		"eph": {
+			Name: "nvme0n1", Size: 100 * gib, Type: disko.NVME, Attachment: disko.PCIE,
+			Properties: disko.PropertySet{disko.Ephemeral: true},
+		},
+		"ro": {Name: "sr0", Size: gib, Type: disko.HDD, Attachment: disko.USB, ReadOnly: true},
+	}
+}
+
+func accepted(filter disko.DiskFilter) []string {
+	found := []string{}
+
+	for _, n := range []string{"eph", "raid", "ro", "ssd"} {
+		if filter(filterDisks()[n]) {
+			found = append(found, n)
+		}
+	}
+
+	return found
+}
+
+func TestFilterCombinators(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Equal([]string{"eph", "raid", "ro", "ssd"}, accepted(disko.AnyDisk))
+	ast.Equal([]string{"eph", "ssd"}, accepted(disko.TypeIs(disko.SSD, disko.NVME)))
+	ast.Equal([]string{"raid"}, accepted(disko.AttachmentIs(disko.RAID)))
+	ast.Equal([]string{"eph"}, accepted(disko.HasProperty(disko.Ephemeral)))
+	ast.Equal([]string{"ssd"}, accepted(disko.HasTable()))
+	ast.Equal([]string{"eph", "raid", "ro"}, accepted(disko.NoPartitions()))
+	ast.Equal([]string{"ro"}, accepted(disko.IsReadOnly()))
+	ast.Equal([]string{"ssd"}, accepted(disko.SerialMatches("S66*")))
+	ast.Equal([]string{"ssd"}, accepted(disko.ModelMatches("SAMSUNG *")))
+	ast.Equal([]string{}, accepted(disko.ModelMatches("[")))
+	ast.Equal([]string{"eph", "ssd"}, accepted(disko.SizeBetween(100*gib, tib)))
+	ast.Equal([]string{"raid"}, accepted(disko.SizeBetween(tib, 0)))
+
+	ast.Equal([]string{"ssd"},
+		accepted(disko.And(disko.Not(disko.HasProperty(disko.Ephemeral)), disko.TypeIs(disko.SSD, disko.NVME))))
+	ast.Equal([]string{"raid", "ro"}, accepted(disko.Or(disko.IsReadOnly(), disko.AttachmentIs(disko.RAID))))
+	ast.Equal([]string{"eph", "raid", "ro", "ssd"}, accepted(disko.And()))
+	ast.Equal([]string{}, accepted(disko.Or()))
+}
+
+func TestParseDiskFilter(t *testing.T) {
+	tables := []struct {
+		expr     string
+		expected []string
+	}{
+		{"", []string{"eph", "raid", "ro", "ssd"}},
+		{"type=SSD", []string{"ssd"}},
+		{"type == ssd", []string{"ssd"}},
+		{"type!=HDD", []string{"eph", "ssd"}},
+		{"type=SSD || type=NVME && !prop=EPHEMERAL", []string{"ssd"}},
+		{"(type=SSD || type=NVME) && !prop=EPHEMERAL", []string{"ssd"}},
+		{"size>=200GiB", []string{"raid", "ssd"}},
+		{"size<1TiB && size>1GiB", []string{"eph", "ssd"}},
+		{"size=1073741824", []string{"ro"}},
+		{"parts=0 && attach=RAID", []string{"raid"}},
+		{"parts>0", []string{"ssd"}},
+		{"table!=NONE", []string{"ssd"}},
+		{"ro", []string{"ro"}},
+		{"!ro", []string{"eph", "raid", "ssd"}},
+		{"ro=false && !(attach=PCIE)", []string{"raid", "ssd"}},
+		{"serial=S66*", []string{"ssd"}},
+		{`model="SAMSUNG MZ7*"`, []string{"ssd"}},
+		{"wwn=0x62cf*", []string{"raid"}},
+		{"name=sd?", []string{"raid", "ssd"}},
+		{`serial=""`, []string{"eph", "raid", "ro"}},
+	}
+
+	for _, table := range tables {
+		filter, err := disko.ParseDiskFilter(table.expr)
+		if err != nil {
+			t.Errorf("ParseDiskFilter(%q) failed: %s", table.expr, err)
+			continue
+		}
+
+		if found := accepted(filter); !assert.ObjectsAreEqual(table.expected, found) {
+			t.Errorf("ParseDiskFilter(%q) accepted %v, expected %v", table.expr, found, table.expected)
+		}
+	}
+}
+
+func TestParseDiskFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"type",
+		"type=",
+		"type=TAPE",
+		"attach=FIBRE",
+		"table=BSD",
+		"size>=40%",
+		"size>=lots",
+		"parts<x",
+		"ro=maybe",
+		"type<SSD",
+		"color=red",
+		"type=SSD &&",
+		"type=SSD & size>1",
+		"(type=SSD",
+		"type=SSD)",
+		"serial=[",
+		`model="SAMSUNG`,
+		"!",
+		"type=SSD type=HDD",
+	} {
+		if _, err := disko.ParseDiskFilter(expr); err == nil {
+			t.Errorf("ParseDiskFilter(%q) should have failed", expr)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package disko
+
+import "context"
+
+// FSType is a type of filesystem that an FSManager creates.  The names are
+// those of mkfs.<type> and of the Signature a probe finds.
+type FSType string
+
+const (
+	// FSExt2 is the second extended filesystem.
+	FSExt2 FSType = "ext2"
+
+	// FSExt3 is ext2 with a journal.
+	FSExt3 FSType = "ext3"
+
+	// FSExt4 is the fourth extended filesystem.
+	FSExt4 FSType = "ext4"
+
+	// FSXFS is the XFS filesystem.
+	FSXFS FSType = "xfs"
+
+	// FSBtrfs is the btrfs filesystem.
+	FSBtrfs FSType = "btrfs"
+
+	// FSVFAT is a FAT filesystem, such as an EFI system partition.
+	FSVFAT FSType = "vfat"
+
+	// FSSwap is swap space.
+	FSSwap FSType = "swap"
+)
+
+// FSOptions are the options to create a filesystem with.  Empty fields
+// leave the choice to mkfs.
+type FSOptions struct {
+	// Label is the label of the filesystem.
+	Label string `json:"label,omitempty"`
+
+	// UUID is the UUID of the filesystem.  For FSVFAT it is the volume id
+	// ("ABCD-1234").
+	UUID string `json:"uuid,omitempty"`
+
+	// Features are the features to turn on, or off with a "^" prefix, as
+	// mkfs takes them: "metadata_csum" or "^has_journal" for ext,
+	// "reflink=1" for xfs, "quota" for btrfs.  FSVFAT and FSSwap take none.
+	Features []string `json:"features,omitempty"`
+
+	// ExtraArgs are passed to mkfs as they are, before the device.
+	ExtraArgs []string `json:"extraArgs,omitempty"`
+}
+
+// FSManager creates and maintains filesystems on block devices: partitions,
+// logical volumes or decrypted LUKS devices.  Devices are given by path.
+// Operations other than CreateFS find the type of the filesystem on the
+// device themselves.
+type FSManager interface {
+	// CreateFS creates a filesystem of type fsType on the device at path.
+	// Anything on the device is lost.
+	CreateFS(path string, fsType FSType, opts FSOptions) error
+
+	// SetFSLabel changes the label of the filesystem on the device at path.
+	SetFSLabel(path string, label string) error
+
+	// CheckFS checks the filesystem on the device at path without changing
+	// it.  It returns an error wrapping ErrCorruptFS if the filesystem has
+	// errors.
+	CheckFS(path string) error
+
+	// GrowFS grows the filesystem on the device at path to the size of the
+	// device.  Some filesystems (xfs, btrfs) can only grow while mounted.
+	GrowFS(path string) error
+}
+
+// ContextFSManager is an FSManager whose methods have variants that take a
+// context.Context.  Cancelling the context, or reaching its deadline, stops
+// the operation and kills any command it has started.  The FSManager
+// methods behave as the Context variants called with context.Background().
+type ContextFSManager interface {
+	FSManager
+
+	// CreateFSContext is CreateFS with a context.
+	CreateFSContext(ctx context.Context, path string, fsType FSType, opts FSOptions) error
+
+	// SetFSLabelContext is SetFSLabel with a context.
+	SetFSLabelContext(ctx context.Context, path string, label string) error
+
+	// CheckFSContext is CheckFS with a context.
+	CheckFSContext(ctx context.Context, path string) error
+
+	// GrowFSContext is GrowFS with a context.
+	GrowFSContext(ctx context.Context, path string) error
+}
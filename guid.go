@@ -17,6 +17,29 @@ func (g GUID) String() string {
 	return GUIDToString(g)
 }
 
+// MarshalText - serialize as a string.
+func (g GUID) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText - unserialize from a string.  An empty string is the zero
+// GUID.
+func (g *GUID) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*g = GUID{}
+		return nil
+	}
+
+	guid, err := StringToGUID(string(b))
+	if err != nil {
+		return err
+	}
+
+	*g = guid
+
+	return nil
+}
+
 // StringToGUID - convert a string to a GUID
 func StringToGUID(sguid string) (GUID, error) {
 	return gpt.StringToGuid(sguid)
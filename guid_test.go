@@ -1,7 +1,9 @@
 package disko_test
 
 import (
+	"encoding/json"
 	"regexp"
+	"strings"
 	"testing"
 
 	"machinerun.io/disko"
@@ -59,3 +61,39 @@ func TestStringKnown(t *testing.T) {
 		}
 	}
 }
+
+func TestGPTHeaderJson(t *testing.T) {
+	hdr := disko.GPTHeader{
+		DiskGUID:           disko.GenGUID(),
+		FirstUsableLBA:     34,
+		LastUsableLBA:      204766,
+		PartitionEntries:   128,
+		PartitionEntrySize: 128,
+	}
+
+	jbytes, err := json.Marshal(hdr)
+	if err != nil {
+		t.Fatalf("Failed to marshal %#v: %s", hdr, err)
+	}
+
+	if !strings.Contains(string(jbytes), `"diskGUID":"`+hdr.DiskGUID.String()+`"`) {
+		t.Errorf("Did not find disk guid string in json: %s", jbytes)
+	}
+
+	found := disko.GPTHeader{}
+	if err := json.Unmarshal(jbytes, &found); err != nil {
+		t.Fatalf("Failed Unmarshal of %s: %s", jbytes, err)
+	}
+
+	if found != hdr {
+		t.Errorf("Objects differed. got %#v expected %#v", found, hdr)
+	}
+
+	if err := json.Unmarshal([]byte(`{"diskGUID": ""}`), &found); err != nil || found.DiskGUID != (disko.GUID{}) {
+		t.Errorf("Empty disk guid gave %s, %v", found.DiskGUID, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"diskGUID": "bogus"}`), &found); err == nil {
+		t.Errorf("Expected error for bad disk guid")
+	}
+}
@@ -0,0 +1,419 @@
+package layout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"machinerun.io/disko"
+)
+
+// OpType enumerates the kinds of Operation.
+type OpType string
+
+const (
+	// OpWipe wipes a disk (disko.System.Wipe).
+	OpWipe OpType = "wipe"
+
+	// OpCreatePartitions creates partitions (disko.System.CreatePartitions).
+	OpCreatePartitions OpType = "create-partitions"
+
+	// OpUpdatePartitions changes the name, type or id of partitions
+	// (disko.System.UpdatePartitions).
+	OpUpdatePartitions OpType = "update-partitions"
+
+	// OpSetPartitionAttributes sets or clears the attribute flags of a
+	// partition (disko.System.SetPartitionAttributes).
+	OpSetPartitionAttributes OpType = "set-partition-attributes"
+
+	// OpDeletePartition deletes a partition (disko.System.DeletePartition).
+	OpDeletePartition OpType = "delete-partition"
+
+	// OpResizePartition moves the end of a partition
+	// (disko.System.ResizePartition).
+	OpResizePartition OpType = "resize-partition"
+
+	// OpSetDiskGUID changes the GUID of a GPT disk
+	// (disko.System.SetDiskGUID).
+	OpSetDiskGUID OpType = "set-disk-guid"
+
+	// OpRelocateBackupGPT moves the backup GPT of a grown disk to its end
+	// (disko.System.RelocateBackupGPT).
+	OpRelocateBackupGPT OpType = "relocate-backup-gpt"
+
+	// OpRepairPartitionTable rebuilds the GPT of a disk from its valid copy
+	// (disko.System.RepairPartitionTable).
+	OpRepairPartitionTable OpType = "repair-partition-table"
+
+	// OpRestorePartitionTable writes a saved partition table back onto a
+	// disk (disko.System.RestorePartitionTable).
+	OpRestorePartitionTable OpType = "restore-partition-table"
+
+	// OpCreatePV creates a physical volume (disko.VolumeManager.CreatePV).
+	OpCreatePV OpType = "create-pv"
+
+	// OpDeletePV deletes a physical volume (disko.VolumeManager.DeletePV).
+	OpDeletePV OpType = "delete-pv"
+
+	// OpCreateVG creates a volume group (disko.VolumeManager.CreateVG).
+	OpCreateVG OpType = "create-vg"
+
+	// OpExtendVG adds physical volumes to a volume group
+	// (disko.VolumeManager.ExtendVG).
+	OpExtendVG OpType = "extend-vg"
+
+	// OpRemoveVG removes a volume group (disko.VolumeManager.RemoveVG).
+	OpRemoveVG OpType = "remove-vg"
+
+	// OpCreateLV creates a logical volume (disko.VolumeManager.CreateLV).
+	OpCreateLV OpType = "create-lv"
+
+	// OpExtendLV grows a logical volume (disko.VolumeManager.ExtendLV).
+	OpExtendLV OpType = "extend-lv"
+
+	// OpRemoveLV removes a logical volume (disko.VolumeManager.RemoveLV).
+	OpRemoveLV OpType = "remove-lv"
+
+	// OpRenameLV renames a logical volume (disko.VolumeManager.RenameLV).
+	OpRenameLV OpType = "rename-lv"
+
+	// OpCryptFormat sets up encryption on a logical volume
+	// (disko.VolumeManager.CryptFormat).
+	OpCryptFormat OpType = "crypt-format"
+
+	// OpCryptOpen opens an encrypted logical volume
+	// (disko.VolumeManager.CryptOpen).
+	OpCryptOpen OpType = "crypt-open"
+
+	// OpCryptClose closes an encrypted logical volume
+	// (disko.VolumeManager.CryptClose).
+	OpCryptClose OpType = "crypt-close"
+)
+
+// Operation is a single step of a Plan.  Only the fields relevant to Type
+// are set.
+type Operation struct {
+	Type OpType `json:"type"`
+
+	// Disk is the device path of the disk for disk operations.
+	Disk string `json:"disk,omitempty"`
+
+	// Table is the table type to create if the disk has none.
+	Table disko.TableType `json:"table,omitempty"`
+
+	// DiskGUID is the GUID of a GPT disk, for a table that is created or
+	// for OpSetDiskGUID.  Empty picks a random one.
+	DiskGUID string `json:"diskGUID,omitempty"`
+
+	// Partitions are the partitions to create or update, or the partition
+	// to resize with its new Last.
+	Partitions disko.PartitionSet `json:"partitions,omitempty"`
+
+	// Backup is the saved table of OpRestorePartitionTable.
+	Backup *disko.TableBackup `json:"backup,omitempty"`
+
+	// Number is the number of the partition to delete or to set the
+	// attributes of.
+	Number uint `json:"number,omitempty"`
+
+	// Attributes are the partition attribute flags of
+	// OpSetPartitionAttributes.  Zero clears them.
+	Attributes disko.PartAttrs `json:"attributes,omitempty"`
+
+	// Device is the device name for pv operations.
+	Device string `json:"device,omitempty"`
+
+	// VG is the volume group name.
+	VG string `json:"vg,omitempty"`
+
+	// PVs are the device names of the physical volumes of a vg operation.
+	PVs []string `json:"pvs,omitempty"`
+
+	// LV is the logical volume name.
+	LV string `json:"lv,omitempty"`
+
+	// NewLV is the new name of a renamed logical volume.
+	NewLV string `json:"newLV,omitempty"`
+
+	// Size is the logical volume size in bytes.
+	Size uint64 `json:"size,omitempty"`
+
+	// SizeExpr is a relative logical volume size ("100%FREE") that is
+	// resolved against the volume group when the operation runs.  Size is
+	// ignored when it is set.
+	SizeExpr disko.SizeExpr `json:"sizeExpr,omitempty"`
+
+	// LVType is the logical volume type.
+	LVType disko.LVType `json:"lvType,omitempty"`
+
+	// Pool is the thin pool of a THIN logical volume.
+	Pool string `json:"pool,omitempty"`
+
+	// Key is the LUKS key of crypt operations.
+	Key string `json:"key,omitempty"`
+
+	// DecryptedName is the name an encrypted logical volume is opened as.
+	DecryptedName string `json:"decryptedName,omitempty"`
+}
+
+func (op Operation) String() string {
+	switch op.Type {
+	case OpWipe, OpRelocateBackupGPT, OpRepairPartitionTable:
+		return fmt.Sprintf("%s %s", op.Type, op.Disk)
+	case OpSetDiskGUID:
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", op.Type, op.Disk, op.DiskGUID))
+	case OpDeletePartition:
+		return fmt.Sprintf("%s %s %d", op.Type, op.Disk, op.Number)
+	case OpSetPartitionAttributes:
+		return strings.TrimSpace(fmt.Sprintf("%s %s %d %s", op.Type, op.Disk, op.Number, op.Attributes))
+	case OpCreatePartitions, OpUpdatePartitions, OpResizePartition, OpRestorePartitionTable:
+		parts := []string{}
+
+		for _, n := range op.partitionNumbers() {
+			p := op.Partitions[n]
+			parts = append(parts,
+				fmt.Sprintf("%d(%s %d-%d)", p.Number, p.Name, p.Start, p.Last))
+		}
+
+		return fmt.Sprintf("%s %s %s", op.Type, op.Disk, strings.Join(parts, " "))
+	case OpCreatePV, OpDeletePV:
+		return fmt.Sprintf("%s %s", op.Type, op.Device)
+	case OpRemoveVG:
+		return fmt.Sprintf("%s %s", op.Type, op.VG)
+	case OpCreateVG, OpExtendVG:
+		return fmt.Sprintf("%s %s %s", op.Type, op.VG, strings.Join(op.PVs, " "))
+	case OpCreateLV, OpExtendLV:
+		if op.SizeExpr != "" {
+			return fmt.Sprintf("%s %s/%s size=%s type=%s", op.Type, op.VG, op.LV, op.SizeExpr, op.LVType)
+		}
+
+		return fmt.Sprintf("%s %s/%s size=%d type=%s", op.Type, op.VG, op.LV, op.Size, op.LVType)
+	case OpCryptFormat, OpRemoveLV:
+		return fmt.Sprintf("%s %s/%s", op.Type, op.VG, op.LV)
+	case OpRenameLV:
+		return fmt.Sprintf("%s %s/%s %s", op.Type, op.VG, op.LV, op.NewLV)
+	case OpCryptOpen, OpCryptClose:
+		return fmt.Sprintf("%s %s/%s %s", op.Type, op.VG, op.LV, op.DecryptedName)
+	}
+
+	return fmt.Sprintf("unknown operation %s", op.Type)
+}
+
+// Run performs the operation.  Disk operations re-scan the disk first, so
+// that earlier operations on the same disk are taken into account.
+func (op Operation) Run(sys disko.System, vmgr disko.VolumeManager) error {
+	switch op.Type {
+	case OpWipe:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.Wipe(disk)
+	case OpCreatePartitions:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		if disk.Table == disko.TableNone {
+			disk.Table = op.Table
+			if disk.GPT.DiskGUID, err = op.diskGUID(); err != nil {
+				return err
+			}
+		}
+
+		return sys.CreatePartitions(disk, op.Partitions)
+	case OpUpdatePartitions:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.UpdatePartitions(disk, op.Partitions)
+	case OpDeletePartition:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.DeletePartition(disk, op.Number)
+	case OpSetPartitionAttributes:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.SetPartitionAttributes(disk, op.Number, op.Attributes)
+	case OpSetDiskGUID:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		id, err := op.diskGUID()
+		if err != nil {
+			return err
+		}
+
+		return sys.SetDiskGUID(disk, id)
+	case OpRelocateBackupGPT:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.RelocateBackupGPT(disk)
+	case OpRepairPartitionTable:
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.RepairPartitionTable(disk)
+	case OpRestorePartitionTable:
+		if op.Backup == nil {
+			return fmt.Errorf("%s %s: no backup to restore", op.Type, op.Disk)
+		}
+
+		disk, err := sys.ScanDisk(op.Disk)
+		if err != nil {
+			return err
+		}
+
+		return sys.RestorePartitionTable(disk, *op.Backup)
+	case OpResizePartition:
+		// each resize changes the disk, so scan it again for the next.
+		for _, n := range op.partitionNumbers() {
+			disk, err := sys.ScanDisk(op.Disk)
+			if err != nil {
+				return err
+			}
+
+			if err := sys.ResizePartition(disk, n, op.Partitions[n].Last); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case OpCreatePV:
+		_, err := vmgr.CreatePV(op.Device)
+		return err
+	case OpDeletePV:
+		pvs, err := findPVs(vmgr, []string{op.Device})
+		if err != nil {
+			return err
+		}
+
+		return vmgr.DeletePV(pvs[0])
+	case OpRemoveVG:
+		return vmgr.RemoveVG(op.VG)
+	case OpCreateVG, OpExtendVG:
+		pvs, err := findPVs(vmgr, op.PVs)
+		if err != nil {
+			return err
+		}
+
+		if op.Type == OpExtendVG {
+			return vmgr.ExtendVG(op.VG, pvs...)
+		}
+
+		_, err = vmgr.CreateVG(op.VG, pvs...)
+
+		return err
+	case OpCreateLV:
+		vgName := op.VG
+		if op.LVType == disko.THIN {
+			vgName = op.VG + "/" + op.Pool
+		}
+
+		size, err := op.lvSize(vmgr)
+		if err != nil {
+			return err
+		}
+
+		_, err = vmgr.CreateLV(vgName, op.LV, size, op.LVType)
+
+		return err
+	case OpExtendLV:
+		size, err := op.lvSize(vmgr)
+		if err != nil {
+			return err
+		}
+
+		return vmgr.ExtendLV(op.VG, op.LV, size)
+	case OpRemoveLV:
+		return vmgr.RemoveLV(op.VG, op.LV)
+	case OpRenameLV:
+		return vmgr.RenameLV(op.VG, op.LV, op.NewLV)
+	case OpCryptFormat:
+		return vmgr.CryptFormat(op.VG, op.LV, op.Key)
+	case OpCryptOpen:
+		return vmgr.CryptOpen(op.VG, op.LV, op.DecryptedName, op.Key)
+	case OpCryptClose:
+		return vmgr.CryptClose(op.VG, op.LV, op.DecryptedName)
+	}
+
+	return fmt.Errorf("unknown operation type '%s'", op.Type)
+}
+
+// partitionNumbers returns the numbers of Partitions in order.
+func (op Operation) partitionNumbers() []uint {
+	nums := make([]uint, 0, len(op.Partitions))
+	for n := range op.Partitions {
+		nums = append(nums, n)
+	}
+
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	return nums
+}
+
+// diskGUID returns DiskGUID as a GUID, zero if it is empty.
+func (op Operation) diskGUID() (disko.GUID, error) {
+	if op.DiskGUID == "" {
+		return disko.GUID{}, nil
+	}
+
+	return disko.StringToGUID(op.DiskGUID)
+}
+
+// lvSize returns Size, or SizeExpr resolved against the current state of
+// the volume group.
+func (op Operation) lvSize(vmgr disko.VolumeManager) (uint64, error) {
+	if op.SizeExpr == "" {
+		return op.Size, nil
+	}
+
+	vgs, err := vmgr.ScanVGs(func(v disko.VG) bool { return v.Name == op.VG })
+	if err != nil {
+		return 0, err
+	}
+
+	vg, ok := vgs[op.VG]
+	if !ok {
+		return 0, fmt.Errorf("vg %s: %w", op.VG, disko.ErrNotFound)
+	}
+
+	return op.SizeExpr.ForLV(vg)
+}
+
+func findPVs(vmgr disko.VolumeManager, names []string) ([]disko.PV, error) {
+	pvSet, err := vmgr.ScanPVs(func(p disko.PV) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	pvs := []disko.PV{}
+
+	for _, name := range names {
+		pv, ok := pvSet[name]
+		if !ok {
+			return nil, fmt.Errorf("physical volume %s not found", name)
+		}
+
+		pvs = append(pvs, pv)
+	}
+
+	return pvs, nil
+}
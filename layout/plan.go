@@ -0,0 +1,518 @@
+package layout
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+// Plan is the ordered list of operations that takes a system from its
+// current state to the state described by a Spec.
+type Plan struct {
+	Operations []Operation `json:"operations"`
+}
+
+func (p Plan) String() string {
+	lines := make([]string, 0, len(p.Operations))
+
+	for i, op := range p.Operations {
+		lines = append(lines, fmt.Sprintf("%d: %s", i+1, op))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// IsEmpty returns true if there is nothing to do.
+func (p Plan) IsEmpty() bool {
+	return len(p.Operations) == 0
+}
+
+// Apply runs the operations of the plan in order, stopping at the first
+// failure.
+func (p Plan) Apply(sys disko.System, vmgr disko.VolumeManager) error {
+	for i, op := range p.Operations {
+		if err := op.Run(sys, vmgr); err != nil {
+			return fmt.Errorf("operation %d (%s) failed: %w", i+1, op, err)
+		}
+	}
+
+	return nil
+}
+
+// NewPlan computes the Plan to get from the current state of sys and vmgr
+// to spec.  vmgr may be nil if spec has no VGs.
+func NewPlan(sys disko.System, vmgr disko.VolumeManager, spec Spec) (Plan, error) {
+	plan := Plan{}
+
+	if err := spec.Validate(); err != nil {
+		return plan, err
+	}
+
+	disks, err := selectDisks(sys, spec.Disks)
+	if err != nil {
+		return plan, err
+	}
+
+	// partNums maps a disk id to its partition numbers by name.
+	partNums := map[string]map[string]uint{}
+
+	for _, ds := range spec.Disks {
+		ops, nums, err := planDisk(ds, disks[ds.ID])
+		if err != nil {
+			return plan, err
+		}
+
+		plan.Operations = append(plan.Operations, ops...)
+		partNums[ds.ID] = nums
+	}
+
+	if len(spec.VGs) == 0 {
+		return plan, nil
+	}
+
+	if vmgr == nil {
+		return plan, fmt.Errorf("layout has volume groups but no volume manager was given")
+	}
+
+	ops, err := planLVM(vmgr, spec.VGs, disks, partNums)
+	if err != nil {
+		return plan, err
+	}
+
+	plan.Operations = append(plan.Operations, ops...)
+
+	return plan, nil
+}
+
+// selectDisks returns the disk for each DiskSpec by its ID.  Disks given
+// by Path are selected first, then those by Match in Spec order.  A disk
+// is used by at most one DiskSpec.
+func selectDisks(sys disko.System, specs []DiskSpec) (map[string]disko.Disk, error) {
+	selected := map[string]disko.Disk{}
+	claimed := map[string]string{}
+	needAll := false
+
+	for _, ds := range specs {
+		if ds.Path == "" {
+			needAll = true
+			continue
+		}
+
+		d, err := sys.ScanDisk(ds.Path)
+		if err != nil {
+			return selected, fmt.Errorf("disk '%s': failed to scan %s: %w", ds.ID, ds.Path, err)
+		}
+
+		if other, ok := claimed[d.Name]; ok {
+			return selected, fmt.Errorf("disk '%s' and '%s' are both %s", other, ds.ID, d.Name)
+		}
+
+		claimed[d.Name] = ds.ID
+		selected[ds.ID] = d
+	}
+
+	if !needAll {
+		return selected, nil
+	}
+
+	all, err := sys.ScanAllDisks(func(d disko.Disk) bool { return true })
+	if err != nil {
+		return selected, err
+	}
+
+	names := make([]string, 0, len(all))
+	for n := range all {
+		names = append(names, n)
+	}
+
+	sort.Strings(names)
+
+	for _, ds := range specs {
+		if ds.Path != "" {
+			continue
+		}
+
+		for _, n := range names {
+			if _, ok := claimed[n]; ok || !ds.Match.matches(all[n]) {
+				continue
+			}
+
+			claimed[n] = ds.ID
+			selected[ds.ID] = all[n]
+
+			break
+		}
+
+		if _, ok := selected[ds.ID]; !ok {
+			return selected, fmt.Errorf("no available disk matched disk '%s'", ds.ID)
+		}
+	}
+
+	return selected, nil
+}
+
+// findExisting returns the partition on d that ps refers to.
+func findExisting(ps PartitionSpec, d disko.Disk) (disko.Partition, bool) {
+	if ps.Number != 0 {
+		p, ok := d.Partitions[ps.Number]
+		return p, ok
+	}
+
+	for _, p := range d.Partitions {
+		if p.Name == ps.Name {
+			return p, true
+		}
+	}
+
+	return disko.Partition{}, false
+}
+
+func sameType(table disko.TableType, a, b disko.PartType) bool {
+	if table != disko.MBR {
+		return a == b
+	}
+
+	ma, errA := partid.PartTypeToMBR(a)
+	mb, errB := partid.PartTypeToMBR(b)
+
+	return errA == nil && errB == nil && ma == mb
+}
+
+// conflict returns a description of how existing partition p on d differs
+// from ps. Sizes relative to free space always match.
+func conflict(ps PartitionSpec, p disko.Partition, d disko.Disk) string {
+	ptype, _ := ps.partType()
+	table := d.Table
+
+	var size uint64
+	if !ps.Size.IsFreeRelative() {
+		size, _ = ps.Size.ForPartition(d, disko.FreeSpace{})
+	}
+
+	switch {
+	case ps.Name != "" && p.Name != ps.Name:
+		return fmt.Sprintf("partition %d has name '%s', not '%s'", p.Number, p.Name, ps.Name)
+	case ps.Number != 0 && p.Number != ps.Number:
+		return fmt.Sprintf("partition '%s' is number %d, not %d", p.Name, p.Number, ps.Number)
+	case !sameType(table, ptype, p.Type):
+		return fmt.Sprintf("partition %d has type %s, not %s", p.Number, p.Type, ptype)
+	case ps.Start != 0 && p.Start != ps.Start:
+		return fmt.Sprintf("partition %d starts at %d, not %d", p.Number, p.Start, ps.Start)
+	case size != 0 && p.Size() != size:
+		return fmt.Sprintf("partition %d has size %d, not %d (%s)", p.Number, p.Size(), size, ps.Size)
+	}
+
+	return ""
+}
+
+// planDisk returns the operations for a single disk and the partition
+// number of each named partition in ds.
+func planDisk(ds DiskSpec, d disko.Disk) ([]Operation, map[string]uint, error) {
+	ops := []Operation{}
+	nums := map[string]uint{}
+	problems := []string{}
+
+	if ds.Table != disko.TableNone && d.Table != disko.TableNone && d.Table != ds.Table {
+		problems = append(problems, fmt.Sprintf("has a %s table, not %s", d.Table, ds.Table))
+	}
+
+	existing := map[int]disko.Partition{}
+
+	for i, ps := range ds.Partitions {
+		p, ok := findExisting(ps, d)
+		if !ok {
+			continue
+		}
+
+		if msg := conflict(ps, p, d); msg != "" {
+			problems = append(problems, msg)
+			continue
+		}
+
+		existing[i] = p
+	}
+
+	work := d
+	work.Partitions = disko.PartitionSet{}
+
+	for n, p := range d.Partitions {
+		work.Partitions[n] = p
+	}
+
+	if len(problems) != 0 {
+		if !ds.Wipe {
+			return ops, nums, fmt.Errorf("disk '%s' (%s) does not match layout: %s",
+				ds.ID, d.Path, strings.Join(problems, "; "))
+		}
+
+		ops = append(ops, Operation{Type: OpWipe, Disk: d.Path})
+		existing = map[int]disko.Partition{}
+		work.Partitions = disko.PartitionSet{}
+		work.Table = disko.TableNone
+	}
+
+	created := work.Table == disko.TableNone
+
+	table := ds.Table
+	if work.Table != disko.TableNone {
+		table = work.Table
+	} else if table == disko.TableNone {
+		table = disko.GPT
+	}
+
+	work.Table = table
+	newParts := disko.PartitionSet{}
+
+	for i, ps := range ds.Partitions {
+		p, ok := existing[i]
+		if !ok {
+			var err error
+			if p, err = allocate(ps, work); err != nil {
+				return ops, nums, fmt.Errorf("disk '%s' (%s): %s", ds.ID, d.Path, err)
+			}
+
+			work.Partitions[p.Number] = p
+			newParts[p.Number] = p
+		}
+
+		if ps.Name != "" {
+			nums[ps.Name] = p.Number
+		}
+
+		nums[strconv.Itoa(int(p.Number))] = p.Number
+	}
+
+	if len(newParts) != 0 {
+		op := Operation{
+			Type:       OpCreatePartitions,
+			Disk:       d.Path,
+			Table:      table,
+			Partitions: newParts,
+		}
+
+		if created && table == disko.GPT {
+			op.DiskGUID = ds.DiskGUID
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, nums, nil
+}
+
+// allocate places a new partition for ps in the free space of d.
+func allocate(ps PartitionSpec, d disko.Disk) (disko.Partition, error) {
+	const maxPartNumMBR, maxPartNumGPT = 4, 128
+
+	ptype, err := ps.partType()
+	if err != nil {
+		return disko.Partition{}, err
+	}
+
+	p := disko.Partition{Number: ps.Number, Name: ps.Name, Type: ptype}
+
+	if p.Number == 0 {
+		maxNum := uint(maxPartNumGPT)
+		if d.Table == disko.MBR {
+			maxNum = maxPartNumMBR
+		}
+
+		for n := uint(1); n <= maxNum; n++ {
+			if _, ok := d.Partitions[n]; !ok {
+				p.Number = n
+				break
+			}
+		}
+
+		if p.Number == 0 {
+			return p, fmt.Errorf("no free partition number for partition '%s'", ps.Name)
+		}
+	}
+
+	for _, fs := range d.FreeSpaces() {
+		start := d.AlignUp(fs.Start)
+		if ps.Start != 0 {
+			start = ps.Start
+		}
+
+		if start < fs.Start || start > fs.Last {
+			continue
+		}
+
+		size, err := ps.Size.ForPartition(d, disko.FreeSpace{Start: start, Last: fs.Last})
+		if err != nil {
+			continue
+		}
+
+		last := start + size - 1
+		if last > fs.Last {
+			continue
+		}
+
+		p.Start, p.Last = start, last
+
+		return p, nil
+	}
+
+	if ps.Start != 0 {
+		return p, fmt.Errorf("partition %d (%s) of size %s does not fit at %d",
+			p.Number, ps.Name, ps.Size, ps.Start)
+	}
+
+	return p, fmt.Errorf("no free space for partition %d (%s) of size %s: %w",
+		p.Number, ps.Name, ps.Size, disko.ErrNoSpace)
+}
+
+// partitionKname returns the kernel name of partition num on disk diskName.
+func partitionKname(diskName string, num uint) string {
+	sep := ""
+	if regexp.MustCompile("[0-9]$").MatchString(diskName) {
+		sep = "p"
+	}
+
+	return fmt.Sprintf("%s%s%d", diskName, sep, num)
+}
+
+// resolvePV returns the device name for a VGSpec PVs entry.
+func resolvePV(ref string, disks map[string]disko.Disk, partNums map[string]map[string]uint) (string, error) {
+	if strings.HasPrefix(ref, "/") {
+		return ref, nil
+	}
+
+	toks := strings.SplitN(ref, ":", 2)
+	d := disks[toks[0]]
+
+	if len(toks) == 1 {
+		return d.Name, nil
+	}
+
+	num, ok := partNums[toks[0]][toks[1]]
+	if !ok {
+		return "", fmt.Errorf("pv '%s': disk '%s' has no partition '%s' in the layout", ref, toks[0], toks[1])
+	}
+
+	return partitionKname(d.Name, num), nil
+}
+
+//nolint:funlen,gocognit
+func planLVM(vmgr disko.VolumeManager, specs []VGSpec, disks map[string]disko.Disk,
+	partNums map[string]map[string]uint) ([]Operation, error) {
+	ops := []Operation{}
+
+	pvSet, err := vmgr.ScanPVs(func(p disko.PV) bool { return true })
+	if err != nil {
+		return ops, err
+	}
+
+	vgSet, err := vmgr.ScanVGs(func(v disko.VG) bool { return true })
+	if err != nil {
+		return ops, err
+	}
+
+	newPVs := map[string]string{}
+
+	for _, vs := range specs {
+		devices := []string{}
+
+		for _, ref := range vs.PVs {
+			dev, err := resolvePV(ref, disks, partNums)
+			if err != nil {
+				return ops, fmt.Errorf("volume group '%s': %s", vs.Name, err)
+			}
+
+			if pv, ok := pvSet[dev]; ok {
+				if pv.VGName != "" && pv.VGName != vs.Name {
+					return ops, fmt.Errorf("volume group '%s': pv %s belongs to volume group '%s'",
+						vs.Name, dev, pv.VGName)
+				}
+			} else if vg, ok := newPVs[dev]; ok {
+				return ops, fmt.Errorf("volume group '%s': pv %s is also used by volume group '%s'",
+					vs.Name, dev, vg)
+			} else {
+				ops = append(ops, Operation{Type: OpCreatePV, Device: dev})
+				newPVs[dev] = vs.Name
+			}
+
+			devices = append(devices, dev)
+		}
+
+		vg, exists := vgSet[vs.Name]
+		if !exists {
+			ops = append(ops, Operation{Type: OpCreateVG, VG: vs.Name, PVs: devices})
+		} else {
+			missing := []string{}
+
+			for _, dev := range devices {
+				if _, ok := vg.PVs[dev]; !ok {
+					missing = append(missing, dev)
+				}
+			}
+
+			if len(missing) != 0 {
+				ops = append(ops, Operation{Type: OpExtendVG, VG: vs.Name, PVs: missing})
+			}
+		}
+
+		for _, ls := range vs.LVs {
+			lv, ok := vg.Volumes[ls.Name]
+
+			if !ok {
+				op := Operation{Type: OpCreateLV, VG: vs.Name, LV: ls.Name, LVType: ls.Type, Pool: ls.Pool}
+				if ls.Size.IsFixed() {
+					op.Size, _ = ls.Size.Resolve(0, 0, 0, disko.ExtentSize)
+				} else {
+					op.SizeExpr = ls.Size
+				}
+
+				ops = append(ops, op)
+
+				if ls.Encrypt {
+					ops = append(ops, Operation{Type: OpCryptFormat, VG: vs.Name, LV: ls.Name, Key: ls.Key})
+				}
+
+				if ls.Encrypt && ls.DecryptedName != "" {
+					ops = append(ops, Operation{
+						Type: OpCryptOpen, VG: vs.Name, LV: ls.Name, Key: ls.Key, DecryptedName: ls.DecryptedName})
+				}
+
+				continue
+			}
+
+			if lv.Type != ls.Type {
+				return ops, fmt.Errorf("logical volume %s/%s is %s, not %s", vs.Name, ls.Name, lv.Type, ls.Type)
+			}
+
+			size := lv.Size
+			if !ls.Size.IsFreeRelative() {
+				if size, err = ls.Size.ForLV(vg); err != nil {
+					return ops, fmt.Errorf("logical volume %s/%s: %s", vs.Name, ls.Name, err)
+				}
+			}
+
+			if lv.Size > size {
+				return ops, fmt.Errorf("logical volume %s/%s is %d bytes, larger than %d. It will not be shrunk",
+					vs.Name, ls.Name, lv.Size, size)
+			} else if lv.Size < size {
+				ops = append(ops, Operation{
+					Type: OpExtendLV, VG: vs.Name, LV: ls.Name, Size: size, LVType: ls.Type})
+			}
+
+			if ls.Encrypt != lv.Encrypted {
+				return ops, fmt.Errorf("logical volume %s/%s has encrypted=%t, not %t",
+					vs.Name, ls.Name, lv.Encrypted, ls.Encrypt)
+			}
+
+			if ls.Encrypt && ls.DecryptedName != "" && lv.DecryptedLVName == "" {
+				ops = append(ops, Operation{
+					Type: OpCryptOpen, VG: vs.Name, LV: ls.Name, Key: ls.Key, DecryptedName: ls.DecryptedName})
+			}
+		}
+	}
+
+	return ops, nil
+}
@@ -0,0 +1,430 @@
+package layout_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/layout"
+	"machinerun.io/disko/mockos"
+	"machinerun.io/disko/partid"
+)
+
+const GiB = 1024 * disko.Mebibyte
+
+const yamlSpec = `
+disks:
+  - id: boot
+    match:
+      type: SSD
+    partitions:
+      - name: efi
+        type: EFI
+        size: 536870912
+      - name: data
+        type: LVM
+  - id: bulk
+    path: /dev/sdb
+    table: GPT
+    partitions:
+      - number: 1
+        name: bulk
+        type: LVM
+vgs:
+  - name: vg0
+    pvs: ["boot:data", "bulk:1"]
+    lvs:
+      - name: root
+        size: 10737418240
+        type: THICK
+      - name: secret
+        size: 1000000
+        type: THICK
+        encrypt: true
+        key: passw0rd
+        decryptedName: secret_crypt
+`
+
+func mockSystem(t *testing.T) disko.System {
+	t.Helper()
+
+	sys, err := mockos.System("testdata/sys.json")
+	if err != nil {
+		t.Fatalf("failed to load mock system: %s", err)
+	}
+
+	return sys
+}
+
+func opTypes(p layout.Plan) []layout.OpType {
+	types := []layout.OpType{}
+	for _, op := range p.Operations {
+		types = append(types, op.Type)
+	}
+
+	return types
+}
+
+func TestParse(t *testing.T) {
+	ast := assert.New(t)
+
+	spec, err := layout.Parse([]byte(yamlSpec))
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.Len(spec.Disks, 2)
+	ast.Equal(disko.GPT, spec.Disks[1].Table)
+	ast.Equal("SSD", spec.Disks[0].Match.Type)
+	ast.Equal(disko.SizeBytes(10*GiB), spec.VGs[0].LVs[0].Size)
+	ast.Equal(disko.THICK, spec.VGs[0].LVs[1].Type)
+
+	jspec, err := layout.Parse([]byte(`{"disks": [{"id": "a", "path": "/dev/sda", "partitions": [{"number": 1}]}]}`))
+	ast.Nil(err)
+	ast.Equal("/dev/sda", jspec.Disks[0].Path)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, doc := range []string{
+		`{"disks": [{"path": "/dev/sda"}]}`,
+		`{"disks": [{"id": "a"}]}`,
+		`{"disks": [{"id": "a", "path": "/dev/sda"}, {"id": "a", "path": "/dev/sdb"}]}`,
+		`{"disks": [{"id": "a", "path": "/dev/sda", "partitions": [{"number": 1, "type": "bogus"}]}]}`,
+		`{"disks": [{"id": "a", "path": "/dev/sda", "partitions": [{"size": 10}]}]}`,
+		`{"vgs": [{"name": "vg0", "pvs": ["nodisk:1"]}]}`,
+		`{"vgs": [{"name": "vg0", "pvs": ["/dev/sda"], "lvs": [{"name": "thin", "type": "THIN", "pool": "p"}]}]}`,
+		`{"vgs": [{"name": "vg0", "pvs": ["/dev/sda"], "lvs": [{"name": "x", "encrypt": true}]}]}`,
+		`{"disks": [{"id": "a", "match": {"filter": "type=TAPE"}}]}`,
+		`{"disks": [{"id": "a", "path": "/dev/sda", "diskGUID": "not-a-guid"}]}`,
+		`{"disks": [{"id": "a", "path": "/dev/sda", "table": "MBR",
+			"diskGUID": "4B1E3C2D-5A6F-4E7D-8C9B-0A1B2C3D4E5F"}]}`,
+	} {
+		if _, err := layout.Parse([]byte(doc)); err == nil {
+			t.Errorf("expected error parsing %s", doc)
+		}
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	ast := assert.New(t)
+
+	spec, err := layout.Parse([]byte(yamlSpec))
+	if !ast.Nil(err) {
+		return
+	}
+
+	sys := mockSystem(t)
+	vmgr := mockos.LVM(sys)
+
+	plan, err := layout.NewPlan(sys, vmgr, spec)
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.Equal(
+		[]layout.OpType{
+			layout.OpCreatePartitions, layout.OpCreatePartitions,
+			layout.OpCreatePV, layout.OpCreatePV, layout.OpCreateVG,
+			layout.OpCreateLV, layout.OpCreateLV, layout.OpCryptFormat, layout.OpCryptOpen,
+		}, opTypes(plan))
+
+	boot := plan.Operations[0]
+	ast.Equal("/dev/sda", boot.Disk)
+	ast.Equal(disko.Mebibyte, boot.Partitions[1].Start)
+	ast.Equal(disko.PartType(partid.EFI), boot.Partitions[1].Type)
+	efi := boot.Partitions[1]
+	ast.Equal(uint64(512*disko.Mebibyte), efi.Size())
+	ast.Equal(boot.Partitions[1].Last+1, boot.Partitions[2].Start)
+	ast.Equal([]string{"sda2", "sdb1"}, plan.Operations[4].PVs)
+	ast.Equal(disko.ExtentSize, plan.Operations[6].Size)
+
+	if !ast.Nil(plan.Apply(sys, vmgr)) {
+		return
+	}
+
+	disk, err := sys.ScanDisk("/dev/sda")
+	ast.Nil(err)
+	ast.Len(disk.Partitions, 2)
+	ast.Equal("efi", disk.Partitions[1].Name)
+
+	vgs, err := vmgr.ScanVGs(nil)
+	ast.Nil(err)
+	ast.Len(vgs["vg0"].Volumes, 2)
+	ast.Equal("secret_crypt", vgs["vg0"].Volumes["secret"].DecryptedLVName)
+
+	// The system now matches, so there is nothing left to do.
+	plan, err = layout.NewPlan(sys, vmgr, spec)
+	ast.Nil(err)
+	ast.True(plan.IsEmpty(), "unexpected operations: %s", plan)
+
+	// Growing a logical volume extends it.
+	spec.VGs[0].LVs[0].Size = "20GiB"
+	plan, err = layout.NewPlan(sys, vmgr, spec)
+	ast.Nil(err)
+	ast.Equal([]layout.OpType{layout.OpExtendLV}, opTypes(plan))
+
+	// Shrinking is refused.
+	spec.VGs[0].LVs[0].Size = "1GiB"
+	_, err = layout.NewPlan(sys, vmgr, spec)
+	ast.NotNil(err)
+}
+
+func TestPlanConflict(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := mockSystem(t)
+	disk, err := sys.ScanDisk("/dev/sdb")
+	ast.Nil(err)
+
+	ast.Nil(sys.CreatePartition(disk, disko.Partition{
+		Number: 1, Name: "old", Type: partid.LinuxFS, Start: disko.Mebibyte, Last: GiB - 1}))
+
+	spec := layout.Spec{
+		Disks: []layout.DiskSpec{{
+			ID:         "bulk",
+			Path:       "/dev/sdb",
+			Partitions: []layout.PartitionSpec{{Number: 1, Name: "bulk", Type: "LVM"}},
+		}},
+	}
+
+	_, err = layout.NewPlan(sys, nil, spec)
+	ast.NotNil(err)
+
+	spec.Disks[0].Wipe = true
+	plan, err := layout.NewPlan(sys, nil, spec)
+	ast.Nil(err)
+	ast.Equal([]layout.OpType{layout.OpWipe, layout.OpCreatePartitions}, opTypes(plan))
+
+	ast.Nil(plan.Apply(sys, nil))
+
+	disk, err = sys.ScanDisk("/dev/sdb")
+	ast.Nil(err)
+	ast.Equal("bulk", disk.Partitions[1].Name)
+	ast.Empty(disk.FreeSpaces())
+}
+
+func TestPlanNoMatch(t *testing.T) {
+	sys := mockSystem(t)
+	spec := layout.Spec{
+		Disks: []layout.DiskSpec{
+			{ID: "a", Match: &layout.DiskMatch{Type: "SSD"}},
+			{ID: "b", Match: &layout.DiskMatch{Type: "SSD"}},
+		},
+	}
+
+	if _, err := layout.NewPlan(sys, nil, spec); err == nil {
+		t.Errorf("expected error with only one SSD for two disks")
+	}
+}
+
+func TestPlanMatchFilter(t *testing.T) {
+	ast := assert.New(t)
+	sys := mockSystem(t)
+	spec := layout.Spec{
+		Disks: []layout.DiskSpec{
+			{ID: "a", Match: &layout.DiskMatch{Filter: "attach=RAID && size>=400GiB"},
+				Partitions: []layout.PartitionSpec{{Name: "data"}}},
+		},
+	}
+
+	plan, err := layout.NewPlan(sys, nil, spec)
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.Equal("/dev/sdb", plan.Operations[0].Disk)
+
+	spec.Disks[0].Match.Filter = "type=NVME"
+	_, err = layout.NewPlan(sys, nil, spec)
+	ast.NotNil(err)
+}
+
+func TestPlanRelativeSizes(t *testing.T) {
+	ast := assert.New(t)
+
+	spec, err := layout.Parse([]byte(`
+disks:
+  - id: bulk
+    path: /dev/sdb
+    partitions:
+      - {name: a, size: 20%}
+      - {name: b, size: 50%FREE}
+      - {name: c, type: LVM, size: rest}
+vgs:
+  - name: vg0
+    pvs: ["bulk:c"]
+    lvs:
+      - {name: root, size: 1GiB}
+      - {name: data, size: 50%FREE}
+      - {name: rest, size: rest}
+`))
+	if !ast.Nil(err) {
+		return
+	}
+
+	sys := mockSystem(t)
+	vmgr := mockos.LVM(sys)
+
+	plan, err := layout.NewPlan(sys, vmgr, spec)
+	if !ast.Nil(err) {
+		return
+	}
+
+	parts := plan.Operations[0].Partitions
+	a, b, c := parts[1], parts[2], parts[3]
+	ast.Equal(uint64(100*GiB), a.Size())
+	ast.Equal(a.Last+1, b.Start)
+	ast.Equal(b.Last+1, c.Start)
+	ast.Equal(b.Size(), c.Size())
+
+	lvOps := plan.Operations[len(plan.Operations)-3:]
+	ast.Equal(uint64(GiB), lvOps[0].Size)
+	ast.Equal(disko.SizeExpr("50%FREE"), lvOps[1].SizeExpr)
+	ast.Equal(disko.SizeRest, lvOps[2].SizeExpr)
+
+	if !ast.Nil(plan.Apply(sys, vmgr)) {
+		return
+	}
+
+	vgs, err := vmgr.ScanVGs(nil)
+	ast.Nil(err)
+
+	vg := vgs["vg0"]
+	free := vg.Size - GiB
+	ast.Equal((free/2/disko.ExtentSize)*disko.ExtentSize, vg.Volumes["data"].Size)
+	ast.Equal(((free-vg.Volumes["data"].Size)/disko.ExtentSize)*disko.ExtentSize, vg.Volumes["rest"].Size)
+
+	// Sizes relative to free space do not change on a re-plan.
+	plan, err = layout.NewPlan(sys, vmgr, spec)
+	ast.Nil(err)
+	ast.True(plan.IsEmpty(), "unexpected operations: %s", plan)
+}
+
+// staleCheckSystem refuses to resize a partition of a disk that changed
+// since it was scanned, as the linux System does.
+type staleCheckSystem struct {
+	disko.System
+	resized []uint
+}
+
+// ScanDisk returns a copy of the disk, so that later changes do not show
+// through a disk scanned before them.
+func (s *staleCheckSystem) ScanDisk(path string) (disko.Disk, error) {
+	d, err := s.System.ScanDisk(path)
+	if err != nil {
+		return d, err
+	}
+
+	parts := disko.PartitionSet{}
+	for n, p := range d.Partitions {
+		parts[n] = p
+	}
+
+	d.Partitions = parts
+
+	return d, nil
+}
+
+func (s *staleCheckSystem) ResizePartition(d disko.Disk, number uint, last uint64) error {
+	cur, err := s.ScanDisk(d.Path)
+	if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(cur.Partitions, d.Partitions) {
+		return disko.ErrStaleDisk
+	}
+
+	s.resized = append(s.resized, number)
+
+	return s.System.ResizePartition(d, number, last)
+}
+
+func TestResizePartitionsOperation(t *testing.T) {
+	ast := assert.New(t)
+
+	sys := &staleCheckSystem{System: mockSystem(t)}
+
+	disk, err := sys.ScanDisk("/dev/sda")
+	if !ast.Nil(err) {
+		return
+	}
+
+	ast.Nil(sys.CreatePartitions(disk, disko.PartitionSet{
+		1: {Number: 1, Start: disko.Mebibyte, Last: 10*disko.Mebibyte - 1, Type: partid.LinuxFS},
+		2: {Number: 2, Start: 20 * disko.Mebibyte, Last: 30*disko.Mebibyte - 1, Type: partid.LinuxFS},
+		3: {Number: 3, Start: 40 * disko.Mebibyte, Last: 50*disko.Mebibyte - 1, Type: partid.LinuxFS},
+	}))
+
+	op := layout.Operation{
+		Type: layout.OpResizePartition,
+		Disk: "/dev/sda",
+		Partitions: disko.PartitionSet{
+			3: {Number: 3, Start: 40 * disko.Mebibyte, Last: 60*disko.Mebibyte - 1},
+			1: {Number: 1, Start: disko.Mebibyte, Last: 20*disko.Mebibyte - 1},
+			2: {Number: 2, Start: 20 * disko.Mebibyte, Last: 40*disko.Mebibyte - 1},
+		},
+	}
+
+	if !ast.Nil(op.Run(sys, nil)) {
+		return
+	}
+
+	ast.Equal([]uint{1, 2, 3}, sys.resized)
+
+	disk, err = sys.ScanDisk("/dev/sda")
+	if ast.Nil(err) {
+		ast.Equal(20*disko.Mebibyte-1, disk.Partitions[1].Last)
+		ast.Equal(40*disko.Mebibyte-1, disk.Partitions[2].Last)
+		ast.Equal(60*disko.Mebibyte-1, disk.Partitions[3].Last)
+	}
+}
+
+func TestPlanDiskGUID(t *testing.T) {
+	ast := assert.New(t)
+
+	const guid = "4B1E3C2D-5A6F-4E7D-8C9B-0A1B2C3D4E5F"
+
+	spec, err := layout.Parse([]byte(`
+disks:
+  - id: bulk
+    path: /dev/sdb
+    diskGUID: ` + guid + `
+    partitions:
+      - {name: data, type: LVM, size: 50%}
+`))
+	if !ast.Nil(err) {
+		return
+	}
+
+	sys := mockSystem(t)
+
+	plan, err := layout.NewPlan(sys, nil, spec)
+	if !ast.Nil(err) {
+		return
+	}
+
+	if !ast.Equal([]layout.OpType{layout.OpCreatePartitions}, opTypes(plan)) {
+		return
+	}
+
+	ast.Equal(guid, plan.Operations[0].DiskGUID)
+
+	if !ast.Nil(plan.Apply(sys, nil)) {
+		return
+	}
+
+	disk, err := sys.ScanDisk("/dev/sdb")
+	if ast.Nil(err) {
+		ast.Equal(guid, disk.GPT.DiskGUID.String())
+	}
+
+	// the table exists now, so its GUID is left alone.
+	spec.Disks[0].Partitions = append(spec.Disks[0].Partitions, layout.PartitionSpec{Name: "more", Type: "LVM"})
+
+	plan, err = layout.NewPlan(sys, nil, spec)
+	if ast.Nil(err) && ast.Len(plan.Operations, 1) {
+		ast.Equal("", plan.Operations[0].DiskGUID)
+	}
+}
@@ -0,0 +1,342 @@
+// Package layout - declarative storage layouts.
+//
+// A Spec describes the desired disks, partitions, physical volumes, volume
+// groups and logical volumes of a machine.  NewPlan compares a Spec against
+// the current state reported by a disko.System and disko.VolumeManager and
+// returns the ordered operations needed to reach it.  Applying a plan for a
+// system that already matches the Spec does nothing.
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+// Spec is the desired storage layout of a machine.
+type Spec struct {
+	// Disks are the disks and their partitions.
+	Disks []DiskSpec `json:"disks"`
+
+	// VGs are the volume groups and their logical volumes.
+	VGs []VGSpec `json:"vgs"`
+}
+
+// DiskSpec describes a single disk. The disk is selected by Path if given,
+// otherwise by Match.
+type DiskSpec struct {
+	// ID is the name used to refer to this disk from elsewhere in the Spec.
+	ID string `json:"id"`
+
+	// Path is the device path of the disk.
+	Path string `json:"path,omitempty"`
+
+	// Match selects the disk by its attributes when Path is empty.
+	Match *DiskMatch `json:"match,omitempty"`
+
+	// Table is the partition table type. TableNone means GPT for a disk that
+	// has no table yet and 'any' for a disk that does.
+	Table disko.TableType `json:"table"`
+
+	// DiskGUID is the GUID of a GPT created on the disk, so that an image
+	// gets the same GUID every time it is built.  Empty picks a random one.
+	// The GUID of an existing table is left as it is.
+	DiskGUID string `json:"diskGUID,omitempty"`
+
+	// Wipe allows the disk to be wiped when its existing partitions
+	// conflict with Partitions.  Without Wipe a conflict is an error.
+	Wipe bool `json:"wipe,omitempty"`
+
+	// Partitions are the partitions that should exist on the disk.
+	Partitions []PartitionSpec `json:"partitions"`
+}
+
+// DiskMatch selects a disk by its attributes. Empty fields match anything.
+type DiskMatch struct {
+	// Name is the kernel name of the disk (sda).
+	Name string `json:"name,omitempty"`
+
+	// Type is a disko.DiskType string (HDD, SSD, NVME).
+	Type string `json:"type,omitempty"`
+
+	// Attachment is a disko.AttachmentType string (RAID, ATA...).
+	Attachment string `json:"attachment,omitempty"`
+
+	// MinSize is the smallest acceptable disk size in bytes.
+	MinSize uint64 `json:"minSize,omitempty"`
+
+	// MaxSize is the largest acceptable disk size in bytes.
+	MaxSize uint64 `json:"maxSize,omitempty"`
+
+	// Filter is a disko.ParseDiskFilter expression the disk must also
+	// match ("type=SSD && serial=S66*").
+	Filter string `json:"filter,omitempty"`
+}
+
+// PartitionSpec describes a single partition.
+type PartitionSpec struct {
+	// Number is the partition number.  Zero picks the lowest free number.
+	Number uint `json:"number,omitempty"`
+
+	// Name is the partition name. An existing partition with the same
+	// Name (or Number) is considered to be this partition.
+	Name string `json:"name,omitempty"`
+
+	// Type is the partition type, as a partid.Text name (LVM, Linux-FS)
+	// or as a GUID string.
+	Type string `json:"type,omitempty"`
+
+	// Start is the byte offset of the partition.  Zero places it at the
+	// start of the first free space it fits in.
+	Start uint64 `json:"start,omitempty"`
+
+	// Size is a disko.SizeExpr ("512MiB", "40%", "50%FREE").  Empty uses
+	// all of the selected free space.  Percentages are of the disk size or
+	// of its free space before the partition is added.
+	Size disko.SizeExpr `json:"size,omitempty"`
+}
+
+// VGSpec describes a volume group.
+type VGSpec struct {
+	// Name is the name of the volume group.
+	Name string `json:"name"`
+
+	// PVs are the devices of the volume group. Each is a reference to a
+	// whole disk ("<diskID>"), a partition on a disk ("<diskID>:<name>" or
+	// "<diskID>:<number>"), or a device path ("/dev/sdb").
+	PVs []string `json:"pvs"`
+
+	// LVs are the logical volumes in the volume group.
+	LVs []LVSpec `json:"lvs"`
+}
+
+// LVSpec describes a logical volume.
+type LVSpec struct {
+	// Name is the name of the logical volume.
+	Name string `json:"name"`
+
+	// Size is a disko.SizeExpr ("10GiB", "40%", "100%FREE").  Fixed sizes
+	// are rounded up to a multiple of disko.ExtentSize.  Relative sizes are
+	// resolved against the volume group when the logical volume is created;
+	// an existing logical volume sized relative to free space is left as is.
+	Size disko.SizeExpr `json:"size"`
+
+	// Type is the logical volume type.
+	Type disko.LVType `json:"type"`
+
+	// Pool is the thin pool a THIN logical volume is created in. The pool
+	// must be listed before the volume.
+	Pool string `json:"pool,omitempty"`
+
+	// Encrypt sets up LUKS encryption on the logical volume with Key.
+	Encrypt bool `json:"encrypt,omitempty"`
+
+	// Key is the LUKS key.
+	Key string `json:"key,omitempty"`
+
+	// DecryptedName is the name to open the encrypted volume as.  Empty
+	// leaves the volume closed.
+	DecryptedName string `json:"decryptedName,omitempty"`
+}
+
+// Parse reads a Spec from a JSON or YAML document.
+func Parse(data []byte) (Spec, error) {
+	spec := Spec{}
+
+	if err := json.Unmarshal(data, &spec); err == nil {
+		return spec, spec.Validate()
+	}
+
+	// Go through json so that the custom unmarshallers of the disko types
+	// are honored for YAML input as well.
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return spec, fmt.Errorf("failed to parse layout: %s", err)
+	}
+
+	jbytes, err := json.Marshal(doc)
+	if err != nil {
+		return spec, fmt.Errorf("failed to convert layout to json: %s", err)
+	}
+
+	if err := json.Unmarshal(jbytes, &spec); err != nil {
+		return spec, fmt.Errorf("failed to parse layout: %s", err)
+	}
+
+	return spec, spec.Validate()
+}
+
+// Validate checks the Spec for internal consistency.
+func (s Spec) Validate() error {
+	diskIDs := map[string]bool{}
+
+	for _, ds := range s.Disks {
+		if ds.ID == "" {
+			return fmt.Errorf("disk with path '%s' has no id", ds.Path)
+		}
+
+		if diskIDs[ds.ID] {
+			return fmt.Errorf("duplicate disk id '%s'", ds.ID)
+		}
+
+		diskIDs[ds.ID] = true
+
+		if ds.Path == "" && ds.Match == nil {
+			return fmt.Errorf("disk '%s' has neither path nor match", ds.ID)
+		}
+
+		if ds.Match != nil {
+			if _, err := disko.ParseDiskFilter(ds.Match.Filter); err != nil {
+				return fmt.Errorf("disk '%s': %s", ds.ID, err)
+			}
+		}
+
+		if ds.DiskGUID != "" {
+			if ds.Table == disko.MBR {
+				return fmt.Errorf("disk '%s' has a diskGUID but an MBR table", ds.ID)
+			}
+
+			if _, err := disko.StringToGUID(ds.DiskGUID); err != nil {
+				return fmt.Errorf("disk '%s': bad diskGUID '%s': %s", ds.ID, ds.DiskGUID, err)
+			}
+		}
+
+		names := map[string]bool{}
+		nums := map[uint]bool{}
+
+		for i, ps := range ds.Partitions {
+			if ps.Name == "" && ps.Number == 0 {
+				return fmt.Errorf("disk '%s' partition %d has neither name nor number", ds.ID, i)
+			}
+
+			if ps.Name != "" {
+				if names[ps.Name] {
+					return fmt.Errorf("disk '%s' has duplicate partition name '%s'", ds.ID, ps.Name)
+				}
+
+				names[ps.Name] = true
+			}
+
+			if ps.Number != 0 {
+				if nums[ps.Number] {
+					return fmt.Errorf("disk '%s' has duplicate partition number %d", ds.ID, ps.Number)
+				}
+
+				nums[ps.Number] = true
+			}
+
+			if _, err := ps.partType(); err != nil {
+				return fmt.Errorf("disk '%s' partition %d: %s", ds.ID, i, err)
+			}
+
+			if err := ps.Size.Validate(); err != nil {
+				return fmt.Errorf("disk '%s' partition %d: %s", ds.ID, i, err)
+			}
+		}
+	}
+
+	vgNames := map[string]bool{}
+
+	for _, vs := range s.VGs {
+		if vs.Name == "" {
+			return fmt.Errorf("volume group with no name")
+		}
+
+		if vgNames[vs.Name] {
+			return fmt.Errorf("duplicate volume group '%s'", vs.Name)
+		}
+
+		vgNames[vs.Name] = true
+
+		if len(vs.PVs) == 0 {
+			return fmt.Errorf("volume group '%s' has no pvs", vs.Name)
+		}
+
+		for _, ref := range vs.PVs {
+			if strings.HasPrefix(ref, "/") {
+				continue
+			}
+
+			if id := strings.SplitN(ref, ":", 2)[0]; !diskIDs[id] {
+				return fmt.Errorf("volume group '%s' pv '%s' refers to unknown disk '%s'", vs.Name, ref, id)
+			}
+		}
+
+		pools := map[string]bool{}
+
+		for _, ls := range vs.LVs {
+			if ls.Name == "" {
+				return fmt.Errorf("volume group '%s' has a logical volume with no name", vs.Name)
+			}
+
+			// thin pools have to be listed before the volumes in them.
+			if ls.Type == disko.THINPOOL {
+				pools[ls.Name] = true
+			} else if ls.Type == disko.THIN && !pools[ls.Pool] {
+				return fmt.Errorf("thin logical volume %s/%s: pool '%s' is not a thin pool listed before it",
+					vs.Name, ls.Name, ls.Pool)
+			}
+
+			if ls.Encrypt && ls.Key == "" {
+				return fmt.Errorf("encrypted logical volume %s/%s has no key", vs.Name, ls.Name)
+			}
+
+			if err := ls.Size.Validate(); err != nil {
+				return fmt.Errorf("logical volume %s/%s: %s", vs.Name, ls.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// partType returns the disko.PartType for the Type string.
+func (ps PartitionSpec) partType() (disko.PartType, error) {
+	if ps.Type == "" {
+		return disko.PartType(partid.LinuxFS), nil
+	}
+
+	for id, text := range partid.Text {
+		if strings.EqualFold(text, ps.Type) {
+			return disko.PartType(id), nil
+		}
+	}
+
+	ptype, err := disko.StringToPartType(ps.Type)
+	if err != nil {
+		return ptype, fmt.Errorf("unknown partition type '%s'", ps.Type)
+	}
+
+	return ptype, nil
+}
+
+// matches returns true if the disk is accepted by the DiskMatch.
+func (m DiskMatch) matches(d disko.Disk) bool {
+	if m.Name != "" && m.Name != d.Name {
+		return false
+	}
+
+	if m.Type != "" && !strings.EqualFold(m.Type, d.Type.String()) {
+		return false
+	}
+
+	if m.Attachment != "" && !strings.EqualFold(m.Attachment, d.Attachment.String()) {
+		return false
+	}
+
+	if m.MinSize != 0 && d.Size < m.MinSize {
+		return false
+	}
+
+	if m.MaxSize != 0 && d.Size > m.MaxSize {
+		return false
+	}
+
+	filter, err := disko.ParseDiskFilter(m.Filter)
+
+	return err == nil && filter(d)
+}
@@ -0,0 +1,167 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"machinerun.io/disko"
+)
+
+// gptReservedSectors is the number of sectors at each end of the disk that
+// a GPT with the usual 128 entry array uses.  A backup always covers at
+// least this much so that restoring an MBR or no table over a GPT also
+// removes the GPT.
+const gptReservedSectors = 34
+
+// BackupPartitionTable saves the partition table of d.  A disk with no
+// table is saved too, restoring it removes any table created since.
+func BackupPartitionTable(d disko.Disk) (disko.TableBackup, error) {
+	fp, err := os.Open(d.Path)
+	if err != nil {
+		return disko.TableBackup{}, err
+	}
+	defer fp.Close()
+
+	size, err := getFileSize(fp)
+	if err != nil {
+		return disko.TableBackup{}, err
+	}
+
+	parts, ttype, ssize, err := findPartitions(fp)
+	if err != nil {
+		return disko.TableBackup{}, fmt.Errorf("failed to read partition table of %s: %w", d.Path, err)
+	}
+
+	if ttype != disko.GPT {
+		ssize = d.SectorSize
+		if ssize == 0 {
+			ssize = sectorSize512
+		}
+	}
+
+	b := disko.TableBackup{
+		Disk:       d.Path,
+		Identity:   d.Identity,
+		Size:       size,
+		SectorSize: ssize,
+		Table:      ttype,
+		Partitions: parts,
+	}
+
+	headLen := uint64(ssize) * gptReservedSectors
+	tailLen := uint64(ssize) * (gptReservedSectors - 1)
+
+	if ttype == disko.GPT {
+		gptTable, _, err := readGPTTableSearch(fp, []uint{ssize})
+		if err != nil {
+			return disko.TableBackup{}, err
+		}
+
+		b.DiskGUID = disko.GUID(gptTable.Header.DiskGUID).String()
+
+		for n, p := range gptTable.Partitions {
+			flags := binary.LittleEndian.Uint64(p.Flags[:])
+			if flags == 0 {
+				continue
+			}
+
+			if b.Attributes == nil {
+				b.Attributes = map[uint]uint64{}
+			}
+
+			b.Attributes[uint(n+1)] = flags
+		}
+
+		hdr := gptTable.Header
+		entriesLen := uint64(hdr.PartitionsArrLen) * uint64(hdr.PartitionEntrySize)
+
+		if end := hdr.PartitionsTableStartLBA*uint64(ssize) + entriesLen; end > headLen {
+			headLen = Ceiling(end, uint64(ssize))
+		}
+
+		if start := (hdr.LastUsableLBA + 1) * uint64(ssize); size-start > tailLen {
+			tailLen = size - start
+		}
+	}
+
+	if headLen+tailLen > size {
+		return disko.TableBackup{}, fmt.Errorf("disk %s of size %d is too small to back up", d.Path, size)
+	}
+
+	if b.Head, err = readAt(fp, 0, headLen); err != nil {
+		return disko.TableBackup{}, err
+	}
+
+	if b.Tail, err = readAt(fp, int64(size-tailLen), tailLen); err != nil {
+		return disko.TableBackup{}, err
+	}
+
+	return b, nil
+}
+
+func readAt(fp io.ReaderAt, offset int64, length uint64) ([]byte, error) {
+	buf := make([]byte, length)
+	if _, err := fp.ReadAt(buf, offset); err != nil {
+		return nil, fmt.Errorf("failed to read %d bytes at %d: %w", length, offset, err)
+	}
+
+	return buf, nil
+}
+
+// restorePartitionTable writes the table in b back onto d and tells the
+// kernel about the restored partitions.
+func restorePartitionTable(ctx context.Context, d disko.Disk, b disko.TableBackup) error {
+	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
+		if _, err := fp.WriteAt(b.Head, 0); err != nil {
+			return fmt.Errorf("failed to restore start of %s: %w", d.Path, err)
+		}
+
+		if _, err := fp.WriteAt(b.Tail, int64(d.Size)-int64(len(b.Tail))); err != nil {
+			return fmt.Errorf("failed to restore end of %s: %w", d.Path, err)
+		}
+
+		if b.Table == disko.GPT {
+			// Read the table back and rewrite it so that both copies are
+			// consistent with each other and this disk.
+			gptTable, _, err := readGPTTableSearch(fp, []uint{b.SectorSize})
+			if err != nil {
+				return fmt.Errorf("restored table on %s is not valid: %w", d.Path, err)
+			}
+
+			if _, err := writeGPTTable(fp, gptTable, d.Size); err != nil {
+				return err
+			}
+		}
+
+		if err := fp.Sync(); err != nil {
+			return err
+		}
+
+		if fInfo.Mode()&os.ModeDevice == 0 {
+			return nil
+		}
+
+		pNums := []uint{}
+		for n := range d.Partitions {
+			pNums = append(pNums, n)
+		}
+
+		if err := kernelDelParts(ctx, d, pNums); err != nil {
+			return err
+		}
+
+		return kernelAddParts(ctx, d, b.Partitions)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := udevSettle(ctx); err != nil {
+		return err
+	}
+
+	return genPartChangeUEvent(d, b.Partitions)
+}
@@ -0,0 +1,117 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+)
+
+func TestBackupRestoreGPT(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 50*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	backup, err := BackupPartitionTable(disk)
+	if err != nil {
+		t.Fatalf("Failed to back up %s: %s", disk.Path, err)
+	}
+
+	ast.Equal(disko.GPT, backup.Table)
+	ast.Equal(uint(sectorSize512), backup.SectorSize)
+	ast.Equal(disk.Size, backup.Size)
+	ast.NotEmpty(backup.DiskGUID)
+	ast.Equal(disk.Partitions, backup.Partitions)
+	ast.Len(backup.Head, 34*sectorSize512)
+	ast.Len(backup.Tail, 33*sectorSize512)
+
+	bpath := path.Join(tmpd, "backup.json")
+	if err := disko.SaveTableBackup(bpath, backup); err != nil {
+		t.Fatalf("Failed to save backup: %s", err)
+	}
+
+	loaded, err := disko.LoadTableBackup(bpath)
+	if err != nil {
+		t.Fatalf("Failed to load backup: %s", err)
+	}
+
+	ast.Equal(backup, loaded)
+
+	if err := wipeDisk(context.Background(), disk); err != nil {
+		t.Fatalf("Failed to wipe disk: %s", err)
+	}
+
+	sys := System()
+
+	wiped, err := sys.ScanDisk(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", disk.Path, err)
+	}
+
+	ast.ErrorIs(sys.RestorePartitionTable(disk, loaded), disko.ErrStaleDisk)
+
+	if err := sys.RestorePartitionTable(wiped, loaded); err != nil {
+		t.Fatalf("Failed to restore table: %s", err)
+	}
+
+	fp, err := os.Open(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to open disk: %s", err)
+	}
+	defer fp.Close()
+
+	pSet, tType, _, err := findPartitions(fp)
+	if err != nil {
+		t.Fatalf("Failed to read restored table: %s", err)
+	}
+
+	ast.Equal(disko.GPT, tType)
+	ast.Equal(disk.Partitions, pSet)
+
+	restored, err := BackupPartitionTable(disk)
+	if err != nil {
+		t.Fatalf("Failed to back up restored disk: %s", err)
+	}
+
+	ast.Equal(backup.DiskGUID, restored.DiskGUID)
+}
+
+func TestRestoreWrongSize(t *testing.T) {
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 50*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	backup, err := BackupPartitionTable(disk)
+	if err != nil {
+		t.Fatalf("Failed to back up %s: %s", disk.Path, err)
+	}
+
+	disk.Size += disko.Mebibyte
+
+	err = System().RestorePartitionTable(disk, backup)
+	if !errors.Is(err, disko.ErrOutOfRange) {
+		t.Errorf("Expected ErrOutOfRange restoring onto a larger disk, got %v", err)
+	}
+}
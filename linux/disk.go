@@ -2,6 +2,8 @@ package linux
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +11,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"unicode/utf16"
@@ -18,6 +21,7 @@ import (
 	"golang.org/x/sys/unix"
 	"machinerun.io/disko"
 	"machinerun.io/disko/partid"
+	"machinerun.io/disko/probe"
 )
 
 const (
@@ -45,7 +49,7 @@ func toGPTPartition(p disko.Partition, sectorSize uint) gpt.Partition {
 		Id:            gpt.Guid(p.ID),
 		FirstLBA:      Floor(p.Start, uint64(sectorSize)) / uint64(sectorSize),
 		LastLBA:       Floor(p.Last, uint64(sectorSize)) / uint64(sectorSize),
-		Flags:         gpt.Flags{},
+		Flags:         toGPTFlags(p.Attributes),
 		PartNameUTF16: getPartName(p.Name),
 		TrailingBytes: []byte{},
 	}
@@ -53,14 +57,35 @@ func toGPTPartition(p disko.Partition, sectorSize uint) gpt.Partition {
 
 // gptToDiskoPartition - convert the gpt.Partition type to a disko.Partition
 func gptToDiskoPartition(p gpt.Partition, num uint, sectorSize uint) disko.Partition {
-	// this is lossy on TrailingBytes  and Flags :-(
+	// this is lossy on TrailingBytes :-(
 	return disko.Partition{
-		Start:  p.FirstLBA * uint64(sectorSize),
-		Last:   p.LastLBA*uint64(sectorSize) + uint64(sectorSize-1),
-		ID:     disko.GUID(p.Id),
-		Type:   disko.PartType(p.Type),
-		Name:   p.Name(),
-		Number: num,
+		Start:      p.FirstLBA * uint64(sectorSize),
+		Last:       p.LastLBA*uint64(sectorSize) + uint64(sectorSize-1),
+		ID:         disko.GUID(p.Id),
+		Type:       disko.PartType(p.Type),
+		Name:       p.Name(),
+		Number:     num,
+		Attributes: disko.PartAttrs(binary.LittleEndian.Uint64(p.Flags[:])),
+	}
+}
+
+// toGPTFlags - convert partition attributes to the little endian flags of
+// a gpt partition entry.
+func toGPTFlags(attrs disko.PartAttrs) gpt.Flags {
+	flags := gpt.Flags{}
+	binary.LittleEndian.PutUint64(flags[:], uint64(attrs))
+
+	return flags
+}
+
+// gptToDiskoHeader - convert the gpt.Header type to a disko.GPTHeader
+func gptToDiskoHeader(h gpt.Header) disko.GPTHeader {
+	return disko.GPTHeader{
+		DiskGUID:           disko.GUID(h.DiskGUID),
+		FirstUsableLBA:     h.FirstUsableLBA,
+		LastUsableLBA:      h.LastUsableLBA,
+		PartitionEntries:   h.PartitionsArrLen,
+		PartitionEntrySize: h.PartitionEntrySize,
 	}
 }
 
@@ -134,6 +159,97 @@ func getAttachType(udInfo disko.UdevInfo) disko.AttachmentType {
 	return attach
 }
 
+// getDiskIdentity returns the identity of the disk from its udev info.
+func getDiskIdentity(udInfo disko.UdevInfo) disko.DiskIdentity {
+	props := udInfo.Properties
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := strings.TrimSpace(props[k]); v != "" {
+				return v
+			}
+		}
+
+		return ""
+	}
+
+	id := disko.DiskIdentity{
+		Serial:   first("ID_SERIAL_SHORT", "ID_SERIAL"),
+		WWN:      first("ID_WWN_WITH_EXTENSION", "ID_WWN"),
+		Model:    strings.TrimSpace(decodeUdevEnc(props["ID_MODEL_ENC"])),
+		Vendor:   strings.TrimSpace(decodeUdevEnc(props["ID_VENDOR_ENC"])),
+		Firmware: first("ID_REVISION"),
+	}
+
+	if id.Model == "" {
+		id.Model = first("ID_MODEL")
+	}
+
+	if id.Vendor == "" {
+		id.Vendor = first("ID_VENDOR")
+	}
+
+	for _, link := range udInfo.Symlinks {
+		if !strings.HasPrefix(link, "/") {
+			link = "/dev/" + link
+		}
+
+		if strings.HasPrefix(link, "/dev/disk/by-id/") {
+			id.ByID = append(id.ByID, link)
+		} else if strings.HasPrefix(link, "/dev/disk/by-path/") {
+			id.ByPath = append(id.ByPath, link)
+		}
+	}
+
+	return id
+}
+
+// decodeUdevEnc decodes the \xNN escapes udev uses in *_ENC properties.
+func decodeUdevEnc(s string) string {
+	const escLen = 4
+
+	var buf strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+escLen <= len(s) && s[i+1] == 'x' {
+			if b, err := strconv.ParseUint(s[i+2:i+escLen], 16, 8); err == nil {
+				buf.WriteByte(byte(b))
+				i += escLen - 1
+
+				continue
+			}
+		}
+
+		buf.WriteByte(s[i])
+	}
+
+	return buf.String()
+}
+
+// mergeDiskIdentity fills the empty fields of id with those of other.
+func mergeDiskIdentity(id, other disko.DiskIdentity) disko.DiskIdentity {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+
+	fill(&id.Serial, other.Serial)
+	fill(&id.WWN, other.WWN)
+	fill(&id.Model, other.Model)
+	fill(&id.Vendor, other.Vendor)
+	fill(&id.Firmware, other.Firmware)
+
+	if len(id.ByID) == 0 {
+		id.ByID = other.ByID
+	}
+
+	if len(id.ByPath) == 0 {
+		id.ByPath = other.ByPath
+	}
+
+	return id
+}
+
 func readGPTTableSearch(fp io.ReadSeeker, sizes []uint) (gpt.Table, uint, error) {
 	const noGptFound = "Bad GPT signature"
 	var gptTable gpt.Table
@@ -198,48 +314,80 @@ func readMBRTable(fp io.ReadSeeker) (disko.PartitionSet, error) {
 }
 
 func findPartitions(fp io.ReadSeeker) (disko.PartitionSet, disko.TableType, uint, error) {
-	var err error
-	var ssize uint
-	var gptTable gpt.Table
+	parts, tType, ssize, _, err := findPartitionsCheck(fp)
+	return parts, tType, ssize, err
+}
 
-	gptTable, ssize, err = readGPTTable(fp)
+// findPartitionsCheck is findPartitions that also returns the check of the
+// GPT, if the disk has one.  The partitions come from the backup GPT if the
+// primary is not valid.
+func findPartitionsCheck(fp io.ReadSeeker) (disko.PartitionSet, disko.TableType, uint, gptCheck, error) {
+	size, err := fp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return disko.PartitionSet{}, disko.TableNone, 0, gptCheck{}, err
+	}
+
+	check, err := checkGPT(fp, uint64(size))
 	if err == ErrNoPartitionTable {
 		parts, err := readMBRTable(fp)
 		if err == ErrNoPartitionTable {
-			return parts, disko.TableNone, ssize, nil
+			return parts, disko.TableNone, 0, check, nil
 		}
 
-		return parts, disko.MBR, sectorSize512, err
+		return parts, disko.MBR, sectorSize512, check, err
 	}
 
+	gptTable, err := check.table()
 	if err != nil {
-		return disko.PartitionSet{}, disko.GPT, ssize, err
+		return disko.PartitionSet{}, disko.GPT, check.ssize, check, err
 	}
 
 	parts := disko.PartitionSet{}
-	ssize64 := uint64(ssize)
 
 	for n, p := range gptTable.Partitions {
 		if p.IsEmpty() {
 			continue
 		}
 
-		part := disko.Partition{
-			Start:  p.FirstLBA * ssize64,
-			Last:   p.LastLBA*ssize64 + ssize64 - 1,
-			ID:     disko.GUID(p.Id),
-			Type:   disko.PartType(p.Type),
-			Name:   p.Name(),
-			Number: uint(n + 1),
-		}
+		part := gptToDiskoPartition(p, uint(n+1), check.ssize)
 		parts[part.Number] = part
 	}
 
-	return parts, disko.GPT, ssize, nil
+	return parts, disko.GPT, check.ssize, check, nil
+}
+
+// probeSignatures fills in what the partitions of d contain, or what the
+// whole disk contains if it has no partition table.  A disk or partition
+// that cannot be read is given a Signature with only the ProbeError, so that
+// one bad sector does not fail the scan of the disk.
+func probeSignatures(fp io.ReaderAt, d *disko.Disk) {
+	if d.Table == disko.TableNone {
+		d.Signature = probeSignature(fp, d.Size)
+		return
+	}
+
+	for n, p := range d.Partitions {
+		p.Signature = probeSignature(io.NewSectionReader(fp, int64(p.Start), int64(p.Size())), p.Size())
+		d.Partitions[n] = p
+	}
+}
+
+func probeSignature(fp io.ReaderAt, size uint64) disko.Signature {
+	sig, err := probe.Probe(fp, size)
+	if err != nil {
+		return disko.Signature{ProbeError: err.Error()}
+	}
+
+	return sig
 }
 
+// realDiskKnameRegex matches the kernel names of the disks that
+// ScanAllDisks scans and Watch reports.
+//
+//nolint:gochecknoglobals
+var realDiskKnameRegex = regexp.MustCompile("^((s|v|xv|h)d[a-z]|nvme[0-9]n[0-9]|mmcblk[0-9]+)$")
+
 func getDiskNames() ([]string, error) {
-	realDiskKnameRegex := regexp.MustCompile("^((s|v|xv|h)d[a-z]|nvme[0-9]n[0-9]|mmcblk[0-9]+)$")
 	disks := []string{}
 
 	files, err := os.ReadDir("/sys/block")
@@ -346,14 +494,14 @@ func getPartName(s string) [72]byte {
 	return b
 }
 
-func wipeDisk(disk disko.Disk) error {
+func wipeDisk(ctx context.Context, disk disko.Disk) error {
 	fp, err := os.OpenFile(disk.Path, os.O_RDWR, 0)
 	if err != nil {
 		return err
 	}
 	defer fp.Close()
 
-	if err := zeroStartEnd(fp, int64(0), int64(disk.Size)); err != nil {
+	if err := zeroStartEnd(ctx, fp, int64(0), int64(disk.Size)); err != nil {
 		return err
 	}
 
@@ -365,7 +513,7 @@ func wipeDisk(disk disko.Disk) error {
 			end = disk.Size
 		}
 
-		if err := zeroStartEnd(fp, int64(p.Start), int64(end)); err != nil {
+		if err := zeroStartEnd(ctx, fp, int64(p.Start), int64(end)); err != nil {
 			return err
 		}
 	}
@@ -374,7 +522,8 @@ func wipeDisk(disk disko.Disk) error {
 }
 
 // zeroStartEnd - zero the start and end provided with 1MiB bytes of zeros.
-func zeroStartEnd(fp io.WriteSeeker, start int64, last int64) error {
+// It stops before the next write once ctx is done.
+func zeroStartEnd(ctx context.Context, fp io.WriteSeeker, start int64, last int64) error {
 	if last <= start {
 		return fmt.Errorf("last %d < start %d", last, start)
 	}
@@ -413,6 +562,10 @@ func zeroStartEnd(fp io.WriteSeeker, start int64, last int64) error {
 	}
 
 	for _, w := range writes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if _, err = fp.Seek(w.start, io.SeekStart); err != nil {
 			return fmt.Errorf("failed to seek to %d to write %v", w.start, w)
 		}
@@ -430,8 +583,8 @@ func zeroStartEnd(fp io.WriteSeeker, start int64, last int64) error {
 	return nil
 }
 
-func addPartitionSetMBR(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.PartitionSet) error {
-	if err := rangeCheckParts(d, pSet); err != nil {
+func addPartitionSetMBR(ctx context.Context, fp io.ReadWriteSeeker, d disko.Disk, pSet disko.PartitionSet) error {
+	if err := d.CheckPartitionRanges(pSet); err != nil {
 		return err
 	}
 
@@ -448,12 +601,16 @@ func addPartitionSetMBR(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Partitio
 		if err := mbrTable.Check(); err != nil {
 			return err
 		}
-	} else {
+	} else if err != nil {
 		return err
 	}
 
 	for _, p := range pSet {
 		mPart := mbrTable.GetPartition(int(p.Number))
+		if !mPart.IsEmpty() {
+			return &disko.PartitionError{Disk: d.Path, Number: p.Number, Err: disko.ErrPartitionExists}
+		}
+
 		mPart.SetLBAStart(uint32(p.Start) / uint32(d.SectorSize))
 		mPart.SetLBALen(uint32(p.Size()) / uint32(d.SectorSize))
 		mType, err := partid.PartTypeToMBR(p.Type)
@@ -464,7 +621,7 @@ func addPartitionSetMBR(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Partitio
 
 		mPart.SetType(mbr.PartitionType(mType))
 
-		if err := zeroStartEnd(fp, int64(p.Start), int64(p.Last)); err != nil {
+		if err := zeroStartEnd(ctx, fp, int64(p.Start), int64(p.Last)); err != nil {
 			return fmt.Errorf("failed to zero partition %d: %s", p.Number, err)
 		}
 	}
@@ -481,7 +638,7 @@ func addPartitionSetMBR(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Partitio
 }
 
 func updatePartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.PartitionSet) error {
-	gptTable, _, err := readGPTTableSearch(fp, []uint{d.SectorSize})
+	gptTable, err := readGPTForWrite(fp, d)
 	if err != nil {
 		return err
 	}
@@ -491,18 +648,18 @@ func updatePartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Parti
 	for n, p := range pSet {
 		gPart := gptTable.Partitions[n-1]
 		if gPart.IsEmpty() {
-			return fmt.Errorf("cannot update disk %s.Path partition %d: partition does not exist",
-				d.Path, p.Number)
+			return &disko.PartitionError{Disk: d.Path, Number: n, Err: disko.ErrPartitionNotFound,
+				Detail: "cannot update"}
 		}
 
 		newPt := gptToDiskoPartition(gPart, n, d.SectorSize)
 
-		// Only the GUID, Type and Name get updated.
-		if newPt.ID != emptyGUID {
+		// Only the GUID, Type, Name and Attributes get updated.
+		if p.ID != emptyGUID {
 			newPt.ID = p.ID
 		}
 
-		if newPt.Type != partid.Empty {
+		if p.Type != partid.Empty {
 			newPt.Type = p.Type
 		}
 
@@ -510,8 +667,14 @@ func updatePartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Parti
 			newPt.Name = p.Name
 		}
 
+		if p.Attributes != 0 {
+			newPt.Attributes = p.Attributes
+		}
+
 		newParts[n] = newPt
-		gptTable.Partitions[n-1] = toGPTPartition(newPt, d.SectorSize)
+		newGPart := toGPTPartition(newPt, d.SectorSize)
+		newGPart.TrailingBytes = gPart.TrailingBytes
+		gptTable.Partitions[n-1] = newGPart
 	}
 
 	if _, err := writeGPTTable(fp, gptTable, d.Size); err != nil {
@@ -522,12 +685,12 @@ func updatePartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Parti
 }
 
 func updatePartitionSetMBR(_ *os.File, d disko.Disk, pSet disko.PartitionSet) error {
-	return fmt.Errorf("MBR partition update is not implemented. Cannot update %d partitions on %s",
-		len(pSet), d.Path)
+	return fmt.Errorf("%w: MBR partition update is not implemented. Cannot update %d partitions on %s",
+		disko.ErrUnsupportedTable, len(pSet), d.Path)
 }
 
 //nolint:scopelint // https://github.com/kyoh86/scopelint/issues/12
-func updatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
+func updatePartitions(ctx context.Context, d disko.Disk, pSet disko.PartitionSet) error {
 	err := withLockedFile(d.Path,
 		func(fp *os.File, fInfo os.FileInfo) error {
 			if d.Table == disko.MBR {
@@ -535,66 +698,29 @@ func updatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
 			} else if d.Table == disko.GPT {
 				return updatePartitionSetGPT(fp, d, pSet)
 			} else if d.Table == disko.TableNone {
-				return fmt.Errorf("cannot update partitions on disk %s: it has no partition table",
-					d.Name)
+				return fmt.Errorf("cannot update partitions on disk %s: it has no partition table: %w",
+					d.Name, disko.ErrUnsupportedTable)
 			}
 			return fmt.Errorf(
-				"cannot update partitions on disk %s: partition table '%s' is not supported",
-				d.Name, d.Table)
+				"cannot update partitions on disk %s: partition table '%s': %w",
+				d.Name, d.Table, disko.ErrUnsupportedTable)
 		})
 
 	if err != nil {
 		return err
 	}
 
-	if err := udevSettle(); err != nil {
+	if err := udevSettle(ctx); err != nil {
 		return err
 	}
 
 	return genPartChangeUEvent(d, pSet)
 }
 
-func rangeCheckParts(d disko.Disk, pSet disko.PartitionSet) error {
-	maxSize := d.Size
-
-	if d.Table == disko.MBR {
-		maxSize = uint64(max32) * uint64(d.SectorSize)
-	}
-
-	maxEnd := ((maxSize - uint64(d.SectorSize)*33) / disko.Mebibyte) * disko.Mebibyte
-	minStart := disko.Mebibyte
-
-	const minPartNum, maxPartNumMBR, maxPartNumGPT = 1, 4, 128
-
-	maxPartNum := uint(maxPartNumGPT)
-	if d.Table == disko.MBR {
-		maxPartNum = uint(maxPartNumMBR)
-	}
-
-	for _, p := range pSet {
-		if p.Number < uint(minPartNum) || p.Number > maxPartNum {
-			return fmt.Errorf("partition number %d is out of range (%d-%d) for %s",
-				p.Number, minPartNum, maxPartNum, d.Table)
-		}
-
-		if p.Start < minStart {
-			return fmt.Errorf("partition %d start (%d) is too low. Must be >= %d",
-				p.Number, p.Start, minStart)
-		}
-
-		if p.Last >= maxEnd {
-			return fmt.Errorf("partition %d Last (%d) is too high. Must be < %d",
-				p.Number, p.Last, maxEnd)
-		}
-	}
-
-	return nil
-}
-
-func addPartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.PartitionSet) error {
-	gptTable, _, err := readGPTTableSearch(fp, []uint{d.SectorSize})
+func addPartitionSetGPT(ctx context.Context, fp io.ReadWriteSeeker, d disko.Disk, pSet disko.PartitionSet) error {
+	gptTable, err := readGPTForWrite(fp, d)
 	if err == ErrNoPartitionTable {
-		gptTable, err = writeNewGPTTable(fp, d.SectorSize, d.Size)
+		gptTable, err = writeNewGPTTable(fp, d.SectorSize, d.Size, d.GPT.DiskGUID)
 		if err != nil {
 			return err
 		}
@@ -602,23 +728,14 @@ func addPartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Partitio
 		return err
 	}
 
-	maxEnd := ((d.Size - uint64(d.SectorSize)*33) / disko.Mebibyte) * disko.Mebibyte
-	minStart := disko.Mebibyte
-
 	for _, p := range pSet {
-		gptTable.Partitions[p.Number-1] = toGPTPartition(p, d.SectorSize)
-
-		if p.Start < minStart {
-			return fmt.Errorf("partition %d start (%d) is too low. Must be >= %d",
-				p.Number, p.Start, minStart)
+		if !gptTable.Partitions[p.Number-1].IsEmpty() {
+			return &disko.PartitionError{Disk: d.Path, Number: p.Number, Err: disko.ErrPartitionExists}
 		}
 
-		if p.Last >= maxEnd {
-			return fmt.Errorf("partition %d Last (%d) is too high. Must be < %d",
-				p.Number, p.Last, maxEnd)
-		}
+		gptTable.Partitions[p.Number-1] = toGPTPartition(p, d.SectorSize)
 
-		if err := zeroStartEnd(fp, int64(p.Start), int64(p.Last)); err != nil {
+		if err := zeroStartEnd(ctx, fp, int64(p.Start), int64(p.Last)); err != nil {
 			return fmt.Errorf("failed to zero partition %d: %s", p.Number, err)
 		}
 	}
@@ -635,12 +752,13 @@ func addPartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pSet disko.Partitio
 //	Caller's responsibility to udevSettle
 //
 //nolint:scopelint // https://github.com/kyoh86/scopelint/issues/12
-func addPartitionSet(d disko.Disk, pSet disko.PartitionSet) error {
+func addPartitionSet(ctx context.Context, d disko.Disk, pSet disko.PartitionSet) error {
 	if d.Table != disko.MBR && d.Table != disko.GPT && d.Table != disko.TableNone {
-		return fmt.Errorf("cannot add partition disk %s with table type %s", d.Name, d.Table)
+		return fmt.Errorf("cannot add partition disk %s with table type %s: %w",
+			d.Name, d.Table, disko.ErrUnsupportedTable)
 	}
 
-	if err := rangeCheckParts(d, pSet); err != nil {
+	if err := d.CheckPartitionRanges(pSet); err != nil {
 		return err
 	}
 
@@ -649,11 +767,11 @@ func addPartitionSet(d disko.Disk, pSet disko.PartitionSet) error {
 	// because of the lock.  After lock is given up, generate Change events.
 	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
 		if d.Table == disko.MBR {
-			if err := addPartitionSetMBR(fp, d, pSet); err != nil {
+			if err := addPartitionSetMBR(ctx, fp, d, pSet); err != nil {
 				return err
 			}
 		} else {
-			if err := addPartitionSetGPT(fp, d, pSet); err != nil {
+			if err := addPartitionSetGPT(ctx, fp, d, pSet); err != nil {
 				return err
 			}
 		}
@@ -662,21 +780,21 @@ func addPartitionSet(d disko.Disk, pSet disko.PartitionSet) error {
 			return nil
 		}
 
-		return kernelAddParts(d, pSet)
+		return kernelAddParts(ctx, d, pSet)
 	})
 
 	if err != nil {
 		return err
 	}
 
-	if err := udevSettle(); err != nil {
+	if err := udevSettle(ctx); err != nil {
 		return err
 	}
 
 	return genPartChangeUEvent(d, pSet)
 }
 
-func deletePartitionSetMBR(fp io.ReadWriteSeeker, pNums []uint) error {
+func deletePartitionSetMBR(fp io.ReadWriteSeeker, d disko.Disk, pNums []uint) error {
 	if _, err := fp.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
@@ -688,10 +806,14 @@ func deletePartitionSetMBR(fp io.ReadWriteSeeker, pNums []uint) error {
 
 	for _, pNum := range pNums {
 		if pNum < 1 || pNum > 4 {
-			return fmt.Errorf("cannot delete partition %d from MBR. Invalid number", pNum)
+			return &disko.PartitionError{Disk: d.Path, Number: pNum, Err: disko.ErrOutOfRange,
+				Detail: "cannot delete partition from MBR. Invalid number"}
 		}
 
 		pt := mbrTable.GetPartition(int(pNum))
+		if pt.IsEmpty() {
+			return &disko.PartitionError{Disk: d.Path, Number: pNum, Err: disko.ErrPartitionNotFound}
+		}
 
 		// pt.SetBootable(false) // https://github.com/rekby/mbr/pull/3/commits
 		pt.SetType(mbr.PART_EMPTY)
@@ -707,7 +829,7 @@ func deletePartitionSetMBR(fp io.ReadWriteSeeker, pNums []uint) error {
 }
 
 func deletePartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pNums []uint) error {
-	gptTable, _, err := readGPTTableSearch(fp, []uint{d.SectorSize})
+	gptTable, err := readGPTForWrite(fp, d)
 	if err != nil {
 		return err
 	}
@@ -721,6 +843,14 @@ func deletePartitionSetGPT(fp io.ReadWriteSeeker, d disko.Disk, pNums []uint) er
 		}, d.SectorSize)
 
 	for _, pNum := range pNums {
+		if pNum < 1 || int(pNum) > len(gptTable.Partitions) {
+			return &disko.PartitionError{Disk: d.Path, Number: pNum, Err: disko.ErrOutOfRange}
+		}
+
+		if gptTable.Partitions[pNum-1].IsEmpty() {
+			return &disko.PartitionError{Disk: d.Path, Number: pNum, Err: disko.ErrPartitionNotFound}
+		}
+
 		gptTable.Partitions[pNum-1] = emptyPart
 	}
 
@@ -763,7 +893,7 @@ func withLockedFile(path string, cb func(*os.File, os.FileInfo) error) error {
 //
 //	this can be executed with a lock.  successful 'delpart /dev/disk 3' will remove all
 //	symlinks in /dev/ to /dev/disk3 even if disk is locked.
-func kernelDelParts(d disko.Disk, pNums []uint) error {
+func kernelDelParts(ctx context.Context, d disko.Disk, pNums []uint) error {
 	for _, pNum := range pNums {
 		bPath := fmt.Sprintf("/sys/class/block/%s", GetPartitionKname(d.Name, pNum))
 
@@ -773,7 +903,7 @@ func kernelDelParts(d disko.Disk, pNums []uint) error {
 			continue
 		}
 
-		if err := runCommand("delpart", d.Path, fmt.Sprintf("%d", pNum)); err != nil {
+		if err := runCommand(ctx, "delpart", d.Path, fmt.Sprintf("%d", pNum)); err != nil {
 			return err
 		}
 	}
@@ -781,9 +911,9 @@ func kernelDelParts(d disko.Disk, pNums []uint) error {
 	return nil
 }
 
-func kernelAddParts(d disko.Disk, pSet disko.PartitionSet) error {
+func kernelAddParts(ctx context.Context, d disko.Disk, pSet disko.PartitionSet) error {
 	for _, p := range pSet {
-		if err := runCommand("addpart", d.Path,
+		if err := runCommand(ctx, "addpart", d.Path,
 			fmt.Sprintf("%d", p.Number),
 			fmt.Sprintf("%d", p.Start/sectorSize512),
 			fmt.Sprintf("%d", p.Size()/sectorSize512)); err != nil {
@@ -814,10 +944,10 @@ func genPartChangeUEvent(d disko.Disk, pSet disko.PartitionSet) error {
 }
 
 //nolint:scopelint // https://github.com/kyoh86/scopelint/issues/12
-func deletePartitions(d disko.Disk, pNums []uint) error {
+func deletePartitions(ctx context.Context, d disko.Disk, pNums []uint) error {
 	return withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
 		if d.Table == disko.MBR {
-			if err := deletePartitionSetMBR(fp, pNums); err != nil {
+			if err := deletePartitionSetMBR(fp, d, pNums); err != nil {
 				return err
 			}
 		} else {
@@ -829,8 +959,230 @@ func deletePartitions(d disko.Disk, pNums []uint) error {
 			return nil
 		}
 
-		return kernelDelParts(d, pNums)
+		return kernelDelParts(ctx, d, pNums)
+	})
+}
+
+// resizePartitionGPT changes the Last of partition number to last.  The
+// partition keeps its start, type, id, name and attributes.  It returns the
+// resized partition.
+func resizePartitionGPT(fp io.ReadWriteSeeker, d disko.Disk, number uint, last uint64) (disko.Partition, error) {
+	gptTable, err := readGPTForWrite(fp, d)
+	if err != nil {
+		return disko.Partition{}, err
+	}
+
+	if number < 1 || int(number) > len(gptTable.Partitions) {
+		return disko.Partition{}, &disko.PartitionError{Disk: d.Path, Number: number, Err: disko.ErrOutOfRange}
+	}
+
+	gPart := gptTable.Partitions[number-1]
+	if gPart.IsEmpty() {
+		return disko.Partition{}, &disko.PartitionError{Disk: d.Path, Number: number,
+			Err: disko.ErrPartitionNotFound, Detail: "cannot resize"}
+	}
+
+	p := gptToDiskoPartition(gPart, number, d.SectorSize)
+	p.Last = last
+
+	// check against the table on the disk rather than what d was scanned with.
+	d.GPT.LastUsableLBA = gptTable.Header.LastUsableLBA
+
+	if err := d.CheckPartitionResize(p); err != nil {
+		return disko.Partition{}, err
+	}
+
+	d.Partitions = disko.PartitionSet{}
+
+	for n, other := range gptTable.Partitions {
+		if !other.IsEmpty() {
+			d.Partitions[uint(n+1)] = gptToDiskoPartition(other, uint(n+1), d.SectorSize)
+		}
+	}
+
+	if err := d.CheckPartitionOverlap(p); err != nil {
+		return disko.Partition{}, err
+	}
+
+	gPart.LastLBA = (last+1)/uint64(d.SectorSize) - 1
+	gptTable.Partitions[number-1] = gPart
+
+	if _, err := writeGPTTable(fp, gptTable, d.Size); err != nil {
+		return disko.Partition{}, err
+	}
+
+	return p, nil
+}
+
+// kernelResizePart - tell the kernel the new size of a partition.  Unlike
+// delpart and addpart this works while the partition is in use.
+func kernelResizePart(ctx context.Context, d disko.Disk, p disko.Partition) error {
+	return runCommand(ctx, "resizepart", d.Path,
+		fmt.Sprintf("%d", p.Number),
+		fmt.Sprintf("%d", p.Size()/sectorSize512))
+}
+
+//nolint:scopelint // https://github.com/kyoh86/scopelint/issues/12
+func resizePartition(ctx context.Context, d disko.Disk, number uint, last uint64) error {
+	if d.Table != disko.GPT {
+		return fmt.Errorf("cannot resize partition %d on disk %s: partition table '%s': %w",
+			number, d.Name, d.Table, disko.ErrUnsupportedTable)
+	}
+
+	var p disko.Partition
+
+	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
+		var err error
+
+		if p, err = resizePartitionGPT(fp, d, number, last); err != nil {
+			return err
+		}
+
+		if fInfo.Mode()&os.ModeDevice == 0 {
+			return nil
+		}
+
+		return kernelResizePart(ctx, d, p)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := udevSettle(ctx); err != nil {
+		return err
+	}
+
+	return genPartChangeUEvent(d, disko.PartitionSet{number: p})
+}
+
+// setPartitionAttributes sets the attribute flags of partition number to
+// attrs.  Unlike updatePartitions it clears the flags when attrs is zero.
+func setPartitionAttributes(ctx context.Context, d disko.Disk, number uint, attrs disko.PartAttrs) error {
+	if d.Table != disko.GPT {
+		return fmt.Errorf("cannot set attributes of partition %d on disk %s: partition table '%s': %w",
+			number, d.Name, d.Table, disko.ErrUnsupportedTable)
+	}
+
+	var p disko.Partition
+
+	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
+		gptTable, err := readGPTForWrite(fp, d)
+		if err != nil {
+			return err
+		}
+
+		if number < 1 || int(number) > len(gptTable.Partitions) {
+			return &disko.PartitionError{Disk: d.Path, Number: number, Err: disko.ErrOutOfRange}
+		}
+
+		gPart := gptTable.Partitions[number-1]
+		if gPart.IsEmpty() {
+			return &disko.PartitionError{Disk: d.Path, Number: number, Err: disko.ErrPartitionNotFound,
+				Detail: "cannot set attributes"}
+		}
+
+		gPart.Flags = toGPTFlags(attrs)
+		gptTable.Partitions[number-1] = gPart
+		p = gptToDiskoPartition(gPart, number, d.SectorSize)
+
+		_, err = writeGPTTable(fp, gptTable, d.Size)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := udevSettle(ctx); err != nil {
+		return err
+	}
+
+	return genPartChangeUEvent(d, disko.PartitionSet{number: p})
+}
+
+//nolint:scopelint // https://github.com/kyoh86/scopelint/issues/12
+func setDiskGUID(ctx context.Context, d disko.Disk, id disko.GUID) error {
+	if d.Table != disko.GPT {
+		return fmt.Errorf("cannot set the guid of disk %s: partition table '%s': %w",
+			d.Name, d.Table, disko.ErrUnsupportedTable)
+	}
+
+	if id == emptyGUID {
+		id = disko.GenGUID()
+	}
+
+	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
+		gptTable, err := readGPTForWrite(fp, d)
+		if err != nil {
+			return err
+		}
+
+		gptTable.Header.DiskGUID = gpt.Guid(id)
+
+		_, err = writeGPTTable(fp, gptTable, d.Size)
+
+		return err
 	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := udevSettle(ctx); err != nil {
+		return err
+	}
+
+	return genDiskChangeUEvent(d)
+}
+
+// relocateBackupGPT moves the backup GPT of d to the end of the disk, as
+// 'sgdisk -e' does.  writeGPTTable always puts it there and extends the last
+// usable LBA to match.
+func relocateBackupGPT(ctx context.Context, d disko.Disk) error {
+	if d.Table != disko.GPT {
+		return fmt.Errorf("cannot relocate the backup GPT of disk %s: partition table '%s': %w",
+			d.Name, d.Table, disko.ErrUnsupportedTable)
+	}
+
+	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
+		gptTable, err := readGPTForWrite(fp, d)
+		if err != nil {
+			return err
+		}
+
+		_, err = writeGPTTable(fp, gptTable, d.Size)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := udevSettle(ctx); err != nil {
+		return err
+	}
+
+	return genDiskChangeUEvent(d)
+}
+
+// genDiskChangeUEvent - have udev update what it knows of the disk, such
+// as ID_PART_TABLE_UUID.
+func genDiskChangeUEvent(d disko.Disk) error {
+	if isBlk, err := blockDeviceExists(d.Path); err != nil {
+		return err
+	} else if !isBlk {
+		return nil
+	}
+
+	uePath := fmt.Sprintf("/sys/class/block/%s/uevent", d.Name)
+	if err := os.WriteFile(uePath, []byte("change"), 0600); err != nil {
+		return fmt.Errorf("failed to write 'change' to %s: %v", uePath, err)
+	}
+
+	return nil
 }
 
 func blockDeviceExists(bpath string) (bool, error) {
@@ -884,10 +1236,17 @@ func writeProtectiveMBR(fp io.ReadWriteSeeker, sectorSize uint, diskSize uint64)
 	return m.Write(fp)
 }
 
-func writeNewGPTTable(fp io.ReadWriteSeeker, sectorSize uint, diskSize uint64) (gpt.Table, error) {
+// writeNewGPTTable - write an empty GPT table with disk GUID diskGUID, or a
+// random one if it is zero.
+func writeNewGPTTable(fp io.ReadWriteSeeker, sectorSize uint, diskSize uint64,
+	diskGUID disko.GUID) (gpt.Table, error) {
+	if diskGUID == emptyGUID {
+		diskGUID = disko.GenGUID()
+	}
+
 	ntArgs := gpt.NewTableArgs{
 		SectorSize: uint64(sectorSize),
-		DiskGuid:   gpt.Guid(disko.GenGUID())}
+		DiskGuid:   gpt.Guid(diskGUID)}
 	gptTable := gpt.NewTable(diskSize, &ntArgs)
 
 	return writeGPTTable(fp, gptTable, diskSize)
@@ -1,6 +1,8 @@
 package linux
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -150,6 +152,63 @@ func TestGetDiskType(t *testing.T) {
 	assert.Equal(disko.SSD.String(), result.String())
 }
 
+func TestGetDiskIdentity(t *testing.T) {
+	assert := assert.New(t)
+
+	id := getDiskIdentity(disko.UdevInfo{
+		Name: "sda",
+		Properties: map[string]string{
+			"ID_MODEL":              "SAMSUNG_MZ7L3960HCJR-00AK1",
+			"ID_MODEL_ENC":          "SAMSUNG\\x20MZ7L3960HCJR-00AK1\\x20\\x20",
+			"ID_REVISION":           "JXTC404Q",
+			"ID_SERIAL":             "SAMSUNG_MZ7L3960HCJR-00AK1_S662NE0R712345",
+			"ID_SERIAL_SHORT":       "S662NE0R712345",
+			"ID_VENDOR":             "ATA",
+			"ID_WWN":                "0x5002538f3312a0b1",
+			"ID_WWN_WITH_EXTENSION": "0x5002538f3312a0b1",
+		},
+		Symlinks: []string{
+			"disk/by-diskseq/3",
+			"disk/by-id/ata-SAMSUNG_MZ7L3960HCJR-00AK1_S662NE0R712345",
+			"disk/by-id/wwn-0x5002538f3312a0b1",
+			"disk/by-path/pci-0000:00:17.0-ata-1",
+		},
+	})
+
+	assert.Equal(disko.DiskIdentity{
+		Serial:   "S662NE0R712345",
+		WWN:      "0x5002538f3312a0b1",
+		Model:    "SAMSUNG MZ7L3960HCJR-00AK1",
+		Vendor:   "ATA",
+		Firmware: "JXTC404Q",
+		ByID: []string{
+			"/dev/disk/by-id/ata-SAMSUNG_MZ7L3960HCJR-00AK1_S662NE0R712345",
+			"/dev/disk/by-id/wwn-0x5002538f3312a0b1",
+		},
+		ByPath: []string{"/dev/disk/by-path/pci-0000:00:17.0-ata-1"},
+	}, id)
+
+	assert.True(getDiskIdentity(disko.UdevInfo{Name: "loop0"}).IsEmpty())
+
+	merged := mergeDiskIdentity(disko.DiskIdentity{Serial: "abc"},
+		disko.DiskIdentity{Serial: "xyz", WWN: "0x62cf89bd43a7af80679aa6b751349581"})
+	assert.Equal(disko.DiskIdentity{Serial: "abc", WWN: "0x62cf89bd43a7af80679aa6b751349581"}, merged)
+}
+
+func TestDecodeUdevEnc(t *testing.T) {
+	for _, table := range []struct{ in, expected string }{
+		{"", ""},
+		{"plain", "plain"},
+		{"a\\x20b", "a b"},
+		{"trail\\x2", "trail\\x2"},
+		{"bad\\xzz", "bad\\xzz"},
+	} {
+		if found := decodeUdevEnc(table.in); found != table.expected {
+			t.Errorf("decodeUdevEnc(%q) returned %q, expected %q", table.in, found, table.expected)
+		}
+	}
+}
+
 func genTempGptDisk(tmpd string, fsize uint64) (disko.Disk, error) {
 	fpath := path.Join(tmpd, "mydisk")
 
@@ -184,7 +243,7 @@ func genTempGptDisk(tmpd string, fsize uint64) (disko.Disk, error) {
 			Number: uint(1),
 		}}
 
-	if err := addPartitionSet(disk, parts); err != nil {
+	if err := addPartitionSet(context.Background(), disk, parts); err != nil {
 		return disk, err
 	}
 
@@ -235,7 +294,7 @@ func TestMyPartition(t *testing.T) {
 		Number: uint(1),
 	}
 
-	err = addPartitionSet(disk, disko.PartitionSet{part.Number: part})
+	err = addPartitionSet(context.Background(), disk, disko.PartitionSet{part.Number: part})
 	if err != nil {
 		t.Errorf("Creation of partition failed: %s", err)
 	}
@@ -306,7 +365,7 @@ func TestMyPartitionMBR(t *testing.T) {
 		Number: uint(1),
 	}
 
-	err = addPartitionSet(disk, disko.PartitionSet{part.Number: part})
+	err = addPartitionSet(context.Background(), disk, disko.PartitionSet{part.Number: part})
 	if err != nil {
 		t.Errorf("Creation of partition failed: %s", err)
 	}
@@ -378,7 +437,7 @@ func TestWipeDisk(t *testing.T) {
 	}
 	fp.Close()
 
-	if err := wipeDisk(disk); err != nil {
+	if err := wipeDisk(context.Background(), disk); err != nil {
 		t.Errorf("Failed wipe of disk: %s", err)
 	}
 
@@ -457,10 +516,20 @@ func TestDeletePartition(t *testing.T) {
 		t.Fatalf("There were %d partitions, expected 1", len(pSet))
 	}
 
-	err = deletePartitions(disk, []uint{1})
+	err = addPartitionSet(context.Background(), disk, disko.PartitionSet{1: pSet[1]})
+	if !errors.Is(err, disko.ErrPartitionExists) {
+		t.Errorf("Expected ErrPartitionExists re-adding partition 1, got: %v", err)
+	}
+
+	err = deletePartitions(context.Background(), disk, []uint{1})
 	if err != nil {
 		t.Fatalf("Failed delete partition 1: %s", err)
 	}
+
+	err = deletePartitions(context.Background(), disk, []uint{1})
+	if !errors.Is(err, disko.ErrPartitionNotFound) {
+		t.Errorf("Expected ErrPartitionNotFound deleting partition 1 again, got: %v", err)
+	}
 }
 
 func TestUpdatePartition(t *testing.T) {
@@ -510,7 +579,7 @@ func TestUpdatePartition(t *testing.T) {
 		},
 	}
 
-	err = updatePartitions(disk, newPSet)
+	err = updatePartitions(context.Background(), disk, newPSet)
 	if err != nil {
 		t.Fatalf("Failed update partition 1: %s", err)
 	}
@@ -579,17 +648,26 @@ func TestBadPartition(t *testing.T) {
 		Number: uint(1),
 	}
 
-	err = addPartitionSet(disk, disko.PartitionSet{part.Number: part})
-	if err == nil {
-		t.Errorf("Created partition with OOB start (%d). should have failed", part.Start)
+	err = addPartitionSet(context.Background(), disk, disko.PartitionSet{part.Number: part})
+	if !errors.Is(err, disko.ErrOutOfRange) {
+		t.Errorf("Created partition with OOB start (%d). should have failed: %v", part.Start, err)
 	}
 
 	part.Start = fs[0].Start
 	part.Last = disk.Size - 1
 
-	err = addPartitionSet(disk, disko.PartitionSet{part.Number: part})
-	if err == nil {
-		t.Errorf("Created partition with OOB end (%d). should have failed", part.Last)
+	err = addPartitionSet(context.Background(), disk, disko.PartitionSet{part.Number: part})
+	if !errors.Is(err, disko.ErrOutOfRange) {
+		t.Errorf("Created partition with OOB end (%d). should have failed: %v", part.Last, err)
+	}
+
+	disk.PhysicalBlockSize = 4096
+	part.Start = fs[0].Start + 512
+	part.Last = fs[0].Last
+
+	err = addPartitionSet(context.Background(), disk, disko.PartitionSet{part.Number: part})
+	if !errors.Is(err, disko.ErrOutOfRange) {
+		t.Errorf("Created partition with misaligned start (%d). should have failed: %v", part.Start, err)
 	}
 }
 
@@ -634,3 +712,340 @@ func TestNoEmptyPartID(t *testing.T) {
 		t.Errorf("toGPTPartition changed partition ID: %s -> %s", before.ID, after.Id)
 	}
 }
+
+func TestResizePartition(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 20*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	// enlarge the disk, as when a cloud volume is grown.
+	if err := os.Truncate(disk.Path, int64(40*disko.Mebibyte)); err != nil {
+		t.Fatalf("Failed to grow %s: %s", disk.Path, err)
+	}
+
+	sys := System()
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", disk.Path, err)
+	}
+
+	orig := disk.Partitions[1]
+
+	grown, err := disko.GrowPartitionToFill(sys, disk, 1)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Equal(39*disko.Mebibyte-1, grown.Last)
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	p := disk.Partitions[1]
+	ast.Equal(grown.Last, p.Last)
+	ast.Equal(orig.Start, p.Start)
+	ast.Equal(orig.ID, p.ID)
+	ast.Equal(orig.Name, p.Name)
+
+	// the backup GPT moved to the new end of the disk.
+	fp, err := os.Open(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", disk.Path, err)
+	}
+	defer fp.Close()
+
+	table, _, err := readGPTTable(fp)
+	if ast.NoError(err) {
+		ast.Equal(disk.Size/sectorSize512-1, table.Header.HeaderCopyStartLBA)
+	}
+
+	_, err = disko.GrowPartitionToFill(sys, disk, 1)
+	ast.ErrorIs(err, disko.ErrNoSpace)
+
+	ast.NoError(sys.ResizePartition(disk, 1, 10*disko.Mebibyte-1))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.Equal(10*disko.Mebibyte-1, disk.Partitions[1].Last)
+	}
+
+	ast.ErrorIs(sys.ResizePartition(disk, 1, disk.Size), disko.ErrOutOfRange)
+	ast.ErrorIs(sys.ResizePartition(disk, 1, orig.Start), disko.ErrOutOfRange)
+	ast.ErrorIs(sys.ResizePartition(disk, 2, 20*disko.Mebibyte-1), disko.ErrPartitionNotFound)
+
+	ast.NoError(sys.CreatePartition(disk, disko.Partition{Number: 2, Start: 20 * disko.Mebibyte,
+		Last: 30*disko.Mebibyte - 1, Type: partid.LinuxFS}))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.ErrorIs(sys.ResizePartition(disk, 1, 25*disko.Mebibyte-1), disko.ErrOverlap)
+
+		grown, err = disko.GrowPartitionToFill(sys, disk, 1)
+		if ast.NoError(err) {
+			ast.Equal(20*disko.Mebibyte-1, grown.Last)
+		}
+	}
+}
+
+func TestPartitionAttributes(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 20*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	sys := System()
+
+	ast.NoError(sys.DeletePartition(disk, 1))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", disk.Path, err)
+	}
+
+	orig := disko.Partition{Number: 1, Start: disko.Mebibyte, Last: 10*disko.Mebibyte - 1,
+		Type: partid.LinuxFS, Name: "root", ID: disko.GenGUID(),
+		Attributes: disko.AttrRequired | disko.AttrLegacyBIOSBootable | disko.AttrNoAuto}
+
+	ast.NoError(sys.CreatePartition(disk, orig))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Equal(orig, disk.Partitions[1])
+
+	// an update of the name keeps everything else.
+	ast.NoError(sys.UpdatePartition(disk, disko.Partition{Number: 1, Name: "newroot"}))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	expected := orig
+	expected.Name = "newroot"
+	ast.Equal(expected, disk.Partitions[1])
+
+	ast.NoError(sys.UpdatePartition(disk, disko.Partition{Number: 1, Attributes: disko.AttrGrowFS}))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.Equal(disko.AttrGrowFS, disk.Partitions[1].Attributes)
+		ast.Equal(orig.ID, disk.Partitions[1].ID)
+		ast.Equal(orig.Type, disk.Partitions[1].Type)
+	}
+
+	// zero attributes clear them, where an update leaves them alone.
+	ast.NoError(sys.SetPartitionAttributes(disk, 1, 0))
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		expected.Attributes = 0
+		ast.Equal(expected, disk.Partitions[1])
+	}
+
+	ast.ErrorIs(sys.SetPartitionAttributes(disk, 2, disko.AttrNoAuto), disko.ErrPartitionNotFound)
+}
+
+func TestDiskGUID(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	fpath := path.Join(tmpd, "mydisk")
+	if err := os.WriteFile(fpath, make([]byte, 20*disko.Mebibyte), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %s", fpath, err)
+	}
+
+	sys := System()
+
+	disk, err := sys.ScanDisk(fpath)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", fpath, err)
+	}
+
+	ast.Equal(disko.GPTHeader{}, disk.GPT)
+
+	myGUID := disko.GenGUID()
+	disk.GPT.DiskGUID = myGUID
+
+	ast.NoError(sys.CreatePartition(disk, disko.Partition{Number: 1, Start: disko.Mebibyte,
+		Last: 10*disko.Mebibyte - 1, Type: partid.LinuxFS}))
+
+	disk, err = sys.ScanDisk(fpath)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Equal(disko.GPTHeader{
+		DiskGUID:           myGUID,
+		FirstUsableLBA:     34,
+		LastUsableLBA:      disk.Size/sectorSize512 - 34,
+		PartitionEntries:   128,
+		PartitionEntrySize: 128,
+	}, disk.GPT)
+
+	newGUID := disko.GenGUID()
+	ast.NoError(sys.SetDiskGUID(disk, newGUID))
+
+	// the disk scanned before is stale now.
+	ast.ErrorIs(sys.SetDiskGUID(disk, myGUID), disko.ErrStaleDisk)
+
+	found, err := sys.ScanDisk(fpath)
+	if ast.NoError(err) {
+		ast.Equal(newGUID, found.GPT.DiskGUID)
+		ast.Equal(disk.Partitions, found.Partitions)
+	}
+
+	ast.NoError(sys.SetDiskGUID(found, disko.GUID{}))
+
+	disk, err = sys.ScanDisk(fpath)
+	if ast.NoError(err) {
+		ast.NotEqual(newGUID, disk.GPT.DiskGUID)
+		ast.NotEqual(disko.GUID{}, disk.GPT.DiskGUID)
+	}
+
+	ast.NoError(sys.Wipe(disk))
+
+	disk, err = sys.ScanDisk(fpath)
+	if ast.NoError(err) {
+		ast.ErrorIs(sys.SetDiskGUID(disk, myGUID), disko.ErrUnsupportedTable)
+	}
+}
+
+func TestRelocateBackupGPT(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 20*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	if err := os.Truncate(disk.Path, int64(50*disko.Mebibyte)); err != nil {
+		t.Fatalf("Failed to grow %s: %s", disk.Path, err)
+	}
+
+	sys := System()
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", disk.Path, err)
+	}
+
+	ast.Equal([]disko.TableProblemKind{disko.ProblemBackupLocation}, problemKinds(disk.TableProblems))
+	ast.Equal(20*disko.Mebibyte/sectorSize512-34, disk.GPT.LastUsableLBA)
+	ast.Empty(disk.FreeSpaces())
+
+	ast.NoError(sys.RelocateBackupGPT(disk))
+
+	found, err := sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Empty(found.TableProblems)
+	ast.Equal(found.Size/sectorSize512-34, found.GPT.LastUsableLBA)
+	ast.Equal(disk.GPT.DiskGUID, found.GPT.DiskGUID)
+	ast.Equal(disk.Partitions, found.Partitions)
+
+	last := disk.Partitions[1].Last
+	ast.Equal([]disko.FreeSpace{{Start: last + 1, Last: 49*disko.Mebibyte - 1}}, found.FreeSpaces())
+
+	// relocating a backup that is already at the end changes nothing.
+	ast.NoError(sys.RelocateBackupGPT(found))
+
+	again, err := sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.Equal(found.GPT, again.GPT)
+		ast.Empty(again.TableProblems)
+	}
+}
+
+type failReaderAt struct{}
+
+func (failReaderAt) ReadAt([]byte, int64) (int, error) {
+	return 0, errors.New("medium error")
+}
+
+func TestProbeSignaturesReadError(t *testing.T) {
+	ast := assert.New(t)
+
+	disk := disko.Disk{
+		Size:  disko.Mebibyte * 10,
+		Table: disko.GPT,
+		Partitions: disko.PartitionSet{
+			1: {Number: 1, Start: disko.Mebibyte, Last: 5*disko.Mebibyte - 1},
+		},
+	}
+
+	probeSignatures(failReaderAt{}, &disk)
+
+	sig := disk.Partitions[1].Signature
+	ast.False(sig.IsEmpty())
+	ast.Equal("", sig.Type)
+	ast.Contains(sig.ProbeError, "medium error")
+	ast.Contains(sig.String(), "medium error")
+}
+
+func TestWipeDiskCancelled(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 20*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ast.ErrorIs(wipeDisk(ctx, disk), context.Canceled)
+
+	// nothing was written, so the table is still there.
+	found, err := System().ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.Equal(disko.GPT, found.Table)
+		ast.Len(found.Partitions, 1)
+	}
+}
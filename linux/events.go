@@ -0,0 +1,236 @@
+package linux
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"machinerun.io/disko"
+)
+
+// EventPhase is when an Event is emitted relative to its operation.
+type EventPhase string
+
+const (
+	// EventBefore is emitted before the operation changes anything.
+	EventBefore EventPhase = "before"
+
+	// EventAfter is emitted once the operation has finished or failed.
+	EventAfter EventPhase = "after"
+)
+
+// Event describes a mutating operation of the linux System, VolumeManager
+// or FSManager.  Every operation emits an EventBefore and an EventAfter
+// with the same ID.
+type Event struct {
+	// ID identifies the operation within this process.
+	ID uint64 `json:"id"`
+
+	// Phase is EventBefore or EventAfter.
+	Phase EventPhase `json:"phase"`
+
+	// Op is the name of the operation (CreatePartitions, CreateLV...).
+	Op string `json:"op"`
+
+	// Time is when the event was emitted.
+	Time time.Time `json:"time"`
+
+	// Disk is the path of the disk a System operation acts on.
+	Disk string `json:"disk,omitempty"`
+
+	// Identity is the identity of Disk.
+	Identity *disko.DiskIdentity `json:"identity,omitempty"`
+
+	// Target is what a VolumeManager or FSManager operation acts on: a
+	// device path, a volume group name or <vg>/<lv>.
+	Target string `json:"target,omitempty"`
+
+	// Request is the set of partitions a System operation creates, updates
+	// or deletes.
+	Request disko.PartitionSet `json:"request,omitempty"`
+
+	// Partitions is the partition table read from Disk when the event was
+	// emitted.  It is empty if the table could not be read.
+	Partitions disko.PartitionSet `json:"partitions,omitempty"`
+
+	// Commands are the command lines run by the operation (EventAfter only).
+	// Keys passed on stdin are not part of them.
+	Commands [][]string `json:"commands,omitempty"`
+
+	// Duration is how long the operation took (EventAfter only).
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// Error is the error the operation returned (EventAfter only).
+	Error string `json:"error,omitempty"`
+}
+
+// Observer is called with the events of every mutating operation.  It is
+// called synchronously, so a slow Observer slows down the operation.
+type Observer func(Event)
+
+// WithObserver adds an Observer of mutating operations.
+func WithObserver(o Observer) Option {
+	return func(opts *options) {
+		opts.observers = append(opts.observers, o)
+	}
+}
+
+//nolint:gochecknoglobals
+var lastEventID uint64
+
+// observe runs op and emits its events to the observers.  ev has the
+// fields that describe the operation, snapshot (which may be nil) reads the
+// partition table for the before and after events.
+func (o options) observe(ctx context.Context, ev Event, snapshot func() disko.PartitionSet,
+	op func(context.Context) error) error {
+	if len(o.observers) == 0 {
+		return op(ctx)
+	}
+
+	ev.ID = atomic.AddUint64(&lastEventID, 1)
+	ev.Phase = EventBefore
+	ev.Time = time.Now()
+
+	if snapshot != nil {
+		ev.Partitions = snapshot()
+	}
+
+	o.emit(ev)
+
+	rec := &cmdRecorder{}
+	err := op(context.WithValue(ctx, cmdRecorderKey{}, rec))
+
+	ev.Phase = EventAfter
+	ev.Commands = rec.commands()
+	ev.Duration = time.Since(ev.Time)
+	ev.Time = time.Now()
+
+	if snapshot != nil {
+		ev.Partitions = snapshot()
+	}
+
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	o.emit(ev)
+
+	return err
+}
+
+func (o options) emit(ev Event) {
+	for _, obs := range o.observers {
+		obs(ev)
+	}
+}
+
+// diskEvent returns the Event for operation op on disk d.
+func diskEvent(op string, d disko.Disk, request disko.PartitionSet) Event {
+	ev := Event{Op: op, Disk: d.Path, Request: request}
+
+	if !d.Identity.IsEmpty() {
+		id := d.Identity
+		ev.Identity = &id
+	}
+
+	return ev
+}
+
+// diskSnapshot returns a function that reads the partition table of d.
+func diskSnapshot(d disko.Disk) func() disko.PartitionSet {
+	return func() disko.PartitionSet {
+		fp, err := os.Open(d.Path)
+		if err != nil {
+			return nil
+		}
+		defer fp.Close()
+
+		parts, _, _, err := findPartitions(fp)
+		if err != nil {
+			return nil
+		}
+
+		return parts
+	}
+}
+
+type cmdRecorderKey struct{}
+
+// cmdRecorder collects the command lines run with a context.
+type cmdRecorder struct {
+	mutex sync.Mutex
+	cmds  [][]string
+}
+
+func (r *cmdRecorder) commands() [][]string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.cmds
+}
+
+// recordCommand adds args to the cmdRecorder of ctx, if it has one.
+func recordCommand(ctx context.Context, args []string) {
+	rec, ok := ctx.Value(cmdRecorderKey{}).(*cmdRecorder)
+	if !ok {
+		return
+	}
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.cmds = append(rec.cmds, append([]string{}, args...))
+}
+
+// Journal is an Observer that appends events to a file as JSON lines.
+type Journal struct {
+	mutex sync.Mutex
+	fp    *os.File
+}
+
+// NewJournal opens (or creates) the journal file at path for appending.
+func NewJournal(path string) (*Journal, error) {
+	const mode = 0600
+
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	return &Journal{fp: fp}, nil
+}
+
+// Observe writes ev to the journal and syncs it to disk.  Write errors are
+// logged, they do not fail the operation.
+func (j *Journal) Observe(ev Event) {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("journal: failed to marshal event %d: %s", ev.ID, err)
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if _, err := j.fp.Write(append(line, '\n')); err != nil {
+		log.Printf("journal: failed to write %s: %s", j.fp.Name(), err)
+		return
+	}
+
+	if err := j.fp.Sync(); err != nil {
+		log.Printf("journal: failed to sync %s: %s", j.fp.Name(), err)
+	}
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.fp.Close()
+}
@@ -0,0 +1,122 @@
+package linux
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+func TestObserverEvents(t *testing.T) {
+	ast := assert.New(t)
+	fpath := path.Join(t.TempDir(), "mydisk")
+	fsize := uint64(200 * 1024 * 1024)
+
+	if !ast.Nil(os.WriteFile(fpath, []byte{}, 0600)) || !ast.Nil(os.Truncate(fpath, int64(fsize))) {
+		return
+	}
+
+	disk := disko.Disk{
+		Name:       "mydisk",
+		Path:       fpath,
+		Size:       fsize,
+		SectorSize: sectorSize512,
+		Identity:   disko.DiskIdentity{Serial: "S1"},
+	}
+
+	events := []Event{}
+	sys := System(WithObserver(func(ev Event) { events = append(events, ev) }))
+
+	fs := disk.FreeSpaces()
+	part := disko.Partition{Start: fs[0].Start, Last: fs[0].Last, Type: partid.LinuxLVM, Number: 1}
+
+	err := sys.CreatePartitionsContext(context.Background(), disk, disko.PartitionSet{1: part})
+	if !ast.Nil(err) || !ast.Len(events, 2) {
+		return
+	}
+
+	before, after := events[0], events[1]
+	ast.Equal(before.ID, after.ID)
+	ast.Equal(EventBefore, before.Phase)
+	ast.Equal(EventAfter, after.Phase)
+	ast.Equal("CreatePartitions", after.Op)
+	ast.Equal(fpath, after.Disk)
+	ast.Equal("S1", after.Identity.Serial)
+	ast.Empty(before.Partitions)
+	ast.Len(after.Partitions, 1)
+	ast.Equal(disko.PartitionSet{1: part}, after.Request)
+	ast.Contains(after.Commands, []string{"udevadm", "settle"})
+	ast.Empty(before.Commands)
+	ast.Empty(after.Error)
+
+	events = []Event{}
+	part.Number = 2
+	part.Start = 0
+
+	err = sys.CreatePartitionsContext(context.Background(), disk, disko.PartitionSet{2: part})
+	if !ast.NotNil(err) || !ast.Len(events, 2) {
+		return
+	}
+
+	ast.Equal(err.Error(), events[1].Error)
+	ast.Len(events[1].Partitions, 1)
+}
+
+func TestRecordCommand(t *testing.T) {
+	ast := assert.New(t)
+
+	// no recorder, nothing to record to.
+	ast.Nil(runCommand(context.Background(), "true"))
+
+	rec := &cmdRecorder{}
+	ctx := context.WithValue(context.Background(), cmdRecorderKey{}, rec)
+
+	ast.Nil(runCommand(ctx, "true", "a"))
+	ast.Nil(runCommandStdin(ctx, "secret", "cat"))
+	ast.Equal([][]string{{"true", "a"}, {"cat"}}, rec.commands())
+}
+
+func TestJournal(t *testing.T) {
+	ast := assert.New(t)
+	jpath := path.Join(t.TempDir(), "journal.jsonl")
+
+	for i := 0; i < 2; i++ {
+		j, err := NewJournal(jpath)
+		if !ast.Nil(err) {
+			return
+		}
+
+		j.Observe(Event{ID: uint64(i), Phase: EventAfter, Op: "RemoveLV", Target: "vg0/lv0", Error: "busy"})
+		ast.Nil(j.Close())
+	}
+
+	fp, err := os.Open(jpath)
+	if !ast.Nil(err) {
+		return
+	}
+	defer fp.Close()
+
+	found := []Event{}
+	scanner := bufio.NewScanner(fp)
+
+	for scanner.Scan() {
+		ev := Event{}
+		ast.Nil(json.Unmarshal(scanner.Bytes(), &ev))
+		found = append(found, ev)
+	}
+
+	if ast.Len(found, 2) {
+		ast.Equal(uint64(1), found[1].ID)
+		ast.Equal("vg0/lv0", found[1].Target)
+		ast.Equal("busy", found[1].Error)
+	}
+
+	_, err = NewJournal(path.Join(jpath, "nodir", "journal"))
+	ast.NotNil(err)
+}
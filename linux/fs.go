@@ -0,0 +1,304 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"machinerun.io/disko"
+	"machinerun.io/disko/probe"
+)
+
+// FSManager returns the linux implementation of disko.FSManager.  It runs
+// the mkfs and maintenance tools of each filesystem.  CreateFS refuses to
+// format a device that is in use unless WithForce is given.
+func FSManager(opts ...Option) disko.ContextFSManager {
+	return &linuxFS{opts: newOptions(opts)}
+}
+
+type linuxFS struct {
+	opts options
+}
+
+func (lf *linuxFS) CreateFS(path string, fsType disko.FSType, opts disko.FSOptions) error {
+	return lf.CreateFSContext(context.Background(), path, fsType, opts)
+}
+
+func (lf *linuxFS) CreateFSContext(ctx context.Context, path string, fsType disko.FSType,
+	opts disko.FSOptions) error {
+	return lf.opts.observe(ctx, Event{Op: "CreateFS", Target: path}, nil,
+		func(ctx context.Context) error {
+			args, err := mkfsArgs(path, fsType, opts)
+			if err != nil {
+				return err
+			}
+
+			if !lf.opts.force {
+				if uses := deviceUsage(path); len(uses) != 0 {
+					return &disko.DiskError{Disk: path, Op: "CreateFS", Err: disko.ErrInUse,
+						Detail: usageDetail(uses)}
+				}
+			}
+
+			return runCommandSettled(ctx, args...)
+		})
+}
+
+func (lf *linuxFS) SetFSLabel(path string, label string) error {
+	return lf.SetFSLabelContext(context.Background(), path, label)
+}
+
+func (lf *linuxFS) SetFSLabelContext(ctx context.Context, path string, label string) error {
+	return lf.opts.observe(ctx, Event{Op: "SetFSLabel", Target: path}, nil,
+		func(ctx context.Context) error {
+			fsType, err := probeFSType(path)
+			if err != nil {
+				return err
+			}
+
+			var args []string
+
+			switch fsType {
+			case disko.FSExt2, disko.FSExt3, disko.FSExt4:
+				args = []string{"e2label", path, label}
+			case disko.FSXFS:
+				if label == "" {
+					label = "--"
+				}
+
+				args = []string{"xfs_admin", "-L", label, path}
+			case disko.FSBtrfs:
+				args = []string{"btrfs", "filesystem", "label", path, label}
+			case disko.FSVFAT:
+				args = []string{"fatlabel", path, label}
+			case disko.FSSwap:
+				args = []string{"swaplabel", "--label", label, path}
+			}
+
+			return runCommandSettled(ctx, args...)
+		})
+}
+
+func (lf *linuxFS) CheckFS(path string) error {
+	return lf.CheckFSContext(context.Background(), path)
+}
+
+// CheckFSContext does not change anything, so it is not observed.
+func (lf *linuxFS) CheckFSContext(ctx context.Context, path string) error {
+	fsType, err := probeFSType(path)
+	if err != nil {
+		return err
+	}
+
+	// corruptRC is the exit code of the check for a filesystem with errors.
+	var args []string
+	var corruptRC int
+
+	switch fsType {
+	case disko.FSExt2, disko.FSExt3, disko.FSExt4:
+		args, corruptRC = []string{"e2fsck", "-f", "-n", path}, 4 //nolint:gomnd
+	case disko.FSXFS:
+		args, corruptRC = []string{"xfs_repair", "-n", path}, 1
+	case disko.FSBtrfs:
+		args, corruptRC = []string{"btrfs", "check", "--readonly", path}, 1
+	case disko.FSVFAT:
+		args, corruptRC = []string{"fsck.vfat", "-n", path}, 1
+	case disko.FSSwap:
+		// there is nothing in swap to check.
+		return nil
+	}
+
+	err = runCommand(ctx, args...)
+
+	var cmdErr *disko.CommandError
+	if errors.As(err, &cmdErr) && !errors.Is(err, disko.ErrToolMissing) && cmdErr.RC&corruptRC != 0 {
+		return fmt.Errorf("%s: %w: %w", path, disko.ErrCorruptFS, err)
+	}
+
+	return err
+}
+
+func (lf *linuxFS) GrowFS(path string) error {
+	return lf.GrowFSContext(context.Background(), path)
+}
+
+func (lf *linuxFS) GrowFSContext(ctx context.Context, path string) error {
+	return lf.opts.observe(ctx, Event{Op: "GrowFS", Target: path}, nil,
+		func(ctx context.Context) error {
+			fsType, err := probeFSType(path)
+			if err != nil {
+				return err
+			}
+
+			mnt := mountPoint(path)
+
+			switch fsType {
+			case disko.FSExt2, disko.FSExt3, disko.FSExt4:
+				return growExt(ctx, path, mnt != "")
+			case disko.FSXFS, disko.FSBtrfs:
+				if mnt == "" {
+					return fmt.Errorf("grow %s %s: %w", fsType, path, disko.ErrNotMounted)
+				}
+
+				if fsType == disko.FSXFS {
+					return runCommand(ctx, "xfs_growfs", mnt)
+				}
+
+				return runCommand(ctx, "btrfs", "filesystem", "resize", "max", mnt)
+			}
+
+			return fmt.Errorf("grow %s %s: %w", fsType, path, disko.ErrUnsupportedFS)
+		})
+}
+
+// growExt grows an ext filesystem.  resize2fs insists that an unmounted
+// filesystem is checked first.  e2fsck -p exits 1 when it fixed something,
+// which still leaves a filesystem that can be resized.
+func growExt(ctx context.Context, path string, mounted bool) error {
+	if !mounted {
+		args := []string{"e2fsck", "-f", "-p", path}
+
+		out, stderr, rc := runCommandWithOutputErrorRc(ctx, args...)
+		if rc > 1 {
+			if err := contextError(ctx, args); err != nil {
+				return err
+			}
+
+			return cmdError(args, out, stderr, rc)
+		}
+	}
+
+	return runCommand(ctx, "resize2fs", path)
+}
+
+// mkfsArgs returns the command line that creates a filesystem of type
+// fsType with opts on path.
+func mkfsArgs(path string, fsType disko.FSType, opts disko.FSOptions) ([]string, error) {
+	var args []string
+
+	switch fsType {
+	case disko.FSExt2, disko.FSExt3, disko.FSExt4:
+		args = []string{"mkfs." + string(fsType), "-F", "-q"}
+		args = appendOpt(args, "-L", opts.Label)
+		args = appendOpt(args, "-U", opts.UUID)
+		args = appendOpt(args, "-O", strings.Join(opts.Features, ","))
+	case disko.FSXFS:
+		args = []string{"mkfs.xfs", "-f", "-q"}
+		args = appendOpt(args, "-L", opts.Label)
+
+		if opts.UUID != "" {
+			args = append(args, "-m", "uuid="+opts.UUID)
+		}
+
+		for _, f := range opts.Features {
+			args = append(args, "-m", f)
+		}
+	case disko.FSBtrfs:
+		args = []string{"mkfs.btrfs", "-f", "-q"}
+		args = appendOpt(args, "-L", opts.Label)
+		args = appendOpt(args, "-U", opts.UUID)
+		args = appendOpt(args, "-O", strings.Join(opts.Features, ","))
+	case disko.FSVFAT, disko.FSSwap:
+		if len(opts.Features) != 0 {
+			return nil, fmt.Errorf("%s takes no features, not %v: %w", fsType, opts.Features, disko.ErrUnsupportedFS)
+		}
+
+		if fsType == disko.FSVFAT {
+			args = []string{"mkfs.vfat"}
+			args = appendOpt(args, "-n", opts.Label)
+			args = appendOpt(args, "-i", strings.ReplaceAll(opts.UUID, "-", ""))
+		} else {
+			args = []string{"mkswap", "-f"}
+			args = appendOpt(args, "-L", opts.Label)
+			args = appendOpt(args, "-U", opts.UUID)
+		}
+	default:
+		return nil, fmt.Errorf("create %q on %s: %w", fsType, path, disko.ErrUnsupportedFS)
+	}
+
+	args = append(args, opts.ExtraArgs...)
+
+	return append(args, path), nil
+}
+
+// appendOpt appends flag and value to args if value is not empty.
+func appendOpt(args []string, flag, value string) []string {
+	if value == "" {
+		return args
+	}
+
+	return append(args, flag, value)
+}
+
+// probeFSType returns the type of the filesystem on the device at path.  It
+// returns an error wrapping ErrUnsupportedFS if there is none that an
+// FSManager maintains.
+func probeFSType(path string) (disko.FSType, error) {
+	fp, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w", path, disko.ErrDiskNotFound)
+	} else if err != nil {
+		return "", openError(path, err)
+	}
+	defer fp.Close()
+
+	size, err := getFileSize(fp)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := probe.Probe(fp, size)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch sig.Type {
+	case probe.Ext2, probe.Ext3, probe.Ext4, probe.XFS, probe.Btrfs, probe.VFAT, probe.Swap:
+		return disko.FSType(sig.Type), nil
+	case "":
+		return "", fmt.Errorf("%s has no filesystem: %w", path, disko.ErrUnsupportedFS)
+	}
+
+	return "", fmt.Errorf("%s has %s: %w", path, sig.Type, disko.ErrUnsupportedFS)
+}
+
+// deviceUsage returns what uses the block device at path.  A path that is
+// not a block device, such as an image file, is not in use.
+func deviceUsage(path string) []disko.Usage {
+	kname, err := getKnameForBlockDevicePath(path)
+	if err != nil {
+		return nil
+	}
+
+	if uses := newUsageScanner("/proc", "/sys").usage(kname); len(uses) != 0 {
+		return uses
+	}
+
+	if isExclusivelyOpen(path) {
+		return []disko.Usage{{Kind: disko.UsageOpen}}
+	}
+
+	return nil
+}
+
+// mountPoint returns where the block device at path is mounted, or "".
+func mountPoint(path string) string {
+	for _, u := range deviceUsage(path) {
+		if u.Kind == disko.UsageMount && u.Via == "" {
+			return u.Target
+		}
+	}
+
+	return ""
+}
+
+func usageDetail(uses []disko.Usage) string {
+	strs := make([]string, 0, len(uses))
+	for _, u := range uses {
+		strs = append(strs, u.String())
+	}
+
+	return strings.Join(strs, ", ")
+}
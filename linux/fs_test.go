@@ -0,0 +1,95 @@
+package linux
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+)
+
+func TestMkfsArgs(t *testing.T) {
+	ast := assert.New(t)
+
+	values := []struct {
+		fsType   disko.FSType
+		opts     disko.FSOptions
+		expected []string
+	}{
+		{disko.FSExt4, disko.FSOptions{}, []string{"mkfs.ext4", "-F", "-q", "/dev/sda1"}},
+		{disko.FSExt4,
+			disko.FSOptions{Label: "root", UUID: "0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a",
+				Features: []string{"^has_journal", "metadata_csum"}},
+			[]string{"mkfs.ext4", "-F", "-q", "-L", "root", "-U", "0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a",
+				"-O", "^has_journal,metadata_csum", "/dev/sda1"}},
+		{disko.FSExt2, disko.FSOptions{ExtraArgs: []string{"-Elazy_itable_init=0"}},
+			[]string{"mkfs.ext2", "-F", "-q", "-Elazy_itable_init=0", "/dev/sda1"}},
+		{disko.FSXFS, disko.FSOptions{Label: "data", UUID: "u", Features: []string{"reflink=1", "crc=1"}},
+			[]string{"mkfs.xfs", "-f", "-q", "-L", "data", "-m", "uuid=u", "-m", "reflink=1", "-m", "crc=1",
+				"/dev/sda1"}},
+		{disko.FSBtrfs, disko.FSOptions{Label: "pool", Features: []string{"quota"}},
+			[]string{"mkfs.btrfs", "-f", "-q", "-L", "pool", "-O", "quota", "/dev/sda1"}},
+		{disko.FSVFAT, disko.FSOptions{Label: "EFI", UUID: "ABCD-1234"},
+			[]string{"mkfs.vfat", "-n", "EFI", "-i", "ABCD1234", "/dev/sda1"}},
+		{disko.FSSwap, disko.FSOptions{Label: "swap"}, []string{"mkswap", "-f", "-L", "swap", "/dev/sda1"}},
+	}
+
+	for _, v := range values {
+		found, err := mkfsArgs("/dev/sda1", v.fsType, v.opts)
+		if ast.NoError(err) {
+			ast.Equal(v.expected, found)
+		}
+	}
+
+	_, err := mkfsArgs("/dev/sda1", "ntfs", disko.FSOptions{})
+	ast.ErrorIs(err, disko.ErrUnsupportedFS)
+
+	_, err = mkfsArgs("/dev/sda1", disko.FSSwap, disko.FSOptions{Features: []string{"x"}})
+	ast.ErrorIs(err, disko.ErrUnsupportedFS)
+}
+
+func TestProbeFSType(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	empty := path.Join(tmpd, "empty")
+	if err := os.WriteFile(empty, make([]byte, disko.Mebibyte), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %s", empty, err)
+	}
+
+	swap := path.Join(tmpd, "swap")
+	if err := os.WriteFile(swap, make([]byte, disko.Mebibyte), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %s", swap, err)
+	}
+
+	if err := writeAt(swap, []byte("SWAPSPACE2"), 4096-10); err != nil {
+		t.Fatalf("Failed to write swap magic: %s", err)
+	}
+
+	fsType, err := probeFSType(swap)
+	if ast.NoError(err) {
+		ast.Equal(disko.FSSwap, fsType)
+	}
+
+	_, err = probeFSType(empty)
+	ast.ErrorIs(err, disko.ErrUnsupportedFS)
+
+	_, err = probeFSType(path.Join(tmpd, "missing"))
+	ast.ErrorIs(err, disko.ErrDiskNotFound)
+
+	fsm := FSManager()
+
+	// swap has nothing to check and cannot grow.
+	ast.NoError(fsm.CheckFS(swap))
+	ast.ErrorIs(fsm.GrowFS(swap), disko.ErrUnsupportedFS)
+	ast.ErrorIs(fsm.CheckFS(empty), disko.ErrUnsupportedFS)
+	ast.ErrorIs(fsm.SetFSLabel(empty, "x"), disko.ErrUnsupportedFS)
+	ast.ErrorIs(fsm.CreateFS(empty, "ntfs", disko.FSOptions{}), disko.ErrUnsupportedFS)
+}
@@ -0,0 +1,362 @@
+package linux
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rekby/gpt"
+	"machinerun.io/disko"
+)
+
+// The errors of gpt.ReadTable, which only come as strings.
+const (
+	gptBadHeaderCRC  = "BAD GPT Header CRC"
+	gptBadEntriesCRC = "Bad partitions crc"
+)
+
+// gptCopy is one of the two copies of a GPT as read from the disk.
+type gptCopy struct {
+	table gpt.Table
+	lba   uint64
+	err   error
+}
+
+// readGPTCopy reads the GPT header at lba and its partition entries.
+func readGPTCopy(fp io.ReadSeeker, ssize uint, lba uint64) gptCopy {
+	c := gptCopy{lba: lba}
+
+	if _, err := fp.Seek(int64(lba*uint64(ssize)), io.SeekStart); err != nil {
+		c.err = err
+		return c
+	}
+
+	c.table, c.err = gpt.ReadTable(fp, uint64(ssize))
+
+	return c
+}
+
+// found returns true if there is a GPT header signature at the copy's lba,
+// valid or not.
+func (c gptCopy) found() bool {
+	return string(c.table.Header.Signature[:]) == "EFI PART"
+}
+
+func (c gptCopy) valid() bool {
+	return c.err == nil
+}
+
+// problem returns what is wrong with the copy, of the header or entries
+// kind.  It returns an empty problem if the copy is valid.
+func (c gptCopy) problem(header, entries disko.TableProblemKind) disko.TableProblem {
+	switch {
+	case c.err == nil:
+		return disko.TableProblem{}
+	case !c.found():
+		return disko.TableProblem{Kind: header, Detail: fmt.Sprintf("no header at LBA %d", c.lba)}
+	case c.err.Error() == gptBadHeaderCRC:
+		return disko.TableProblem{Kind: header, Detail: fmt.Sprintf("header at LBA %d has a bad crc", c.lba)}
+	case c.err.Error() == gptBadEntriesCRC:
+		return disko.TableProblem{Kind: entries, Detail: fmt.Sprintf(
+			"partition entries at LBA %d have a bad crc", c.table.Header.PartitionsTableStartLBA)}
+	}
+
+	return disko.TableProblem{Kind: entries, Detail: fmt.Sprintf(
+		"partition entries at LBA %d cannot be read: %s", c.table.Header.PartitionsTableStartLBA, c.err)}
+}
+
+// gptCheck is both copies of the GPT on a disk and what is wrong with them.
+type gptCheck struct {
+	primary  gptCopy
+	backup   gptCopy
+	ssize    uint
+	problems []disko.TableProblem
+}
+
+// table returns the copy of the table to use: the primary if it is valid
+// and the backup otherwise.
+func (g gptCheck) table() (gpt.Table, error) {
+	switch {
+	case g.primary.valid():
+		return g.primary.table, nil
+	case g.backup.valid():
+		return g.backup.table, nil
+	case g.primary.found():
+		return gpt.Table{}, g.primary.err
+	}
+
+	return gpt.Table{}, g.backup.err
+}
+
+// readGPTForWrite returns the GPT of d, read from fp, for a change to be
+// made to it and written back.  Writing a table whose primary is not valid
+// would silently replace it with whatever the change was made to, so that
+// returns an error wrapping ErrBadPartitionTable until the table has been
+// repaired with RepairPartitionTable.  It returns ErrNoPartitionTable if
+// the disk has no GPT.
+func readGPTForWrite(fp io.ReadSeeker, d disko.Disk) (gpt.Table, error) {
+	check, err := checkGPT(fp, d.Size)
+	if err != nil {
+		return gpt.Table{}, err
+	}
+
+	if !check.primary.valid() {
+		p := check.primary.problem(disko.ProblemPrimaryHeader, disko.ProblemPrimaryEntries)
+		return gpt.Table{}, fmt.Errorf("%s: %w: %s: %s, repair the table first",
+			d.Path, disko.ErrBadPartitionTable, p.Kind, p.Detail)
+	}
+
+	return check.primary.table, nil
+}
+
+// checkGPT reads both copies of the GPT on fp, a disk of size bytes, and
+// checks them and the partitions in them.  A backup with no primary is only
+// taken to be a GPT if the MBR protects it, otherwise the disk has been
+// given an MBR table since.  It returns ErrNoPartitionTable if there is no
+// GPT.
+func checkGPT(fp io.ReadSeeker, size uint64) (gptCheck, error) {
+	for _, ssize := range []uint{sectorSize512, sectorSize4k} {
+		if size < uint64(ssize)*gptReservedSectors*2 {
+			continue
+		}
+
+		g := gptCheck{ssize: ssize}
+		lastLBA := size/uint64(ssize) - 1
+
+		g.primary = readGPTCopy(fp, ssize, 1)
+
+		backupLBA := lastLBA
+		if g.primary.valid() {
+			if alt := g.primary.table.Header.HeaderCopyStartLBA; alt > 1 && alt < lastLBA {
+				backupLBA = alt
+			}
+		}
+
+		g.backup = readGPTCopy(fp, ssize, backupLBA)
+		if !g.backup.found() && backupLBA != lastLBA {
+			g.backup = readGPTCopy(fp, ssize, lastLBA)
+		}
+
+		pmbr := protectiveMBRProblem(fp)
+
+		if !g.primary.found() && (!g.backup.found() || pmbr != "") {
+			continue
+		}
+
+		g.check(lastLBA, pmbr)
+
+		return g, nil
+	}
+
+	return gptCheck{}, ErrNoPartitionTable
+}
+
+// check fills in the problems of g.  lastLBA is the last sector of the disk
+// and pmbr what is wrong with the protective MBR.
+func (g *gptCheck) check(lastLBA uint64, pmbr string) {
+	if p := g.primary.problem(disko.ProblemPrimaryHeader, disko.ProblemPrimaryEntries); p.Kind != "" {
+		g.problems = append(g.problems, p)
+	}
+
+	if p := g.backup.problem(disko.ProblemBackupHeader, disko.ProblemBackupEntries); p.Kind != "" {
+		g.problems = append(g.problems, p)
+	}
+
+	if g.primary.valid() {
+		if alt := g.primary.table.Header.HeaderCopyStartLBA; alt != lastLBA {
+			g.problems = append(g.problems, disko.TableProblem{Kind: disko.ProblemBackupLocation,
+				Detail: fmt.Sprintf("backup header is at LBA %d, not the last LBA %d", alt, lastLBA)})
+		}
+	}
+
+	if g.primary.valid() && g.backup.valid() {
+		if fields := headerDifferences(g.primary.table.Header, g.backup.table.Header); len(fields) != 0 {
+			g.problems = append(g.problems, disko.TableProblem{Kind: disko.ProblemMismatch,
+				Detail: "primary and backup differ in " + strings.Join(fields, ", ")})
+		}
+	}
+
+	if pmbr != "" {
+		g.problems = append(g.problems, disko.TableProblem{Kind: disko.ProblemProtectiveMBR, Detail: pmbr})
+	}
+
+	if table, err := g.table(); err == nil {
+		g.problems = append(g.problems, partitionProblems(table)...)
+	}
+}
+
+// headerDifferences returns the fields that differ between the primary
+// header p and backup header b, other than where each copy is.
+func headerDifferences(p, b gpt.Header) []string {
+	fields := []string{}
+
+	if p.DiskGUID != b.DiskGUID {
+		fields = append(fields, "disk guid")
+	}
+
+	if p.FirstUsableLBA != b.FirstUsableLBA || p.LastUsableLBA != b.LastUsableLBA {
+		fields = append(fields, "usable LBAs")
+	}
+
+	if p.PartitionsArrLen != b.PartitionsArrLen || p.PartitionEntrySize != b.PartitionEntrySize {
+		fields = append(fields, "partition entry count or size")
+	}
+
+	if p.PartitionsCRC != b.PartitionsCRC {
+		fields = append(fields, "partition entries")
+	}
+
+	if p.HeaderStartLBA != b.HeaderCopyStartLBA {
+		fields = append(fields, "location of the primary")
+	}
+
+	return fields
+}
+
+// partitionProblems returns the partitions of table that are out of the
+// usable LBAs or overlap another.
+func partitionProblems(table gpt.Table) []disko.TableProblem {
+	problems := []disko.TableProblem{}
+	hdr := table.Header
+	nums := []int{}
+
+	for i, p := range table.Partitions {
+		if p.IsEmpty() {
+			continue
+		}
+
+		if p.FirstLBA > p.LastLBA || p.FirstLBA < hdr.FirstUsableLBA || p.LastLBA > hdr.LastUsableLBA {
+			problems = append(problems, disko.TableProblem{Kind: disko.ProblemOutOfBounds, Partition: uint(i + 1),
+				Detail: fmt.Sprintf("LBAs %d-%d are not within the usable LBAs %d-%d",
+					p.FirstLBA, p.LastLBA, hdr.FirstUsableLBA, hdr.LastUsableLBA)})
+		}
+
+		nums = append(nums, i)
+	}
+
+	sort.Slice(nums, func(i, j int) bool {
+		return table.Partitions[nums[i]].FirstLBA < table.Partitions[nums[j]].FirstLBA
+	})
+
+	for i := 1; i < len(nums); i++ {
+		prev, cur := table.Partitions[nums[i-1]], table.Partitions[nums[i]]
+		if cur.FirstLBA <= prev.LastLBA {
+			problems = append(problems, disko.TableProblem{Kind: disko.ProblemOverlap, Partition: uint(nums[i] + 1),
+				Detail: fmt.Sprintf("LBAs %d-%d overlap partition %d (%d-%d)",
+					cur.FirstLBA, cur.LastLBA, nums[i-1]+1, prev.FirstLBA, prev.LastLBA)})
+		}
+	}
+
+	return problems
+}
+
+// protectiveMBRProblem returns what is wrong with the protective MBR in the
+// first sector of fp, or "" if it has one.  An MBR with other partitions
+// alongside the protective one (a hybrid MBR) is accepted.
+func protectiveMBRProblem(fp io.ReadSeeker) string {
+	const (
+		entriesOffset, entrySize, numEntries = 0x1BE, 16, 4
+		typeOffset, startOffset              = 4, 8
+		gptProtective                        = 0xEE
+	)
+
+	buf := make([]byte, sectorSize512)
+
+	if _, err := fp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Sprintf("cannot be read: %s", err)
+	}
+
+	if _, err := io.ReadFull(fp, buf); err != nil {
+		return fmt.Sprintf("cannot be read: %s", err)
+	}
+
+	if buf[0x1FE] != 0x55 || buf[0x1FF] != 0xAA {
+		return "no MBR signature"
+	}
+
+	for i := 0; i < numEntries; i++ {
+		entry := buf[entriesOffset+i*entrySize : entriesOffset+(i+1)*entrySize]
+		if entry[typeOffset] != gptProtective {
+			continue
+		}
+
+		if start := binary.LittleEndian.Uint32(entry[startOffset:]); start != 1 {
+			return fmt.Sprintf("protective partition starts at LBA %d, not 1", start)
+		}
+
+		return ""
+	}
+
+	return "no protective partition"
+}
+
+// repairPartitionTable rebuilds the GPT of d from the copy of it that is
+// valid, the primary if both are, and writes a new protective MBR.  It fixes
+// the problems that are Repairable, including a backup that is not at the
+// end of a grown disk.  Partitions that overlap or are out of bounds are
+// left as they are.  It returns an error wrapping ErrBadPartitionTable if
+// neither copy is valid.
+func repairPartitionTable(ctx context.Context, d disko.Disk) error {
+	var table gpt.Table
+
+	err := withLockedFile(d.Path, func(fp *os.File, fInfo os.FileInfo) error {
+		size, err := getFileSize(fp)
+		if err != nil {
+			return err
+		}
+
+		check, err := checkGPT(fp, size)
+		if err == ErrNoPartitionTable {
+			return fmt.Errorf("disk %s has no GPT to repair: %w", d.Path, disko.ErrUnsupportedTable)
+		} else if err != nil {
+			return err
+		}
+
+		if table, err = check.table(); err != nil {
+			return fmt.Errorf("%s: %w: neither copy of the GPT is valid: %w", d.Path, disko.ErrBadPartitionTable, err)
+		}
+
+		if table, err = writeGPTTable(fp, table, size); err != nil {
+			return err
+		}
+
+		if fInfo.Mode()&os.ModeDevice == 0 {
+			return nil
+		}
+
+		return kernelAddMissingParts(ctx, d, table)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := udevSettle(ctx); err != nil {
+		return err
+	}
+
+	return genDiskChangeUEvent(d)
+}
+
+// kernelAddMissingParts tells the kernel of the partitions in table that it
+// does not know, as when it found no valid GPT on the disk.
+func kernelAddMissingParts(ctx context.Context, d disko.Disk, table gpt.Table) error {
+	missing := disko.PartitionSet{}
+
+	for i, p := range table.Partitions {
+		if p.IsEmpty() {
+			continue
+		}
+
+		n := uint(i + 1)
+		if _, err := os.Stat(fmt.Sprintf("/sys/class/block/%s", GetPartitionKname(d.Name, n))); os.IsNotExist(err) {
+			missing[n] = gptToDiskoPartition(p, n, uint(table.SectorSize))
+		}
+	}
+
+	return kernelAddParts(ctx, d, missing)
+}
@@ -0,0 +1,262 @@
+package linux
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rekby/gpt"
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+// problemKinds returns the kinds of problems, in order.
+func problemKinds(problems []disko.TableProblem) []disko.TableProblemKind {
+	kinds := []disko.TableProblemKind{}
+	for _, p := range problems {
+		kinds = append(kinds, p.Kind)
+	}
+
+	return kinds
+}
+
+// corruptAt flips the bits of the byte at offset of the file at fpath.
+func corruptAt(t *testing.T, fpath string, offset int64) {
+	fp, err := os.OpenFile(fpath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", fpath, err)
+	}
+	defer fp.Close()
+
+	buf := []byte{0}
+	if _, err := fp.ReadAt(buf, offset); err != nil {
+		t.Fatalf("Failed to read %s at %d: %s", fpath, offset, err)
+	}
+
+	buf[0] ^= 0xFF
+
+	if _, err := fp.WriteAt(buf, offset); err != nil {
+		t.Fatalf("Failed to write %s at %d: %s", fpath, offset, err)
+	}
+}
+
+func TestCheckAndRepairGPT(t *testing.T) {
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	const size = 20 * disko.Mebibyte
+
+	lastLBA := int64(size/sectorSize512 - 1)
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, fpath string)
+		kinds   []disko.TableProblemKind
+	}{
+		{"primary header", func(t *testing.T, fpath string) {
+			corruptAt(t, fpath, sectorSize512+0x30)
+		}, []disko.TableProblemKind{disko.ProblemPrimaryHeader}},
+		{"primary entries", func(t *testing.T, fpath string) {
+			corruptAt(t, fpath, 2*sectorSize512+0x38)
+		}, []disko.TableProblemKind{disko.ProblemPrimaryEntries}},
+		{"backup header", func(t *testing.T, fpath string) {
+			corruptAt(t, fpath, lastLBA*sectorSize512+0x30)
+		}, []disko.TableProblemKind{disko.ProblemBackupHeader}},
+		{"backup entries", func(t *testing.T, fpath string) {
+			corruptAt(t, fpath, (lastLBA-32)*sectorSize512+0x38)
+		}, []disko.TableProblemKind{disko.ProblemBackupEntries}},
+		{"protective mbr", func(t *testing.T, fpath string) {
+			corruptAt(t, fpath, 0x1BE+4)
+		}, []disko.TableProblemKind{disko.ProblemProtectiveMBR}},
+		{"grown disk", func(t *testing.T, fpath string) {
+			if err := os.Truncate(fpath, int64(2*size)); err != nil {
+				t.Fatalf("Failed to grow %s: %s", fpath, err)
+			}
+		}, []disko.TableProblemKind{disko.ProblemBackupLocation}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ast := assert.New(t)
+			sys := System()
+
+			disk, err := genTempGptDisk(tmpd, size)
+			if err != nil {
+				t.Fatalf("Creation of temp disk failed: %s", err)
+			}
+
+			defer os.Remove(disk.Path)
+
+			disk, err = sys.ScanDisk(disk.Path)
+			if !ast.NoError(err) {
+				return
+			}
+
+			ast.Empty(disk.TableProblems)
+
+			test.corrupt(t, disk.Path)
+
+			found, err := sys.ScanDisk(disk.Path)
+			if !ast.NoError(err) {
+				return
+			}
+
+			ast.Equal(test.kinds, problemKinds(found.TableProblems))
+			ast.Equal(disk.Partitions, found.Partitions)
+			ast.Equal(disk.GPT.DiskGUID, found.GPT.DiskGUID)
+
+			ast.NoError(sys.RepairPartitionTable(found))
+
+			found, err = sys.ScanDisk(disk.Path)
+			if ast.NoError(err) {
+				ast.Empty(found.TableProblems)
+				ast.Equal(disk.Partitions, found.Partitions)
+			}
+		})
+	}
+}
+
+func TestRepairGPTErrors(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 20*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	lastLBA := int64(disk.Size/sectorSize512 - 1)
+
+	corruptAt(t, disk.Path, sectorSize512+0x30)
+	corruptAt(t, disk.Path, lastLBA*sectorSize512+0x30)
+
+	ast.ErrorIs(repairPartitionTable(context.Background(), disk), disko.ErrBadPartitionTable)
+
+	if err := os.WriteFile(disk.Path, make([]byte, disk.Size), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %s", disk.Path, err)
+	}
+
+	ast.ErrorIs(repairPartitionTable(context.Background(), disk), disko.ErrUnsupportedTable)
+}
+
+func TestPartitionProblems(t *testing.T) {
+	ast := assert.New(t)
+
+	part := func(first, last uint64) gpt.Partition {
+		return gpt.Partition{Type: gpt.PartType(partid.LinuxFS), FirstLBA: first, LastLBA: last}
+	}
+
+	table := gpt.Table{
+		Header: gpt.Header{FirstUsableLBA: 34, LastUsableLBA: 1000},
+		Partitions: []gpt.Partition{
+			part(100, 199),
+			{},
+			part(150, 300),
+			part(900, 1100),
+			part(10, 20),
+		},
+	}
+
+	problems := partitionProblems(table)
+
+	ast.Equal([]disko.TableProblem{
+		{Kind: disko.ProblemOutOfBounds, Partition: 4, Detail: "LBAs 900-1100 are not within the usable LBAs 34-1000"},
+		{Kind: disko.ProblemOutOfBounds, Partition: 5, Detail: "LBAs 10-20 are not within the usable LBAs 34-1000"},
+		{Kind: disko.ProblemOverlap, Partition: 3, Detail: "LBAs 150-300 overlap partition 1 (100-199)"},
+	}, problems)
+
+	for _, p := range problems {
+		ast.False(p.Repairable())
+	}
+}
+
+func TestWriteCorruptPrimary(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 20*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	sys := System()
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", disk.Path, err)
+	}
+
+	if err := sys.ResizePartition(disk, 1, 10*disko.Mebibyte-1); err != nil {
+		t.Fatalf("Failed to resize partition on %s: %s", disk.Path, err)
+	}
+
+	// wipe out the primary header, leaving only the backup.
+	fp, err := os.OpenFile(disk.Path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", disk.Path, err)
+	}
+
+	_, err = fp.WriteAt(make([]byte, sectorSize512), sectorSize512)
+	fp.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to write %s: %s", disk.Path, err)
+	}
+
+	disk, err = sys.ScanDisk(disk.Path)
+	if err != nil {
+		t.Fatalf("Failed to scan %s: %s", disk.Path, err)
+	}
+
+	ast.Equal([]disko.TableProblemKind{disko.ProblemPrimaryHeader}, problemKinds(disk.TableProblems))
+
+	part := disko.Partition{Number: 2, Start: 10 * disko.Mebibyte, Last: 15*disko.Mebibyte - 1,
+		Type: partid.LinuxFS}
+
+	ast.ErrorIs(sys.CreatePartitions(disk, disko.PartitionSet{2: part}), disko.ErrBadPartitionTable)
+	ast.ErrorIs(sys.DeletePartition(disk, 1), disko.ErrBadPartitionTable)
+	ast.ErrorIs(sys.SetDiskGUID(disk, disko.GenGUID()), disko.ErrBadPartitionTable)
+
+	// the backup, and the partition in it, are left as they were.
+	found, err := sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Equal(disk.Partitions, found.Partitions)
+	ast.Equal(disk.TableProblems, found.TableProblems)
+
+	ast.NoError(sys.RepairPartitionTable(found))
+
+	found, err = sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Empty(found.TableProblems)
+
+	if ast.NoError(sys.CreatePartitions(found, disko.PartitionSet{2: part})) {
+		found, err = sys.ScanDisk(disk.Path)
+		if ast.NoError(err) {
+			ast.Len(found.Partitions, 2)
+			ast.Equal(disk.Partitions[1], found.Partitions[1])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package linux
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"machinerun.io/disko"
+)
+
+// guard returns an error if op should not change d.  The disk is scanned
+// again and checked with checkGuard.
+func (ls *linuxSystem) guard(ctx context.Context, op string, d disko.Disk, parts []uint) error {
+	cur, err := ls.ScanDiskContext(ctx, d.Path)
+	if err != nil {
+		return err
+	}
+
+	return checkGuard(op, d, cur, parts, ls.opts.force)
+}
+
+// checkGuard returns an error if op should not change d, given cur, the
+// disk as it is now.  cur must still be the disk d describes: the same
+// size, sector size, table, identity and partitions.  Unless forced, the
+// disk must also be writable, and neither the disk nor the partitions in
+// parts (every partition if parts is nil) may be in use.
+func checkGuard(op string, d, cur disko.Disk, parts []uint, force bool) error {
+	if detail := staleDetail(d, cur); detail != "" {
+		return &disko.DiskError{Disk: d.Path, Op: op, Err: disko.ErrStaleDisk, Detail: detail}
+	}
+
+	if force {
+		return nil
+	}
+
+	if cur.ReadOnly {
+		return &disko.DiskError{Disk: d.Path, Op: op, Err: disko.ErrReadOnly}
+	}
+
+	if parts == nil {
+		for n := range cur.PartitionUsage {
+			parts = append(parts, n)
+		}
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i] < parts[j] })
+
+	uses := []string{}
+
+	for _, u := range cur.Usage {
+		uses = append(uses, u.String())
+	}
+
+	for _, n := range parts {
+		for _, u := range cur.PartitionUsage[n] {
+			uses = append(uses, fmt.Sprintf("partition %d: %s", n, u))
+		}
+	}
+
+	if len(uses) != 0 {
+		return &disko.DiskError{Disk: d.Path, Op: op, Err: disko.ErrInUse, Detail: strings.Join(uses, ", ")}
+	}
+
+	return nil
+}
+
+// staleDetail returns how cur, the disk as it is now, differs from d, or ""
+// if d is still current.  A disk with no table may be given any table type
+// as that is the type a new table is created with.  The GPT disk GUID and
+// identity fields are only compared if both are known, and partition
+// signatures not at all.
+func staleDetail(d, cur disko.Disk) string {
+	switch {
+	case d.Size != cur.Size:
+		return fmt.Sprintf("size is %d, not %d", cur.Size, d.Size)
+	case d.SectorSize != 0 && d.SectorSize != cur.SectorSize:
+		return fmt.Sprintf("sector size is %d, not %d", cur.SectorSize, d.SectorSize)
+	case cur.Table != disko.TableNone && d.Table != cur.Table:
+		return fmt.Sprintf("table is %s, not %s", cur.Table, d.Table)
+	case idDiffers(d.Identity.Serial, cur.Identity.Serial):
+		return fmt.Sprintf("serial is %q, not %q", cur.Identity.Serial, d.Identity.Serial)
+	case idDiffers(d.Identity.WWN, cur.Identity.WWN):
+		return fmt.Sprintf("wwn is %q, not %q", cur.Identity.WWN, d.Identity.WWN)
+	case d.Table == disko.GPT && cur.Table == disko.GPT && d.GPT.DiskGUID != (disko.GUID{}) &&
+		d.GPT.DiskGUID != cur.GPT.DiskGUID:
+		return fmt.Sprintf("disk guid is %s, not %s", cur.GPT.DiskGUID, d.GPT.DiskGUID)
+	}
+
+	nums := []uint{}
+
+	for n := range d.Partitions {
+		nums = append(nums, n)
+	}
+
+	for n := range cur.Partitions {
+		if _, ok := d.Partitions[n]; !ok {
+			nums = append(nums, n)
+		}
+	}
+
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	for _, n := range nums {
+		p, inD := d.Partitions[n]
+		c, inCur := cur.Partitions[n]
+
+		// what is on a partition is not part of the table.
+		p.Signature, c.Signature = disko.Signature{}, disko.Signature{}
+
+		switch {
+		case !inD:
+			return fmt.Sprintf("partition %d was added", n)
+		case !inCur:
+			return fmt.Sprintf("partition %d was removed", n)
+		case p != c:
+			return fmt.Sprintf("partition %d was changed", n)
+		}
+	}
+
+	return ""
+}
+
+func idDiffers(a, b string) bool {
+	return a != "" && b != "" && a != b
+}
+
+// partNumbers returns the partition numbers in pSet.
+func partNumbers(pSet disko.PartitionSet) []uint {
+	nums := make([]uint, 0, len(pSet))
+	for n := range pSet {
+		nums = append(nums, n)
+	}
+
+	return nums
+}
@@ -0,0 +1,138 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+func guardDisk() disko.Disk {
+	return disko.Disk{
+		Name:       "sda",
+		Path:       "/dev/sda",
+		Size:       100 * disko.Mebibyte,
+		SectorSize: 512,
+		Table:      disko.GPT,
+		Identity:   disko.DiskIdentity{Serial: "S1"},
+		Partitions: disko.PartitionSet{
+			1: {Number: 1, Start: disko.Mebibyte, Last: 10*disko.Mebibyte - 1, Type: partid.LinuxFS},
+			2: {Number: 2, Start: 10 * disko.Mebibyte, Last: 20*disko.Mebibyte - 1, Type: partid.LinuxLVM},
+		},
+	}
+}
+
+func TestStaleDetail(t *testing.T) {
+	ast := assert.New(t)
+	d := guardDisk()
+
+	ast.Equal("", staleDetail(d, guardDisk()))
+
+	mods := []struct {
+		detail string
+		modify func(*disko.Disk)
+	}{
+		{"size is 209715200, not 104857600", func(c *disko.Disk) { c.Size *= 2 }},
+		{"sector size is 4096, not 512", func(c *disko.Disk) { c.SectorSize = 4096 }},
+		{"table is MBR, not GPT", func(c *disko.Disk) { c.Table = disko.MBR }},
+		{`serial is "S2", not "S1"`, func(c *disko.Disk) { c.Identity.Serial = "S2" }},
+		{"partition 3 was added", func(c *disko.Disk) { c.Partitions[3] = disko.Partition{Number: 3} }},
+		{"partition 1 was removed", func(c *disko.Disk) { delete(c.Partitions, 1) }},
+		{"partition 2 was changed", func(c *disko.Disk) {
+			p := c.Partitions[2]
+			p.Name = "renamed"
+			c.Partitions[2] = p
+		}},
+		// not stale: no table yet, or identity not known.
+		{"", func(c *disko.Disk) { c.Table = disko.TableNone }},
+		{"", func(c *disko.Disk) { c.Identity = disko.DiskIdentity{} }},
+	}
+
+	for _, m := range mods {
+		cur := guardDisk()
+		m.modify(&cur)
+		ast.Equal(m.detail, staleDetail(d, cur))
+	}
+}
+
+func TestCheckGuard(t *testing.T) {
+	ast := assert.New(t)
+	d := guardDisk()
+
+	cur := guardDisk()
+	ast.NoError(checkGuard("Wipe", d, cur, nil, false))
+
+	cur.PartitionUsage = map[uint][]disko.Usage{2: {{Kind: disko.UsageMount, Target: "/", Detail: "ext4"}}}
+
+	err := checkGuard("Wipe", d, cur, nil, false)
+	ast.ErrorIs(err, disko.ErrInUse)
+	ast.EqualError(err, "Wipe /dev/sda: in use: partition 2: mount / (ext4)")
+
+	var derr *disko.DiskError
+	if ast.True(errors.As(err, &derr)) {
+		ast.Equal("Wipe", derr.Op)
+		ast.Equal("/dev/sda", derr.Disk)
+	}
+
+	ast.NoError(checkGuard("DeletePartition", d, cur, []uint{1}, false))
+	ast.ErrorIs(checkGuard("DeletePartition", d, cur, []uint{2}, false), disko.ErrInUse)
+	ast.NoError(checkGuard("Wipe", d, cur, nil, true))
+
+	cur = guardDisk()
+	cur.Usage = []disko.Usage{{Kind: disko.UsageHolder, Target: "/dev/mapper/vg0-lv0", Detail: "lvm"}}
+	ast.ErrorIs(checkGuard("DeletePartition", d, cur, []uint{1}, false), disko.ErrInUse)
+
+	cur = guardDisk()
+	cur.ReadOnly = true
+	ast.ErrorIs(checkGuard("CreatePartitions", d, cur, nil, false), disko.ErrReadOnly)
+	ast.NoError(checkGuard("CreatePartitions", d, cur, nil, true))
+
+	// force does not apply a stale scan.
+	cur = guardDisk()
+	cur.Size++
+	ast.ErrorIs(checkGuard("Wipe", d, cur, nil, true), disko.ErrStaleDisk)
+}
+
+func TestGuardStaleScan(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 50*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	sys := System()
+
+	scanned, err := sys.ScanDisk(disk.Path)
+	if !ast.NoError(err) {
+		return
+	}
+
+	// something else deletes the partition after the scan.
+	if err := deletePartitions(context.Background(), disk, []uint{1}); err != nil {
+		t.Fatalf("Failed to delete partition: %s", err)
+	}
+
+	err = sys.Wipe(scanned)
+	ast.ErrorIs(err, disko.ErrStaleDisk)
+	ast.Contains(err.Error(), "partition 1 was removed")
+
+	err = System(WithForce()).Wipe(scanned)
+	ast.ErrorIs(err, disko.ErrStaleDisk)
+
+	rescanned, err := sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.NoError(sys.Wipe(rescanned))
+	}
+}
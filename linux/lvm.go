@@ -1,6 +1,7 @@
 package linux
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -15,21 +16,26 @@ const pvMetaDataSize = 128 * disko.Mebibyte
 const thinPoolMetaDataSize = 1024 * disko.Mebibyte
 
 // VolumeManager returns the linux implementation of disko.VolumeManager interface.
-func VolumeManager() disko.VolumeManager {
-	return &linuxLVM{}
+func VolumeManager(opts ...Option) disko.ContextVolumeManager {
+	return &linuxLVM{opts: newOptions(opts)}
 }
 
 type linuxLVM struct {
+	opts options
 }
 
 func (ls *linuxLVM) ScanPVs(filter disko.PVFilter) (disko.PVSet, error) {
-	return ls.scanPVs(filter)
+	return ls.ScanPVsContext(context.Background(), filter)
 }
 
-func (ls *linuxLVM) scanPVs(filter disko.PVFilter, scanArgs ...string) (disko.PVSet, error) {
+func (ls *linuxLVM) ScanPVsContext(ctx context.Context, filter disko.PVFilter) (disko.PVSet, error) {
+	return ls.scanPVs(ctx, filter)
+}
+
+func (ls *linuxLVM) scanPVs(ctx context.Context, filter disko.PVFilter, scanArgs ...string) (disko.PVSet, error) {
 	pvs := disko.PVSet{}
 
-	pvdatum, err := getPvReport(scanArgs...)
+	pvdatum, err := getPvReport(ctx, scanArgs...)
 	if err != nil {
 		return pvs, err
 	}
@@ -45,15 +51,19 @@ func (ls *linuxLVM) scanPVs(filter disko.PVFilter, scanArgs ...string) (disko.PV
 }
 
 func (ls *linuxLVM) ScanVGs(filter disko.VGFilter) (disko.VGSet, error) {
-	return ls.scanVGs(filter)
+	return ls.ScanVGsContext(context.Background(), filter)
+}
+
+func (ls *linuxLVM) ScanVGsContext(ctx context.Context, filter disko.VGFilter) (disko.VGSet, error) {
+	return ls.scanVGs(ctx, filter)
 }
 
-func (ls *linuxLVM) scanVGs(filter disko.VGFilter, scanArgs ...string) (disko.VGSet, error) {
+func (ls *linuxLVM) scanVGs(ctx context.Context, filter disko.VGFilter, scanArgs ...string) (disko.VGSet, error) {
 	var vgdatum []lvmVGData
 	var vgs = disko.VGSet{}
 	var err error
 
-	vgdatum, err = getVgReport(scanArgs...)
+	vgdatum, err = getVgReport(ctx, scanArgs...)
 	if err != nil {
 		return vgs, err
 	}
@@ -86,7 +96,7 @@ func (ls *linuxLVM) scanVGs(filter disko.VGFilter, scanArgs ...string) (disko.VG
 	lvSetsByVG := map[string]disko.LVSet{}
 	pvSetsByVG := map[string]disko.PVSet{}
 
-	lvs, err := ls.scanLVs(func(d disko.LV) bool { return true })
+	lvs, err := ls.scanLVs(ctx, func(d disko.LV) bool { return true })
 
 	if err != nil {
 		return vgs, err
@@ -100,7 +110,7 @@ func (ls *linuxLVM) scanVGs(filter disko.VGFilter, scanArgs ...string) (disko.VG
 		}
 	}
 
-	pvs, err := ls.scanPVs(func(d disko.PV) bool { return true })
+	pvs, err := ls.scanPVs(ctx, func(d disko.PV) bool { return true })
 
 	if err != nil {
 		return vgs, err
@@ -124,15 +134,19 @@ func (ls *linuxLVM) scanVGs(filter disko.VGFilter, scanArgs ...string) (disko.VG
 }
 
 func (ls *linuxLVM) ScanLVs(filter disko.LVFilter) (disko.LVSet, error) {
-	return ls.scanLVs(filter)
+	return ls.ScanLVsContext(context.Background(), filter)
+}
+
+func (ls *linuxLVM) ScanLVsContext(ctx context.Context, filter disko.LVFilter) (disko.LVSet, error) {
+	return ls.scanLVs(ctx, filter)
 }
 
-func (ls *linuxLVM) scanLVs(filter disko.LVFilter, scanArgs ...string) (disko.LVSet, error) {
+func (ls *linuxLVM) scanLVs(ctx context.Context, filter disko.LVFilter, scanArgs ...string) (disko.LVSet, error) {
 	var lvdatum []lvmLVData
 	var lvs = disko.LVSet{}
 	var err error
 
-	lvdatum, err = getLvReport(scanArgs...)
+	lvdatum, err = getLvReport(ctx, scanArgs...)
 	if err != nil {
 		return lvs, err
 	}
@@ -143,7 +157,7 @@ func (ls *linuxLVM) scanLVs(filter disko.LVFilter, scanArgs ...string) (disko.LV
 	for _, lvd := range lvdatum {
 		lv := lvd.toLV()
 
-		if crypt, cryptName, cryptPath, err = getLuksInfo(lv.Path); err != nil {
+		if crypt, cryptName, cryptPath, err = getLuksInfo(ctx, lv.Path); err != nil {
 			return lvs, err
 		}
 
@@ -164,6 +178,22 @@ func (ls *linuxLVM) scanLVs(filter disko.LVFilter, scanArgs ...string) (disko.LV
 }
 
 func (ls *linuxLVM) CreatePV(name string) (disko.PV, error) {
+	return ls.CreatePVContext(context.Background(), name)
+}
+
+func (ls *linuxLVM) CreatePVContext(ctx context.Context, name string) (disko.PV, error) {
+	var pv disko.PV
+
+	err := ls.opts.observe(ctx, Event{Op: "CreatePV", Target: name}, nil,
+		func(ctx context.Context) (err error) {
+			pv, err = ls.createPV(ctx, name)
+			return err
+		})
+
+	return pv, err
+}
+
+func (ls *linuxLVM) createPV(ctx context.Context, name string) (disko.PV, error) {
 	nilPV := disko.PV{}
 
 	var err error
@@ -173,14 +203,14 @@ func (ls *linuxLVM) CreatePV(name string) (disko.PV, error) {
 		return nilPV, err
 	}
 
-	err = runCommandSettled("lvm", "pvcreate", "--force", "--zero=y",
+	err = runCommandSettled(ctx, "lvm", "pvcreate", "--force", "--zero=y",
 		fmt.Sprintf("--metadatasize=%dB", pvMetaDataSize), path)
 
 	if err != nil {
 		return nilPV, err
 	}
 
-	pvs, err := ls.scanPVs(func(d disko.PV) bool { return true }, path)
+	pvs, err := ls.scanPVs(ctx, func(d disko.PV) bool { return true }, path)
 	if err != nil {
 		return nilPV, err
 	}
@@ -194,11 +224,22 @@ func (ls *linuxLVM) CreatePV(name string) (disko.PV, error) {
 }
 
 func (ls *linuxLVM) DeletePV(pv disko.PV) error {
-	return runCommandSettled("lvm", "pvremove", "--force", "--force", "--yes", pv.Path)
+	return ls.DeletePVContext(context.Background(), pv)
+}
+
+func (ls *linuxLVM) DeletePVContext(ctx context.Context, pv disko.PV) error {
+	return ls.opts.observe(ctx, Event{Op: "DeletePV", Target: pv.Path}, nil,
+		func(ctx context.Context) error {
+			return runCommandSettled(ctx, "lvm", "pvremove", "--force", "--force", "--yes", pv.Path)
+		})
 }
 
 func (ls *linuxLVM) HasPV(name string) bool {
-	pvs, err := ls.scanPVs(func(d disko.PV) bool { return true }, getPathForKname(name))
+	return ls.HasPVContext(context.Background(), name)
+}
+
+func (ls *linuxLVM) HasPVContext(ctx context.Context, name string) bool {
+	pvs, err := ls.scanPVs(ctx, func(d disko.PV) bool { return true }, getPathForKname(name))
 	if err != nil {
 		return false
 	}
@@ -207,6 +248,22 @@ func (ls *linuxLVM) HasPV(name string) bool {
 }
 
 func (ls *linuxLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
+	return ls.CreateVGContext(context.Background(), name, pvs...)
+}
+
+func (ls *linuxLVM) CreateVGContext(ctx context.Context, name string, pvs ...disko.PV) (disko.VG, error) {
+	var vg disko.VG
+
+	err := ls.opts.observe(ctx, Event{Op: "CreateVG", Target: name}, nil,
+		func(ctx context.Context) (err error) {
+			vg, err = ls.createVG(ctx, name, pvs...)
+			return err
+		})
+
+	return vg, err
+}
+
+func (ls *linuxLVM) createVG(ctx context.Context, name string, pvs ...disko.PV) (disko.VG, error) {
 	cmd := []string{"lvm", "vgcreate", "--force", "--zero=y",
 		fmt.Sprintf("--metadatasize=%dB", pvMetaDataSize), name}
 
@@ -214,12 +271,12 @@ func (ls *linuxLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
 		cmd = append(cmd, p.Path)
 	}
 
-	err := runCommandSettled(cmd...)
+	err := runCommandSettled(ctx, cmd...)
 	if err != nil {
 		return disko.VG{}, err
 	}
 
-	vgSet, err := ls.scanVGs(func(d disko.VG) bool { return true }, name)
+	vgSet, err := ls.scanVGs(ctx, func(d disko.VG) bool { return true }, name)
 
 	if err != nil {
 		return disko.VG{}, err
@@ -229,6 +286,17 @@ func (ls *linuxLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
 }
 
 func (ls *linuxLVM) ExtendVG(vgName string, pvs ...disko.PV) error {
+	return ls.ExtendVGContext(context.Background(), vgName, pvs...)
+}
+
+func (ls *linuxLVM) ExtendVGContext(ctx context.Context, vgName string, pvs ...disko.PV) error {
+	return ls.opts.observe(ctx, Event{Op: "ExtendVG", Target: vgName}, nil,
+		func(ctx context.Context) error {
+			return ls.extendVG(ctx, vgName, pvs...)
+		})
+}
+
+func (ls *linuxLVM) extendVG(ctx context.Context, vgName string, pvs ...disko.PV) error {
 	// Have to create the PVs first in case they were dirty.
 	// pvcreate can be run on existing pvs.
 	// https://bugzilla.redhat.com/show_bug.cgi?id=2134912
@@ -240,14 +308,14 @@ func (ls *linuxLVM) ExtendVG(vgName string, pvs ...disko.PV) error {
 	cmd := append([]string{"lvm", "pvcreate", "--force", "--zero=y",
 		fmt.Sprintf("--metadatasize=%dB", pvMetaDataSize)}, pvPaths...)
 
-	err := runCommandSettled(cmd...)
+	err := runCommandSettled(ctx, cmd...)
 	if err != nil {
 		return err
 	}
 
 	cmd = append([]string{"lvm", "vgextend", "--zero=y", vgName}, pvPaths...)
 
-	err = runCommandSettled(cmd...)
+	err = runCommandSettled(ctx, cmd...)
 	if err != nil {
 		return err
 	}
@@ -256,11 +324,22 @@ func (ls *linuxLVM) ExtendVG(vgName string, pvs ...disko.PV) error {
 }
 
 func (ls *linuxLVM) RemoveVG(vgName string) error {
-	return runCommand("lvm", "vgremove", "--force", vgName)
+	return ls.RemoveVGContext(context.Background(), vgName)
+}
+
+func (ls *linuxLVM) RemoveVGContext(ctx context.Context, vgName string) error {
+	return ls.opts.observe(ctx, Event{Op: "RemoveVG", Target: vgName}, nil,
+		func(ctx context.Context) error {
+			return runCommand(ctx, "lvm", "vgremove", "--force", vgName)
+		})
 }
 
 func (ls *linuxLVM) HasVG(vgName string) bool {
-	vgs, err := ls.scanVGs(func(d disko.VG) bool { return true }, vgName)
+	return ls.HasVGContext(context.Background(), vgName)
+}
+
+func (ls *linuxLVM) HasVGContext(ctx context.Context, vgName string) bool {
+	vgs, err := ls.scanVGs(ctx, func(d disko.VG) bool { return true }, vgName)
 	if err != nil {
 		return false
 	}
@@ -269,30 +348,52 @@ func (ls *linuxLVM) HasVG(vgName string) bool {
 }
 
 func (ls *linuxLVM) CryptFormat(vgName string, lvName string, key string) error {
-	return runCommandStdin(
-		key,
-		"cryptsetup", "luksFormat", "--type=luks2", "--key-file=-", lvPath(vgName, lvName))
+	return ls.CryptFormatContext(context.Background(), vgName, lvName, key)
+}
+
+func (ls *linuxLVM) CryptFormatContext(ctx context.Context, vgName string, lvName string, key string) error {
+	return ls.opts.observe(ctx, Event{Op: "CryptFormat", Target: vgLv(vgName, lvName)}, nil,
+		func(ctx context.Context) error {
+			return runCommandStdin(ctx, key,
+				"cryptsetup", "luksFormat", "--type=luks2", "--key-file=-", lvPath(vgName, lvName))
+		})
 }
 
 func (ls *linuxLVM) CryptOpen(vgName string, lvName string,
 	decryptedName string, key string) error {
-	return runCommandStdin(key,
-		"cryptsetup", "open", "--type=luks", "--key-file=-",
-		lvPath(vgName, lvName), decryptedName)
+	return ls.CryptOpenContext(context.Background(), vgName, lvName, decryptedName, key)
+}
+
+func (ls *linuxLVM) CryptOpenContext(ctx context.Context, vgName string, lvName string,
+	decryptedName string, key string) error {
+	return ls.opts.observe(ctx, Event{Op: "CryptOpen", Target: vgLv(vgName, lvName)}, nil,
+		func(ctx context.Context) error {
+			return runCommandStdin(ctx, key,
+				"cryptsetup", "open", "--type=luks", "--key-file=-",
+				lvPath(vgName, lvName), decryptedName)
+		})
 }
 
 func (ls *linuxLVM) CryptClose(vgName string, lvName string,
 	decryptedName string) error {
-	return runCommand("cryptsetup", "close", decryptedName)
+	return ls.CryptCloseContext(context.Background(), vgName, lvName, decryptedName)
 }
 
-func createLVCmd(args ...string) error {
-	return runCommandSettled(
+func (ls *linuxLVM) CryptCloseContext(ctx context.Context, vgName string, lvName string,
+	decryptedName string) error {
+	return ls.opts.observe(ctx, Event{Op: "CryptClose", Target: vgLv(vgName, lvName)}, nil,
+		func(ctx context.Context) error {
+			return runCommand(ctx, "cryptsetup", "close", decryptedName)
+		})
+}
+
+func createLVCmd(ctx context.Context, args ...string) error {
+	return runCommandSettled(ctx,
 		append([]string{"lvm", "lvcreate", "--ignoremonitoring", "--yes", "--activate=y",
 			"--setactivationskip=n"}, args...)...)
 }
 
-func createThinPool(name string, vgName string, size uint64, mdSize uint64) error {
+func createThinPool(ctx context.Context, name string, vgName string, size uint64, mdSize uint64) error {
 	// thinpool takes up size + 2*mdSize
 	// https://www.redhat.com/archives/linux-lvm/2020-October/thread.html#00016
 	args := []string{}
@@ -302,11 +403,29 @@ func createThinPool(name string, vgName string, size uint64, mdSize uint64) erro
 		args = append(args, fmt.Sprintf("--poolmetadatasize=%dB", mdSize))
 	}
 
-	return createLVCmd(append(args, "--zero=y", "--wipesignatures=y",
+	return createLVCmd(ctx, append(args, "--zero=y", "--wipesignatures=y",
 		fmt.Sprintf("--size=%dB", size), "--thinpool="+name, vgName)...)
 }
 
 func (ls *linuxLVM) CreateLV(vgName string, name string, size uint64,
+	lvType disko.LVType) (disko.LV, error) {
+	return ls.CreateLVContext(context.Background(), vgName, name, size, lvType)
+}
+
+func (ls *linuxLVM) CreateLVContext(ctx context.Context, vgName string, name string, size uint64,
+	lvType disko.LVType) (disko.LV, error) {
+	var lv disko.LV
+
+	err := ls.opts.observe(ctx, Event{Op: "CreateLV", Target: vgLv(vgName, name)}, nil,
+		func(ctx context.Context) (err error) {
+			lv, err = ls.createLV(ctx, vgName, name, size, lvType)
+			return err
+		})
+
+	return lv, err
+}
+
+func (ls *linuxLVM) createLV(ctx context.Context, vgName string, name string, size uint64,
 	lvType disko.LVType) (disko.LV, error) {
 	nilLV := disko.LV{}
 
@@ -331,11 +450,11 @@ func (ls *linuxLVM) CreateLV(vgName string, name string, size uint64,
 		vglv = vgLv(strings.Split(vgName, "/")[0], name)
 
 		// creation of thin volumes are always zero'd, and passing '--zero=y' will fail.
-		if err := createLVCmd("--virtualsize="+sizeB, nameFlag, vgName); err != nil {
+		if err := createLVCmd(ctx, "--virtualsize="+sizeB, nameFlag, vgName); err != nil {
 			return nilLV, err
 		}
 	case disko.THICK:
-		if err := createLVCmd("--zero=y", "--wipesignatures=y", "--size="+sizeB, nameFlag, vgName); err != nil {
+		if err := createLVCmd(ctx, "--zero=y", "--wipesignatures=y", "--size="+sizeB, nameFlag, vgName); err != nil {
 			return nilLV, err
 		}
 
@@ -344,12 +463,12 @@ func (ls *linuxLVM) CreateLV(vgName string, name string, size uint64,
 		}
 	case disko.THINPOOL:
 		// When creating a THINPOOL, the name is the thin pool name.
-		if err := createThinPool(name, vgName, size, thinPoolMetaDataSize); err != nil {
+		if err := createThinPool(ctx, name, vgName, size, thinPoolMetaDataSize); err != nil {
 			return nilLV, err
 		}
 	}
 
-	lvs, err := ls.scanLVs(func(d disko.LV) bool { return true }, vglv)
+	lvs, err := ls.scanLVs(ctx, func(d disko.LV) bool { return true }, vglv)
 
 	if err != nil {
 		return nilLV, err
@@ -403,15 +522,42 @@ func luks2Wipe(fpath string) error {
 }
 
 func (ls *linuxLVM) RenameLV(vgName string, lvName string, newLvName string) error {
-	return runCommandSettled("lvm", "lvrename", vgName, lvName, newLvName)
+	return ls.RenameLVContext(context.Background(), vgName, lvName, newLvName)
+}
+
+func (ls *linuxLVM) RenameLVContext(ctx context.Context, vgName string, lvName string, newLvName string) error {
+	return ls.opts.observe(ctx, Event{Op: "RenameLV", Target: vgLv(vgName, lvName)}, nil,
+		func(ctx context.Context) error {
+			return runCommandSettled(ctx, "lvm", "lvrename", vgName, lvName, newLvName)
+		})
 }
 
 func (ls *linuxLVM) RemoveLV(vgName string, lvName string) error {
-	return runCommandSettled(
-		"lvm", "lvremove", "--force", "--force", vgLv(vgName, lvName))
+	return ls.RemoveLVContext(context.Background(), vgName, lvName)
+}
+
+func (ls *linuxLVM) RemoveLVContext(ctx context.Context, vgName string, lvName string) error {
+	return ls.opts.observe(ctx, Event{Op: "RemoveLV", Target: vgLv(vgName, lvName)}, nil,
+		func(ctx context.Context) error {
+			return runCommandSettled(ctx,
+				"lvm", "lvremove", "--force", "--force", vgLv(vgName, lvName))
+		})
 }
 
 func (ls *linuxLVM) ExtendLV(vgName string, lvName string,
+	newSize uint64) error {
+	return ls.ExtendLVContext(context.Background(), vgName, lvName, newSize)
+}
+
+func (ls *linuxLVM) ExtendLVContext(ctx context.Context, vgName string, lvName string,
+	newSize uint64) error {
+	return ls.opts.observe(ctx, Event{Op: "ExtendLV", Target: vgLv(vgName, lvName)}, nil,
+		func(ctx context.Context) error {
+			return ls.extendLV(ctx, vgName, lvName, newSize)
+		})
+}
+
+func (ls *linuxLVM) extendLV(ctx context.Context, vgName string, lvName string,
 	newSize uint64) error {
 	var err error
 
@@ -419,7 +565,7 @@ func (ls *linuxLVM) ExtendLV(vgName string, lvName string,
 		return err
 	}
 
-	err = runCommandSettled(
+	err = runCommandSettled(ctx,
 		"lvm", "lvextend", fmt.Sprintf("--size=%dB", newSize),
 		vgLv(vgName, lvName))
 
@@ -427,11 +573,11 @@ func (ls *linuxLVM) ExtendLV(vgName string, lvName string,
 		return err
 	}
 
-	if crypt, cryptName, _, err := getLuksInfo(lvPath(vgName, lvName)); err != nil {
+	if crypt, cryptName, _, err := getLuksInfo(ctx, lvPath(vgName, lvName)); err != nil {
 		return err
 	} else if crypt && cryptName != "" {
 		// luks device already opened, so resize it.
-		if err := runCommandSettled("cryptsetup", "resize", cryptName); err != nil {
+		if err := runCommandSettled(ctx, "cryptsetup", "resize", cryptName); err != nil {
 			return err
 		}
 	}
@@ -440,9 +586,17 @@ func (ls *linuxLVM) ExtendLV(vgName string, lvName string,
 }
 
 func (ls *linuxLVM) HasLV(vgName string, name string) bool {
-	lvs, err := ls.scanLVs(func(d disko.LV) bool { return true }, vgLv(vgName, name))
+	return ls.HasLVContext(context.Background(), vgName, name)
+}
+
+func (ls *linuxLVM) HasLVContext(ctx context.Context, vgName string, name string) bool {
+	lvs, err := ls.scanLVs(ctx, func(d disko.LV) bool { return true }, vgLv(vgName, name))
 	if err != nil {
-		log.Panicf("Failed to scan logical volumes: %s", err)
+		if ctx.Err() == nil {
+			log.Printf("Failed to scan logical volumes: %s", err)
+		}
+
+		return false
 	}
 
 	return len(lvs) != 0
@@ -474,7 +628,7 @@ func chompBytes(data []byte) []byte {
 //	cryptName - name of crypt dev if device is open - "" if not encrypted.
 //	cryptPath - path of crypt dev if device is open - "" if not encrypted.
 //	error - nil unless an error occurred.
-func getLuksInfo(devpath string) (bool, string, string, error) {
+func getLuksInfo(ctx context.Context, devpath string) (bool, string, string, error) {
 	crypt := false
 
 	if !pathExists(devpath) {
@@ -484,9 +638,11 @@ func getLuksInfo(devpath string) (bool, string, string, error) {
 	// $ cryptsetup luksUUID /dev/vg_ifc0/certs
 	// a41a29c5-e375-4586-b30f-40eee4441db6
 	cmd := []string{"cryptsetup", "luksUUID", devpath}
-	stdout, stderr, rc := runCommandWithOutputErrorRc(cmd...)
+	stdout, stderr, rc := runCommandWithOutputErrorRc(ctx, cmd...)
 
-	if rc == 1 {
+	if err := contextError(ctx, cmd); err != nil && rc != 0 {
+		return crypt, "", "", err
+	} else if rc == 1 {
 		return crypt, "", "", nil
 	} else if rc != 0 {
 		return crypt, "", "", cmdError(cmd, stdout, stderr, rc)
@@ -500,9 +656,13 @@ func getLuksInfo(devpath string) (bool, string, string, error) {
 	minFields := 4
 
 	cmd = []string{"dmsetup", "table", "--concise"}
-	stdout, stderr, rc = runCommandWithOutputErrorRc(cmd...)
+	stdout, stderr, rc = runCommandWithOutputErrorRc(ctx, cmd...)
 
 	if rc != 0 {
+		if err := contextError(ctx, cmd); err != nil {
+			return crypt, "", "", err
+		}
+
 		return crypt, "", "", cmdError(cmd, stdout, stderr, rc)
 	}
 
@@ -557,6 +717,14 @@ func (d *lvmLVData) toLV() disko.LV {
 		Encrypted: false,
 	}
 
+	if lvtype == disko.THIN {
+		lv.Pool = d.Pool
+	}
+
+	if lvtype == disko.THIN || lvtype == disko.THINPOOL {
+		lv.DataPercent = d.DataPercent
+	}
+
 	return lv
 }
 
@@ -58,6 +58,7 @@ func TestLVDataToLV(t *testing.T) {
 				UUID:      aUUID,
 				Size:      mySize,
 				Type:      disko.THIN,
+				Pool:      "ThinDataLV",
 				Encrypted: false,
 			},
 		},
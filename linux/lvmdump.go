@@ -1,22 +1,23 @@
 package linux
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 )
 
-func readReportUint64(s string) uint64 {
+func readReportUint64(s string) (uint64, error) {
 	// lvm --report-format=json --unit=B puts unit 'B' at end of all sizes.
 	s = strings.TrimSuffix(s, "B")
 
 	num, err := strconv.ParseUint(s, 10, 64)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to convert string %s to int64: %s", s, err))
+		return 0, fmt.Errorf("failed to convert string %s to uint64: %w", s, err)
 	}
 
-	return num
+	return num, nil
 }
 
 type lvmPVData struct {
@@ -41,9 +42,18 @@ func (d *lvmPVData) UnmarshalJSON(b []byte) error {
 	d.Path = m["pv_name"]
 	d.VGName = m["vg_name"]
 	d.UUID = m["pv_uuid"]
-	d.Size = readReportUint64(m["pv_size"])
-	d.MetadataSize = readReportUint64(m["pv_mda_size"])
-	d.Free = readReportUint64(m["pv_free"])
+
+	if d.Size, err = readReportUint64(m["pv_size"]); err != nil {
+		return err
+	}
+
+	if d.MetadataSize, err = readReportUint64(m["pv_mda_size"]); err != nil {
+		return err
+	}
+
+	if d.Free, err = readReportUint64(m["pv_free"]); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -59,14 +69,18 @@ func parsePvReport(report []byte) ([]lvmPVData, error) {
 	return d["report"][0]["pv"], nil
 }
 
-func getPvReport(args ...string) ([]lvmPVData, error) {
+func getPvReport(ctx context.Context, args ...string) ([]lvmPVData, error) {
 	cmd := []string{"lvm", "pvs", "--options=pv_all,vg_name", "--report-format=json", "--unit=B"}
 	cmd = append(cmd, args...)
-	out, stderr, rc := runCommandWithOutputErrorRc(cmd...)
+	out, stderr, rc := runCommandWithOutputErrorRc(ctx, cmd...)
 
 	if rc != 0 {
+		if err := contextError(ctx, cmd); err != nil {
+			return nil, err
+		}
+
 		return []lvmPVData{},
-			fmt.Errorf("failed lvm pvs [%d]: %s\n%s", rc, out, stderr)
+			fmt.Errorf("failed lvm pvs: %w", cmdError(cmd, out, stderr, rc))
 	}
 
 	return parsePvReport(out)
@@ -90,9 +104,16 @@ func (d *lvmVGData) UnmarshalJSON(b []byte) error {
 
 	d.raw = m
 	d.Name = m["vg_name"]
-	d.Size = readReportUint64(m["vg_size"])
+
+	if d.Size, err = readReportUint64(m["vg_size"]); err != nil {
+		return err
+	}
+
 	d.UUID = m["vg_uuid"]
-	d.Free = readReportUint64(m["vg_free"])
+
+	if d.Free, err = readReportUint64(m["vg_free"]); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -108,14 +129,18 @@ func parseVgReport(report []byte) ([]lvmVGData, error) {
 	return d["report"][0]["vg"], nil
 }
 
-func getVgReport(args ...string) ([]lvmVGData, error) {
+func getVgReport(ctx context.Context, args ...string) ([]lvmVGData, error) {
 	cmd := []string{"lvm", "vgs", "--options=vg_all", "--report-format=json", "--unit=B"}
 	cmd = append(cmd, args...)
-	out, stderr, rc := runCommandWithOutputErrorRc(cmd...)
+	out, stderr, rc := runCommandWithOutputErrorRc(ctx, cmd...)
 
 	if rc != 0 {
+		if err := contextError(ctx, cmd); err != nil {
+			return nil, err
+		}
+
 		return []lvmVGData{},
-			fmt.Errorf("failed lvm vgs [%d]: %s\n%s", rc, out, stderr)
+			fmt.Errorf("failed lvm vgs: %w", cmdError(cmd, out, stderr, rc))
 	}
 
 	return parseVgReport(out)
@@ -129,7 +154,9 @@ type lvmLVData struct {
 	UUID   string
 	Active bool
 	Pool   string
-	raw    map[string]string
+	// DataPercent is data_percent, which is empty but for thin volumes.
+	DataPercent float64
+	raw         map[string]string
 }
 
 func (d *lvmLVData) UnmarshalJSON(b []byte) error {
@@ -147,7 +174,16 @@ func (d *lvmLVData) UnmarshalJSON(b []byte) error {
 	d.Active = m["lv_active"] == "active"
 	d.Pool = m["pool_lv"]
 	d.UUID = m["lv_uuid"]
-	d.Size = readReportUint64(m["lv_size"])
+
+	if d.Size, err = readReportUint64(m["lv_size"]); err != nil {
+		return err
+	}
+
+	if pct := m["data_percent"]; pct != "" {
+		if d.DataPercent, err = strconv.ParseFloat(pct, 64); err != nil {
+			return fmt.Errorf("failed to convert data_percent %s to float: %w", pct, err)
+		}
+	}
 
 	return nil
 }
@@ -163,14 +199,18 @@ func parseLvReport(report []byte) ([]lvmLVData, error) {
 	return d["report"][0]["lv"], nil
 }
 
-func getLvReport(args ...string) ([]lvmLVData, error) {
+func getLvReport(ctx context.Context, args ...string) ([]lvmLVData, error) {
 	cmd := []string{"lvm", "lvs", "--options=lv_all,vg_name", "--report-format=json", "--unit=B"}
 	cmd = append(cmd, args...)
-	out, stderr, rc := runCommandWithOutputErrorRc(cmd...)
+	out, stderr, rc := runCommandWithOutputErrorRc(ctx, cmd...)
 
 	if rc != 0 {
+		if err := contextError(ctx, cmd); err != nil {
+			return nil, err
+		}
+
 		return []lvmLVData{},
-			fmt.Errorf("failed lvm lvs [%d]: %s\n%s", rc, out, stderr)
+			fmt.Errorf("failed lvm lvs: %w", cmdError(cmd, out, stderr, rc))
 	}
 
 	return parseLvReport(out)
@@ -47,6 +47,30 @@ func TestParseLvReport(t *testing.T) {
 			}}, found)
 }
 
+func TestParseLvReportThinPool(t *testing.T) {
+	ast := assert.New(t)
+
+	found, err := parseLvReport([]byte(
+		`{"report": [{"lv": [{
+          "lv_active": "active",
+          "lv_name": "pool",
+          "lv_path": "",
+          "lv_size": "` + asBS(size1) + `",
+          "lv_uuid": "yY7AfO-dtWE-ROJR-f7G9-d70P-pjGF-lFfXgf",
+          "vg_name": "atx_container",
+          "pool_lv": "",
+          "data_percent": "37.25"
+		}]}]}`))
+
+	if ast.NoError(err) && ast.Len(found, 1) {
+		ast.Equal(37.25, found[0].DataPercent)
+	}
+
+	_, err = parseLvReport([]byte(
+		`{"report": [{"lv": [{"lv_size": "` + asBS(size1) + `", "data_percent": "lots"}]}]}`))
+	ast.Error(err)
+}
+
 func TestParseVgReport(t *testing.T) {
 	ast := assert.New(t)
 	rawStub := map[string]string{"ignore-key": "ignore-val"}
@@ -101,3 +125,15 @@ func TestParsePvReport(t *testing.T) {
 				raw:          rawStub,
 			}}, found)
 }
+
+func TestParseReportBadSize(t *testing.T) {
+	ast := assert.New(t)
+
+	_, err := parseLvReport([]byte(
+		`{"report": [{"lv": [{
+          "lv_name": "storage",
+          "lv_size": "12.5GiB",
+          "vg_name": "atx_container"
+		}]}]}`))
+	ast.NotNil(err)
+}
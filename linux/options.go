@@ -0,0 +1,65 @@
+package linux
+
+// defaultScanParallelism is how many disks ScanDisks scans at once unless
+// WithScanParallelism says otherwise.
+const defaultScanParallelism = 8
+
+// Option configures the linux System, VolumeManager and FSManager.
+type Option func(*options)
+
+type options struct {
+	observers       []Observer
+	scanParallelism int
+	tolerantScan    bool
+	force           bool
+}
+
+// WithScanParallelism sets how many disks ScanDisks and ScanAllDisks scan
+// at once.  1 scans them one after the other, n < 1 uses the default.
+func WithScanParallelism(n int) Option {
+	return func(opts *options) {
+		opts.scanParallelism = n
+	}
+}
+
+// WithTolerantScan makes ScanDisks and ScanAllDisks return every disk they
+// could scan.  The disks that could not be scanned are left out and their
+// errors returned as a disko.ScanErrors.
+func WithTolerantScan() Option {
+	return func(opts *options) {
+		opts.tolerantScan = true
+	}
+}
+
+// WithForce lets Wipe, CreatePartitions, UpdatePartitions and
+// DeletePartition change disks that are read only or in use.  The disk
+// must still match the scan it was passed with.  It also lets CreateFS
+// format a device that is in use.
+func WithForce() Option {
+	return func(opts *options) {
+		opts.force = true
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// scanWorkers returns the number of goroutines to scan n disks with.
+func (o options) scanWorkers(n int) int {
+	workers := o.scanParallelism
+	if workers < 1 {
+		workers = defaultScanParallelism
+	}
+
+	if n < workers {
+		return n
+	}
+
+	return workers
+}
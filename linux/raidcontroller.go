@@ -1,6 +1,10 @@
 package linux
 
-import "machinerun.io/disko"
+import (
+	"context"
+
+	"machinerun.io/disko"
+)
 
 type RAIDControllerType string
 
@@ -13,6 +17,9 @@ const (
 type RAIDController interface {
 	// Type() RAIDControllerType
 	GetDiskType(string) (disko.DiskType, error)
+	GetDiskTypeContext(context.Context, string) (disko.DiskType, error)
+	GetDiskIdentity(string) (disko.DiskIdentity, error)
+	GetDiskIdentityContext(context.Context, string) (disko.DiskIdentity, error)
 	IsSysPathRAID(string) bool
 	DriverSysfsPath() string
 }
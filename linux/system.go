@@ -1,12 +1,16 @@
 package linux
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -18,16 +22,22 @@ import (
 
 type linuxSystem struct {
 	raidctrls []RAIDController
+	opts      options
+
+	// raidMutex serializes the RAID controller queries of concurrent scans.
+	// The vendor tools are not meant to run more than one at a time.
+	raidMutex sync.Mutex
 }
 
 // System returns an linux specific implementation of disko.System interface.
-func System() disko.System {
+func System(opts ...Option) disko.ContextSystem {
 	return &linuxSystem{
 		raidctrls: []RAIDController{
 			megaraid.CachingStorCli(),
-			smartpqi.ArcConf(),
-			mpi3mr.StorCli2(),
+			smartpqi.CachingArcConf(),
+			mpi3mr.CachingStorCli2(),
 		},
+		opts: newOptions(opts),
 	}
 }
 
@@ -39,8 +49,13 @@ func System() disko.System {
 var vmbusSyspathEphemeral = regexp.MustCompile(`.*/VMBUS:\d\d/00000000-0001-\d{4}-\d{4}-\d{12}/host.*`)
 
 func (ls *linuxSystem) ScanAllDisks(filter disko.DiskFilter) (disko.DiskSet, error) {
+	return ls.ScanAllDisksContext(context.Background(), filter)
+}
+
+func (ls *linuxSystem) ScanAllDisksContext(ctx context.Context, filter disko.DiskFilter) (disko.DiskSet, error) {
 	var err error
 	var dpaths = []string{}
+	var scanErrs = disko.ScanErrors{}
 
 	names, err := getDiskNames()
 	if err != nil {
@@ -52,6 +67,11 @@ func (ls *linuxSystem) ScanAllDisks(filter disko.DiskFilter) (disko.DiskSet, err
 
 		f, err := os.Open(dpath)
 		if err != nil {
+			if ls.opts.tolerantScan {
+				scanErrs[dpath] = openError(dpath, err)
+				continue
+			}
+
 			// ENOMEDIUM will occur on a empty sd reader.
 			if e, ok := err.(*os.PathError); ok {
 				if e.Err == syscall.ENOMEDIUM {
@@ -69,28 +89,151 @@ func (ls *linuxSystem) ScanAllDisks(filter disko.DiskFilter) (disko.DiskSet, err
 		dpaths = append(dpaths, dpath)
 	}
 
-	return ls.ScanDisks(filter, dpaths...)
+	disks, err := ls.ScanDisksContext(ctx, filter, dpaths...)
+	if len(scanErrs) == 0 {
+		return disks, err
+	}
+
+	if others, ok := err.(disko.ScanErrors); ok {
+		for p, e := range others {
+			scanErrs[p] = e
+		}
+	} else if err != nil {
+		return disks, err
+	}
+
+	return disks, scanErrs
+}
+
+// openError returns the error of opening the disk at dpath.
+func openError(dpath string, err error) error {
+	if errors.Is(err, syscall.ENOMEDIUM) {
+		return fmt.Errorf("%s: %w", dpath, disko.ErrNoMedium)
+	}
+
+	return err
 }
 
 func (ls *linuxSystem) ScanDisks(filter disko.DiskFilter,
 	dpaths ...string) (disko.DiskSet, error) {
+	return ls.ScanDisksContext(context.Background(), filter, dpaths...)
+}
+
+// ScanDisksContext scans dpaths with up to scanParallelism of them at once.
+// The result is the same as scanning them one after the other: on error,
+// the disks before the first path that failed are returned with its error.
+// A tolerant scan scans every path and returns the errors as ScanErrors.
+func (ls *linuxSystem) ScanDisksContext(ctx context.Context, filter disko.DiskFilter,
+	dpaths ...string) (disko.DiskSet, error) {
+	type result struct {
+		disk disko.Disk
+		err  error
+		done bool
+	}
+
+	results := make([]result, len(dpaths))
+	failed := atomic.Int64{}
+	failed.Store(int64(len(dpaths)))
+
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < ls.opts.scanWorkers(len(dpaths)); w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range work {
+				disk, err := ls.ScanDiskContext(ctx, dpaths[i])
+				results[i] = result{disk: disk, err: err, done: true}
+
+				if err == nil || ls.opts.tolerantScan {
+					continue
+				}
+
+				for cur := failed.Load(); int64(i) < cur; cur = failed.Load() {
+					if failed.CompareAndSwap(cur, int64(i)) {
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	// Paths are handed out in order, so once a path has failed there is no
+	// need to scan any after it.
+	for i := range dpaths {
+		if int64(i) > failed.Load() {
+			break
+		}
+
+		if err := ctx.Err(); err != nil {
+			results[i] = result{err: err, done: true}
+			break
+		}
+
+		work <- i
+	}
+
+	close(work)
+	wg.Wait()
+
 	disks := disko.DiskSet{}
+	scanErrs := disko.ScanErrors{}
 
-	for _, dpath := range dpaths {
-		disk, err := ls.ScanDisk(dpath)
-		if err != nil {
-			return disks, err
+	for i, r := range results {
+		if !r.done {
+			break
+		}
+
+		if r.err != nil {
+			if !ls.opts.tolerantScan || ctx.Err() != nil {
+				return disks, r.err
+			}
+
+			scanErrs[dpaths[i]] = r.err
+
+			continue
 		}
 
-		if filter(disk) {
+		if filter(r.disk) {
 			// Accepted so add to the set
-			disks[disk.Name] = disk
+			disks[r.disk.Name] = r.disk
 		}
 	}
 
+	if len(scanErrs) != 0 {
+		return disks, scanErrs
+	}
+
 	return disks, nil
 }
 
+// queryRAIDController returns the disk type and identity of the RAID volume
+// at devicePath from ctrl.
+func (ls *linuxSystem) queryRAIDController(ctx context.Context, ctrl RAIDController,
+	devicePath string) (disko.DiskType, disko.DiskIdentity, error) {
+	ls.raidMutex.Lock()
+	defer ls.raidMutex.Unlock()
+
+	// we know this is device is part of a raid, so if we cannot get
+	// disk type we must return an error
+	dType, err := ctrl.GetDiskTypeContext(ctx, devicePath)
+	if err != nil {
+		return dType, disko.DiskIdentity{},
+			fmt.Errorf("%w: failed to get diskType of %q: %w", disko.ErrRAIDController, devicePath, err)
+	}
+
+	// the controller only fills in what udev could not tell.
+	cID, err := ctrl.GetDiskIdentityContext(ctx, devicePath)
+	if err != nil {
+		cID = disko.DiskIdentity{}
+	}
+
+	return dType, cID, nil
+}
+
 func getDiskReadOnly(kname string) (bool, error) {
 	syspath, err := getSysPathForBlockDevicePath(kname)
 	if err != nil {
@@ -129,13 +272,18 @@ func getDiskProperties(d disko.UdevInfo) disko.PropertySet {
 	return props
 }
 
-//nolint:funlen
 func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
+	return ls.ScanDiskContext(context.Background(), devicePath)
+}
+
+//nolint:funlen
+func (ls *linuxSystem) ScanDiskContext(ctx context.Context, devicePath string) (disko.Disk, error) {
 	var err error
 	var blockdev = true
 	var ssize uint = sectorSize512
 	var diskType disko.DiskType
 	var attachType disko.AttachmentType
+	var identity disko.DiskIdentity
 	var ro bool
 
 	name, err := getKnameForBlockDevicePath(devicePath)
@@ -154,24 +302,24 @@ func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
 	udInfo := disko.UdevInfo{}
 
 	if blockdev {
-		udInfo, err = GetUdevInfo(name)
+		udInfo, err = GetUdevInfoContext(ctx, name)
 		if err != nil {
 			return disko.Disk{}, err
 		}
 
 		attachType = getAttachType(udInfo)
+		identity = getDiskIdentity(udInfo)
 
 		for _, ctrl := range ls.raidctrls {
 			if IsSysPathRAID(udInfo.Properties["DEVPATH"], ctrl.DriverSysfsPath()) {
-				// we know this is device is part of a raid, so if we cannot get
-				// disk type we must return an error
-				dType, err := ctrl.GetDiskType(devicePath)
+				dType, cID, err := ls.queryRAIDController(ctx, ctrl, devicePath)
 				if err != nil {
-					return disko.Disk{}, fmt.Errorf("failed to get diskType of %q from RAID controller: %s", devicePath, err)
+					return disko.Disk{}, err
 				}
 
 				attachType = disko.RAID
 				diskType = dType
+				identity = mergeDiskIdentity(identity, cID)
 
 				break
 			}
@@ -196,6 +344,8 @@ func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
 		ro = false
 		if err := unix.Access(devicePath, unix.W_OK); err == unix.EACCES {
 			ro = true
+		} else if err == unix.ENOENT {
+			return disko.Disk{}, fmt.Errorf("%s: %w", devicePath, disko.ErrDiskNotFound)
 		} else if err != nil {
 			return disko.Disk{}, err
 		}
@@ -212,11 +362,16 @@ func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
 		Type:       diskType,
 		Attachment: attachType,
 		Properties: properties,
+		Identity:   identity,
+	}
+
+	if blockdev {
+		setDiskTopology(path.Join("/sys/block", name), &disk)
 	}
 
 	fh, err := os.Open(devicePath)
 	if err != nil {
-		return disk, err
+		return disk, openError(devicePath, err)
 	}
 	defer fh.Close()
 
@@ -226,10 +381,10 @@ func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
 	}
 
 	disk.Size = size
-	parts, tType, ssize, err := findPartitions(fh)
+	parts, tType, ssize, check, err := findPartitionsCheck(fh)
 
 	if err != nil {
-		return disk, err
+		return disk, fmt.Errorf("%s: %w: %w", devicePath, disko.ErrBadPartitionTable, err)
 	}
 
 	disk.Table = tType
@@ -237,8 +392,8 @@ func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
 	if tType == disko.GPT && ssize != disk.SectorSize {
 		if blockdev {
 			return disk, fmt.Errorf(
-				"disk %s has sector size %d and partition table sector size %d",
-				disk.Path, disk.SectorSize, ssize)
+				"disk %s has sector size %d and partition table sector size %d: %w",
+				disk.Path, disk.SectorSize, ssize, disko.ErrSectorSizeMismatch)
 		}
 
 		disk.SectorSize = ssize
@@ -246,63 +401,243 @@ func (ls *linuxSystem) ScanDisk(devicePath string) (disko.Disk, error) {
 
 	disk.Partitions = parts
 
+	if tType == disko.GPT {
+		gptTable, _ := check.table()
+		disk.GPT = gptToDiskoHeader(gptTable.Header)
+		disk.TableProblems = check.problems
+	}
+
+	probeSignatures(fh, &disk)
+
+	if blockdev {
+		setDiskUsage(&disk)
+	}
+
 	return disk, nil
 }
 
 func (ls *linuxSystem) CreatePartition(d disko.Disk, p disko.Partition) error {
-	if err := addPartitionSet(d, disko.PartitionSet{p.Number: p}); err != nil {
-		return err
-	}
+	return ls.CreatePartitionContext(context.Background(), d, p)
+}
 
-	return udevSettle()
+func (ls *linuxSystem) CreatePartitionContext(ctx context.Context, d disko.Disk, p disko.Partition) error {
+	return ls.CreatePartitionsContext(ctx, d, disko.PartitionSet{p.Number: p})
 }
 
 func (ls *linuxSystem) CreatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
-	if err := addPartitionSet(d, pSet); err != nil {
-		return err
-	}
+	return ls.CreatePartitionsContext(context.Background(), d, pSet)
+}
 
-	return udevSettle()
+func (ls *linuxSystem) CreatePartitionsContext(ctx context.Context, d disko.Disk, pSet disko.PartitionSet) error {
+	return ls.opts.observe(ctx, diskEvent("CreatePartitions", d, pSet), diskSnapshot(d),
+		func(ctx context.Context) error {
+			if err := ls.guard(ctx, "CreatePartitions", d, nil); err != nil {
+				return err
+			}
+
+			if err := addPartitionSet(ctx, d, pSet); err != nil {
+				return err
+			}
+
+			return udevSettle(ctx)
+		})
 }
 
 func (ls *linuxSystem) DeletePartition(d disko.Disk, number uint) error {
-	if err := deletePartitions(d, []uint{number}); err != nil {
-		return err
+	return ls.DeletePartitionContext(context.Background(), d, number)
+}
+
+func (ls *linuxSystem) DeletePartitionContext(ctx context.Context, d disko.Disk, number uint) error {
+	request := disko.PartitionSet{number: {Number: number}}
+	if p, ok := d.Partitions[number]; ok {
+		request[number] = p
 	}
 
-	return udevSettle()
+	return ls.opts.observe(ctx, diskEvent("DeletePartition", d, request), diskSnapshot(d),
+		func(ctx context.Context) error {
+			if err := ls.guard(ctx, "DeletePartition", d, []uint{number}); err != nil {
+				return err
+			}
+
+			if err := deletePartitions(ctx, d, []uint{number}); err != nil {
+				return err
+			}
+
+			return udevSettle(ctx)
+		})
 }
 
 func (ls *linuxSystem) UpdatePartition(d disko.Disk, p disko.Partition) error {
-	if err := updatePartitions(d, disko.PartitionSet{p.Number: p}); err != nil {
-		return err
-	}
+	return ls.UpdatePartitionContext(context.Background(), d, p)
+}
 
-	return udevSettle()
+func (ls *linuxSystem) UpdatePartitionContext(ctx context.Context, d disko.Disk, p disko.Partition) error {
+	return ls.UpdatePartitionsContext(ctx, d, disko.PartitionSet{p.Number: p})
 }
 
 func (ls *linuxSystem) UpdatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
-	if err := updatePartitions(d, pSet); err != nil {
-		return err
+	return ls.UpdatePartitionsContext(context.Background(), d, pSet)
+}
+
+func (ls *linuxSystem) UpdatePartitionsContext(ctx context.Context, d disko.Disk, pSet disko.PartitionSet) error {
+	return ls.opts.observe(ctx, diskEvent("UpdatePartitions", d, pSet), diskSnapshot(d),
+		func(ctx context.Context) error {
+			if err := ls.guard(ctx, "UpdatePartitions", d, partNumbers(pSet)); err != nil {
+				return err
+			}
+
+			if err := updatePartitions(ctx, d, pSet); err != nil {
+				return err
+			}
+
+			return udevSettle(ctx)
+		})
+}
+
+func (ls *linuxSystem) SetPartitionAttributes(d disko.Disk, number uint, attrs disko.PartAttrs) error {
+	return ls.SetPartitionAttributesContext(context.Background(), d, number, attrs)
+}
+
+func (ls *linuxSystem) SetPartitionAttributesContext(ctx context.Context, d disko.Disk, number uint,
+	attrs disko.PartAttrs) error {
+	request := disko.PartitionSet{number: {Number: number, Attributes: attrs}}
+
+	return ls.opts.observe(ctx, diskEvent("SetPartitionAttributes", d, request), diskSnapshot(d),
+		func(ctx context.Context) error {
+			if err := ls.guard(ctx, "SetPartitionAttributes", d, []uint{number}); err != nil {
+				return err
+			}
+
+			return setPartitionAttributes(ctx, d, number, attrs)
+		})
+}
+
+func (ls *linuxSystem) ResizePartition(d disko.Disk, number uint, last uint64) error {
+	return ls.ResizePartitionContext(context.Background(), d, number, last)
+}
+
+// ResizePartitionContext may grow a partition that is in use, as the kernel
+// is told of the new size without removing the partition.  Shrinking one
+// is refused unless forced.
+func (ls *linuxSystem) ResizePartitionContext(ctx context.Context, d disko.Disk, number uint, last uint64) error {
+	request := disko.PartitionSet{number: {Number: number, Last: last}}
+	if p, ok := d.Partitions[number]; ok {
+		p.Last = last
+		request[number] = p
 	}
 
-	return udevSettle()
+	return ls.opts.observe(ctx, diskEvent("ResizePartition", d, request), diskSnapshot(d),
+		func(ctx context.Context) error {
+			parts := []uint{}
+			if p, ok := d.Partitions[number]; !ok || last < p.Last {
+				parts = []uint{number}
+			}
+
+			if err := ls.guard(ctx, "ResizePartition", d, parts); err != nil {
+				return err
+			}
+
+			return resizePartition(ctx, d, number, last)
+		})
+}
+
+func (ls *linuxSystem) SetDiskGUID(d disko.Disk, id disko.GUID) error {
+	return ls.SetDiskGUIDContext(context.Background(), d, id)
+}
+
+func (ls *linuxSystem) SetDiskGUIDContext(ctx context.Context, d disko.Disk, id disko.GUID) error {
+	return ls.opts.observe(ctx, diskEvent("SetDiskGUID", d, nil), diskSnapshot(d),
+		func(ctx context.Context) error {
+			// the partitions are left alone, so they may be in use.
+			if err := ls.guard(ctx, "SetDiskGUID", d, []uint{}); err != nil {
+				return err
+			}
+
+			return setDiskGUID(ctx, d, id)
+		})
+}
+
+func (ls *linuxSystem) RelocateBackupGPT(d disko.Disk) error {
+	return ls.RelocateBackupGPTContext(context.Background(), d)
+}
+
+func (ls *linuxSystem) RelocateBackupGPTContext(ctx context.Context, d disko.Disk) error {
+	return ls.opts.observe(ctx, diskEvent("RelocateBackupGPT", d, nil), diskSnapshot(d),
+		func(ctx context.Context) error {
+			// the partitions are left alone, so they may be in use.
+			if err := ls.guard(ctx, "RelocateBackupGPT", d, []uint{}); err != nil {
+				return err
+			}
+
+			return relocateBackupGPT(ctx, d)
+		})
+}
+
+func (ls *linuxSystem) RepairPartitionTable(d disko.Disk) error {
+	return ls.RepairPartitionTableContext(context.Background(), d)
+}
+
+func (ls *linuxSystem) RepairPartitionTableContext(ctx context.Context, d disko.Disk) error {
+	return ls.opts.observe(ctx, diskEvent("RepairPartitionTable", d, nil), diskSnapshot(d),
+		func(ctx context.Context) error {
+			// the partitions are left alone, so they may be in use.
+			if err := ls.guard(ctx, "RepairPartitionTable", d, []uint{}); err != nil {
+				return err
+			}
+
+			return repairPartitionTable(ctx, d)
+		})
+}
+
+func (ls *linuxSystem) RestorePartitionTable(d disko.Disk, b disko.TableBackup) error {
+	return ls.RestorePartitionTableContext(context.Background(), d, b)
+}
+
+func (ls *linuxSystem) RestorePartitionTableContext(ctx context.Context, d disko.Disk, b disko.TableBackup) error {
+	return ls.opts.observe(ctx, diskEvent("RestorePartitionTable", d, b.Partitions), diskSnapshot(d),
+		func(ctx context.Context) error {
+			if err := b.Check(d); err != nil {
+				return err
+			}
+
+			if err := ls.guard(ctx, "RestorePartitionTable", d, nil); err != nil {
+				return err
+			}
+
+			return restorePartitionTable(ctx, d, b)
+		})
 }
 
 func (ls *linuxSystem) Wipe(d disko.Disk) error {
-	if err := wipeDisk(d); err != nil {
-		return err
-	}
+	return ls.WipeContext(context.Background(), d)
+}
+
+func (ls *linuxSystem) WipeContext(ctx context.Context, d disko.Disk) error {
+	return ls.opts.observe(ctx, diskEvent("Wipe", d, nil), diskSnapshot(d),
+		func(ctx context.Context) error {
+			if err := ls.guard(ctx, "Wipe", d, nil); err != nil {
+				return err
+			}
 
-	return udevSettle()
+			if err := wipeDisk(ctx, d); err != nil {
+				return err
+			}
+
+			return udevSettle(ctx)
+		})
 }
 
 func (ls *linuxSystem) GetDiskType(path string, udInfo disko.UdevInfo) (disko.DiskType, error) {
+	return ls.GetDiskTypeContext(context.Background(), path, udInfo)
+}
+
+func (ls *linuxSystem) GetDiskTypeContext(ctx context.Context, path string,
+	udInfo disko.UdevInfo) (disko.DiskType, error) {
 	for _, ctrl := range ls.raidctrls {
 		if IsSysPathRAID(udInfo.Properties["DEVPATH"], ctrl.DriverSysfsPath()) {
-			dType, err := ctrl.GetDiskType(path)
+			dType, err := ctrl.GetDiskTypeContext(ctx, path)
 			if err != nil {
-				return disko.HDD, fmt.Errorf("failed to get diskType of %q from RAID controller: %s", path, err)
+				return disko.HDD, fmt.Errorf("failed to get diskType of %q from RAID controller: %w", path, err)
 			}
 
 			return dType, nil
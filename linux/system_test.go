@@ -235,3 +235,190 @@ func TestCreatePartitions(t *testing.T) {
 	ast.Equal(disko.FILESYSTEM, scannedDisk.Attachment)
 	ast.Equal(disko.TYPEFILE, scannedDisk.Type)
 }
+
+func TestScanDisksParallel(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	paths := []string{}
+
+	for i := 0; i < 12; i++ {
+		fpath := path.Join(tmpd, fmt.Sprintf("disk%02d", i))
+		if err := os.WriteFile(fpath, []byte{}, 0600); err != nil {
+			t.Fatalf("Failed to write to a temp file: %s", err)
+		}
+
+		if err := os.Truncate(fpath, int64(i+1)*int64(disko.Mebibyte)); err != nil {
+			t.Fatalf("Failed create empty file: %s", err)
+		}
+
+		paths = append(paths, fpath)
+	}
+
+	serial, err := System(WithScanParallelism(1)).ScanDisks(disko.AnyDisk, paths...)
+	if !ast.NoError(err) {
+		return
+	}
+
+	parallel, err := System(WithScanParallelism(5)).ScanDisks(disko.AnyDisk, paths...)
+	if !ast.NoError(err) {
+		return
+	}
+
+	ast.Len(parallel, len(paths))
+	ast.Equal(serial, parallel)
+
+	// the error is that of the first path that fails, and the disks before
+	// it are returned.
+	bad := append([]string{}, paths[:3]...)
+	bad = append(bad, path.Join(tmpd, "missing1"), paths[3], path.Join(tmpd, "missing2"))
+
+	for _, n := range []int{1, 2, 6} {
+		disks, err := System(WithScanParallelism(n)).ScanDisks(disko.AnyDisk, bad...)
+		if ast.ErrorIs(err, disko.ErrDiskNotFound) {
+			ast.Contains(err.Error(), "missing1")
+		}
+
+		ast.Len(disks, 3)
+	}
+}
+
+func TestScanWorkers(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Equal(defaultScanParallelism, newOptions(nil).scanWorkers(100))
+	ast.Equal(3, newOptions(nil).scanWorkers(3))
+	ast.Equal(1, newOptions([]Option{WithScanParallelism(1)}).scanWorkers(100))
+	ast.Equal(20, newOptions([]Option{WithScanParallelism(20)}).scanWorkers(100))
+	ast.Equal(defaultScanParallelism, newOptions([]Option{WithScanParallelism(-1)}).scanWorkers(100))
+}
+
+func TestScanDisksTolerant(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	good := path.Join(tmpd, "good")
+	if err := os.WriteFile(good, []byte{}, 0600); err != nil {
+		t.Fatalf("Failed to write to a temp file: %s", err)
+	}
+
+	if err := os.Truncate(good, int64(10*disko.Mebibyte)); err != nil {
+		t.Fatalf("Failed create empty file: %s", err)
+	}
+
+	badDir := path.Join(tmpd, "bad")
+	if err := os.Mkdir(badDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %s", err)
+	}
+
+	bad, err := genTempGptDisk(badDir, 10*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	// scribble over the primary and backup GPT headers so that the
+	// signature is there but the crc is wrong.
+	fp, err := os.OpenFile(bad.Path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %s", bad.Path, err)
+	}
+
+	for _, off := range []int64{sectorSize512 + 0x20, int64(bad.Size) - sectorSize512 + 0x20} {
+		if _, err := fp.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, off); err != nil {
+			t.Fatalf("Failed to corrupt %s: %s", bad.Path, err)
+		}
+	}
+
+	fp.Close()
+
+	missing := path.Join(tmpd, "missing")
+	paths := []string{missing, good, bad.Path}
+
+	_, err = System().ScanDisks(disko.AnyDisk, paths...)
+	ast.ErrorIs(err, disko.ErrDiskNotFound)
+
+	disks, err := System(WithTolerantScan()).ScanDisks(disko.AnyDisk, paths...)
+	ast.Len(disks, 1)
+	ast.Contains(disks, "good")
+
+	var scanErrs disko.ScanErrors
+	if ast.ErrorAs(err, &scanErrs) {
+		ast.Len(scanErrs, 2)
+		ast.ErrorIs(scanErrs[missing], disko.ErrDiskNotFound)
+		ast.ErrorIs(scanErrs[bad.Path], disko.ErrBadPartitionTable)
+	}
+}
+
+func TestScanDiskSignatures(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	disk, err := genTempGptDisk(tmpd, 50*disko.Mebibyte)
+	if err != nil {
+		t.Fatalf("Creation of temp disk failed: %s", err)
+	}
+
+	// An ext2 superblock magic and label in partition 1.
+	sb := make([]byte, 256)
+	sb[0x38], sb[0x39] = 0x53, 0xef
+	copy(sb[0x78:], "scratch")
+
+	if err := writeAt(disk.Path, sb, int64(disk.Partitions[1].Start)+1024); err != nil {
+		t.Fatalf("Failed to write superblock: %s", err)
+	}
+
+	// swap on a disk with no partition table.
+	rawPath := path.Join(tmpd, "raw")
+	if err := os.WriteFile(rawPath, make([]byte, disko.Mebibyte), 0600); err != nil {
+		t.Fatalf("Failed to write raw disk: %s", err)
+	}
+
+	if err := writeAt(rawPath, []byte("SWAPSPACE2"), 4096-10); err != nil {
+		t.Fatalf("Failed to write swap magic: %s", err)
+	}
+
+	sys := System()
+
+	found, err := sys.ScanDisk(disk.Path)
+	if ast.NoError(err) {
+		ast.Equal(disko.Signature{Type: "ext2", Label: "scratch", Version: "0.0"}, found.Partitions[1].Signature)
+		ast.True(found.Signature.IsEmpty())
+	}
+
+	found, err = sys.ScanDisk(rawPath)
+	if ast.NoError(err) {
+		ast.Equal(disko.TableNone, found.Table)
+		ast.Equal(disko.Signature{Type: "swap", Version: "0"}, found.Signature)
+	}
+}
+
+func writeAt(fpath string, data []byte, off int64) error {
+	fp, err := os.OpenFile(fpath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	defer fp.Close()
+
+	_, err = fp.WriteAt(data, off)
+
+	return err
+}
@@ -0,0 +1,218 @@
+package linux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// UEvent is a kernel or udev uevent.
+type UEvent struct {
+	// Action is add, remove, change, move, bind or unbind.
+	Action string
+
+	// DevPath is the sysfs path of the device without /sys.
+	DevPath string
+
+	// Subsystem is the subsystem of the device, "block" for disks.
+	Subsystem string
+
+	// DevType is "disk" or "partition" for block devices.
+	DevType string
+
+	// DevName is the device node, relative to /dev in kernel events and
+	// absolute in udev events.
+	DevName string
+
+	// Env has all the KEY=VALUE pairs of the event.
+	Env map[string]string
+}
+
+// UEventSource delivers uevents.  Receive blocks until there is an event.
+// Once the source is closed Receive returns io.EOF, other errors (such as
+// events lost to a full socket buffer) are not fatal.
+type UEventSource interface {
+	Receive() (UEvent, error)
+	Close() error
+}
+
+// UEventGroup is the netlink multicast group to listen to.
+type UEventGroup uint32
+
+const (
+	// KernelUEvents are sent by the kernel as soon as a device changes.
+	KernelUEvents UEventGroup = 1
+
+	// UdevUEvents are sent by udev after its rules have run, so the
+	// device node, symlinks and udev properties are in place.
+	UdevUEvents UEventGroup = 2
+)
+
+const (
+	udevMonitorMagic = 0xfeedcafe
+	ueventBufSize    = 64 * 1024
+	ueventSockBuf    = 4 * 1024 * 1024
+)
+
+//nolint:gochecknoglobals
+var udevPrefix = []byte("libudev\x00")
+
+type netlinkSource struct {
+	file  *os.File
+	group UEventGroup
+	mutex sync.Mutex
+}
+
+// NewUEventSource returns a UEventSource that listens to group on a
+// NETLINK_KOBJECT_UEVENT socket.  Events that were not sent by the kernel
+// or by root are dropped.
+func NewUEventSource(group UEventGroup) (UEventSource, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK,
+		unix.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uevent socket: %w", err)
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: uint32(group)}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind uevent socket: %w", err)
+	}
+
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_PASSCRED, 1); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to set SO_PASSCRED on uevent socket: %w", err)
+	}
+
+	// a bigger buffer means fewer lost events in a burst.  Only root may
+	// force it, so failure is fine.
+	_ = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUFFORCE, ueventSockBuf)
+
+	return &netlinkSource{file: os.NewFile(uintptr(fd), "uevent"), group: group}, nil
+}
+
+func (s *netlinkSource) Receive() (UEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rc, err := s.file.SyscallConn()
+	if err != nil {
+		return UEvent{}, io.EOF
+	}
+
+	buf := make([]byte, ueventBufSize)
+	oob := make([]byte, unix.CmsgSpace(unix.SizeofUcred))
+
+	for {
+		var n, oobn int
+		var from unix.Sockaddr
+		var rerr error
+
+		err := rc.Read(func(fd uintptr) bool {
+			n, oobn, _, from, rerr = unix.Recvmsg(int(fd), buf, oob, 0)
+			return rerr != unix.EAGAIN
+		})
+
+		switch {
+		case errors.Is(err, os.ErrClosed):
+			return UEvent{}, io.EOF
+		case err != nil:
+			return UEvent{}, err
+		case rerr != nil:
+			return UEvent{}, fmt.Errorf("failed to read uevent: %w", rerr)
+		}
+
+		if !s.trusted(from, oob[:oobn]) {
+			continue
+		}
+
+		return ParseUEvent(buf[:n])
+	}
+}
+
+// trusted returns true if a message came from the kernel (kernel group) or
+// from a root process (udev group).
+func (s *netlinkSource) trusted(from unix.Sockaddr, oob []byte) bool {
+	nl, ok := from.(*unix.SockaddrNetlink)
+	if !ok {
+		return false
+	}
+
+	if s.group == KernelUEvents {
+		return nl.Pid == 0
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil || len(msgs) == 0 {
+		return false
+	}
+
+	cred, err := unix.ParseUnixCredentials(&msgs[0])
+
+	return err == nil && cred.Uid == 0
+}
+
+func (s *netlinkSource) Close() error {
+	return s.file.Close()
+}
+
+// ParseUEvent parses a uevent message as sent by the kernel
+// ("action@devpath\0KEY=VALUE\0...") or by udev (a libudev header followed
+// by KEY=VALUE\0 pairs).
+func ParseUEvent(msg []byte) (UEvent, error) {
+	var props []byte
+
+	if bytes.HasPrefix(msg, udevPrefix) {
+		const hdrLen = 24
+
+		if len(msg) < hdrLen {
+			return UEvent{}, fmt.Errorf("short udev uevent of %d bytes", len(msg))
+		}
+
+		if magic := binary.BigEndian.Uint32(msg[8:12]); magic != udevMonitorMagic {
+			return UEvent{}, fmt.Errorf("bad udev uevent magic %#x", magic)
+		}
+
+		off := binary.NativeEndian.Uint32(msg[16:20])
+		length := binary.NativeEndian.Uint32(msg[20:24])
+
+		if uint64(off)+uint64(length) > uint64(len(msg)) {
+			return UEvent{}, fmt.Errorf("udev uevent properties at %d+%d past end %d", off, length, len(msg))
+		}
+
+		props = msg[off : off+length]
+	} else {
+		end := bytes.IndexByte(msg, 0)
+		if end < 0 || !bytes.Contains(msg[:end], []byte("@")) {
+			return UEvent{}, fmt.Errorf("bad kernel uevent %q", msg)
+		}
+
+		props = msg[end+1:]
+	}
+
+	ev := UEvent{Env: map[string]string{}}
+
+	for _, kv := range bytes.Split(props, []byte{0}) {
+		if k, v, ok := strings.Cut(string(kv), "="); ok {
+			ev.Env[k] = v
+		}
+	}
+
+	ev.Action = ev.Env["ACTION"]
+	ev.DevPath = ev.Env["DEVPATH"]
+	ev.Subsystem = ev.Env["SUBSYSTEM"]
+	ev.DevType = ev.Env["DEVTYPE"]
+	ev.DevName = ev.Env["DEVNAME"]
+
+	if ev.Action == "" || ev.DevPath == "" {
+		return UEvent{}, fmt.Errorf("uevent has no ACTION or DEVPATH")
+	}
+
+	return ev, nil
+}
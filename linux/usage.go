@@ -0,0 +1,243 @@
+package linux
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"machinerun.io/disko"
+)
+
+// maxHolderDepth bounds how deep holders of holders are followed.
+const maxHolderDepth = 8
+
+// usageScanner finds what uses block devices.  It reads the mounts and
+// swaps once, and sysfs for each device.
+type usageScanner struct {
+	// sysClassBlock is the /sys/class/block directory.
+	sysClassBlock string
+
+	// mounts are the mounts by device number ("8:1").
+	mounts map[string][]disko.Usage
+
+	// swaps are the active swap devices by kernel name.
+	swaps map[string]string
+}
+
+// newUsageScanner reads the mounts and swaps from procDir and uses sysDir
+// for holders.  Missing files mean nothing of that kind is in use.
+func newUsageScanner(procDir, sysDir string) usageScanner {
+	return usageScanner{
+		sysClassBlock: path.Join(sysDir, "class", "block"),
+		mounts:        readMountInfo(path.Join(procDir, "self", "mountinfo")),
+		swaps:         readSwaps(path.Join(procDir, "swaps")),
+	}
+}
+
+// setDiskUsage fills in what uses d and its partitions.
+func setDiskUsage(d *disko.Disk) {
+	u := newUsageScanner("/proc", "/sys")
+
+	d.Usage = u.usage(d.Name)
+	d.PartitionUsage = nil
+
+	for n := range d.Partitions {
+		if usage := u.usage(GetPartitionKname(d.Name, n)); len(usage) != 0 {
+			if d.PartitionUsage == nil {
+				d.PartitionUsage = map[uint][]disko.Usage{}
+			}
+
+			d.PartitionUsage[n] = usage
+		}
+	}
+
+	if !d.InUse() && isExclusivelyOpen(d.Path) {
+		d.Usage = []disko.Usage{{Kind: disko.UsageOpen}}
+	}
+}
+
+// usage returns what uses the block device kname.
+func (u usageScanner) usage(kname string) []disko.Usage {
+	return u.usageVia(kname, "", 0)
+}
+
+func (u usageScanner) usageVia(kname, via string, depth int) []disko.Usage {
+	var usage []disko.Usage
+
+	if devNum, err := os.ReadFile(path.Join(u.sysClassBlock, kname, "dev")); err == nil {
+		for _, m := range u.mounts[strings.TrimSpace(string(devNum))] {
+			m.Via = via
+			usage = append(usage, m)
+		}
+	}
+
+	if swap, ok := u.swaps[kname]; ok {
+		usage = append(usage, disko.Usage{Kind: disko.UsageSwap, Target: swap, Via: via})
+	}
+
+	holders, err := os.ReadDir(path.Join(u.sysClassBlock, kname, "holders"))
+	if err != nil || depth >= maxHolderDepth {
+		return usage
+	}
+
+	for _, h := range holders {
+		target, detail := u.holderInfo(h.Name())
+		usage = append(usage, disko.Usage{Kind: disko.UsageHolder, Target: target, Detail: detail, Via: via})
+
+		hVia := via
+		if hVia == "" {
+			hVia = target
+		}
+
+		usage = append(usage, u.usageVia(h.Name(), hVia, depth+1)...)
+	}
+
+	return usage
+}
+
+// holderInfo returns the device path and kind of the holder kname.
+func (u usageScanner) holderInfo(kname string) (string, string) {
+	dmDir := path.Join(u.sysClassBlock, kname, "dm")
+
+	if _, err := os.Stat(dmDir); err != nil {
+		if strings.HasPrefix(kname, "md") {
+			return getPathForKname(kname), "md"
+		}
+
+		return getPathForKname(kname), ""
+	}
+
+	target := getPathForKname(kname)
+	if name, err := os.ReadFile(path.Join(dmDir, "name")); err == nil {
+		target = path.Join("/dev/mapper", strings.TrimSpace(string(name)))
+	}
+
+	uuid, _ := os.ReadFile(path.Join(dmDir, "uuid"))
+
+	kinds := []struct{ prefix, kind string }{
+		{"LVM-", "lvm"},
+		{"CRYPT-", "crypt"},
+		{"mpath-", "multipath"},
+	}
+
+	for _, k := range kinds {
+		if strings.HasPrefix(string(uuid), k.prefix) {
+			return target, k.kind
+		}
+	}
+
+	return target, "dm"
+}
+
+// readMountInfo returns the mounts in a mountinfo file by device number.
+// A line is:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+//
+// with the device number third, the mount point fifth and the filesystem
+// type after the "-".
+func readMountInfo(mountInfo string) map[string][]disko.Usage {
+	const minFields = 10
+
+	mounts := map[string][]disko.Usage{}
+
+	fp, err := os.Open(mountInfo)
+	if err != nil {
+		return mounts
+	}
+	defer fp.Close()
+
+	scanner := bufio.NewScanner(fp)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < minFields {
+			continue
+		}
+
+		fsType := ""
+
+		for i := 6; i < len(fields)-1; i++ {
+			if fields[i] == "-" {
+				fsType = fields[i+1]
+				break
+			}
+		}
+
+		mounts[fields[2]] = append(mounts[fields[2]],
+			disko.Usage{Kind: disko.UsageMount, Target: unescapeMount(fields[4]), Detail: fsType})
+	}
+
+	return mounts
+}
+
+// unescapeMount decodes the octal escapes (\040 for space) of a mount point.
+func unescapeMount(s string) string {
+	const escLen = 4
+
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+escLen <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+escLen], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += escLen - 1
+
+				continue
+			}
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// readSwaps returns the active swap partitions in a /proc/swaps file by
+// kernel name.  Swap files are not on a device of their own and are left
+// out.
+func readSwaps(swaps string) map[string]string {
+	found := map[string]string{}
+
+	content, err := os.ReadFile(swaps)
+	if err != nil {
+		return found
+	}
+
+	for _, line := range strings.Split(string(content), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != "partition" {
+			continue
+		}
+
+		dev := unescapeMount(fields[0])
+		if resolved, err := filepath.EvalSymlinks(dev); err == nil {
+			found[path.Base(resolved)] = dev
+		} else {
+			found[path.Base(dev)] = dev
+		}
+	}
+
+	return found
+}
+
+// isExclusivelyOpen returns true if something holds devPath open
+// exclusively (O_EXCL), as mkfs, a running VM or a kernel user would.
+func isExclusivelyOpen(devPath string) bool {
+	fd, err := unix.Open(devPath, unix.O_RDONLY|unix.O_EXCL|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return errors.Is(err, unix.EBUSY)
+	}
+
+	unix.Close(fd)
+
+	return false
+}
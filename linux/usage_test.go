@@ -0,0 +1,94 @@
+package linux
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		fpath := path.Join(root, name)
+
+		if err := os.MkdirAll(path.Dir(fpath), 0755); err != nil {
+			t.Fatalf("Failed to create dir for %s: %s", fpath, err)
+		}
+
+		if err := os.WriteFile(fpath, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %s", fpath, err)
+		}
+	}
+}
+
+func TestUsageScanner(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	// sda1 is /boot, sda2 is swap, sda3 is a LUKS volume holding an LVM PV
+	// with the root filesystem on it.  sdb is not used.
+	writeTree(t, tmpd, map[string]string{
+		"proc/self/mountinfo": "" +
+			"22 1 8:1 / /boot rw,relatime shared:1 - ext4 /dev/sda1 rw\n" +
+			"23 1 253:1 / / rw,relatime shared:2 - xfs /dev/mapper/vg0-root rw\n" +
+			"24 23 253:1 / /my\\040data rw,relatime shared:3 - xfs /dev/mapper/vg0-root rw\n" +
+			"25 1 0:21 / /proc rw shared:4 - proc proc rw\n",
+		"proc/swaps": "" +
+			"Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n" +
+			"/dev/sda2                               partition\t8388604\t\t0\t\t-2\n" +
+			"/swapfile                               file\t\t1048572\t\t0\t\t-3\n",
+		"sys/class/block/sda/dev":           "8:0\n",
+		"sys/class/block/sda1/dev":          "8:1\n",
+		"sys/class/block/sda2/dev":          "8:2\n",
+		"sys/class/block/sda3/dev":          "8:3\n",
+		"sys/class/block/sda3/holders/dm-0": "",
+		"sys/class/block/dm-0/dev":          "253:0\n",
+		"sys/class/block/dm-0/dm/name":      "sda3_crypt\n",
+		"sys/class/block/dm-0/dm/uuid":      "CRYPT-LUKS2-0123456789abcdef-sda3_crypt\n",
+		"sys/class/block/dm-0/holders/dm-1": "",
+		"sys/class/block/dm-1/dev":          "253:1\n",
+		"sys/class/block/dm-1/dm/name":      "vg0-root\n",
+		"sys/class/block/dm-1/dm/uuid":      "LVM-abcdefABCDEF\n",
+		"sys/class/block/sdb/dev":           "8:16\n",
+		"sys/class/block/md0/dev":           "9:0\n",
+		"sys/class/block/sdc/holders/md0":   "",
+		"sys/class/block/sdc/dev":           "8:32\n",
+	})
+
+	u := newUsageScanner(path.Join(tmpd, "proc"), path.Join(tmpd, "sys"))
+
+	ast.Nil(u.usage("sda"))
+	ast.Nil(u.usage("sdb"))
+	ast.Equal([]disko.Usage{{Kind: disko.UsageMount, Target: "/boot", Detail: "ext4"}}, u.usage("sda1"))
+	ast.Equal([]disko.Usage{{Kind: disko.UsageSwap, Target: "/dev/sda2"}}, u.usage("sda2"))
+	ast.Equal([]disko.Usage{
+		{Kind: disko.UsageHolder, Target: "/dev/mapper/sda3_crypt", Detail: "crypt"},
+		{Kind: disko.UsageHolder, Target: "/dev/mapper/vg0-root", Detail: "lvm", Via: "/dev/mapper/sda3_crypt"},
+		{Kind: disko.UsageMount, Target: "/", Detail: "xfs", Via: "/dev/mapper/sda3_crypt"},
+		{Kind: disko.UsageMount, Target: "/my data", Detail: "xfs", Via: "/dev/mapper/sda3_crypt"},
+	}, u.usage("sda3"))
+	ast.Equal([]disko.Usage{{Kind: disko.UsageHolder, Target: "/dev/md0", Detail: "md"}}, u.usage("sdc"))
+}
+
+func TestUsageScannerMissing(t *testing.T) {
+	u := newUsageScanner("/nonexistent/proc", "/nonexistent/sys")
+
+	assert.Nil(t, u.usage("sda"))
+}
+
+func TestUnescapeMount(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Equal("/mnt/a b", unescapeMount(`/mnt/a\040b`))
+	ast.Equal("/mnt/a\tb\\", unescapeMount(`/mnt/a\011b\134`))
+	ast.Equal(`/mnt/x\9`, unescapeMount(`/mnt/x\9`))
+	ast.Equal("/plain", unescapeMount("/plain"))
+}
@@ -2,6 +2,7 @@ package linux
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"machinerun.io/disko"
@@ -19,14 +21,22 @@ import (
 
 // GetUdevInfo return a UdevInfo for the device with kernel name kname.
 func GetUdevInfo(kname string) (disko.UdevInfo, error) {
-	out, stderr, rc := runCommandWithOutputErrorRc(
-		"udevadm", "info", "--query=all", "--export", "--name="+kname)
+	return GetUdevInfoContext(context.Background(), kname)
+}
+
+// GetUdevInfoContext is GetUdevInfo with a context.
+func GetUdevInfoContext(ctx context.Context, kname string) (disko.UdevInfo, error) {
+	cmd := []string{"udevadm", "info", "--query=all", "--export", "--name=" + kname}
+	out, stderr, rc := runCommandWithOutputErrorRc(ctx, cmd...)
 
 	info := disko.UdevInfo{Name: kname}
 
 	if rc != 0 {
-		return info,
-			fmt.Errorf("error querying kname '%s' [%d]: %s", kname, rc, stderr)
+		if err := contextError(ctx, cmd); err != nil {
+			return info, err
+		}
+
+		return info, fmt.Errorf("error querying kname '%s': %w", kname, cmdError(cmd, out, stderr, rc))
 	}
 
 	return info, parseUdevInfo(out, &info)
@@ -137,27 +147,29 @@ func cmdError(args []string, out []byte, err []byte, rc int) error {
 		return nil
 	}
 
-	return errors.New(cmdString(args, out, err, rc))
+	return &disko.CommandError{Args: args, Stdout: out, Stderr: err, RC: rc}
 }
 
-func cmdString(args []string, out []byte, err []byte, rc int) string {
-	tlen := len(err)
-	if tlen == 0 || err[tlen-1] != '\n' {
-		err = append(err, '\n')
+// contextError returns a non-nil error if ctx is done.  A command that was
+// killed because its context ended should report that rather than its
+// exit code.
+func contextError(ctx context.Context, args []string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("command %v interrupted: %w", args, err)
 	}
 
-	tlen = len(out)
-	if tlen == 0 || out[tlen-1] != '\n' {
-		out = append(out, '\n')
-	}
-
-	return fmt.Sprintf(
-		"command returned %d:\n cmd: %v\n out: %s err: %s",
-		rc, args, out, err)
+	return nil
 }
 
-func runCommandWithOutputErrorRc(args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command(args[0], args[1:]...) //nolint:gosec
+// cmdWaitDelay is how long to wait for the output of a command killed by
+// its context. Without it, a child that inherited stdout keeps Run waiting.
+const cmdWaitDelay = time.Second
+
+func runCommandWithOutputErrorRc(ctx context.Context, args ...string) ([]byte, []byte, int) {
+	recordCommand(ctx, args)
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.WaitDelay = cmdWaitDelay
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -166,13 +178,22 @@ func runCommandWithOutputErrorRc(args ...string) ([]byte, []byte, int) {
 	return stdout.Bytes(), stderr.Bytes(), getCommandErrorRC(err)
 }
 
-func runCommand(args ...string) error {
-	out, err, rc := runCommandWithOutputErrorRc(args...)
+func runCommand(ctx context.Context, args ...string) error {
+	out, err, rc := runCommandWithOutputErrorRc(ctx, args...)
+	if rc != 0 {
+		if err := contextError(ctx, args); err != nil {
+			return err
+		}
+	}
+
 	return cmdError(args, out, err, rc)
 }
 
-func runCommandWithOutputErrorRcStdin(input string, args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command(args[0], args[1:]...) //nolint:gosec
+func runCommandWithOutputErrorRcStdin(ctx context.Context, input string, args ...string) ([]byte, []byte, int) {
+	recordCommand(ctx, args)
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) //nolint:gosec
+	cmd.WaitDelay = cmdWaitDelay
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -192,22 +213,28 @@ func runCommandWithOutputErrorRcStdin(input string, args ...string) ([]byte, []b
 	return stdout.Bytes(), stderr.Bytes(), getCommandErrorRC(err)
 }
 
-func runCommandStdin(input string, args ...string) error {
-	out, err, rc := runCommandWithOutputErrorRcStdin(input, args...)
+func runCommandStdin(ctx context.Context, input string, args ...string) error {
+	out, err, rc := runCommandWithOutputErrorRcStdin(ctx, input, args...)
+	if rc != 0 {
+		if err := contextError(ctx, args); err != nil {
+			return err
+		}
+	}
+
 	return cmdError(args, out, err, rc)
 }
 
-func udevSettle() error {
-	return runCommand("udevadm", "settle")
+func udevSettle(ctx context.Context) error {
+	return runCommand(ctx, "udevadm", "settle")
 }
 
-func runCommandSettled(args ...string) error {
-	err := runCommand(args...)
+func runCommandSettled(ctx context.Context, args ...string) error {
+	err := runCommand(ctx, args...)
 	if err != nil {
 		return err
 	}
 
-	return udevSettle()
+	return udevSettle(ctx)
 }
 
 func pathExists(d string) bool {
@@ -243,6 +270,31 @@ func getBlockSize(dev string) (uint64, error) {
 	return uint64(v), nil
 }
 
+// setDiskTopology reads the IO topology of a block device from its sysfs
+// directory (/sys/block/<kname>) into d.  Values that are missing or
+// cannot be parsed are left as 0 (unknown).
+func setDiskTopology(sysBlockPath string, d *disko.Disk) {
+	readUint := func(name string) uint {
+		content, err := os.ReadFile(path.Join(sysBlockPath, name))
+		if err != nil {
+			return 0
+		}
+
+		// alignment_offset is -1 when the device cannot be aligned.
+		v, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+		if err != nil || v < 0 {
+			return 0
+		}
+
+		return uint(v)
+	}
+
+	d.PhysicalBlockSize = readUint("queue/physical_block_size")
+	d.MinimumIOSize = readUint("queue/minimum_io_size")
+	d.OptimalIOSize = readUint("queue/optimal_io_size")
+	d.AlignmentOffset = readUint("alignment_offset")
+}
+
 func getFileSize(file *os.File) (uint64, error) {
 	var err error
 	var cur, pos int64
@@ -1,8 +1,10 @@
 package linux
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"machinerun.io/disko"
@@ -102,7 +104,7 @@ E: USEC_INITIALIZED=1926114
 
 func TestRunCommandWithOutputErrorRc(t *testing.T) {
 	assert := assert.New(t)
-	out, err, rc := runCommandWithOutputErrorRc(
+	out, err, rc := runCommandWithOutputErrorRc(context.Background(),
 		"sh", "-c", "echo -n STDOUT; echo STDERR 1>&2; exit 99")
 	assert.Equal(out, []byte("STDOUT"))
 	assert.Equal(err, []byte("STDERR\n"))
@@ -111,7 +113,7 @@ func TestRunCommandWithOutputErrorRc(t *testing.T) {
 
 func TestRunCommandWithOutputErrorRcStdin(t *testing.T) {
 	assert := assert.New(t)
-	out, err, rc := runCommandWithOutputErrorRcStdin(
+	out, err, rc := runCommandWithOutputErrorRcStdin(context.Background(),
 		"line1\nline2\n0\n",
 		"sh", "-c",
 		`read o; echo "$o"; read o; echo "$o" 1>&2; read rc; exit $rc`)
@@ -122,14 +124,35 @@ func TestRunCommandWithOutputErrorRcStdin(t *testing.T) {
 
 func TestRunCommandWithStdin(t *testing.T) {
 	assert := assert.New(t)
-	assert.Nil(runCommandStdin("the-stdin", "sh", "-c", "exit 0"))
-	assert.NotNil(runCommandStdin("", "sh", "-c", "exit 1"))
+	assert.Nil(runCommandStdin(context.Background(), "the-stdin", "sh", "-c", "exit 0"))
+	assert.NotNil(runCommandStdin(context.Background(), "", "sh", "-c", "exit 1"))
 }
 
 func TestRunCommand(t *testing.T) {
 	assert := assert.New(t)
-	assert.Nil(runCommand("sh", "-c", "exit 0"))
-	assert.NotNil(runCommand("sh", "-c", "exit 1"))
+	assert.Nil(runCommand(context.Background(), "sh", "-c", "exit 0"))
+	assert.NotNil(runCommand(context.Background(), "sh", "-c", "exit 1"))
+}
+
+func TestRunCommandContext(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := runCommand(ctx, "sh", "-c", "sleep 10")
+
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Less(time.Since(start), 5*time.Second)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(runCommandStdin(ctx, "", "sh", "-c", "exit 0"), context.Canceled)
+
+	_, err = GetUdevInfoContext(ctx, "sda")
+	assert.ErrorIs(err, context.Canceled)
 }
 
 func TestCeilingUp(t *testing.T) {
@@ -211,3 +234,31 @@ func TestVgLv(t *testing.T) {
 		}
 	}
 }
+
+func TestSetDiskTopology(t *testing.T) {
+	ast := assert.New(t)
+	dir := t.TempDir()
+
+	ast.Nil(os.Mkdir(dir+"/queue", 0755))
+
+	for name, val := range map[string]string{
+		"queue/physical_block_size": "4096\n",
+		"queue/minimum_io_size":     "65536\n",
+		"queue/optimal_io_size":     "196608\n",
+		"alignment_offset":          "-1\n",
+	} {
+		ast.Nil(os.WriteFile(dir+"/"+name, []byte(val), 0600))
+	}
+
+	d := disko.Disk{}
+	setDiskTopology(dir, &d)
+
+	ast.Equal(uint(4096), d.PhysicalBlockSize)
+	ast.Equal(uint(65536), d.MinimumIOSize)
+	ast.Equal(uint(196608), d.OptimalIOSize)
+	ast.Equal(uint(0), d.AlignmentOffset)
+
+	d = disko.Disk{}
+	setDiskTopology(dir+"/missing", &d)
+	ast.Equal(disko.Disk{}, d)
+}
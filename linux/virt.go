@@ -1,6 +1,9 @@
 package linux
 
-import "log"
+import (
+	"context"
+	"log"
+)
 
 type virtType int
 
@@ -55,7 +58,7 @@ type systemdDetector struct {
 }
 
 func (d *systemdDetector) detectVirt() ([]byte, []byte, int) {
-	return runCommandWithOutputErrorRc("systemd-detect-virt", "--vm")
+	return runCommandWithOutputErrorRc(context.Background(), "systemd-detect-virt", "--vm")
 }
 
 func (d *systemdDetector) logf(format string, a ...interface{}) {
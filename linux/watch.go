@@ -0,0 +1,211 @@
+package linux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+
+	"machinerun.io/disko"
+)
+
+// WatchEventType is the kind of a WatchEvent.
+type WatchEventType string
+
+const (
+	// DiskAdded is a disk that appeared.
+	DiskAdded WatchEventType = "disk-added"
+
+	// DiskRemoved is a disk that went away.  Only the Name and Path of the
+	// event's Disk are set.
+	DiskRemoved WatchEventType = "disk-removed"
+
+	// DiskChanged is a disk that changed: it was resized, its medium
+	// changed or its partition table was re-read.
+	DiskChanged WatchEventType = "disk-changed"
+
+	// PartitionAdded is a partition that appeared on a disk.
+	PartitionAdded WatchEventType = "partition-added"
+
+	// PartitionRemoved is a partition that went away from a disk.
+	PartitionRemoved WatchEventType = "partition-removed"
+
+	// PartitionChanged is a partition that changed.
+	PartitionChanged WatchEventType = "partition-changed"
+
+	// WatchError is an error receiving uevents.  Events may have been lost,
+	// rescan to catch up.
+	WatchError WatchEventType = "error"
+)
+
+// WatchEvent is a change to a disk or one of its partitions.
+type WatchEvent struct {
+	// Type is the kind of the event.
+	Type WatchEventType
+
+	// Disk is the disk scanned after the event.  For partition events it
+	// is the disk the partition is on.
+	Disk disko.Disk
+
+	// Partition is the partition number of partition events.
+	Partition uint
+
+	// UEvent is the uevent the event was made from.
+	UEvent UEvent
+
+	// Err is the error receiving uevents (WatchError) or scanning Disk.
+	Err error
+}
+
+// Watcher turns the block device uevents of a UEventSource into
+// WatchEvents.
+type Watcher struct {
+	source UEventSource
+	system disko.ContextSystem
+
+	// devDir is where kernel device names are relative to.
+	devDir string
+
+	// knames matches the kernel names of the disks to report.
+	knames *regexp.Regexp
+}
+
+// NewWatcher returns a Watcher for the uevents from source.  The opts
+// configure the System that disks are scanned with.
+func NewWatcher(source UEventSource, opts ...Option) *Watcher {
+	return &Watcher{
+		source: source,
+		system: System(opts...),
+		devDir: "/dev",
+		knames: realDiskKnameRegex,
+	}
+}
+
+// Watch listens for udev block device events and sends a WatchEvent for
+// each change to a disk accepted by filter on the returned channel.  The
+// channel is closed once ctx is done.
+func Watch(ctx context.Context, filter disko.DiskFilter, opts ...Option) (<-chan WatchEvent, error) {
+	source, err := NewUEventSource(UdevUEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWatcher(source, opts...).Watch(ctx, filter), nil
+}
+
+// Watch sends a WatchEvent on the returned channel for each block device
+// uevent about a disk accepted by filter, or one of its partitions.
+// Removals are always sent as there is no disk left to filter.  The source
+// is closed and the channel closed once ctx is done or the source ends.
+func (w *Watcher) Watch(ctx context.Context, filter disko.DiskFilter) <-chan WatchEvent {
+	events := make(chan WatchEvent)
+	stop := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+
+		w.source.Close()
+	}()
+
+	go func() {
+		defer close(events)
+		defer close(stop)
+
+		for {
+			uev, err := w.source.Receive()
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return
+			}
+
+			var ev WatchEvent
+			var ok bool
+
+			if err != nil {
+				ev, ok = WatchEvent{Type: WatchError, Err: err}, true
+			} else {
+				ev, ok = w.event(ctx, uev, filter)
+			}
+
+			if !ok {
+				continue
+			}
+
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events
+}
+
+// event returns the WatchEvent for uev, or false if uev is not about a
+// disk that is watched.
+func (w *Watcher) event(ctx context.Context, uev UEvent, filter disko.DiskFilter) (WatchEvent, bool) {
+	if uev.Subsystem != "block" {
+		return WatchEvent{}, false
+	}
+
+	ev := WatchEvent{UEvent: uev}
+	kname := path.Base(uev.DevPath)
+
+	switch uev.DevType {
+	case "disk":
+		ev.Type = diskEventTypes[uev.Action]
+	case "partition":
+		ev.Type = partitionEventTypes[uev.Action]
+		kname = path.Base(path.Dir(uev.DevPath))
+
+		if n, err := strconv.ParseUint(uev.Env["PARTN"], 10, 32); err == nil {
+			ev.Partition = uint(n)
+		}
+	}
+
+	if ev.Type == "" || !w.knames.MatchString(kname) {
+		return WatchEvent{}, false
+	}
+
+	devPath := path.Join(w.devDir, kname)
+	if uev.DevType == "disk" && path.IsAbs(uev.DevName) {
+		devPath = uev.DevName
+	}
+
+	if ev.Type == DiskRemoved {
+		ev.Disk = disko.Disk{Name: kname, Path: devPath}
+		return ev, true
+	}
+
+	ev.Disk, ev.Err = w.system.ScanDiskContext(ctx, devPath)
+	if ev.Err != nil {
+		// a disk that is gone by the time it is scanned will have its own
+		// remove event.
+		ev.Disk.Name, ev.Disk.Path = kname, devPath
+
+		return ev, true
+	}
+
+	return ev, filter(ev.Disk)
+}
+
+//nolint:gochecknoglobals
+var diskEventTypes = map[string]WatchEventType{
+	"add":    DiskAdded,
+	"remove": DiskRemoved,
+	"change": DiskChanged,
+	"move":   DiskChanged,
+}
+
+//nolint:gochecknoglobals
+var partitionEventTypes = map[string]WatchEventType{
+	"add":    PartitionAdded,
+	"remove": PartitionRemoved,
+	"change": PartitionChanged,
+	"move":   PartitionChanged,
+}
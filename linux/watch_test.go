@@ -0,0 +1,190 @@
+package linux
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+)
+
+// fakeSource is a UEventSource fed from a channel.
+type fakeSource struct {
+	events chan UEvent
+	done   chan struct{}
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{events: make(chan UEvent), done: make(chan struct{})}
+}
+
+func (s *fakeSource) Receive() (UEvent, error) {
+	select {
+	case ev := <-s.events:
+		return ev, nil
+	case <-s.done:
+		return UEvent{}, io.EOF
+	}
+}
+
+func (s *fakeSource) Close() error {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	return nil
+}
+
+func kernelUEvent(kv ...string) []byte {
+	env := map[string]string{}
+	for _, s := range kv {
+		k, v, _ := strings.Cut(s, "=")
+		env[k] = v
+	}
+
+	return []byte(env["ACTION"] + "@" + env["DEVPATH"] + "\x00" + strings.Join(kv, "\x00") + "\x00")
+}
+
+func udevUEvent(kv ...string) []byte {
+	props := []byte(strings.Join(kv, "\x00") + "\x00")
+	hdr := make([]byte, 40)
+
+	copy(hdr, udevPrefix)
+	binary.BigEndian.PutUint32(hdr[8:], udevMonitorMagic)
+	binary.NativeEndian.PutUint32(hdr[12:], uint32(len(hdr)))
+	binary.NativeEndian.PutUint32(hdr[16:], uint32(len(hdr)))
+	binary.NativeEndian.PutUint32(hdr[20:], uint32(len(props)))
+
+	return append(hdr, props...)
+}
+
+func TestParseUEvent(t *testing.T) {
+	ast := assert.New(t)
+	env := []string{"ACTION=add", "DEVPATH=/devices/virtual/block/sdz/sdz1",
+		"SUBSYSTEM=block", "DEVTYPE=partition", "PARTN=1"}
+
+	kev, err := ParseUEvent(kernelUEvent(append(env, "DEVNAME=sdz1")...))
+	if ast.NoError(err) {
+		ast.Equal("add", kev.Action)
+		ast.Equal("/devices/virtual/block/sdz/sdz1", kev.DevPath)
+		ast.Equal("block", kev.Subsystem)
+		ast.Equal("partition", kev.DevType)
+		ast.Equal("sdz1", kev.DevName)
+		ast.Equal("1", kev.Env["PARTN"])
+	}
+
+	uev, err := ParseUEvent(udevUEvent(append(env, "DEVNAME=/dev/sdz1", "ID_SERIAL=abc")...))
+	if ast.NoError(err) {
+		ast.Equal("/dev/sdz1", uev.DevName)
+		ast.Equal("abc", uev.Env["ID_SERIAL"])
+		ast.Equal(kev.DevPath, uev.DevPath)
+	}
+
+	for _, bad := range [][]byte{
+		[]byte("garbage"),
+		[]byte("add@/devices/x\x00SUBSYSTEM=block\x00"),
+		udevUEvent("ACTION=add")[:20],
+		bytes.Replace(udevUEvent("ACTION=add", "DEVPATH=/x"), []byte{0xfe, 0xed}, []byte{0, 0}, 1),
+	} {
+		_, err := ParseUEvent(bad)
+		ast.Error(err, "%q", bad)
+	}
+}
+
+//nolint:funlen
+func TestWatch(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpd, err := os.MkdirTemp("", "disko_test")
+	if err != nil {
+		t.Fatalf("Failed to create tempdir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpd)
+
+	for _, name := range []string{"sdy", "sdz"} {
+		fpath := path.Join(tmpd, name)
+		if err := os.WriteFile(fpath, []byte{}, 0600); err != nil {
+			t.Fatalf("Failed to write to a temp file: %s", err)
+		}
+
+		if err := os.Truncate(fpath, int64(10*disko.Mebibyte)); err != nil {
+			t.Fatalf("Failed create empty file: %s", err)
+		}
+	}
+
+	src := newFakeSource()
+	w := NewWatcher(src)
+	w.devDir = tmpd
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := w.Watch(ctx, func(d disko.Disk) bool { return d.Name != "sdy" })
+
+	send := func(kv ...string) {
+		ev, err := ParseUEvent(kernelUEvent(kv...))
+		if err != nil {
+			t.Fatalf("bad uevent %v: %s", kv, err)
+		}
+
+		src.events <- ev
+	}
+
+	go func() {
+		// ignored: not block, not a real disk name, filtered out, unknown action.
+		send("ACTION=add", "DEVPATH=/devices/net/eth0", "SUBSYSTEM=net")
+		send("ACTION=add", "DEVPATH=/devices/virtual/block/loop0", "SUBSYSTEM=block", "DEVTYPE=disk")
+		send("ACTION=add", "DEVPATH=/devices/virtual/block/sdy", "SUBSYSTEM=block", "DEVTYPE=disk")
+		send("ACTION=bind", "DEVPATH=/devices/virtual/block/sdz", "SUBSYSTEM=block", "DEVTYPE=disk")
+
+		send("ACTION=add", "DEVPATH=/devices/virtual/block/sdz", "SUBSYSTEM=block", "DEVTYPE=disk",
+			"DEVNAME=sdz")
+		send("ACTION=add", "DEVPATH=/devices/virtual/block/sdz/sdz2", "SUBSYSTEM=block",
+			"DEVTYPE=partition", "PARTN=2")
+		send("ACTION=remove", "DEVPATH=/devices/virtual/block/sdy", "SUBSYSTEM=block", "DEVTYPE=disk")
+	}()
+
+	expected := []struct {
+		etype     WatchEventType
+		name      string
+		partition uint
+		scanned   bool
+	}{
+		{DiskAdded, "sdz", 0, true},
+		{PartitionAdded, "sdz", 2, true},
+		{DiskRemoved, "sdy", 0, false},
+	}
+
+	for _, exp := range expected {
+		select {
+		case ev := <-events:
+			ast.Equal(exp.etype, ev.Type)
+			ast.Equal(exp.name, ev.Disk.Name)
+			ast.Equal(path.Join(tmpd, exp.name), ev.Disk.Path)
+			ast.Equal(exp.partition, ev.Partition)
+			ast.NoError(ev.Err)
+
+			if exp.scanned {
+				ast.Equal(10*disko.Mebibyte, ev.Disk.Size)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s event", exp.etype)
+		}
+	}
+
+	cancel()
+
+	for range events {
+		t.Errorf("unexpected event after cancel")
+	}
+}
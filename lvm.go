@@ -1,8 +1,10 @@
 package disko
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // VolumeManager provides logical volume oprations that allows for creation and
@@ -66,6 +68,66 @@ type VolumeManager interface {
 	HasLV(vgName string, name string) bool
 }
 
+// ContextVolumeManager is a VolumeManager whose methods have variants that
+// take a context.Context. Cancelling the context, or reaching its deadline,
+// stops the operation and kills any command it has started.  The
+// VolumeManager methods behave as the Context variants called with
+// context.Background().
+type ContextVolumeManager interface {
+	VolumeManager
+
+	// ScanPVsContext is ScanPVs with a context.
+	ScanPVsContext(ctx context.Context, filter PVFilter) (PVSet, error)
+
+	// ScanVGsContext is ScanVGs with a context.
+	ScanVGsContext(ctx context.Context, filter VGFilter) (VGSet, error)
+
+	// CreatePVContext is CreatePV with a context.
+	CreatePVContext(ctx context.Context, diskName string) (PV, error)
+
+	// DeletePVContext is DeletePV with a context.
+	DeletePVContext(ctx context.Context, pv PV) error
+
+	// HasPVContext is HasPV with a context.
+	HasPVContext(ctx context.Context, name string) bool
+
+	// CreateVGContext is CreateVG with a context.
+	CreateVGContext(ctx context.Context, name string, pvs ...PV) (VG, error)
+
+	// ExtendVGContext is ExtendVG with a context.
+	ExtendVGContext(ctx context.Context, vgName string, pvs ...PV) error
+
+	// RemoveVGContext is RemoveVG with a context.
+	RemoveVGContext(ctx context.Context, vgName string) error
+
+	// HasVGContext is HasVG with a context.
+	HasVGContext(ctx context.Context, vgName string) bool
+
+	// CryptFormatContext is CryptFormat with a context.
+	CryptFormatContext(ctx context.Context, vgName string, lvName string, key string) error
+
+	// CryptOpenContext is CryptOpen with a context.
+	CryptOpenContext(ctx context.Context, vgName string, lvName string, decryptedName string, key string) error
+
+	// CryptCloseContext is CryptClose with a context.
+	CryptCloseContext(ctx context.Context, vgName string, lvName string, decryptedName string) error
+
+	// CreateLVContext is CreateLV with a context.
+	CreateLVContext(ctx context.Context, vgName string, name string, size uint64, lvType LVType) (LV, error)
+
+	// RemoveLVContext is RemoveLV with a context.
+	RemoveLVContext(ctx context.Context, vgName string, lvName string) error
+
+	// RenameLVContext is RenameLV with a context.
+	RenameLVContext(ctx context.Context, vgName string, lvName string, newLvName string) error
+
+	// ExtendLVContext is ExtendLV with a context.
+	ExtendLVContext(ctx context.Context, vgName string, lvName string, newSize uint64) error
+
+	// HasLVContext is HasLV with a context.
+	HasLVContext(ctx context.Context, vgName string, name string) bool
+}
+
 // PV wraps a LVM physical volume. A lvm physical volume is the raw
 // block device or other disk like devices that provide storage capacity.
 type PV struct {
@@ -116,6 +178,13 @@ type LV struct {
 	// Type is the type of logical volume.
 	Type LVType `json:"type"`
 
+	// Pool is the name of the thin pool of a THIN logical volume.
+	Pool string `json:"pool,omitempty"`
+
+	// DataPercent is how much of the data space of a THINPOOL or THIN
+	// logical volume is in use, in percent.
+	DataPercent float64 `json:"dataPercent,omitempty"`
+
 	// The volume group that this logical volume is part of.
 	VGName string `json:"vgname"`
 
@@ -229,6 +298,13 @@ type VG struct {
 type VGSet map[string]VG
 
 // Details returns a formatted string with the information of volume groups.
+// Use a Renderer for other formats.
 func (vgs VGSet) Details() string {
-	return ""
+	var buf strings.Builder
+
+	if err := (TextRenderer{}).RenderVGs(&buf, vgs); err != nil {
+		return err.Error()
+	}
+
+	return buf.String()
 }
@@ -1,8 +1,10 @@
 package megaraid
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"machinerun.io/disko"
 )
@@ -33,6 +35,17 @@ type VirtDrive struct {
 	Properties map[string]string
 }
 
+// Identity - the identity of the virtual drive as the OS will see it.
+func (vd *VirtDrive) Identity() disko.DiskIdentity {
+	id := disko.DiskIdentity{}
+
+	if naa := strings.ToLower(vd.Properties["SCSI NAA Id"]); naa != "" {
+		id.WWN = "0x" + naa
+	}
+
+	return id
+}
+
 // VirtDriveSet - a map of VirtDrives by their Number.
 type VirtDriveSet map[int]*VirtDrive
 
@@ -134,9 +147,21 @@ type MegaRaid interface {
 	// Query - Query the controller provided
 	Query(int) (Controller, error)
 
+	// QueryContext - Query with a context.Context that bounds the storcli calls
+	QueryContext(context.Context, int) (Controller, error)
+
 	// GetDiskType - Determine the disk type if controller owns disk
 	GetDiskType(string) (disko.DiskType, error)
 
+	// GetDiskTypeContext - GetDiskType with a context.Context that bounds the storcli calls
+	GetDiskTypeContext(context.Context, string) (disko.DiskType, error)
+
+	// GetDiskIdentity - Return the identity the controller reports for the disk
+	GetDiskIdentity(string) (disko.DiskIdentity, error)
+
+	// GetDiskIdentityContext - GetDiskIdentity with a context.Context that bounds the storcli calls
+	GetDiskIdentityContext(context.Context, string) (disko.DiskIdentity, error)
+
 	// DriverSysfsPath - Return the sysfs path to the linux driver for this controller
 	DriverSysfsPath() string
 
@@ -2,11 +2,13 @@ package megaraid
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -44,6 +46,10 @@ type scResultSection struct {
 }
 
 func (sc *storCli) Query(cID int) (Controller, error) {
+	return sc.QueryContext(context.Background(), cID)
+}
+
+func (sc *storCli) QueryContext(ctx context.Context, cID int) (Controller, error) {
 	// run /c0 show all
 	//   - get PDs and VDs
 	// run /c0/vall show all
@@ -53,7 +59,11 @@ func (sc *storCli) Query(cID int) (Controller, error) {
 
 	args := []string{fmt.Sprintf("/c%d", cID), "show", "nolog"}
 
-	if stdout, stderr, rc = storcli(args...); rc != 0 {
+	if stdout, stderr, rc = storcli(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return Controller{}, err
+		}
+
 		var err error = ErrNoStorcli
 		if rc != noStorCliRC {
 			err = cmdError(args, stdout, stderr, rc)
@@ -66,7 +76,11 @@ func (sc *storCli) Query(cID int) (Controller, error) {
 
 	args = []string{fmt.Sprintf("/c%d/vall", cID), "show", "all", "nolog"}
 
-	if stdout, stderr, rc = storcli(args...); rc != 0 {
+	if stdout, stderr, rc = storcli(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return Controller{}, err
+		}
+
 		return Controller{}, cmdError(args, stdout, stderr, rc)
 	}
 
@@ -80,9 +94,21 @@ func (sc *storCli) DriverSysfsPath() string {
 }
 
 func (sc *storCli) GetDiskType(path string) (disko.DiskType, error) {
+	return sc.GetDiskTypeContext(context.Background(), path)
+}
+
+func (sc *storCli) GetDiskTypeContext(ctx context.Context, path string) (disko.DiskType, error) {
 	return disko.HDD, fmt.Errorf("missing controller to run query")
 }
 
+func (sc *storCli) GetDiskIdentity(path string) (disko.DiskIdentity, error) {
+	return sc.GetDiskIdentityContext(context.Background(), path)
+}
+
+func (sc *storCli) GetDiskIdentityContext(ctx context.Context, path string) (disko.DiskIdentity, error) {
+	return disko.DiskIdentity{}, fmt.Errorf("missing controller to run query")
+}
+
 // not implemented in driver layer
 func (sc *storCli) IsSysPathRAID(syspath string) bool {
 	return false
@@ -552,8 +578,8 @@ func stringToMediaType(mtypeStr string) MediaType {
 	return UnknownMedia
 }
 
-func storcli(args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command("storcli", args...)
+func storcli(ctx context.Context, args ...string) ([]byte, []byte, int) {
+	cmd := exec.CommandContext(ctx, "storcli", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -590,6 +616,10 @@ func getCommandErrorRCDefault(err error, rcError int) int {
 type cachingStorCli struct {
 	mr    MegaRaid
 	cache *cache.Cache
+
+	// mutex makes concurrent queries that miss the cache wait for the one
+	// that is running storcli instead of all running it.
+	mutex sync.Mutex
 }
 
 // CachingStorCli - just a cache for a MegaRaid
@@ -603,12 +633,20 @@ func CachingStorCli() MegaRaid {
 }
 
 func (csc *cachingStorCli) Query(cID int) (Controller, error) {
+	return csc.QueryContext(context.Background(), cID)
+}
+
+func (csc *cachingStorCli) QueryContext(ctx context.Context, cID int) (Controller, error) {
 	type qresult struct {
 		ctrl Controller
 		err  error
 	}
 
 	cacheName := fmt.Sprintf("query-%d", cID)
+
+	csc.mutex.Lock()
+	defer csc.mutex.Unlock()
+
 	cached, found := csc.cache.Get(cacheName)
 
 	if found {
@@ -616,14 +654,22 @@ func (csc *cachingStorCli) Query(cID int) (Controller, error) {
 		return ret.ctrl, ret.err
 	}
 
-	ctrl, err := csc.mr.Query(cID)
-	csc.cache.Set(cacheName, qresult{ctrl: ctrl, err: err}, cache.DefaultExpiration)
+	ctrl, err := csc.mr.QueryContext(ctx, cID)
+
+	// An interrupted query says nothing about the controller.
+	if ctx.Err() == nil {
+		csc.cache.Set(cacheName, qresult{ctrl: ctrl, err: err}, cache.DefaultExpiration)
+	}
 
 	return ctrl, err
 }
 
 func (csc *cachingStorCli) GetDiskType(path string) (disko.DiskType, error) {
-	ctrl, err := csc.Query(0)
+	return csc.GetDiskTypeContext(context.Background(), path)
+}
+
+func (csc *cachingStorCli) GetDiskTypeContext(ctx context.Context, path string) (disko.DiskType, error) {
+	ctrl, err := csc.QueryContext(ctx, 0)
 	if err == nil {
 		for _, vd := range ctrl.VirtDrives {
 			if vd.Path == path {
@@ -641,6 +687,25 @@ func (csc *cachingStorCli) GetDiskType(path string) (disko.DiskType, error) {
 	return disko.HDD, fmt.Errorf("cannot determine disk type")
 }
 
+func (csc *cachingStorCli) GetDiskIdentity(path string) (disko.DiskIdentity, error) {
+	return csc.GetDiskIdentityContext(context.Background(), path)
+}
+
+func (csc *cachingStorCli) GetDiskIdentityContext(ctx context.Context, path string) (disko.DiskIdentity, error) {
+	ctrl, err := csc.QueryContext(ctx, 0)
+	if err != nil {
+		return disko.DiskIdentity{}, err
+	}
+
+	for _, vd := range ctrl.VirtDrives {
+		if vd.Path == path {
+			return vd.Identity(), nil
+		}
+	}
+
+	return disko.DiskIdentity{}, fmt.Errorf("no virtual drive for %s", path)
+}
+
 func (csc *cachingStorCli) DriverSysfsPath() string {
 	return csc.mr.DriverSysfsPath()
 }
@@ -1,10 +1,17 @@
 package megaraid
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
 )
 
 var tableData1 = `
@@ -249,6 +256,22 @@ func TestNewController(t *testing.T) {
 	}
 }
 
+func TestVirtDriveIdentity(t *testing.T) {
+	ctrl, err := newController(0, sys0CxShow, sys0CxVallShowAll)
+	if err != nil {
+		t.Fatalf("newController failed: %s", err)
+	}
+
+	expected := "0x6cc167e9730322c027dd6f0c462b44b4"
+	if found := ctrl.VirtDrives[0].Identity().WWN; found != expected {
+		t.Errorf("VirtDrive 0 had WWN %q, expected %q", found, expected)
+	}
+
+	if id := (&VirtDrive{}).Identity(); !id.IsEmpty() {
+		t.Errorf("VirtDrive with no properties had identity %v", id)
+	}
+}
+
 func TestJsonDriveGroupSet(t *testing.T) {
 	dgs := DriveGroupSet{
 		1: &DriveGroup{
@@ -1289,3 +1312,61 @@ Model  State   Temp Mode MfgDate
 CVPM05 Optimal 34C  -    2018/10/16
 ------------------------------------
 `
+
+func TestQueryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	csc := CachingStorCli()
+
+	if _, err := csc.QueryContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// the interrupted query must not be cached.
+	if _, found := csc.(*cachingStorCli).cache.Get("query-0"); found {
+		t.Errorf("interrupted query result was cached")
+	}
+
+	if _, err := csc.GetDiskTypeContext(ctx, "/dev/sda"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// countingMegaRaid is a MegaRaid whose queries take a while and are counted.
+type countingMegaRaid struct {
+	storCli
+	queries int32
+}
+
+func (c *countingMegaRaid) QueryContext(ctx context.Context, cID int) (Controller, error) {
+	atomic.AddInt32(&c.queries, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return Controller{ID: cID}, nil
+}
+
+func TestCachingStorCliConcurrent(t *testing.T) {
+	mr := &countingMegaRaid{}
+	csc := &cachingStorCli{mr: mr, cache: cache.New(time.Minute, time.Minute)}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := csc.Query(0); err != nil {
+				t.Errorf("Query failed: %s", err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&mr.queries); n != 1 {
+		t.Errorf("expected 1 storcli query for 10 concurrent callers, got %d", n)
+	}
+}
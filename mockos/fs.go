@@ -0,0 +1,140 @@
+package mockos
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"regexp"
+	"strings"
+
+	"machinerun.io/disko"
+)
+
+type mockFS struct {
+	// Filesystems are the filesystems on devices, by device path.
+	Filesystems map[string]disko.Signature `json:"filesystems"`
+	sys         disko.System
+	vmgr        disko.VolumeManager
+}
+
+// FS returns a mock implementation of disko.FSManager.  Filesystems can be
+// created on the disks and partitions of sys and on the logical volumes,
+// plain or decrypted, of vmgr.  vmgr may be nil.
+func FS(sys disko.System, vmgr disko.VolumeManager) disko.FSManager {
+	return &mockFS{
+		Filesystems: map[string]disko.Signature{},
+		sys:         sys,
+		vmgr:        vmgr,
+	}
+}
+
+func (m *mockFS) CreateFS(devPath string, fsType disko.FSType, opts disko.FSOptions) error {
+	switch fsType {
+	case disko.FSExt2, disko.FSExt3, disko.FSExt4, disko.FSXFS, disko.FSBtrfs:
+	case disko.FSVFAT, disko.FSSwap:
+		if len(opts.Features) != 0 {
+			return fmt.Errorf("%s takes no features, not %v: %w", fsType, opts.Features, disko.ErrUnsupportedFS)
+		}
+	default:
+		return fmt.Errorf("create %q on %s: %w", fsType, devPath, disko.ErrUnsupportedFS)
+	}
+
+	if !m.hasDevice(devPath) {
+		return fmt.Errorf("%s: %w", devPath, disko.ErrDiskNotFound)
+	}
+
+	uuid := opts.UUID
+	if uuid == "" {
+		uuid = strings.ToLower(disko.GenGUID().String())
+
+		if fsType == disko.FSVFAT {
+			uuid = fmt.Sprintf("%04X-%04X", rand.Intn(0x10000), rand.Intn(0x10000)) //nolint:gosec,gomnd
+		}
+	}
+
+	m.Filesystems[devPath] = disko.Signature{Type: string(fsType), Label: opts.Label, UUID: uuid}
+
+	return nil
+}
+
+func (m *mockFS) SetFSLabel(devPath string, label string) error {
+	sig, err := m.find(devPath)
+	if err != nil {
+		return err
+	}
+
+	sig.Label = label
+	m.Filesystems[devPath] = sig
+
+	return nil
+}
+
+func (m *mockFS) CheckFS(devPath string) error {
+	_, err := m.find(devPath)
+	return err
+}
+
+func (m *mockFS) GrowFS(devPath string) error {
+	sig, err := m.find(devPath)
+	if err != nil {
+		return err
+	}
+
+	if t := disko.FSType(sig.Type); t == disko.FSVFAT || t == disko.FSSwap {
+		return fmt.Errorf("grow %s %s: %w", t, devPath, disko.ErrUnsupportedFS)
+	}
+
+	return nil
+}
+
+// find returns the filesystem on devPath.
+func (m *mockFS) find(devPath string) (disko.Signature, error) {
+	if sig, ok := m.Filesystems[devPath]; ok {
+		return sig, nil
+	}
+
+	if !m.hasDevice(devPath) {
+		return disko.Signature{}, fmt.Errorf("%s: %w", devPath, disko.ErrDiskNotFound)
+	}
+
+	return disko.Signature{}, fmt.Errorf("%s has no filesystem: %w", devPath, disko.ErrUnsupportedFS)
+}
+
+// hasDevice returns true if devPath is a disk, partition or logical volume.
+func (m *mockFS) hasDevice(devPath string) bool {
+	endsWithNum := regexp.MustCompile("[0-9]$")
+
+	disks, _ := m.sys.ScanAllDisks(func(d disko.Disk) bool { return true })
+	for _, d := range disks {
+		if d.Path == devPath {
+			return true
+		}
+
+		sep := ""
+		if endsWithNum.MatchString(d.Path) {
+			sep = "p"
+		}
+
+		for n := range d.Partitions {
+			if fmt.Sprintf("%s%s%d", d.Path, sep, n) == devPath {
+				return true
+			}
+		}
+	}
+
+	if m.vmgr == nil {
+		return false
+	}
+
+	vgs, _ := m.vmgr.ScanVGs(func(vg disko.VG) bool { return true })
+	for _, vg := range vgs {
+		for _, lv := range vg.Volumes {
+			if path.Join("/dev", vg.Name, lv.Name) == devPath ||
+				(lv.DecryptedLVPath != "" && lv.DecryptedLVPath == devPath) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
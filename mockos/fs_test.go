@@ -0,0 +1,67 @@
+package mockos_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"machinerun.io/disko"
+	"machinerun.io/disko/mockos"
+	"machinerun.io/disko/partid"
+)
+
+func TestFS(t *testing.T) {
+	Convey("testing filesystems", t, func() {
+		sys, err := mockos.System("testdata/model_sys.json")
+		So(err, ShouldBeNil)
+
+		disks, _ := sys.ScanAllDisks(nil)
+		So(sys.CreatePartition(disks["sda"], disko.Partition{
+			Number: 1, Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS}), ShouldBeNil)
+
+		lvm := mockos.LVM(sys)
+		fsm := mockos.FS(sys, lvm)
+
+		Convey("Filesystems can be created on partitions and maintained", func() {
+			So(fsm.CreateFS("/dev/sda1", disko.FSExt4,
+				disko.FSOptions{Label: "root", Features: []string{"metadata_csum"}}), ShouldBeNil)
+			So(fsm.CheckFS("/dev/sda1"), ShouldBeNil)
+			So(fsm.SetFSLabel("/dev/sda1", "newroot"), ShouldBeNil)
+			So(fsm.GrowFS("/dev/sda1"), ShouldBeNil)
+		})
+
+		Convey("Filesystems can be created on logical volumes", func() {
+			pv, err := lvm.CreatePV("sda1")
+			So(err, ShouldBeNil)
+			_, err = lvm.CreateVG("vg0", pv)
+			So(err, ShouldBeNil)
+			_, err = lvm.CreateLV("vg0", "data", 8*disko.Mebibyte, disko.THICK)
+			So(err, ShouldBeNil)
+
+			So(fsm.CreateFS("/dev/vg0/data", disko.FSXFS, disko.FSOptions{}), ShouldBeNil)
+			So(fsm.CheckFS("/dev/vg0/data"), ShouldBeNil)
+		})
+
+		Convey("Swap and vfat take no features and cannot grow", func() {
+			err := fsm.CreateFS("/dev/sda1", disko.FSSwap, disko.FSOptions{Features: []string{"x"}})
+			So(errors.Is(err, disko.ErrUnsupportedFS), ShouldBeTrue)
+
+			So(fsm.CreateFS("/dev/sda1", disko.FSVFAT, disko.FSOptions{Label: "EFI"}), ShouldBeNil)
+			So(errors.Is(fsm.GrowFS("/dev/sda1"), disko.ErrUnsupportedFS), ShouldBeTrue)
+		})
+
+		Convey("Unknown devices, types and missing filesystems are errors", func() {
+			err := fsm.CreateFS("/dev/sdxx", disko.FSExt4, disko.FSOptions{})
+			So(errors.Is(err, disko.ErrDiskNotFound), ShouldBeTrue)
+
+			err = fsm.CreateFS("/dev/sda1", "ntfs", disko.FSOptions{})
+			So(errors.Is(err, disko.ErrUnsupportedFS), ShouldBeTrue)
+
+			err = fsm.CheckFS("/dev/sda1")
+			So(errors.Is(err, disko.ErrUnsupportedFS), ShouldBeTrue)
+
+			err = fsm.SetFSLabel("/dev/sdxx", "x")
+			So(errors.Is(err, disko.ErrDiskNotFound), ShouldBeTrue)
+		})
+	})
+}
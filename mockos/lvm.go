@@ -3,6 +3,8 @@ package mockos
 import (
 	"fmt"
 	"path"
+	"regexp"
+	"strings"
 
 	"machinerun.io/disko"
 )
@@ -48,38 +50,51 @@ func (lvm *mockLVM) ScanVGs(filter disko.VGFilter) (disko.VGSet, error) {
 	return vgs, nil
 }
 
-func hasPartition(disks disko.DiskSet, name string) bool {
+// findPartition returns the partition with the given name or kernel
+// name (sda1, nvme0n1p1).
+func findPartition(disks disko.DiskSet, name string) (disko.Partition, bool) {
+	endsWithNum := regexp.MustCompile("[0-9]$")
+
 	for _, d := range disks {
+		sep := ""
+		if endsWithNum.MatchString(d.Name) {
+			sep = "p"
+		}
+
 		for _, p := range d.Partitions {
-			if p.Name == name {
-				return true
+			if p.Name == name || fmt.Sprintf("%s%s%d", d.Name, sep, p.Number) == name {
+				return p, true
 			}
 		}
 	}
 
-	return false
+	return disko.Partition{}, false
 }
 
 func (lvm *mockLVM) CreatePV(deviceName string) (disko.PV, error) {
 	disks, _ := lvm.sys.ScanAllDisks(func(d disko.Disk) bool { return true })
 	d, ok := disks[deviceName]
+	size := d.Size
 
 	if !ok {
 		// The device is not a disk, lets check if it is a partition.
-		if !hasPartition(disks, deviceName) {
-			return disko.PV{}, fmt.Errorf("disk %s does not exist", deviceName)
+		p, ok := findPartition(disks, deviceName)
+		if !ok {
+			return disko.PV{}, fmt.Errorf("%s: %w", deviceName, disko.ErrDiskNotFound)
 		}
+
+		size = p.Size()
 	}
 
 	if _, ok := lvm.PVs[deviceName]; ok {
-		return disko.PV{}, fmt.Errorf("pv %s already exists", deviceName)
+		return disko.PV{}, fmt.Errorf("pv %s: %w", deviceName, disko.ErrExists)
 	}
 
 	pv := disko.PV{
 		Name:     deviceName,
 		Path:     path.Join("dev", deviceName),
-		Size:     d.Size,
-		FreeSize: d.Size,
+		Size:     size,
+		FreeSize: size,
 	}
 
 	lvm.freePVs[pv.Name] = pv
@@ -90,12 +105,12 @@ func (lvm *mockLVM) CreatePV(deviceName string) (disko.PV, error) {
 
 func (lvm *mockLVM) DeletePV(pv disko.PV) error {
 	if _, ok := lvm.PVs[pv.Name]; !ok {
-		return fmt.Errorf("pv %s does not exist", pv.Name)
+		return fmt.Errorf("pv %s: %w", pv.Name, disko.ErrNotFound)
 	}
 
 	// PV must not be used by any vg to delete
 	if _, ok := lvm.freePVs[pv.Name]; !ok {
-		return fmt.Errorf("pv %s is in use", pv.Name)
+		return fmt.Errorf("pv %s in use: %w", pv.Name, disko.ErrBusy)
 	}
 
 	delete(lvm.PVs, pv.Name)
@@ -111,7 +126,7 @@ func (lvm *mockLVM) HasPV(name string) bool {
 
 func (lvm *mockLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
 	if _, ok := lvm.VGs[name]; ok {
-		return disko.VG{}, fmt.Errorf("vg %s already exists", name)
+		return disko.VG{}, fmt.Errorf("vg %s: %w", name, disko.ErrExists)
 	}
 
 	pvSet := disko.PVSet{}
@@ -120,12 +135,14 @@ func (lvm *mockLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
 	for _, pv := range pvs {
 		if _, ok := lvm.freePVs[pv.Name]; !ok {
 			// pv already used by some other vg
-			return disko.VG{}, fmt.Errorf("pv %s already in use", pv.Name)
+			return disko.VG{}, fmt.Errorf("pv %s in use: %w", pv.Name, disko.ErrBusy)
 		}
 
 		// delete the PV from list and add it to this vg list
 		delete(lvm.freePVs, pv.Name)
+		pv.VGName = name
 		pvSet[pv.Name] = pv
+		lvm.PVs[pv.Name] = pv
 
 		size += pv.Size
 	}
@@ -146,20 +163,22 @@ func (lvm *mockLVM) CreateVG(name string, pvs ...disko.PV) (disko.VG, error) {
 func (lvm *mockLVM) ExtendVG(vgName string, pvs ...disko.PV) error {
 	vg, ok := lvm.VGs[vgName]
 	if !ok {
-		return fmt.Errorf("vg %s does not exist", vgName)
+		return fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
 	}
 
 	for _, pv := range pvs {
 		if _, ok := lvm.freePVs[pv.Name]; !ok {
 			// pv already used by some other vg
-			return fmt.Errorf("pv %s already in use", pv.Name)
+			return fmt.Errorf("pv %s in use: %w", pv.Name, disko.ErrBusy)
 		}
 	}
 
 	// Delete all the added pvs from the free list
 	for _, pv := range pvs {
 		delete(lvm.freePVs, pv.Name)
+		pv.VGName = vgName
 		vg.PVs[pv.Name] = pv
+		lvm.PVs[pv.Name] = pv
 		vg.Size += pv.Size
 		vg.FreeSpace += pv.FreeSize
 	}
@@ -172,12 +191,14 @@ func (lvm *mockLVM) ExtendVG(vgName string, pvs ...disko.PV) error {
 func (lvm *mockLVM) RemoveVG(vgName string) error {
 	vg, ok := lvm.VGs[vgName]
 	if !ok {
-		return fmt.Errorf("vg %s does not exist", vgName)
+		return fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
 	}
 
 	for _, pv := range vg.PVs {
 		// Add all the pvs from this vg into the free list
+		pv.VGName = ""
 		lvm.freePVs[pv.Name] = pv
+		lvm.PVs[pv.Name] = pv
 	}
 
 	// Delete this VG from lvm
@@ -195,7 +216,7 @@ func (lvm *mockLVM) CryptFormat(vgName string, lvName string,
 	key string) error {
 	vg, lv, err := lvm.findLV(vgName, lvName)
 	if err != nil {
-		return fmt.Errorf("lv %s does not exist", lvName)
+		return fmt.Errorf("lv %s: %w", lvName, disko.ErrNotFound)
 	}
 
 	lv.Encrypted = true
@@ -208,7 +229,7 @@ func (lvm *mockLVM) CryptOpen(vgName string, lvName string,
 	decryptedName string, key string) error {
 	vg, lv, err := lvm.findLV(vgName, lvName)
 	if err != nil {
-		return fmt.Errorf("lv %s does not exist", lvName)
+		return fmt.Errorf("lv %s: %w", lvName, disko.ErrNotFound)
 	}
 
 	if !lv.Encrypted {
@@ -226,7 +247,7 @@ func (lvm *mockLVM) CryptClose(vgName string, lvName string,
 	decryptedName string) error {
 	vg, lv, err := lvm.findLV(vgName, lvName)
 	if err != nil {
-		return fmt.Errorf("lv %s does not exist", lvName)
+		return fmt.Errorf("lv %s: %w", lvName, disko.ErrNotFound)
 	}
 
 	if !lv.Encrypted {
@@ -246,24 +267,31 @@ func (lvm *mockLVM) CryptClose(vgName string, lvName string,
 
 func (lvm *mockLVM) CreateLV(vgName string, name string, size uint64,
 	lvType disko.LVType) (disko.LV, error) {
+	// THIN volumes are created in <vgname>/<thinpool>.
+	pool := ""
+	if toks := strings.SplitN(vgName, "/", 2); len(toks) == 2 { //nolint:gomnd
+		vgName, pool = toks[0], toks[1]
+	}
+
 	vg, _, err := lvm.findLV(vgName, name)
 	if err == nil {
-		return disko.LV{}, fmt.Errorf("lv %s already exists", name)
+		return disko.LV{}, fmt.Errorf("lv %s: %w", name, disko.ErrExists)
 	}
 
 	vg, ok := lvm.VGs[vgName]
 	if !ok {
-		return disko.LV{}, fmt.Errorf("vg %s does not exist", vgName)
+		return disko.LV{}, fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
 	}
 
 	if vg.FreeSpace < size {
-		return disko.LV{}, fmt.Errorf("vg %s does not have enough space", vgName)
+		return disko.LV{}, fmt.Errorf("vg %s: %w", vgName, disko.ErrNoSpace)
 	}
 
 	lv := disko.LV{
 		Name:      name,
 		Size:      size,
 		Type:      lvType,
+		Pool:      pool,
 		VGName:    vgName,
 		Encrypted: false,
 	}
@@ -320,13 +348,16 @@ func (lvm *mockLVM) ExtendLV(vgName string, lvName string,
 	deltaSize := newSize - lv.Size
 
 	if vg.FreeSpace < deltaSize {
-		return fmt.Errorf("vg %s does not have enough space", vg.Name)
+		return fmt.Errorf("vg %s: %w", vg.Name, disko.ErrNoSpace)
 	}
 
 	// allocate the space from the vg to this lv
 	vg.FreeSpace -= deltaSize
 	lv.Size += deltaSize
 
+	vg.Volumes[lvName] = lv
+	lvm.VGs[vg.Name] = vg
+
 	return nil
 }
 
@@ -338,12 +369,12 @@ func (lvm *mockLVM) HasLV(vgName string, name string) bool {
 func (lvm *mockLVM) findLV(vgName string, lvName string) (disko.VG, disko.LV, error) {
 	vg, ok := lvm.VGs[vgName]
 	if !ok {
-		return disko.VG{}, disko.LV{}, fmt.Errorf("vg %s not found", vgName)
+		return disko.VG{}, disko.LV{}, fmt.Errorf("vg %s: %w", vgName, disko.ErrNotFound)
 	}
 
 	lv, ok := vg.Volumes[lvName]
 	if !ok {
-		return disko.VG{}, disko.LV{}, fmt.Errorf("lv %s not found", lvName)
+		return disko.VG{}, disko.LV{}, fmt.Errorf("lv %s: %w", lvName, disko.ErrNotFound)
 	}
 
 	return vg, lv, nil
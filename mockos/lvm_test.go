@@ -1,6 +1,7 @@
 package mockos_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -12,7 +13,8 @@ import (
 
 func TestPV(t *testing.T) {
 	Convey("testing lvm PVs", t, func() {
-		sys := mockos.System("testdata/model_sys.json")
+		sys, err := mockos.System("testdata/model_sys.json")
+		So(err, ShouldBeNil)
 		So(sys, ShouldNotBeNil)
 
 		lvm := mockos.LVM(sys)
@@ -30,10 +32,10 @@ func TestPV(t *testing.T) {
 		So(lvm.HasPV("sda"), ShouldBeTrue)
 
 		_, err = lvm.CreatePV("sda")
-		So(err, ShouldBeError)
+		So(errors.Is(err, disko.ErrExists), ShouldBeTrue)
 
 		err = lvm.DeletePV(disko.PV{Name: "blah"})
-		So(err, ShouldBeError)
+		So(errors.Is(err, disko.ErrNotFound), ShouldBeTrue)
 
 		err = lvm.DeletePV((pv))
 		So(err, ShouldBeNil)
@@ -43,18 +45,20 @@ func TestPV(t *testing.T) {
 //nolint:funlen
 func TestVG(t *testing.T) {
 	Convey("testing lvm VGs", t, func() {
-		sys := mockos.System("testdata/model_sys.json")
+		sys, err := mockos.System("testdata/model_sys.json")
+		So(err, ShouldBeNil)
 		lvm := mockos.LVM(sys)
 
 		// Create a partition per disk and a PV
 		disks, _ := sys.ScanAllDisks(nil)
 		for _, d := range disks {
 			name := d.Name + "1"
+			free := d.FreeSpaces()[0]
 			err := sys.CreatePartition(d, disko.Partition{
 				Name:   name,
 				Number: 1,
-				Start:  0,
-				Last:   d.Size,
+				Start:  free.Start,
+				Last:   free.Last,
 				Type:   partid.LinuxFS,
 			})
 
@@ -146,7 +150,8 @@ func TestVG(t *testing.T) {
 //nolint:funlen
 func TestLV(t *testing.T) {
 	Convey("test lvm lvs", t, func() {
-		sys := mockos.System("testdata/model_sys.json")
+		sys, err := mockos.System("testdata/model_sys.json")
+		So(err, ShouldBeNil)
 		lvm := mockos.LVM(sys)
 		So(sys, ShouldNotBeNil)
 		So(lvm, ShouldNotBeNil)
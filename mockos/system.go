@@ -8,20 +8,21 @@ import (
 	"machinerun.io/disko"
 )
 
-// System returns a mock os implementation of the disk.System interface.
-func System(layout string) disko.System {
+// System returns a mock os implementation of the disk.System interface
+// loaded from the json file at layout.
+func System(layout string) (disko.System, error) {
 	file, err := os.ReadFile(layout)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	sys := &mockSys{}
 
 	if err := json.Unmarshal(file, sys); err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to parse %s: %w", layout, err)
 	}
 
-	return sys
+	return sys, nil
 }
 
 type mockSys struct {
@@ -66,22 +67,51 @@ func (ms *mockSys) ScanDisk(path string) (disko.Disk, error) {
 		}
 	}
 
-	return disko.Disk{}, fmt.Errorf("disk %s not found", path)
+	return disko.Disk{}, fmt.Errorf("%s: %w", path, disko.ErrDiskNotFound)
 }
 
 func (ms *mockSys) CreatePartition(d disko.Disk, p disko.Partition) error {
 	if disk, ok := ms.Disks[d.Name]; ok {
+		if err := disk.CheckPartitionRanges(disko.PartitionSet{p.Number: p}); err != nil {
+			return err
+		}
+
 		if _, ok := disk.Partitions[p.Number]; ok {
-			return fmt.Errorf("partition %d already exists", p.Number)
+			return &disko.PartitionError{Disk: disk.Path, Number: p.Number, Err: disko.ErrPartitionExists}
+		}
+
+		if disk.Partitions == nil {
+			disk.Partitions = disko.PartitionSet{}
 		}
 
 		disk.Partitions[p.Number] = p
 
+		if disk.Table == disko.TableNone {
+			disk.Table = d.Table
+			if disk.Table == disko.TableNone {
+				disk.Table = disko.GPT
+			}
+
+			if disk.Table == disko.GPT {
+				disk.GPT.DiskGUID = d.GPT.DiskGUID
+				if disk.GPT.DiskGUID == (disko.GUID{}) {
+					disk.GPT.DiskGUID = disko.GenGUID()
+				}
+
+				disk.GPT.PartitionEntries = gptDefaultEntries
+				disk.GPT.PartitionEntrySize = gptDefaultEntrySize
+				disk.GPT.FirstUsableLBA = 2 + disk.GPTEntrySectors()
+				disk.GPT.LastUsableLBA = disk.RelocatedLastUsableLBA()
+			}
+		}
+
+		ms.Disks[d.Name] = disk
+
 		// Ignore free spaces for mock
 		return nil
 	}
 
-	return fmt.Errorf("disk %s does not exist", d.Name)
+	return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
 }
 
 func (ms *mockSys) CreatePartitions(d disko.Disk, pSet disko.PartitionSet) error {
@@ -98,7 +128,7 @@ func (ms *mockSys) UpdatePartition(d disko.Disk, p disko.Partition) error {
 	cur, ok := d.Partitions[p.Number]
 
 	if !ok {
-		return fmt.Errorf("partition %d did not exist on disk %s", p.Number, d)
+		return &disko.PartitionError{Disk: d.Path, Number: p.Number, Err: disko.ErrPartitionNotFound}
 	}
 
 	emptyGUID := disko.GUID{}
@@ -117,6 +147,10 @@ func (ms *mockSys) UpdatePartition(d disko.Disk, p disko.Partition) error {
 		upd.Type = p.Type
 	}
 
+	if p.Attributes != 0 {
+		upd.Attributes = p.Attributes
+	}
+
 	d.Partitions[p.Number] = upd
 
 	return nil
@@ -132,10 +166,32 @@ func (ms *mockSys) UpdatePartitions(d disko.Disk, pSet disko.PartitionSet) error
 	return nil
 }
 
+func (ms *mockSys) SetPartitionAttributes(d disko.Disk, number uint, attrs disko.PartAttrs) error {
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot set attributes of partition %d on disk %s: partition table '%s': %w",
+			number, disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	p, ok := disk.Partitions[number]
+	if !ok {
+		return &disko.PartitionError{Disk: disk.Path, Number: number, Err: disko.ErrPartitionNotFound}
+	}
+
+	p.Attributes = attrs
+	disk.Partitions[number] = p
+
+	return nil
+}
+
 func (ms *mockSys) DeletePartition(d disko.Disk, number uint) error {
 	if disk, ok := ms.Disks[d.Name]; ok {
 		if _, ok := disk.Partitions[number]; !ok {
-			return fmt.Errorf("partition %d does not exist", number)
+			return &disko.PartitionError{Disk: disk.Path, Number: number, Err: disko.ErrPartitionNotFound}
 		}
 
 		delete(disk.Partitions, number)
@@ -144,10 +200,142 @@ func (ms *mockSys) DeletePartition(d disko.Disk, number uint) error {
 		return nil
 	}
 
-	return fmt.Errorf("disk %s does not exist", d.Name)
+	return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+}
+
+func (ms *mockSys) ResizePartition(d disko.Disk, number uint, last uint64) error {
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	p, ok := disk.Partitions[number]
+	if !ok {
+		return &disko.PartitionError{Disk: disk.Path, Number: number, Err: disko.ErrPartitionNotFound}
+	}
+
+	p.Last = last
+
+	if err := disk.CheckPartitionResize(p); err != nil {
+		return err
+	}
+
+	if err := disk.CheckPartitionOverlap(p); err != nil {
+		return err
+	}
+
+	disk.Partitions[number] = p
+
+	return nil
+}
+
+func (ms *mockSys) SetDiskGUID(d disko.Disk, id disko.GUID) error {
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot set the guid of disk %s: partition table '%s': %w",
+			disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	if id == (disko.GUID{}) {
+		id = disko.GenGUID()
+	}
+
+	disk.GPT.DiskGUID = id
+	ms.Disks[d.Name] = disk
+
+	return nil
+}
+
+func (ms *mockSys) RelocateBackupGPT(d disko.Disk) error {
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("cannot relocate the backup GPT of disk %s: partition table '%s': %w",
+			disk.Name, disk.Table, disko.ErrUnsupportedTable)
+	}
+
+	disk.GPT.LastUsableLBA = disk.RelocatedLastUsableLBA()
+
+	problems := []disko.TableProblem{}
+
+	for _, p := range disk.TableProblems {
+		if p.Kind != disko.ProblemBackupLocation {
+			problems = append(problems, p)
+		}
+	}
+
+	disk.TableProblems = problems
+	ms.Disks[d.Name] = disk
+
+	return nil
+}
+
+func (ms *mockSys) RepairPartitionTable(d disko.Disk) error {
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	if disk.Table != disko.GPT {
+		return fmt.Errorf("disk %s has no GPT to repair: %w", disk.Name, disko.ErrUnsupportedTable)
+	}
+
+	problems, err := disk.ProblemsAfterRepair()
+	if err != nil {
+		return err
+	}
+
+	// the repaired backup is at the end of the disk.
+	disk.GPT.LastUsableLBA = disk.RelocatedLastUsableLBA()
+	disk.TableProblems = problems
+	ms.Disks[d.Name] = disk
+
+	return nil
 }
 
+func (ms *mockSys) RestorePartitionTable(d disko.Disk, b disko.TableBackup) error {
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	if err := b.Check(disk); err != nil {
+		return err
+	}
+
+	disk, err := b.RestoredDisk(disk)
+	if err != nil {
+		return err
+	}
+
+	ms.Disks[d.Name] = disk
+
+	return nil
+}
+
+// The size of the partition entry array of a new GPT.
+const (
+	gptDefaultEntries   = 128
+	gptDefaultEntrySize = 128
+)
+
 func (ms *mockSys) Wipe(d disko.Disk) error {
-	// later mate
+	disk, ok := ms.Disks[d.Name]
+	if !ok {
+		return fmt.Errorf("%s: %w", d.Name, disko.ErrDiskNotFound)
+	}
+
+	disk.Partitions = disko.PartitionSet{}
+	disk.Table = disko.TableNone
+	disk.GPT = disko.GPTHeader{}
+	ms.Disks[d.Name] = disk
+
 	return nil
 }
@@ -1,6 +1,7 @@
 package mockos_test
 
 import (
+	"errors"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -14,9 +15,11 @@ func TestSystem(t *testing.T) {
 	myID, _ := disko.StringToGUID("01234567-89AB-CDEF-0123-456789ABCDEF")
 
 	Convey("testing System Model", t, func() {
-		So(func() { mockos.System("unknown") }, ShouldPanic)
+		_, err := mockos.System("unknown")
+		So(err, ShouldNotBeNil)
 
-		sys := mockos.System("testdata/model_sys.json")
+		sys, err := mockos.System("testdata/model_sys.json")
+		So(err, ShouldBeNil)
 		So(sys, ShouldNotBeNil)
 
 		Convey("Calling ScanAllDisks with no filter function should return all the disks", func() {
@@ -38,7 +41,7 @@ func TestSystem(t *testing.T) {
 
 		Convey("Calling ScanDisk on path that does not contain any disk should return error ", func() {
 			_, err := sys.ScanDisk("path/with/no/disk")
-			So(err, ShouldNotBeNil)
+			So(errors.Is(err, disko.ErrDiskNotFound), ShouldBeTrue)
 		})
 
 		Convey("Calling ScanDisk on dev/sda path should return the disk(s) with similar path", func() {
@@ -66,8 +69,8 @@ func TestSystem(t *testing.T) {
 				Name: "sda",
 			}
 			partition := disko.Partition{
-				Start:  0,
-				Last:   10000,
+				Start:  disko.Mebibyte,
+				Last:   2*disko.Mebibyte - 1,
 				ID:     myID,
 				Type:   partid.LinuxFS,
 				Name:   "sda1",
@@ -93,19 +96,35 @@ func TestSystem(t *testing.T) {
 				So(err, ShouldBeNil)
 
 				err = sys.DeletePartition(disk, 10)
-				So(err, ShouldBeError)
+				So(errors.Is(err, disko.ErrPartitionNotFound), ShouldBeTrue)
 
 				d, _ := sys.ScanDisk("/dev/sda")
 				So(len(d.Partitions), ShouldEqual, 0)
 
 				disk.Name = "crap"
 				err = sys.DeletePartition(disk, 1)
-				So(err, ShouldBeError)
+				So(errors.Is(err, disko.ErrDiskNotFound), ShouldBeTrue)
+			})
+
+			Convey("Calling CreatePartition out of the disk's range should return error", func() {
+				bad := partition
+				bad.Number = 2
+				bad.Start = 0
+
+				err := sys.CreatePartition(disk, bad)
+				So(errors.Is(err, disko.ErrOutOfRange), ShouldBeTrue)
+
+				d, _ := sys.ScanDisk("/dev/sda")
+				So(len(d.Partitions), ShouldEqual, 1)
 			})
 
 			Convey("Calling CreatePartition with an existing partition should return error", func() {
 				err := sys.CreatePartition(disk, partition)
-				So(err, ShouldNotBeNil)
+				So(errors.Is(err, disko.ErrPartitionExists), ShouldBeTrue)
+
+				var perr *disko.PartitionError
+				So(errors.As(err, &perr), ShouldBeTrue)
+				So(perr.Number, ShouldEqual, 1)
 			})
 		})
 
@@ -115,16 +134,16 @@ func TestSystem(t *testing.T) {
 			}
 			pSet := disko.PartitionSet{
 				1: disko.Partition{
-					Start:  0,
-					Last:   10000 - 1,
+					Start:  disko.Mebibyte,
+					Last:   2*disko.Mebibyte - 1,
 					ID:     myID,
 					Type:   partid.LinuxFS,
 					Name:   "sda1",
 					Number: 1,
 				},
 				2: disko.Partition{
-					Start:  10000,
-					Last:   20000 - 1,
+					Start:  2 * disko.Mebibyte,
+					Last:   3*disko.Mebibyte - 1,
 					ID:     myID,
 					Type:   partid.LinuxFS,
 					Name:   "sda2",
@@ -167,13 +186,174 @@ func TestSystem(t *testing.T) {
 			})
 		})
 
+		Convey("Calling UpdatePartition should keep attributes unless given", func() {
+			So(sys.CreatePartition(disko.Disk{Name: "sda"}, disko.Partition{
+				Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS, Number: 1,
+				Attributes: disko.AttrRequired}), ShouldBeNil)
+
+			d, _ := sys.ScanDisk("/dev/sda")
+			So(sys.UpdatePartition(d, disko.Partition{Number: 1, Name: "root"}), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.Partitions[1].Attributes, ShouldEqual, disko.AttrRequired)
+
+			So(sys.UpdatePartition(d, disko.Partition{Number: 1, Attributes: disko.AttrNoAuto}), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.Partitions[1].Attributes, ShouldEqual, disko.AttrNoAuto)
+			So(d.Partitions[1].Name, ShouldEqual, "root")
+
+			So(sys.SetPartitionAttributes(d, 1, 0), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.Partitions[1].Attributes, ShouldEqual, disko.PartAttrs(0))
+			So(d.Partitions[1].Name, ShouldEqual, "root")
+
+			err := sys.SetPartitionAttributes(d, 2, disko.AttrNoAuto)
+			So(errors.Is(err, disko.ErrPartitionNotFound), ShouldBeTrue)
+		})
+
+		Convey("The disk guid is set when the table is created and can be changed", func() {
+			myGUID := disko.GenGUID()
+			d := disko.Disk{Name: "sda", GPT: disko.GPTHeader{DiskGUID: myGUID}}
+
+			So(errors.Is(sys.SetDiskGUID(d, myGUID), disko.ErrUnsupportedTable), ShouldBeTrue)
+			So(sys.CreatePartition(d, disko.Partition{
+				Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS, Number: 1}), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.GPT.DiskGUID, ShouldEqual, myGUID)
+
+			newGUID := disko.GenGUID()
+			So(sys.SetDiskGUID(d, newGUID), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.GPT.DiskGUID, ShouldEqual, newGUID)
+		})
+
+		Convey("RelocateBackupGPT makes the space a grown disk gained usable", func() {
+			grown, err := mockos.System("testdata/grown_sys.json")
+			So(err, ShouldBeNil)
+
+			d, err := grown.ScanDisk("/dev/sdh")
+			So(err, ShouldBeNil)
+			So(d.TableProblems, ShouldHaveLength, 1)
+			So(d.FreeSpaces(), ShouldBeEmpty)
+
+			So(grown.RelocateBackupGPT(d), ShouldBeNil)
+
+			d, _ = grown.ScanDisk("/dev/sdh")
+			So(d.TableProblems, ShouldBeEmpty)
+			So(d.GPT.LastUsableLBA, ShouldEqual, d.Size/512-34)
+
+			p, err := disko.GrowPartitionToFill(grown, d, 1)
+			So(err, ShouldBeNil)
+			So(p.Last, ShouldEqual, d.Size-disko.Mebibyte-1)
+
+			err = sys.RelocateBackupGPT(disko.Disk{Name: "sda"})
+			So(errors.Is(err, disko.ErrUnsupportedTable), ShouldBeTrue)
+		})
+
+		Convey("GrowPartitionToFill relocates the backup GPT of a grown disk", func() {
+			grown, err := mockos.System("testdata/grown_sys.json")
+			So(err, ShouldBeNil)
+
+			d, err := grown.ScanDisk("/dev/sdh")
+			So(err, ShouldBeNil)
+
+			p, err := disko.GrowPartitionToFill(grown, d, 1)
+			So(err, ShouldBeNil)
+			So(p.Last, ShouldEqual, d.Size-disko.Mebibyte-1)
+
+			d, _ = grown.ScanDisk("/dev/sdh")
+			So(d.TableProblems, ShouldBeEmpty)
+			So(d.Partitions[1], ShouldResemble, p)
+		})
+
+		Convey("RepairPartitionTable fixes the problems of a disk's table", func() {
+			grown, err := mockos.System("testdata/grown_sys.json")
+			So(err, ShouldBeNil)
+
+			d, err := grown.ScanDisk("/dev/sdh")
+			So(err, ShouldBeNil)
+
+			So(grown.RepairPartitionTable(d), ShouldBeNil)
+
+			d, _ = grown.ScanDisk("/dev/sdh")
+			So(d.TableProblems, ShouldBeEmpty)
+			So(d.GPT.LastUsableLBA, ShouldEqual, d.Size/512-34)
+
+			err = sys.RepairPartitionTable(disko.Disk{Name: "sda"})
+			So(errors.Is(err, disko.ErrUnsupportedTable), ShouldBeTrue)
+		})
+
+		Convey("RestorePartitionTable puts back the table of a backup", func() {
+			myGUID := disko.GenGUID()
+			d, _ := sys.ScanDisk("/dev/sda")
+
+			head := make([]byte, 34*512)
+			head[0x1FE], head[0x1FF] = 0x55, 0xAA
+
+			backup := disko.TableBackup{
+				Disk: d.Path, Size: d.Size, SectorSize: 512, Table: disko.GPT, DiskGUID: myGUID.String(),
+				Partitions: disko.PartitionSet{1: {
+					Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS, Number: 1}},
+				Head: head,
+			}
+
+			So(sys.RestorePartitionTable(d, backup), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.Table, ShouldEqual, disko.GPT)
+			So(d.GPT.DiskGUID, ShouldEqual, myGUID)
+			So(d.Partitions, ShouldResemble, backup.Partitions)
+
+			backup.Size += disko.Mebibyte
+			err := sys.RestorePartitionTable(d, backup)
+			So(errors.Is(err, disko.ErrOutOfRange), ShouldBeTrue)
+		})
+
+		Convey("Calling ResizePartition should move the end of a partition", func() {
+			So(sys.CreatePartition(disko.Disk{Name: "sda"}, disko.Partition{
+				Start: disko.Mebibyte, Last: 100*disko.Mebibyte - 1, Type: partid.LinuxFS, Number: 1}), ShouldBeNil)
+
+			d, _ := sys.ScanDisk("/dev/sda")
+			So(sys.ResizePartition(d, 1, 50*disko.Mebibyte-1), ShouldBeNil)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.Partitions[1].Last, ShouldEqual, 50*disko.Mebibyte-1)
+
+			p, err := disko.GrowPartitionToFill(sys, d, 1)
+			So(err, ShouldBeNil)
+			So(p.Last, ShouldEqual, d.Size-disko.Mebibyte-1)
+
+			d, _ = sys.ScanDisk("/dev/sda")
+			So(d.Partitions[1], ShouldResemble, p)
+
+			_, err = disko.GrowPartitionToFill(sys, d, 1)
+			So(errors.Is(err, disko.ErrNoSpace), ShouldBeTrue)
+
+			err = sys.ResizePartition(d, 1, d.Size)
+			So(errors.Is(err, disko.ErrOutOfRange), ShouldBeTrue)
+
+			err = sys.ResizePartition(d, 2, d.Size)
+			So(errors.Is(err, disko.ErrPartitionNotFound), ShouldBeTrue)
+
+			So(sys.ResizePartition(d, 1, 10*disko.Mebibyte-1), ShouldBeNil)
+			So(sys.CreatePartition(d, disko.Partition{
+				Start: 20 * disko.Mebibyte, Last: 30*disko.Mebibyte - 1, Type: partid.LinuxFS, Number: 2}), ShouldBeNil)
+
+			err = sys.ResizePartition(d, 1, 25*disko.Mebibyte-1)
+			So(errors.Is(err, disko.ErrOverlap), ShouldBeTrue)
+		})
+
 		Convey("Calling CreatePartition on a disk not being track by system should return error", func() {
 			disk := disko.Disk{
 				Name: "invalid",
 			}
 			partition := disko.Partition{
-				Start:  0,
-				Last:   10000,
+				Start:  disko.Mebibyte,
+				Last:   2*disko.Mebibyte - 1,
 				ID:     myID,
 				Type:   partid.LinuxFS,
 				Name:   "partition1",
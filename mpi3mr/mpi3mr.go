@@ -1,8 +1,10 @@
 package mpi3mr
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 
 	"github.com/google/go-cmp/cmp"
 	"machinerun.io/disko"
@@ -31,6 +33,17 @@ func (vd *VirtualDrive) IsSSD() bool {
 	return true
 }
 
+// Identity - the identity of the virtual drive as the OS will see it.
+func (vd *VirtualDrive) Identity() disko.DiskIdentity {
+	id := disko.DiskIdentity{Serial: strings.TrimSpace(vd.Properties.SerialNumber)}
+
+	if naa := strings.ToLower(vd.Properties.SCSINAAId); naa != "" {
+		id.WWN = "0x" + naa
+	}
+
+	return id
+}
+
 // IsEqual - compare the two drives
 func (vd *VirtualDrive) IsEqual(vd2 VirtualDrive) bool {
 	return cmp.Equal(*vd, vd2)
@@ -67,9 +80,21 @@ type Mpi3mr interface {
 	// Query - Query the controller provided
 	Query(int) (Controller, error)
 
+	// QueryContext - Query with a context.Context that bounds the storcli2 calls
+	QueryContext(context.Context, int) (Controller, error)
+
 	// GetDiskType - Determine the disk type if controller owns disk
 	GetDiskType(string) (disko.DiskType, error)
 
+	// GetDiskTypeContext - GetDiskType with a context.Context that bounds the storcli2 calls
+	GetDiskTypeContext(context.Context, string) (disko.DiskType, error)
+
+	// GetDiskIdentity - Return the identity the controller reports for the disk
+	GetDiskIdentity(string) (disko.DiskIdentity, error)
+
+	// GetDiskIdentityContext - GetDiskIdentity with a context.Context that bounds the storcli2 calls
+	GetDiskIdentityContext(context.Context, string) (disko.DiskIdentity, error)
+
 	// DriverSysfsPath - Return the sysfs path to the linux driver for this controller
 	DriverSysfsPath() string
 
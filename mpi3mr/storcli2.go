@@ -2,13 +2,17 @@ package mpi3mr
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
 	"machinerun.io/disko"
 )
@@ -479,8 +483,8 @@ func parseShowOutput(showOutput []byte) ([]int, error) {
 	return cIDs, nil
 }
 
-func storcli2(args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command("storcli2", args...)
+func storcli2(ctx context.Context, args ...string) ([]byte, []byte, int) {
+	cmd := exec.CommandContext(ctx, "storcli2", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -505,16 +509,19 @@ func getCommandErrorRCDefault(err error, rcError int) int {
 	}
 
 	exitError, ok := err.(*exec.ExitError)
+	if !ok {
+		return rcError
+	}
 
 	exitRC := exitError.ExitCode()
 	if exitRC == StorCli2ShowRC {
 		return 0
 	}
-	if ok {
-		if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
-			return status.ExitStatus()
-		}
+
+	if status, ok := exitError.Sys().(syscall.WaitStatus); ok {
+		return status.ExitStatus()
 	}
+
 	return rcError
 }
 
@@ -539,6 +546,10 @@ const (
 )
 
 func (sc *storCli2) Query(cID int) (Controller, error) {
+	return sc.QueryContext(context.Background(), cID)
+}
+
+func (sc *storCli2) QueryContext(ctx context.Context, cID int) (Controller, error) {
 	// run /c0 show all nolog J
 	//   - get PDs and VDs in JSON format
 	// run /c0/vall show all nolog J
@@ -548,7 +559,11 @@ func (sc *storCli2) Query(cID int) (Controller, error) {
 
 	args := []string{fmt.Sprintf("/c%d", cID), "show", "nolog", "J"}
 
-	if stdout, stderr, rc = storcli2(args...); rc != 0 {
+	if stdout, stderr, rc = storcli2(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return Controller{}, err
+		}
+
 		var err error = ErrNoStor2cli
 		if rc != noStorCli2RC {
 			err = cmdError(args, stdout, stderr, rc)
@@ -560,7 +575,11 @@ func (sc *storCli2) Query(cID int) (Controller, error) {
 	cxShowNoLogJOut := stdout
 
 	args = []string{fmt.Sprintf("/c%d/vall", cID), "show", "all", "nolog", "J"}
-	if stdout, stderr, rc = storcli2(args...); rc != 0 {
+	if stdout, stderr, rc = storcli2(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return Controller{}, err
+		}
+
 		return Controller{}, cmdError(args, stdout, stderr, rc)
 	}
 
@@ -570,12 +589,20 @@ func (sc *storCli2) Query(cID int) (Controller, error) {
 }
 
 func (sc *storCli2) List() ([]int, error) {
+	return sc.listContext(context.Background())
+}
+
+func (sc *storCli2) listContext(ctx context.Context) ([]int, error) {
 	var stdout, stderr []byte
 	var rc int
 
 	args := []string{"show", "nolog", "J"}
 
-	if stdout, stderr, rc = storcli2(args...); rc != 0 {
+	if stdout, stderr, rc = storcli2(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return []int{}, err
+		}
+
 		var err error = ErrNoStor2cli
 		if rc != noStorCli2RC {
 			err = cmdError(args, stdout, stderr, rc)
@@ -597,15 +624,46 @@ func (sc *storCli2) DriverSysfsPath() string {
 }
 
 func (sc *storCli2) GetDiskType(path string) (disko.DiskType, error) {
-	cIDs, err := sc.List()
+	return sc.GetDiskTypeContext(context.Background(), path)
+}
+
+func (sc *storCli2) GetDiskTypeContext(ctx context.Context, path string) (disko.DiskType, error) {
+	return getDiskType(ctx, sc, path)
+}
+
+func (sc *storCli2) GetDiskIdentity(path string) (disko.DiskIdentity, error) {
+	return sc.GetDiskIdentityContext(context.Background(), path)
+}
+
+func (sc *storCli2) GetDiskIdentityContext(ctx context.Context, path string) (disko.DiskIdentity, error) {
+	return getDiskIdentity(ctx, sc, path)
+}
+
+// not implemented in driver layer
+func (sc *storCli2) IsSysPathRAID(syspath string) bool {
+	return false
+}
+
+// controllerQuerier is what disk lookups need from a storcli2.
+type controllerQuerier interface {
+	listContext(ctx context.Context) ([]int, error)
+	QueryContext(ctx context.Context, cID int) (Controller, error)
+}
+
+func getDiskType(ctx context.Context, sc controllerQuerier, path string) (disko.DiskType, error) {
+	cIDs, err := sc.listContext(ctx)
 	if err != nil {
-		return disko.HDD, errors.Errorf("failed to get controller list: %s", err)
+		return disko.HDD, errors.Wrap(err, "failed to get controller list")
 	}
 
 	errors := []error{}
 	for _, cID := range cIDs {
-		ctrl, err := sc.Query(cID)
+		ctrl, err := sc.QueryContext(ctx, cID)
 		if err != nil {
+			if ctx.Err() != nil {
+				return disko.HDD, err
+			}
+
 			errors = append(errors, fmt.Errorf("error while getting config for controller id:%d %s", cID, err))
 			continue
 		}
@@ -627,7 +685,135 @@ func (sc *storCli2) GetDiskType(path string) (disko.DiskType, error) {
 	return disko.HDD, fmt.Errorf("cannot determine diskt type for path %q", path)
 }
 
+func getDiskIdentity(ctx context.Context, sc controllerQuerier, path string) (disko.DiskIdentity, error) {
+	cIDs, err := sc.listContext(ctx)
+	if err != nil {
+		return disko.DiskIdentity{}, errors.Wrap(err, "failed to get controller list")
+	}
+
+	for _, cID := range cIDs {
+		ctrl, err := sc.QueryContext(ctx, cID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return disko.DiskIdentity{}, err
+			}
+
+			continue
+		}
+
+		for _, vDev := range ctrl.VirtualDrives {
+			if vDev.Path() == path {
+				return vDev.Identity(), nil
+			}
+		}
+	}
+
+	return disko.DiskIdentity{}, fmt.Errorf("no virtual drive for %s", path)
+}
+
+type cachingStorCli2 struct {
+	sc    controllerQuerier
+	cache *cache.Cache
+
+	// mutex makes concurrent queries that miss the cache wait for the one
+	// that is running storcli2 instead of all running it.
+	mutex sync.Mutex
+}
+
+// CachingStorCli2 - just a cache for a storcli2 Mpi3mr
+func CachingStorCli2() Mpi3mr {
+	const longTime = 5 * time.Minute
+
+	return &cachingStorCli2{
+		sc:    &storCli2{},
+		cache: cache.New(longTime, longTime),
+	}
+}
+
+func (csc *cachingStorCli2) Query(cID int) (Controller, error) {
+	return csc.QueryContext(context.Background(), cID)
+}
+
+func (csc *cachingStorCli2) QueryContext(ctx context.Context, cID int) (Controller, error) {
+	type qresult struct {
+		ctrl Controller
+		err  error
+	}
+
+	cacheName := fmt.Sprintf("query-%d", cID)
+
+	csc.mutex.Lock()
+	defer csc.mutex.Unlock()
+
+	cached, found := csc.cache.Get(cacheName)
+
+	if found {
+		ret := cached.(qresult)
+		return ret.ctrl, ret.err
+	}
+
+	ctrl, err := csc.sc.QueryContext(ctx, cID)
+
+	// An interrupted query says nothing about the controller.
+	if ctx.Err() == nil {
+		csc.cache.Set(cacheName, qresult{ctrl: ctrl, err: err}, cache.DefaultExpiration)
+	}
+
+	return ctrl, err
+}
+
+func (csc *cachingStorCli2) List() ([]int, error) {
+	return csc.listContext(context.Background())
+}
+
+func (csc *cachingStorCli2) listContext(ctx context.Context) ([]int, error) {
+	type lresult struct {
+		cIDs []int
+		err  error
+	}
+
+	const cacheName = "list"
+
+	csc.mutex.Lock()
+	defer csc.mutex.Unlock()
+
+	cached, found := csc.cache.Get(cacheName)
+
+	if found {
+		ret := cached.(lresult)
+		return ret.cIDs, ret.err
+	}
+
+	cIDs, err := csc.sc.listContext(ctx)
+
+	if ctx.Err() == nil {
+		csc.cache.Set(cacheName, lresult{cIDs: cIDs, err: err}, cache.DefaultExpiration)
+	}
+
+	return cIDs, err
+}
+
+func (csc *cachingStorCli2) DriverSysfsPath() string {
+	return SysfsPCIDriversPath
+}
+
+func (csc *cachingStorCli2) GetDiskType(path string) (disko.DiskType, error) {
+	return csc.GetDiskTypeContext(context.Background(), path)
+}
+
+func (csc *cachingStorCli2) GetDiskTypeContext(ctx context.Context, path string) (disko.DiskType, error) {
+	return getDiskType(ctx, csc, path)
+}
+
+func (csc *cachingStorCli2) GetDiskIdentity(path string) (disko.DiskIdentity, error) {
+	return csc.GetDiskIdentityContext(context.Background(), path)
+}
+
+func (csc *cachingStorCli2) GetDiskIdentityContext(ctx context.Context, path string) (disko.DiskIdentity, error) {
+	return getDiskIdentity(ctx, csc, path)
+}
+
 // not implemented in driver layer
-func (sc *storCli2) IsSysPathRAID(syspath string) bool {
+func (csc *cachingStorCli2) IsSysPathRAID(syspath string) bool {
 	return false
 }
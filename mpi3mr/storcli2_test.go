@@ -1,10 +1,17 @@
 package mpi3mr
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/patrickmn/go-cache"
 )
 
 var showNoLogJData = `
@@ -416,6 +423,32 @@ func TestStorCli2NewController(t *testing.T) {
 	}
 }
 
+func TestVirtualDriveIdentity(t *testing.T) {
+	ctrl, err := newController(0, []byte(showC0ShowNoLogJData), []byte(testc0VAllShowAllJOut))
+	if err != nil {
+		t.Fatalf("failed to create new controller")
+	}
+
+	for _, vd := range ctrl.VirtualDrives {
+		if vd.Path() != "/dev/sdg" {
+			continue
+		}
+
+		id := vd.Identity()
+		if id.WWN != "0x62cf89bd43a7af80679aa6b751349581" {
+			t.Errorf("unexpected WWN %q", id.WWN)
+		}
+
+		if id.Serial != "0081953451b7a69a6780afa743bd89cf" {
+			t.Errorf("unexpected Serial %q", id.Serial)
+		}
+
+		return
+	}
+
+	t.Errorf("no virtual drive for /dev/sdg")
+}
+
 var pdForeignData = `
 {
   "EID:Slt": "322:5",
@@ -446,3 +479,99 @@ func TestStorCli2ParsePhysicalDriveForeign(t *testing.T) {
 	}
 
 }
+
+func TestQueryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := StorCli2().QueryContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if _, err := StorCli2().GetDiskTypeContext(ctx, "/dev/sda"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCachingQueryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	csc := CachingStorCli2()
+
+	if _, err := csc.QueryContext(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// the interrupted query must not be cached.
+	if _, found := csc.(*cachingStorCli2).cache.Get("query-0"); found {
+		t.Errorf("interrupted query result was cached")
+	}
+
+	if _, err := csc.GetDiskIdentityContext(ctx, "/dev/sda"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if _, found := csc.(*cachingStorCli2).cache.Get("list"); found {
+		t.Errorf("interrupted list result was cached")
+	}
+}
+
+// countingStorCli2 is a storcli2 with two controllers whose lists and
+// queries take a while and are counted.
+type countingStorCli2 struct {
+	lists   int32
+	queries int32
+}
+
+func (c *countingStorCli2) listContext(ctx context.Context) ([]int, error) {
+	atomic.AddInt32(&c.lists, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return []int{0, 1}, nil
+}
+
+func (c *countingStorCli2) QueryContext(ctx context.Context, cID int) (Controller, error) {
+	atomic.AddInt32(&c.queries, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	vd := VirtualDrive{DGVD: fmt.Sprintf("%d/0", cID)}
+	vd.Properties.OSDriveName = fmt.Sprintf("/dev/sd%c", 'a'+cID)
+	vd.Properties.SerialNumber = fmt.Sprintf("serial%d", cID)
+
+	return Controller{ID: cID, VirtualDrives: VirtualDriveSet{vd.ID(): vd}}, nil
+}
+
+func TestCachingStorCli2Concurrent(t *testing.T) {
+	sc := &countingStorCli2{}
+	csc := &cachingStorCli2{sc: sc, cache: cache.New(time.Minute, time.Minute)}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			path := fmt.Sprintf("/dev/sd%c", 'a'+i%2)
+
+			id, err := csc.GetDiskIdentity(path)
+			if err != nil {
+				t.Errorf("GetDiskIdentity(%s) failed: %s", path, err)
+			} else if expected := fmt.Sprintf("serial%d", i%2); id.Serial != expected {
+				t.Errorf("GetDiskIdentity(%s) serial %q, expected %q", path, id.Serial, expected)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&sc.lists); n != 1 {
+		t.Errorf("expected 1 storcli2 list for 10 concurrent callers, got %d", n)
+	}
+
+	if n := atomic.LoadInt32(&sc.queries); n != 2 {
+		t.Errorf("expected 2 storcli2 queries for 10 concurrent callers, got %d", n)
+	}
+}
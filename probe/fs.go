@@ -0,0 +1,234 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"machinerun.io/disko"
+)
+
+// ext2/3/4 superblock.
+const (
+	extSuperOffset = 1024
+	extSuperSize   = 256
+	extMagic       = 0xef53
+
+	extCompatHasJournal = 0x4
+
+	// extents, 64bit, mmp and flex_bg.
+	ext4Incompat = 0x40 | 0x80 | 0x100 | 0x200
+
+	// huge_file, gdt_csum, dir_nlink, extra_isize and metadata_csum.
+	ext4ROCompat = 0x8 | 0x10 | 0x20 | 0x40 | 0x400
+)
+
+func probeExt(dev device) (disko.Signature, error) {
+	sb, err := dev.read(extSuperOffset, extSuperSize)
+	if sb == nil || le16(sb[0x38:]) != extMagic {
+		return disko.Signature{}, err
+	}
+
+	fsType := Ext2
+
+	switch {
+	case le32(sb[0x60:])&ext4Incompat != 0 || le32(sb[0x64:])&ext4ROCompat != 0:
+		fsType = Ext4
+	case le32(sb[0x5c:])&extCompatHasJournal != 0:
+		fsType = Ext3
+	}
+
+	return disko.Signature{
+		Type:    fsType,
+		Label:   cstring(sb[0x78:0x88]),
+		UUID:    formatUUID(sb[0x68:0x78]),
+		Version: fmt.Sprintf("%d.%d", le32(sb[0x4c:]), le16(sb[0x3e:])),
+	}, nil
+}
+
+// xfs superblock, which is big endian.
+const (
+	xfsSuperSize   = 120
+	xfsMagic       = "XFSB"
+	xfsVersionMask = 0xf
+)
+
+func probeXFS(dev device) (disko.Signature, error) {
+	sb, err := dev.read(0, xfsSuperSize)
+	if sb == nil || string(sb[0:4]) != xfsMagic {
+		return disko.Signature{}, err
+	}
+
+	return disko.Signature{
+		Type:    XFS,
+		Label:   cstring(sb[108:120]),
+		UUID:    formatUUID(sb[32:48]),
+		Version: fmt.Sprintf("%d", be16(sb[100:])&xfsVersionMask),
+	}, nil
+}
+
+// btrfs superblock.
+const (
+	btrfsSuperOffset = 64 * 1024
+	btrfsSuperSize   = 0x22b
+	btrfsMagic       = "_BHRfS_M"
+)
+
+func probeBtrfs(dev device) (disko.Signature, error) {
+	sb, err := dev.read(btrfsSuperOffset, btrfsSuperSize)
+	if sb == nil || string(sb[0x40:0x48]) != btrfsMagic {
+		return disko.Signature{}, err
+	}
+
+	return disko.Signature{
+		Type:  Btrfs,
+		Label: cstring(sb[0x12b:0x22b]),
+		UUID:  formatUUID(sb[0x20:0x30]),
+	}, nil
+}
+
+// squashfs superblock.
+const (
+	squashfsSuperSize = 96
+	squashfsMagic     = "hsqs"
+)
+
+func probeSquashfs(dev device) (disko.Signature, error) {
+	sb, err := dev.read(0, squashfsSuperSize)
+	if sb == nil || string(sb[0:4]) != squashfsMagic {
+		return disko.Signature{}, err
+	}
+
+	return disko.Signature{
+		Type:    Squashfs,
+		Version: fmt.Sprintf("%d.%d", le16(sb[28:]), le16(sb[30:])),
+	}, nil
+}
+
+// iso9660 primary volume descriptor.
+const (
+	isoPVDOffset = 16 * 2048
+	isoPVDSize   = 2048
+	isoMagic     = "CD001"
+	isoPVDType   = 1
+)
+
+func probeISO9660(dev device) (disko.Signature, error) {
+	pvd, err := dev.read(isoPVDOffset, isoPVDSize)
+	if pvd == nil || pvd[0] != isoPVDType || string(pvd[1:6]) != isoMagic {
+		return disko.Signature{}, err
+	}
+
+	return disko.Signature{
+		Type:  ISO9660,
+		Label: padded(pvd[40:72]),
+		UUID:  isoDateUUID(pvd[813:829]),
+	}, nil
+}
+
+// isoDateUUID returns the "UUID" blkid gives an iso9660 filesystem: its
+// creation time ("YYYYMMDDHHMMSScc") as "YYYY-MM-DD-HH-MM-SS-cc".  It is ""
+// if the time is not set.
+func isoDateUUID(date []byte) string {
+	if strings.Trim(string(date), "0\x00 ") == "" {
+		return ""
+	}
+
+	d := string(date)
+
+	return strings.Join([]string{d[0:4], d[4:6], d[6:8], d[8:10], d[10:12], d[12:14], d[14:16]}, "-")
+}
+
+// swap header.  The magic is at the end of the first page, whose size
+// depends on the system that made it.
+const (
+	swapHeaderOffset = 1024
+	swapHeaderSize   = 44
+	swapMagicSize    = 10
+	swapMagic1       = "SWAPSPACE2"
+	swapMagic0       = "SWAP-SPACE"
+)
+
+func probeSwap(dev device) (disko.Signature, error) {
+	for _, pageSize := range []uint64{4096, 8192, 16384, 32768, 65536} {
+		magic, err := dev.read(pageSize-swapMagicSize, swapMagicSize)
+		if magic == nil {
+			return disko.Signature{}, err
+		}
+
+		switch string(magic) {
+		case swapMagic0:
+			return disko.Signature{Type: Swap, Version: "0"}, nil
+		case swapMagic1:
+			hdr, err := dev.read(swapHeaderOffset, swapHeaderSize)
+			if hdr == nil {
+				return disko.Signature{}, err
+			}
+
+			return disko.Signature{
+				Type:    Swap,
+				Label:   cstring(hdr[28:44]),
+				UUID:    formatUUID(hdr[12:28]),
+				Version: fmt.Sprintf("%d", le32(hdr[0:])),
+			}, nil
+		}
+	}
+
+	return disko.Signature{}, nil
+}
+
+// FAT boot sector.
+const (
+	fatBootSize    = 512
+	fatNoName      = "NO NAME"
+	fatMaxSector   = 4096
+	fatMinSector   = 512
+	fatSerialShift = 16
+)
+
+func probeVFAT(dev device) (disko.Signature, error) {
+	bs, err := dev.read(0, fatBootSize)
+	if bs == nil {
+		return disko.Signature{}, err
+	}
+
+	sectorSize := le16(bs[11:])
+	perCluster := bs[13]
+
+	if sectorSize < fatMinSector || sectorSize > fatMaxSector || sectorSize&(sectorSize-1) != 0 ||
+		perCluster == 0 || perCluster&(perCluster-1) != 0 || bs[16] == 0 {
+		return disko.Signature{}, nil
+	}
+
+	// FAT32 has a longer BIOS parameter block than FAT12 and FAT16, and the
+	// extended boot record follows it.
+	var ebr []byte
+
+	version := ""
+
+	switch {
+	case bytes.Equal(bs[0x52:0x5a], []byte("FAT32   ")):
+		ebr, version = bs[0x40:], "FAT32"
+	case bytes.Equal(bs[0x36:0x3b], []byte("FAT12")), bytes.Equal(bs[0x36:0x3b], []byte("FAT16")):
+		ebr, version = bs[0x24:], string(bs[0x36:0x3b])
+	case bytes.Equal(bs[0x36:0x3e], []byte("FAT     ")):
+		ebr = bs[0x24:]
+	default:
+		return disko.Signature{}, nil
+	}
+
+	label := padded(ebr[7:18])
+	if label == fatNoName {
+		label = ""
+	}
+
+	serial := binary.LittleEndian.Uint32(ebr[3:])
+
+	return disko.Signature{
+		Type:    VFAT,
+		Label:   label,
+		UUID:    fmt.Sprintf("%04X-%04X", serial>>fatSerialShift, serial&0xffff),
+		Version: version,
+	}, nil
+}
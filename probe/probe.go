@@ -0,0 +1,124 @@
+// Package probe identifies what a disk or partition contains by reading
+// the superblocks and labels of the formats it knows, much as blkid does,
+// but without running anything.  It works on anything that can be read at
+// an offset: block devices, partitions of them and image files.
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"machinerun.io/disko"
+)
+
+// The types of signatures that are found.  They are the names blkid uses.
+const (
+	Ext2     = "ext2"
+	Ext3     = "ext3"
+	Ext4     = "ext4"
+	XFS      = "xfs"
+	Btrfs    = "btrfs"
+	VFAT     = "vfat"
+	Swap     = "swap"
+	LUKS     = "crypto_LUKS"
+	LVM2     = "LVM2_member"
+	MDRaid   = "linux_raid_member"
+	ZFS      = "zfs_member"
+	ISO9660  = "iso9660"
+	Squashfs = "squashfs"
+)
+
+// prober looks for one kind of signature on dev.  It returns an empty
+// Signature if it is not there.
+type prober func(dev device) (disko.Signature, error)
+
+// probers are tried in order, and the first signature found is the one
+// returned.  RAID members, encrypted volumes and LVM PVs come first as they
+// may hide a filesystem inside them.  The FAT boot sector has the weakest
+// check and comes last.
+//
+//nolint:gochecknoglobals
+var probers = []prober{
+	probeMDRaid, probeLUKS, probeLVM2, probeXFS, probeExt, probeBtrfs,
+	probeSquashfs, probeISO9660, probeZFS, probeSwap, probeVFAT,
+}
+
+// Probe returns the signature of what r, a device or image of size bytes,
+// contains.  It returns an empty Signature if nothing known is found, and
+// an error only if r could not be read.
+func Probe(r io.ReaderAt, size uint64) (disko.Signature, error) {
+	dev := device{r: r, size: size}
+
+	for _, p := range probers {
+		sig, err := p(dev)
+		if err != nil || !sig.IsEmpty() {
+			return sig, err
+		}
+	}
+
+	return disko.Signature{}, nil
+}
+
+// device is what is probed.
+type device struct {
+	r    io.ReaderAt
+	size uint64
+}
+
+// read returns the n bytes at off, or nil if they are not all on the device.
+func (d device) read(off, n uint64) ([]byte, error) {
+	if off > d.size || n > d.size-off {
+		return nil, nil
+	}
+
+	buf := make([]byte, n)
+
+	if _, err := d.r.ReadAt(buf, int64(off)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("read %d bytes at %d: %w", n, off, err)
+	}
+
+	return buf, nil
+}
+
+// cstring returns b up to the first NUL.
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+// padded returns b without the NULs and spaces it is padded with.
+func padded(b []byte) string {
+	return string(bytes.TrimRight(b, " \x00"))
+}
+
+// formatUUID returns the 16 bytes of b as a UUID string, or "" if they are
+// all zero.
+func formatUUID(b []byte) string {
+	if bytes.Equal(b[:16], make([]byte, 16)) {
+		return ""
+	}
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func le16(b []byte) uint16 {
+	return binary.LittleEndian.Uint16(b)
+}
+
+func le32(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b)
+}
+
+func be16(b []byte) uint16 {
+	return binary.BigEndian.Uint16(b)
+}
@@ -0,0 +1,178 @@
+package probe_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"machinerun.io/disko"
+	"machinerun.io/disko/probe"
+)
+
+const testUUID = "\x01\x23\x45\x67\x89\xab\xcd\xef\x01\x23\x45\x67\x89\xab\xcd\xef"
+
+const testUUIDString = "01234567-89ab-cdef-0123-456789abcdef"
+
+// image is a zeroed device image with the given data put at offsets.
+func image(size int, puts ...interface{}) []byte {
+	img := make([]byte, size)
+
+	for i := 0; i < len(puts); i += 2 {
+		off := puts[i].(int)
+
+		switch v := puts[i+1].(type) {
+		case string:
+			copy(img[off:], v)
+		case []byte:
+			copy(img[off:], v)
+		case uint16:
+			binary.LittleEndian.PutUint16(img[off:], v)
+		case uint32:
+			binary.LittleEndian.PutUint32(img[off:], v)
+		case uint64:
+			binary.LittleEndian.PutUint64(img[off:], v)
+		}
+	}
+
+	return img
+}
+
+func be16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func be32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func be64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// nvPair is an XDR encoded nvlist pair with one element.
+func nvPair(name string, dataType uint32, value []byte) []byte {
+	padded := append([]byte(name), make([]byte, (4-len(name)%4)%4)...)
+	body := append(append(be32(uint32(len(name))), padded...), be32(dataType)...)
+	body = append(append(body, be32(1)...), value...)
+
+	return append(append(be32(uint32(len(body)+8)), be32(0)...), body...)
+}
+
+func nvString(name, value string) []byte {
+	padded := append([]byte(value), make([]byte, (4-len(value)%4)%4)...)
+	return nvPair(name, 9, append(be32(uint32(len(value))), padded...))
+}
+
+func nvUint64(name string, value uint64) []byte {
+	return nvPair(name, 8, be64(value))
+}
+
+//nolint:funlen
+func TestProbe(t *testing.T) {
+	const mib = 1024 * 1024
+
+	ext4 := image(mib,
+		1024+0x38, uint16(0xef53), 1024+0x4c, uint32(1), 1024+0x60, uint32(0x2c2),
+		1024+0x68, testUUID, 1024+0x78, "rootfs")
+	ext3 := image(mib, 1024+0x38, uint16(0xef53), 1024+0x5c, uint32(0x4))
+	ext2 := image(mib, 1024+0x38, uint16(0xef53))
+
+	xfs := image(mib, 0, "XFSB", 32, testUUID, 100, be16(0xb4a5), 108, "data")
+	btrfs := image(mib, 0x10000+0x40, "_BHRfS_M", 0x10000+0x20, testUUID, 0x10000+0x12b, "pool")
+	squashfs := image(mib, 0, "hsqs", 28, uint16(4), 30, uint16(0))
+	iso := image(mib, 0x8000, []byte{1}, 0x8001, "CD001", 0x8000+40, "UBUNTU 24.04                    ",
+		0x8000+813, "2024042512000000")
+
+	swap := image(mib, 4096-10, "SWAPSPACE2", 1024, uint32(1), 1024+12, testUUID, 1024+28, "swappy")
+	swap64k := image(mib, 65536-10, "SWAPSPACE2", 1024, uint32(1))
+
+	fat32 := image(mib, 11, uint16(512), 13, []byte{8}, 16, []byte{2},
+		0x43, uint32(0x1234abcd), 0x47, "EFI        ", 0x52, "FAT32   ", 510, []byte{0x55, 0xaa})
+	fat16 := image(mib, 11, uint16(512), 13, []byte{4}, 16, []byte{2},
+		0x27, uint32(0xdeadbeef), 0x2b, "NO NAME    ", 0x36, "FAT16   ")
+
+	luks1 := image(mib, 0, "LUKS\xba\xbe", 6, be16(1), 168, testUUIDString)
+	luks2 := image(mib, 0, "LUKS\xba\xbe", 6, be16(2), 24, "secret", 168, testUUIDString)
+
+	lvm := image(mib, 512, "LABELONE", 512+8, uint64(1), 512+20, uint32(32), 512+24, "LVM2 001",
+		512+32, "abcdefghijklmnopqrstuvwxyzABCDEF")
+
+	// data_offset at 128 is where the data starts, super_offset at 144 is
+	// where the superblock is.
+	md12 := image(mib, 4096, uint32(0xa92b4efc), 4096+4, uint32(1), 4096+16, testUUID, 4096+32, "host:0",
+		4096+128, uint64(1024), 4096+144, uint64(8))
+	md10 := image(mib, mib-16*512, uint32(0xa92b4efc), mib-16*512+4, uint32(1), mib-16*512+16, testUUID,
+		mib-16*512+128, uint64(0), mib-16*512+144, uint64(mib/512-16))
+	md090 := image(mib, mib-65536, uint32(0xa92b4efc), mib-65536+8, uint32(90),
+		mib-65536+20, testUUID[0:4], mib-65536+52, testUUID[4:])
+
+	nvlist := append([]byte{1, 1, 0, 0}, append(be32(0), be32(1)...)...)
+	nvlist = append(nvlist, nvUint64("version", 5000)...)
+	nvlist = append(nvlist, nvString("name", "tank")...)
+	nvlist = append(nvlist, nvPair("vdev_tree", 19, make([]byte, 24))...)
+	nvlist = append(nvlist, nvUint64("pool_guid", 1234567890123)...)
+	nvlist = append(nvlist, be32(0)...)
+	zfs := image(mib, 16*1024, nvlist, 128*1024+3*1024, uint64(0x00bab10c))
+
+	values := []struct {
+		name     string
+		img      []byte
+		expected disko.Signature
+	}{
+		{"ext4", ext4, disko.Signature{Type: probe.Ext4, Label: "rootfs", UUID: testUUIDString, Version: "1.0"}},
+		{"ext3", ext3, disko.Signature{Type: probe.Ext3, Version: "0.0"}},
+		{"ext2", ext2, disko.Signature{Type: probe.Ext2, Version: "0.0"}},
+		{"xfs", xfs, disko.Signature{Type: probe.XFS, Label: "data", UUID: testUUIDString, Version: "5"}},
+		{"btrfs", btrfs, disko.Signature{Type: probe.Btrfs, Label: "pool", UUID: testUUIDString}},
+		{"squashfs", squashfs, disko.Signature{Type: probe.Squashfs, Version: "4.0"}},
+		{"iso9660", iso, disko.Signature{Type: probe.ISO9660, Label: "UBUNTU 24.04",
+			UUID: "2024-04-25-12-00-00-00"}},
+		{"swap", swap, disko.Signature{Type: probe.Swap, Label: "swappy", UUID: testUUIDString, Version: "1"}},
+		{"swap64k", swap64k, disko.Signature{Type: probe.Swap, Version: "1"}},
+		{"fat32", fat32, disko.Signature{Type: probe.VFAT, Label: "EFI", UUID: "1234-ABCD", Version: "FAT32"}},
+		{"fat16", fat16, disko.Signature{Type: probe.VFAT, UUID: "DEAD-BEEF", Version: "FAT16"}},
+		{"luks1", luks1, disko.Signature{Type: probe.LUKS, UUID: testUUIDString, Version: "1"}},
+		{"luks2", luks2, disko.Signature{Type: probe.LUKS, Label: "secret", UUID: testUUIDString, Version: "2"}},
+		{"lvm2", lvm, disko.Signature{Type: probe.LVM2, UUID: "abcdef-ghij-klmn-opqr-stuv-wxyz-ABCDEF",
+			Version: "LVM2 001"}},
+		{"md1.2", md12, disko.Signature{Type: probe.MDRaid, Label: "host:0", UUID: testUUIDString, Version: "1.2"}},
+		{"md1.0", md10, disko.Signature{Type: probe.MDRaid, UUID: testUUIDString, Version: "1.0"}},
+		{"md0.90", md090, disko.Signature{Type: probe.MDRaid, UUID: testUUIDString, Version: "0.90.0"}},
+		{"zfs", zfs, disko.Signature{Type: probe.ZFS, Label: "tank", UUID: "1234567890123", Version: "5000"}},
+		{"empty", make([]byte, mib), disko.Signature{}},
+		{"tiny", make([]byte, 100), disko.Signature{}},
+	}
+
+	for _, v := range values {
+		found, err := probe.Probe(bytes.NewReader(v.img), uint64(len(v.img)))
+		if assert.NoError(t, err, v.name) {
+			assert.Equal(t, v.expected, found, v.name)
+		}
+	}
+}
+
+// A RAID member that also looks like a filesystem is a RAID member.
+func TestProbeOrder(t *testing.T) {
+	img := image(1024*1024, 0, "XFSB", 4096, uint32(0xa92b4efc), 4096+4, uint32(1),
+		4096+128, uint64(1024), 4096+144, uint64(8))
+
+	found, err := probe.Probe(bytes.NewReader(img), uint64(len(img)))
+	if assert.NoError(t, err) {
+		assert.Equal(t, probe.MDRaid, found.Type)
+	}
+}
+
+type failReader struct{}
+
+var errFail = errors.New("medium error")
+
+func (failReader) ReadAt([]byte, int64) (int, error) {
+	return 0, errFail
+}
+
+func TestProbeReadError(t *testing.T) {
+	_, err := probe.Probe(failReader{}, 1024*1024)
+	assert.ErrorIs(t, err, errFail)
+}
@@ -0,0 +1,136 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"machinerun.io/disko"
+)
+
+// md RAID superblocks.  Version 0.90 and 1.0 are at the end of the device,
+// 1.1 at the start and 1.2 4KiB from the start.
+const (
+	mdSuperSize   = 256
+	mdMagic       = 0xa92b4efc
+	mdSuperOffset = 144
+	md090Align    = 64 * 1024
+	md1EndSectors = 16
+	md1Offset12   = 4096
+	sectorSize    = 512
+)
+
+func probeMDRaid(dev device) (disko.Signature, error) {
+	type location struct {
+		offset uint64
+		minor  int
+	}
+
+	locations := []location{{0, 1}, {md1Offset12, 2}}
+	if sectors := dev.size / sectorSize; sectors > md1EndSectors {
+		locations = append(locations, location{((sectors - md1EndSectors) &^ 7) * sectorSize, 0})
+	}
+
+	for _, loc := range locations {
+		sb, err := dev.read(loc.offset, mdSuperSize)
+		if err != nil {
+			return disko.Signature{}, err
+		}
+
+		// super_offset is where the superblock says it is.
+		if sb == nil || le32(sb[0:]) != mdMagic || le32(sb[4:]) != 1 ||
+			binary.LittleEndian.Uint64(sb[mdSuperOffset:]) != loc.offset/sectorSize {
+			continue
+		}
+
+		return disko.Signature{
+			Type:    MDRaid,
+			Label:   cstring(sb[32:64]),
+			UUID:    formatUUID(sb[16:32]),
+			Version: fmt.Sprintf("1.%d", loc.minor),
+		}, nil
+	}
+
+	if dev.size < 2*md090Align {
+		return disko.Signature{}, nil
+	}
+
+	sb, err := dev.read(dev.size&^(md090Align-1)-md090Align, mdSuperSize)
+	if sb == nil || le32(sb[0:]) != mdMagic || le32(sb[4:]) != 0 {
+		return disko.Signature{}, err
+	}
+
+	// The first word of the uuid is apart from the other three.
+	uuid := append(append([]byte{}, sb[20:24]...), sb[52:64]...)
+
+	return disko.Signature{
+		Type:    MDRaid,
+		UUID:    formatUUID(uuid),
+		Version: fmt.Sprintf("%d.%02d.%d", le32(sb[4:]), le32(sb[8:]), le32(sb[12:])),
+	}, nil
+}
+
+// LUKS header.  LUKS2 has a label, LUKS1 does not.
+const (
+	luksHeaderSize = 208
+	luksMagic      = "LUKS\xba\xbe"
+)
+
+func probeLUKS(dev device) (disko.Signature, error) {
+	hdr, err := dev.read(0, luksHeaderSize)
+	if hdr == nil || string(hdr[0:6]) != luksMagic {
+		return disko.Signature{}, err
+	}
+
+	sig := disko.Signature{
+		Type:    LUKS,
+		UUID:    cstring(hdr[168:208]),
+		Version: fmt.Sprintf("%d", be16(hdr[6:])),
+	}
+
+	if be16(hdr[6:]) != 1 {
+		sig.Label = cstring(hdr[24:72])
+	}
+
+	return sig, nil
+}
+
+// LVM2 physical volume label.  It is in one of the first four sectors and
+// points at the PV header, which starts with the PV uuid.
+const (
+	lvmLabelSectors = 4
+	lvmLabelID      = "LABELONE"
+	lvmLabelType    = "LVM2 001"
+	lvmUUIDLen      = 32
+)
+
+func probeLVM2(dev device) (disko.Signature, error) {
+	for n := uint64(0); n < lvmLabelSectors; n++ {
+		label, err := dev.read(n*sectorSize, sectorSize)
+		if label == nil {
+			return disko.Signature{}, err
+		}
+
+		if string(label[0:8]) != lvmLabelID || string(label[24:32]) != lvmLabelType {
+			continue
+		}
+
+		offset := uint64(le32(label[20:]))
+		if offset+lvmUUIDLen > sectorSize {
+			continue
+		}
+
+		return disko.Signature{
+			Type:    LVM2,
+			UUID:    formatLVMUUID(string(label[offset : offset+lvmUUIDLen])),
+			Version: string(label[24:32]),
+		}, nil
+	}
+
+	return disko.Signature{}, nil
+}
+
+// formatLVMUUID returns the 32 characters of an LVM uuid with the dashes
+// LVM shows them with: 6-4-4-4-4-4-6.
+func formatLVMUUID(id string) string {
+	return fmt.Sprintf("%s-%s-%s-%s-%s-%s-%s", id[0:6], id[6:10], id[10:14], id[14:18], id[18:22], id[22:26], id[26:32])
+}
@@ -0,0 +1,128 @@
+package probe
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"machinerun.io/disko"
+)
+
+// ZFS vdev label.  The first of the four labels is at the start of the
+// device.  It has the pool configuration as an XDR encoded nvlist at 16KiB
+// and an array of uberblocks at 128KiB.
+const (
+	zfsNVListOffset    = 16 * 1024
+	zfsNVListSize      = 112 * 1024
+	zfsUberOffset      = 128 * 1024
+	zfsUberSlot        = 1024
+	zfsUberSlots       = 128
+	zfsUberMagic       = 0x00bab10c
+	zfsEncodingXDR     = 1
+	zfsNVListHeaderLen = 12
+
+	nvTypeUint64 = 8
+	nvTypeString = 9
+)
+
+func probeZFS(dev device) (disko.Signature, error) {
+	ubers, err := dev.read(zfsUberOffset, zfsUberSlot*zfsUberSlots)
+	if ubers == nil {
+		return disko.Signature{}, err
+	}
+
+	found := false
+
+	for i := 0; i < zfsUberSlots && !found; i++ {
+		slot := ubers[i*zfsUberSlot:]
+		found = binary.LittleEndian.Uint64(slot) == zfsUberMagic || binary.BigEndian.Uint64(slot) == zfsUberMagic
+	}
+
+	if !found {
+		return disko.Signature{}, nil
+	}
+
+	nvlist, err := dev.read(zfsNVListOffset, zfsNVListSize)
+	if err != nil {
+		return disko.Signature{}, err
+	}
+
+	sig := disko.Signature{Type: ZFS}
+	strs, nums := readNVList(nvlist)
+
+	sig.Label = strs["name"]
+
+	if guid, ok := nums["pool_guid"]; ok {
+		sig.UUID = fmt.Sprintf("%d", guid)
+	}
+
+	if version, ok := nums["version"]; ok {
+		sig.Version = fmt.Sprintf("%d", version)
+	}
+
+	return sig, nil
+}
+
+// readNVList returns the string and uint64 pairs at the top level of an
+// XDR encoded nvlist.  Other pairs are skipped.  A damaged list gives the
+// pairs before the damage.
+//
+// The list is a 4 byte header (encoding, endian, 2 reserved), the nvlist
+// version and flags, and then the pairs.  Each pair is its encoded size,
+// decoded size, name, data type, element count and value.  A pair with an
+// encoded size of 0 ends the list.  XDR is big endian and pads strings to 4
+// bytes.
+func readNVList(b []byte) (map[string]string, map[string]uint64) {
+	strs := map[string]string{}
+	nums := map[string]uint64{}
+
+	if len(b) < zfsNVListHeaderLen || b[0] != zfsEncodingXDR {
+		return strs, nums
+	}
+
+	u32 := func(b []byte, off int) (int, bool) {
+		if off < 0 || off+4 > len(b) {
+			return 0, false
+		}
+
+		return int(binary.BigEndian.Uint32(b[off:])), true
+	}
+
+	xdrString := func(b []byte, off int) (string, int, bool) {
+		n, ok := u32(b, off)
+		if !ok || n < 0 || off+4+n > len(b) {
+			return "", 0, false
+		}
+
+		return string(b[off+4 : off+4+n]), off + 4 + (n+3)&^3, true
+	}
+
+	for off := zfsNVListHeaderLen; ; {
+		size, ok := u32(b, off)
+		if !ok || size <= 0 || off+size > len(b) {
+			break
+		}
+
+		pair := b[off : off+size]
+		off += size
+
+		name, next, ok := xdrString(pair, 8)
+		if !ok {
+			break
+		}
+
+		dataType, _ := u32(pair, next)
+
+		switch dataType {
+		case nvTypeString:
+			if s, _, ok := xdrString(pair, next+8); ok {
+				strs[name] = s
+			}
+		case nvTypeUint64:
+			if next+16 <= len(pair) {
+				nums[name] = binary.BigEndian.Uint64(pair[next+8:])
+			}
+		}
+	}
+
+	return strs, nums
+}
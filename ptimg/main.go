@@ -384,6 +384,11 @@ func main() {
 				Value: false,
 				Usage: "Do not mount the partition.",
 			},
+			&cli.StringFlag{
+				Name:  "disk-guid",
+				Value: "",
+				Usage: "Set the GPT disk GUID of the image, for reproducible images",
+			},
 			&cli.IntFlag{
 				Name:  "max-size",
 				Value: maxPtSizeMiB,
@@ -421,42 +426,45 @@ func createOrFindPartition(dSys disko.System, devPath string, ptname string, max
 		}
 	}
 
-	freeList := disk.FreeSpacesWithMin(size100M)
-	if len(freeList) == 0 {
+	pSet, err := disk.Allocate([]disko.PartitionRequest{{
+		Name:    ptname,
+		Type:    partid.LinuxFS,
+		MinSize: disko.SizeBytes(size100M),
+		MaxSize: disko.SizeBytes(uint64(maxSize) * disko.Mebibyte),
+		Grow:    true,
+	}})
+	if errors.Is(err, disko.ErrNoSpace) {
 		return 0, fmt.Errorf(
 			"could not find freespace on %s.  You can add space to it with "+
 				"'qemu-img resize %s +10G'", disk.Path, disk.Path)
+	} else if err != nil {
+		return 0, err
 	}
 
-	for i := uint(1); i < 128; i++ {
-		if _, exists := disk.Partitions[i]; !exists {
-			ptNum = i
-			break
-		}
+	for n := range pSet {
+		ptNum = n
 	}
 
-	if ptNum == 0 {
-		return 0, fmt.Errorf("failed to find an open partition number")
-	}
+	msgf("Creating new partition with name=%s number=%d\n", ptname, ptNum)
 
-	last := freeList[0].Last
-	if (last - freeList[0].Start) > uint64(maxSize)*disko.Mebibyte {
-		last = freeList[0].Start + uint64(maxSize)*disko.Mebibyte - 1
-	}
+	err = dSys.CreatePartitions(disk, pSet)
+
+	return ptNum, err
+}
 
-	newPart := disko.Partition{
-		Start:  freeList[0].Start,
-		Last:   last,
-		Type:   partid.LinuxFS,
-		Name:   ptname,
-		Number: ptNum,
+func setDiskGUID(dSys disko.System, devPath string, id disko.GUID) error {
+	disk, err := dSys.ScanDisk(devPath)
+	if err != nil {
+		return err
 	}
 
-	msgf("Creating new partition with name=%s number=%d\n", ptname, ptNum)
+	if disk.GPT.DiskGUID == id {
+		return nil
+	}
 
-	err = dSys.CreatePartition(disk, newPart)
+	msgf("Setting disk guid of %s to %s\n", devPath, id)
 
-	return ptNum, err
+	return dSys.SetDiskGUID(disk, id)
 }
 
 func handleMount(cpSrc string, exCmd []string, devPath string, subs map[string]string) error {
@@ -563,6 +571,13 @@ func partCreate(c *cli.Context) error {
 	myname := c.String("pt-name")
 	maxSize := c.Int("max-size")
 
+	var diskGUID disko.GUID
+	if s := c.String("disk-guid"); s != "" {
+		if diskGUID, err = disko.StringToGUID(s); err != nil {
+			return fmt.Errorf("bad --disk-guid '%s': %w", s, err)
+		}
+	}
+
 	if c.Bool("execute") {
 		exCmd = c.Args().Slice()[1:]
 	} else if c.Args().Len() != 1 {
@@ -616,6 +631,12 @@ func partCreate(c *cli.Context) error {
 
 	mysys := linux.System()
 
+	if diskGUID != (disko.GUID{}) {
+		if err := setDiskGUID(mysys, devPath, diskGUID); err != nil {
+			return err
+		}
+	}
+
 	if ptNum, err = createOrFindPartition(mysys, devPath, myname, maxSize); err != nil {
 		return err
 	}
@@ -632,7 +653,10 @@ func partCreate(c *cli.Context) error {
 	if !skipMkfs {
 		msgf("Executing mkfs.ext2 on %s\n", partPath)
 
-		err = runCommand("mkfs.ext2", "-F", "-Elazy_itable_init=0,lazy_journal_init=0", "-L"+myname, partPath)
+		err = linux.FSManager().CreateFS(partPath, disko.FSExt2, disko.FSOptions{
+			Label:     myname,
+			ExtraArgs: []string{"-Elazy_itable_init=0,lazy_journal_init=0"},
+		})
 		if err != nil {
 			return err
 		}
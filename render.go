@@ -0,0 +1,506 @@
+package disko
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Renderer writes reports of disks and volume groups in a specific format.
+type Renderer interface {
+	// RenderDisks writes a report of the disks, their partitions and free
+	// spaces to w.
+	RenderDisks(w io.Writer, disks DiskSet) error
+
+	// RenderVGs writes a report of the volume groups, their PVs and LVs to w.
+	RenderVGs(w io.Writer, vgs VGSet) error
+}
+
+// RenderFormats is the list of formats accepted by NewRenderer.
+//
+//nolint:gochecknoglobals
+var RenderFormats = []string{"text", "json", "yaml"}
+
+// NewRenderer returns the Renderer for the named format, one of
+// RenderFormats.
+func NewRenderer(format string) (Renderer, error) {
+	switch strings.ToLower(format) {
+	case "text", "":
+		return TextRenderer{}, nil
+	case "json":
+		return JSONRenderer{}, nil
+	case "yaml":
+		return YAMLRenderer{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format '%s'. Must be one of %s",
+		format, strings.Join(RenderFormats, ", "))
+}
+
+// TextRenderer renders reports as aligned text tables.
+type TextRenderer struct{}
+
+// JSONRenderer renders reports as indented json.
+type JSONRenderer struct{}
+
+// YAMLRenderer renders reports as yaml.
+type YAMLRenderer struct{}
+
+type partitionReport struct {
+	Number uint   `json:"number" yaml:"number"`
+	Name   string `json:"name" yaml:"name"`
+	Start  uint64 `json:"start" yaml:"start"`
+	Last   uint64 `json:"last" yaml:"last"`
+	Size   uint64 `json:"size" yaml:"size"`
+	Type   string `json:"type" yaml:"type"`
+	ID     string `json:"id" yaml:"id"`
+
+	Signature  string   `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Attributes string   `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	Usage      []string `json:"usage,omitempty" yaml:"usage,omitempty"`
+}
+
+type freeSpaceReport struct {
+	Start uint64 `json:"start" yaml:"start"`
+	Last  uint64 `json:"last" yaml:"last"`
+	Size  uint64 `json:"size" yaml:"size"`
+}
+
+type diskReport struct {
+	Name       string            `json:"name" yaml:"name"`
+	Path       string            `json:"path" yaml:"path"`
+	Serial     string            `json:"serial,omitempty" yaml:"serial,omitempty"`
+	WWN        string            `json:"wwn,omitempty" yaml:"wwn,omitempty"`
+	Model      string            `json:"model,omitempty" yaml:"model,omitempty"`
+	Size       uint64            `json:"size" yaml:"size"`
+	SectorSize uint              `json:"sectorSize" yaml:"sectorSize"`
+	Type       string            `json:"type" yaml:"type"`
+	Attachment string            `json:"attachment" yaml:"attachment"`
+	Table      string            `json:"table" yaml:"table"`
+	DiskGUID   string            `json:"diskGUID,omitempty" yaml:"diskGUID,omitempty"`
+	ReadOnly   bool              `json:"readOnly" yaml:"readOnly"`
+	Properties []string          `json:"properties" yaml:"properties"`
+	Partitions []partitionReport `json:"partitions" yaml:"partitions"`
+	FreeSpaces []freeSpaceReport `json:"freeSpaces" yaml:"freeSpaces"`
+	FreeSpace  uint64            `json:"freeSpace" yaml:"freeSpace"`
+	Signature  string            `json:"signature,omitempty" yaml:"signature,omitempty"`
+	Usage      []string          `json:"usage,omitempty" yaml:"usage,omitempty"`
+	Problems   []string          `json:"tableProblems,omitempty" yaml:"tableProblems,omitempty"`
+}
+
+type pvReport struct {
+	Name     string `json:"name" yaml:"name"`
+	Path     string `json:"path" yaml:"path"`
+	Size     uint64 `json:"size" yaml:"size"`
+	FreeSize uint64 `json:"freeSize" yaml:"freeSize"`
+}
+
+type lvReport struct {
+	Name string `json:"name" yaml:"name"`
+	Path string `json:"path" yaml:"path"`
+	Size uint64 `json:"size" yaml:"size"`
+	Type string `json:"type" yaml:"type"`
+
+	// Pool is the thin pool of a THIN volume.
+	Pool string `json:"pool,omitempty" yaml:"pool,omitempty"`
+
+	// Provisioned is the sum of the sizes of the thin volumes in a THINPOOL.
+	Provisioned uint64 `json:"provisioned,omitempty" yaml:"provisioned,omitempty"`
+
+	// ThinVolumes is the number of thin volumes in a THINPOOL.
+	ThinVolumes int `json:"thinVolumes,omitempty" yaml:"thinVolumes,omitempty"`
+
+	// DataPercent is how much of the data space of a THINPOOL or THIN
+	// volume is in use.
+	DataPercent float64 `json:"dataPercent,omitempty" yaml:"dataPercent,omitempty"`
+
+	Encrypted     bool   `json:"encrypted" yaml:"encrypted"`
+	DecryptedName string `json:"decryptedName,omitempty" yaml:"decryptedName,omitempty"`
+	DecryptedPath string `json:"decryptedPath,omitempty" yaml:"decryptedPath,omitempty"`
+}
+
+type vgReport struct {
+	Name      string     `json:"name" yaml:"name"`
+	UUID      string     `json:"uuid" yaml:"uuid"`
+	Size      uint64     `json:"size" yaml:"size"`
+	FreeSpace uint64     `json:"freeSpace" yaml:"freeSpace"`
+	PVs       []pvReport `json:"pvs" yaml:"pvs"`
+	LVs       []lvReport `json:"lvs" yaml:"lvs"`
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func newDiskReport(d Disk) diskReport {
+	r := diskReport{
+		Name:       d.Name,
+		Path:       d.Path,
+		Serial:     d.Identity.Serial,
+		WWN:        d.Identity.WWN,
+		Model:      d.Identity.Model,
+		Size:       d.Size,
+		SectorSize: d.SectorSize,
+		Type:       d.Type.String(),
+		Attachment: d.Attachment.String(),
+		Table:      d.Table.String(),
+		DiskGUID:   diskGUIDString(d),
+		ReadOnly:   d.ReadOnly,
+		Properties: []string{},
+		Partitions: []partitionReport{},
+		FreeSpaces: []freeSpaceReport{},
+		Signature:  d.Signature.String(),
+		Usage:      usageStrings(d.Usage),
+	}
+
+	for _, p := range d.TableProblems {
+		r.Problems = append(r.Problems, p.String())
+	}
+
+	for p, v := range d.Properties {
+		if v {
+			r.Properties = append(r.Properties, string(p))
+		}
+	}
+
+	sort.Strings(r.Properties)
+
+	pNums := make([]uint, 0, len(d.Partitions))
+	for n := range d.Partitions {
+		pNums = append(pNums, n)
+	}
+
+	sort.Slice(pNums, func(i, j int) bool { return pNums[i] < pNums[j] })
+
+	for _, n := range pNums {
+		p := d.Partitions[n]
+		r.Partitions = append(r.Partitions, partitionReport{
+			Number:     p.Number,
+			Name:       p.Name,
+			Start:      p.Start,
+			Last:       p.Last,
+			Size:       p.Size(),
+			Type:       type2str(p.Type),
+			ID:         p.ID.String(),
+			Signature:  p.Signature.String(),
+			Attributes: p.Attributes.String(),
+			Usage:      usageStrings(d.PartitionUsage[n]),
+		})
+	}
+
+	for _, f := range d.FreeSpaces() {
+		r.FreeSpaces = append(r.FreeSpaces, freeSpaceReport{Start: f.Start, Last: f.Last, Size: f.Size()})
+		r.FreeSpace += f.Size()
+	}
+
+	return r
+}
+
+func usageStrings(usage []Usage) []string {
+	if len(usage) == 0 {
+		return nil
+	}
+
+	strs := make([]string, 0, len(usage))
+	for _, u := range usage {
+		strs = append(strs, u.String())
+	}
+
+	return strs
+}
+
+// usageLines returns a line for each use of the disk and its partitions.
+func (r diskReport) usageLines() []string {
+	lines := []string{}
+
+	for _, u := range r.Usage {
+		lines = append(lines, r.Name+": "+u)
+	}
+
+	for _, p := range r.Partitions {
+		for _, u := range p.Usage {
+			lines = append(lines, fmt.Sprintf("%s partition %d: %s", r.Name, p.Number, u))
+		}
+	}
+
+	return lines
+}
+
+// signatureLines returns a line for what the disk and each of its
+// partitions contain.
+func (r diskReport) signatureLines() []string {
+	lines := []string{}
+
+	if r.Signature != "" {
+		lines = append(lines, r.Name+": "+r.Signature)
+	}
+
+	for _, p := range r.Partitions {
+		if p.Signature != "" {
+			lines = append(lines, fmt.Sprintf("%s partition %d: %s", r.Name, p.Number, p.Signature))
+		}
+	}
+
+	return lines
+}
+
+func newDiskReports(disks DiskSet) []diskReport {
+	reports := []diskReport{}
+	for _, n := range sortedKeys(disks) {
+		reports = append(reports, newDiskReport(disks[n]))
+	}
+
+	return reports
+}
+
+func newVGReport(vg VG) vgReport {
+	r := vgReport{
+		Name:      vg.Name,
+		UUID:      vg.UUID,
+		Size:      vg.Size,
+		FreeSpace: vg.FreeSpace,
+		PVs:       []pvReport{},
+		LVs:       []lvReport{},
+	}
+
+	for _, n := range sortedKeys(vg.PVs) {
+		pv := vg.PVs[n]
+		r.PVs = append(r.PVs, pvReport{Name: pv.Name, Path: pv.Path, Size: pv.Size, FreeSize: pv.FreeSize})
+	}
+
+	for _, n := range sortedKeys(vg.Volumes) {
+		lv := vg.Volumes[n]
+		lr := lvReport{
+			Name:          lv.Name,
+			Path:          lv.Path,
+			Size:          lv.Size,
+			Type:          lv.Type.String(),
+			Pool:          lv.Pool,
+			DataPercent:   lv.DataPercent,
+			Encrypted:     lv.Encrypted,
+			DecryptedName: lv.DecryptedLVName,
+			DecryptedPath: lv.DecryptedLVPath,
+		}
+
+		if lv.Type == THINPOOL {
+			for _, thin := range vg.Volumes {
+				if thin.Type == THIN && thin.Pool == lv.Name {
+					lr.Provisioned += thin.Size
+					lr.ThinVolumes++
+				}
+			}
+		}
+
+		r.LVs = append(r.LVs, lr)
+	}
+
+	return r
+}
+
+func newVGReports(vgs VGSet) []vgReport {
+	reports := []vgReport{}
+	for _, n := range sortedKeys(vgs) {
+		reports = append(reports, newVGReport(vgs[n]))
+	}
+
+	return reports
+}
+
+// RenderDisks writes each disk's summary followed by a table of its
+// partitions and free spaces.
+func (TextRenderer) RenderDisks(w io.Writer, disks DiskSet) error {
+	for _, n := range sortedKeys(disks) {
+		d := disks[n]
+		if _, err := fmt.Fprintf(w, "%s\n%s", d.String(), d.Details()); err != nil {
+			return err
+		}
+
+		report := newDiskReport(d)
+
+		for _, r := range report.signatureLines() {
+			if _, err := fmt.Fprintf(w, "contains: %s\n", r); err != nil {
+				return err
+			}
+		}
+
+		for _, r := range report.usageLines() {
+			if _, err := fmt.Fprintf(w, "in use: %s\n", r); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range report.Problems {
+			if _, err := fmt.Fprintf(w, "table problem: %s: %s\n", report.Name, p); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RenderVGs writes each volume group's summary followed by a table of its
+// PVs and LVs.
+func (TextRenderer) RenderVGs(w io.Writer, vgs VGSet) error {
+	for _, r := range newVGReports(vgs) {
+		_, err := fmt.Fprintf(w, "%s UUID=%s Size=%s FreeSpace=%s NumPVs=%d NumLVs=%d\n",
+			r.Name, r.UUID, sizeString(r.Size), sizeString(r.FreeSpace), len(r.PVs), len(r.LVs))
+		if err != nil {
+			return err
+		}
+
+		rows := [][]string{{"PV", "Path", "Size", "Free"}}
+		for _, pv := range r.PVs {
+			rows = append(rows, []string{pv.Name, pv.Path, sizeString(pv.Size), sizeString(pv.FreeSize)})
+		}
+
+		if err := WriteTable(w, rows); err != nil {
+			return err
+		}
+
+		rows = [][]string{{"LV", "Type", "Size", "Pool", "Provisioned", "Data Used", "Encrypted", "Decrypted"}}
+		for _, lv := range r.LVs {
+			provisioned, used := "", ""
+			if lv.Type == THINPOOL.String() {
+				provisioned = fmt.Sprintf("%s in %d (%d%%)",
+					sizeString(lv.Provisioned), lv.ThinVolumes, percent(lv.Provisioned, lv.Size))
+			}
+
+			if lv.Type == THINPOOL.String() || lv.Type == THIN.String() {
+				used = fmt.Sprintf("%.2f%%", lv.DataPercent)
+			}
+
+			decrypted := ""
+			if lv.Encrypted {
+				decrypted = "<closed>"
+				if lv.DecryptedPath != "" {
+					decrypted = lv.DecryptedPath
+				}
+			}
+
+			rows = append(rows, []string{
+				lv.Name, lv.Type, sizeString(lv.Size), lv.Pool, provisioned, used,
+				fmt.Sprintf("%t", lv.Encrypted), decrypted})
+		}
+
+		if err := WriteTable(w, rows); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
+
+func writeYAML(w io.Writer, v interface{}) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2) //nolint:gomnd
+
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// RenderDisks writes the disks as a json list sorted by name.
+func (JSONRenderer) RenderDisks(w io.Writer, disks DiskSet) error {
+	return writeJSON(w, newDiskReports(disks))
+}
+
+// RenderVGs writes the volume groups as a json list sorted by name.
+func (JSONRenderer) RenderVGs(w io.Writer, vgs VGSet) error {
+	return writeJSON(w, newVGReports(vgs))
+}
+
+// RenderDisks writes the disks as a yaml list sorted by name.
+func (YAMLRenderer) RenderDisks(w io.Writer, disks DiskSet) error {
+	return writeYAML(w, newDiskReports(disks))
+}
+
+// RenderVGs writes the volume groups as a yaml list sorted by name.
+func (YAMLRenderer) RenderVGs(w io.Writer, vgs VGSet) error {
+	return writeYAML(w, newVGReports(vgs))
+}
+
+// WriteTable writes rows to w as a table with each column padded to the
+// width of its widest field.
+func WriteTable(w io.Writer, rows [][]string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var lengths = make([]int, len(rows[0]))
+
+	for _, line := range rows {
+		for i, field := range line {
+			if len(field) > lengths[i] {
+				lengths[i] = len(field)
+			}
+		}
+	}
+
+	fmts := make([]string, len(lengths))
+
+	for i, l := range lengths {
+		fmts[i] = fmt.Sprintf("%%-%ds", l)
+	}
+
+	pfmt := strings.Join(fmts, " | ") + " |\n"
+
+	for _, line := range rows {
+		s := make([]interface{}, len(line))
+		for i, v := range line {
+			s[i] = v
+		}
+
+		if _, err := fmt.Fprintf(w, pfmt, s...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sizeString returns n in MiB if it is a whole number of MiB, otherwise
+// in bytes.
+func sizeString(n uint64) string {
+	if n%Mebibyte == 0 {
+		return fmt.Sprintf("%dMiB", n/Mebibyte)
+	}
+
+	return fmt.Sprintf("%d", n)
+}
+
+func percent(n, total uint64) uint64 {
+	if total == 0 {
+		return 0
+	}
+
+	return n * 100 / total //nolint:gomnd
+}
@@ -0,0 +1,262 @@
+package disko_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+	"machinerun.io/disko"
+	"machinerun.io/disko/partid"
+)
+
+func renderDisks() disko.DiskSet {
+	return disko.DiskSet{
+		"sda": {
+			Name:       "sda",
+			Path:       "/dev/sda",
+			Size:       100 * disko.Mebibyte,
+			SectorSize: 512,
+			Table:      disko.GPT,
+			Partitions: disko.PartitionSet{
+				1: {Number: 1, Start: disko.Mebibyte, Last: 51*disko.Mebibyte - 1, Type: partid.LinuxLVM, Name: "data"},
+			},
+		},
+		"sdb": {Name: "sdb", Path: "/dev/sdb", Size: 50 * disko.Mebibyte, SectorSize: 512},
+	}
+}
+
+func renderVGs() disko.VGSet {
+	return disko.VGSet{
+		"vg0": {
+			Name:      "vg0",
+			Size:      100 * disko.Mebibyte,
+			FreeSpace: 20 * disko.Mebibyte,
+			PVs: disko.PVSet{
+				"sda1": {Name: "sda1", Path: "/dev/sda1", Size: 100 * disko.Mebibyte, VGName: "vg0"},
+			},
+			Volumes: disko.LVSet{
+				"pool": {Name: "pool", Size: 40 * disko.Mebibyte, Type: disko.THINPOOL, VGName: "vg0",
+					DataPercent: 12.5},
+				"thin0": {Name: "thin0", Size: 8 * disko.Mebibyte, Type: disko.THIN, Pool: "pool", VGName: "vg0"},
+				"thin1": {Name: "thin1", Size: 12 * disko.Mebibyte, Type: disko.THIN, Pool: "pool", VGName: "vg0"},
+				"root": {Name: "root", Size: 40 * disko.Mebibyte, Type: disko.THICK, VGName: "vg0",
+					Encrypted: true, DecryptedLVName: "root_crypt", DecryptedLVPath: "/dev/mapper/root_crypt"},
+			},
+		},
+	}
+}
+
+func TestNewRenderer(t *testing.T) {
+	ast := assert.New(t)
+
+	for _, f := range disko.RenderFormats {
+		r, err := disko.NewRenderer(f)
+		ast.Nil(err)
+		ast.NotNil(r)
+	}
+
+	_, err := disko.NewRenderer("xml")
+	ast.NotNil(err)
+}
+
+func TestRenderDisksJSON(t *testing.T) {
+	ast := assert.New(t)
+
+	var buf bytes.Buffer
+	if !ast.Nil(disko.JSONRenderer{}.RenderDisks(&buf, renderDisks())) {
+		return
+	}
+
+	found := []struct {
+		Name       string
+		Table      string
+		FreeSpace  uint64
+		Partitions []struct {
+			Number uint
+			Size   uint64
+			Type   string
+		}
+	}{}
+
+	if !ast.Nil(json.Unmarshal(buf.Bytes(), &found)) {
+		return
+	}
+
+	ast.Len(found, 2)
+	ast.Equal("sda", found[0].Name)
+	ast.Equal("GPT", found[0].Table)
+	ast.Len(found[0].Partitions, 1)
+	ast.Equal(50*disko.Mebibyte, found[0].Partitions[0].Size)
+	ast.Equal("LVM", found[0].Partitions[0].Type)
+	ast.NotZero(found[0].FreeSpace)
+	ast.Equal("sdb", found[1].Name)
+}
+
+func TestRenderVGsYAML(t *testing.T) {
+	ast := assert.New(t)
+
+	var buf bytes.Buffer
+	if !ast.Nil(disko.YAMLRenderer{}.RenderVGs(&buf, renderVGs())) {
+		return
+	}
+
+	found := []struct {
+		Name string
+		PVs  []struct{ Name string }
+		LVs  []struct {
+			Name          string
+			Type          string
+			Pool          string
+			Provisioned   uint64
+			ThinVolumes   int     `yaml:"thinVolumes"`
+			DataPercent   float64 `yaml:"dataPercent"`
+			Encrypted     bool
+			DecryptedPath string `yaml:"decryptedPath"`
+		}
+	}{}
+
+	if !ast.Nil(yaml.Unmarshal(buf.Bytes(), &found)) {
+		return
+	}
+
+	ast.Len(found, 1)
+	ast.Len(found[0].PVs, 1)
+	ast.Len(found[0].LVs, 4)
+
+	// LVs are sorted by name: pool, root, thin0, thin1.
+	pool := found[0].LVs[0]
+	ast.Equal("THINPOOL", pool.Type)
+	ast.Equal(20*disko.Mebibyte, pool.Provisioned)
+	ast.Equal(2, pool.ThinVolumes)
+	ast.Equal(12.5, pool.DataPercent)
+
+	root := found[0].LVs[1]
+	ast.True(root.Encrypted)
+	ast.Equal("/dev/mapper/root_crypt", root.DecryptedPath)
+
+	ast.Equal("pool", found[0].LVs[2].Pool)
+}
+
+func TestDetails(t *testing.T) {
+	ast := assert.New(t)
+
+	details := renderDisks().Details()
+	ast.Contains(details, "sda (/dev/sda)")
+	ast.Contains(details, "sdb (/dev/sdb)")
+	ast.Contains(details, "<free>")
+	ast.Less(strings.Index(details, "sda"), strings.Index(details, "sdb"))
+
+	details = renderVGs().Details()
+	ast.Contains(details, "vg0 ")
+	ast.Contains(details, "20MiB in 2 (50%)")
+	ast.Contains(details, "12.50%")
+	ast.Contains(details, "/dev/mapper/root_crypt")
+
+	ast.Equal("", disko.DiskSet{}.Details())
+}
+
+func TestWriteTable(t *testing.T) {
+	var buf bytes.Buffer
+
+	err := disko.WriteTable(&buf, [][]string{{"a", "bbb"}, {"cccc", "d"}})
+	if err != nil {
+		t.Fatalf("WriteTable failed: %s", err)
+	}
+
+	expected := "a    | bbb |\ncccc | d   |\n"
+	if buf.String() != expected {
+		t.Errorf("WriteTable gave %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestRenderDisksUsage(t *testing.T) {
+	ast := assert.New(t)
+	disks := renderDisks()
+
+	sda := disks["sda"]
+	sda.PartitionUsage = map[uint][]disko.Usage{
+		1: {
+			{Kind: disko.UsageHolder, Target: "/dev/mapper/root_crypt", Detail: "crypt"},
+			{Kind: disko.UsageMount, Target: "/", Detail: "ext4", Via: "/dev/mapper/root_crypt"},
+		},
+	}
+	disks["sda"] = sda
+
+	var buf bytes.Buffer
+	if !ast.Nil(disko.TextRenderer{}.RenderDisks(&buf, disks)) {
+		return
+	}
+
+	ast.Contains(buf.String(),
+		"in use: sda partition 1: holder /dev/mapper/root_crypt (crypt)\n"+
+			"in use: sda partition 1: mount / (ext4) via /dev/mapper/root_crypt\n")
+
+	buf.Reset()
+
+	if !ast.Nil(disko.JSONRenderer{}.RenderDisks(&buf, disks)) {
+		return
+	}
+
+	ast.Contains(buf.String(), `"mount / (ext4) via /dev/mapper/root_crypt"`)
+}
+
+func TestRenderDisksSignature(t *testing.T) {
+	ast := assert.New(t)
+	disks := renderDisks()
+
+	sda := disks["sda"]
+	p := sda.Partitions[1]
+	p.Signature = disko.Signature{Type: "crypto_LUKS", UUID: "0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a", Version: "2"}
+	sda.Partitions[1] = p
+	disks["sda"] = sda
+
+	var buf bytes.Buffer
+	if !ast.Nil(disko.TextRenderer{}.RenderDisks(&buf, disks)) {
+		return
+	}
+
+	ast.Contains(buf.String(), "contains: sda partition 1: crypto_LUKS uuid=0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a\n")
+
+	buf.Reset()
+
+	if !ast.Nil(disko.YAMLRenderer{}.RenderDisks(&buf, disks)) {
+		return
+	}
+
+	ast.Contains(buf.String(), "signature: crypto_LUKS uuid=0b2d5c3e-4a4f-4a42-9d77-3f0d1b1c2e9a\n")
+}
+
+func TestRenderDisksTableProblems(t *testing.T) {
+	ast := assert.New(t)
+	disks := renderDisks()
+
+	sda := disks["sda"]
+	sda.TableProblems = []disko.TableProblem{
+		{Kind: disko.ProblemBackupHeader, Detail: "header at LBA 2047 has a bad crc"},
+		{Kind: disko.ProblemOverlap, Partition: 2, Detail: "LBAs 150-300 overlap partition 1 (100-199)"},
+	}
+	disks["sda"] = sda
+
+	var buf bytes.Buffer
+	if !ast.Nil(disko.TextRenderer{}.RenderDisks(&buf, disks)) {
+		return
+	}
+
+	ast.Contains(buf.String(), "table problem: sda: backup-header: header at LBA 2047 has a bad crc\n")
+	ast.Contains(buf.String(),
+		"table problem: sda: overlap: partition 2: LBAs 150-300 overlap partition 1 (100-199)\n")
+
+	buf.Reset()
+
+	if !ast.Nil(disko.JSONRenderer{}.RenderDisks(&buf, disks)) {
+		return
+	}
+
+	ast.Contains(buf.String(), `"backup-header: header at LBA 2047 has a bad crc"`)
+
+	ast.True(sda.TableProblems[0].Repairable())
+	ast.False(sda.TableProblems[1].Repairable())
+}
@@ -0,0 +1,72 @@
+package disko
+
+import "fmt"
+
+// GrowLast returns the Last that partition number of d has when grown into
+// all of the free space that follows it.  The end is aligned down as
+// FreeSpaces aligns it.  It returns an error wrapping ErrNoSpace if there
+// is no free space after the partition.
+func (d *Disk) GrowLast(number uint) (uint64, error) {
+	p, ok := d.Partitions[number]
+	if !ok {
+		return 0, &PartitionError{Disk: d.Path, Number: number, Err: ErrPartitionNotFound}
+	}
+
+	for _, f := range d.FreeSpacesWithMin(1) {
+		if f.Start == p.Last+1 {
+			return f.Last, nil
+		}
+	}
+
+	return 0, &PartitionError{Disk: d.Path, Number: number, Err: ErrNoSpace,
+		Detail: fmt.Sprintf("no free space after %d", p.Last)}
+}
+
+// GrowPartitionToFill grows partition number of d into all of the free
+// space that follows it, as growpart of cloud-utils does.  It is how an
+// image written to a small disk claims the rest of a larger one.  The
+// backup GPT of a disk that has grown is relocated to the new end of the
+// disk first, so that the space the disk gained is usable.  It returns the
+// partition as grown.
+func GrowPartitionToFill(sys System, d Disk, number uint) (Partition, error) {
+	if d.backupGPTMisplaced() {
+		if err := sys.RelocateBackupGPT(d); err != nil {
+			return Partition{}, err
+		}
+
+		var err error
+		if d, err = sys.ScanDisk(d.Path); err != nil {
+			return Partition{}, err
+		}
+	}
+
+	last, err := d.GrowLast(number)
+	if err != nil {
+		return Partition{}, err
+	}
+
+	if err := sys.ResizePartition(d, number, last); err != nil {
+		return Partition{}, err
+	}
+
+	p := d.Partitions[number]
+	p.Last = last
+
+	return p, nil
+}
+
+// backupGPTMisplaced returns true if the backup GPT of d is not at the end
+// of the disk, as when the disk has grown since the GPT was written.
+func (d *Disk) backupGPTMisplaced() bool {
+	if d.Table != GPT {
+		return false
+	}
+
+	for _, p := range d.TableProblems {
+		if p.Kind == ProblemBackupLocation {
+			return true
+		}
+	}
+
+	return d.GPT.LastUsableLBA != 0 && d.GPT.LastUsableLBA < d.RelocatedLastUsableLBA()
+}
@@ -0,0 +1,244 @@
+package disko
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SizeExpr is a human readable size.  It is one of:
+//
+//	"1048576"   a number of bytes.
+//	"512MiB"    a number with a unit.  KiB, MiB, GiB, TiB and PiB (and the
+//	            lvm style K, M, G, T and P) are powers of 1024.  KB, MB,
+//	            GB, TB and PB are powers of 1000.  The number may have a
+//	            fraction ("1.5TB").
+//	"40%"       a percentage of the whole disk or volume group.
+//	"40%FREE"   a percentage of the free space of the disk or volume group.
+//	"rest"      all of the remaining free space.
+//
+// Units and keywords are case insensitive.  Sizes are resolved against a
+// disk with ForPartition or a volume group with ForLV.  Fixed sizes are
+// rounded up to the alignment, relative sizes are rounded down so that they
+// fit.  The empty SizeExpr is the same as "rest".
+type SizeExpr string
+
+// SizeRest is the SizeExpr for all of the remaining free space.
+const SizeRest SizeExpr = "rest"
+
+const (
+	pctFree  = "%free"
+	pct      = "%"
+	maxPct   = 100
+	unitDecK = 1000
+	unitBinK = 1024
+)
+
+// kinds of parsedSize.
+const (
+	sizeBytes = iota
+	sizePercent
+	sizePercentFree
+	sizeRest
+)
+
+//nolint:gochecknoglobals
+var sizeUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"k":   unitBinK,
+	"kib": unitBinK,
+	"kb":  unitDecK,
+	"m":   unitBinK * unitBinK,
+	"mib": unitBinK * unitBinK,
+	"mb":  unitDecK * unitDecK,
+	"g":   unitBinK * unitBinK * unitBinK,
+	"gib": unitBinK * unitBinK * unitBinK,
+	"gb":  unitDecK * unitDecK * unitDecK,
+	"t":   unitBinK * unitBinK * unitBinK * unitBinK,
+	"tib": unitBinK * unitBinK * unitBinK * unitBinK,
+	"tb":  unitDecK * unitDecK * unitDecK * unitDecK,
+	"p":   unitBinK * unitBinK * unitBinK * unitBinK * unitBinK,
+	"pib": unitBinK * unitBinK * unitBinK * unitBinK * unitBinK,
+	"pb":  unitDecK * unitDecK * unitDecK * unitDecK * unitDecK,
+}
+
+// parsedSize is the parsed form of a SizeExpr.
+type parsedSize struct {
+	kind    int
+	bytes   uint64
+	percent float64
+}
+
+// SizeBytes returns the SizeExpr for n bytes.
+func SizeBytes(n uint64) SizeExpr {
+	return SizeExpr(strconv.FormatUint(n, 10))
+}
+
+func (s SizeExpr) parse() (parsedSize, error) {
+	str := strings.ToLower(strings.TrimSpace(string(s)))
+
+	switch {
+	case str == "" || str == string(SizeRest):
+		return parsedSize{kind: sizeRest}, nil
+	case strings.HasSuffix(str, pctFree), strings.HasSuffix(str, pct):
+		ps := parsedSize{kind: sizePercent}
+		if strings.HasSuffix(str, pctFree) {
+			ps.kind = sizePercentFree
+			str = strings.TrimSuffix(str, pctFree)
+		} else {
+			str = strings.TrimSuffix(str, pct)
+		}
+
+		num, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil || num <= 0 || num > maxPct {
+			return ps, fmt.Errorf("invalid size '%s': percentage must be > 0 and <= 100", s)
+		}
+
+		ps.percent = num
+
+		return ps, nil
+	}
+
+	numEnd := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if numEnd == -1 {
+		numEnd = len(str)
+	}
+
+	numStr, unitStr := str[:numEnd], strings.TrimSpace(str[numEnd:])
+
+	mult, ok := sizeUnits[unitStr]
+	if !ok || numStr == "" {
+		return parsedSize{}, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	if !strings.Contains(numStr, ".") {
+		num, err := strconv.ParseUint(numStr, 10, 64)
+		if err != nil || (num != 0 && mult > math.MaxUint64/num) {
+			return parsedSize{}, fmt.Errorf("invalid size '%s'", s)
+		}
+
+		return parsedSize{kind: sizeBytes, bytes: num * mult}, nil
+	}
+
+	num, err := strconv.ParseFloat(numStr, 64)
+	if err != nil {
+		return parsedSize{}, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	bytes := math.Round(num * float64(mult))
+	if bytes >= math.MaxUint64 {
+		return parsedSize{}, fmt.Errorf("invalid size '%s': too large", s)
+	}
+
+	return parsedSize{kind: sizeBytes, bytes: uint64(bytes)}, nil
+}
+
+// Validate returns an error if s is not a valid SizeExpr.
+func (s SizeExpr) Validate() error {
+	_, err := s.parse()
+	return err
+}
+
+// IsFixed returns true if s is a number of bytes rather than relative to
+// the size of a disk or volume group.
+func (s SizeExpr) IsFixed() bool {
+	ps, err := s.parse()
+	return err == nil && ps.kind == sizeBytes
+}
+
+// IsFreeRelative returns true if s depends on the free space ("%FREE" or
+// "rest"), so it resolves differently once space has been used.
+func (s SizeExpr) IsFreeRelative() bool {
+	ps, err := s.parse()
+	return err == nil && (ps.kind == sizePercentFree || ps.kind == sizeRest)
+}
+
+// Resolve returns the size in bytes of s for something of size total with
+// free bytes free, of which rest are available for "rest".  The result is a
+// multiple of align.
+func (s SizeExpr) Resolve(total, free, rest, align uint64) (uint64, error) {
+	ps, err := s.parse()
+	if err != nil {
+		return 0, err
+	}
+
+	if align == 0 {
+		align = 1
+	}
+
+	var size uint64
+
+	switch ps.kind {
+	case sizeBytes:
+		return ((ps.bytes + align - 1) / align) * align, nil
+	case sizePercent:
+		size = uint64(float64(total) * ps.percent / maxPct)
+	case sizePercentFree:
+		size = uint64(float64(free) * ps.percent / maxPct)
+	case sizeRest:
+		size = rest
+	}
+
+	size = (size / align) * align
+	if size == 0 {
+		return 0, fmt.Errorf("size '%s' is less than %d bytes: %w", s, align, ErrNoSpace)
+	}
+
+	return size, nil
+}
+
+// ForPartition returns the size in bytes of s for a partition on d that
+// is placed in free space fs.  Percentages are of the disk size and its
+// total free space and "rest" is all of fs.  The size is rounded to the
+// disk's Alignment grain.
+func (s SizeExpr) ForPartition(d Disk, fs FreeSpace) (uint64, error) {
+	var free uint64
+
+	for _, f := range d.FreeSpaces() {
+		free += f.Size()
+	}
+
+	grain, _ := d.Alignment()
+
+	return s.Resolve(d.Size, free, fs.Size(), grain)
+}
+
+// ForLV returns the size in bytes of s for a logical volume in vg.
+// Percentages are of the volume group size and free space and "rest" is all
+// of the free space.  The size is rounded to ExtentSize.
+func (s SizeExpr) ForLV(vg VG) (uint64, error) {
+	return s.Resolve(vg.Size, vg.FreeSpace, vg.FreeSpace, ExtentSize)
+}
+
+// UnmarshalJSON accepts a json string or number.
+func (s *SizeExpr) UnmarshalJSON(b []byte) error {
+	var asStr string
+	var asNum uint64
+
+	if err := json.Unmarshal(b, &asNum); err == nil {
+		// 0 has always meant "use what is left".
+		*s = SizeBytes(asNum)
+		if asNum == 0 {
+			*s = ""
+		}
+
+		return nil
+	}
+
+	if err := json.Unmarshal(b, &asStr); err != nil {
+		return fmt.Errorf("size must be a string or a number: %s", b)
+	}
+
+	if err := SizeExpr(asStr).Validate(); err != nil {
+		return err
+	}
+
+	*s = SizeExpr(asStr)
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package disko_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"machinerun.io/disko"
+)
+
+func TestSizeExprResolve(t *testing.T) {
+	const gib = 1024 * disko.Mebibyte
+
+	values := []struct {
+		expr     disko.SizeExpr
+		expected uint64
+	}{
+		{"1048576", disko.Mebibyte},
+		{"1000", disko.Mebibyte},
+		{"512MiB", 512 * disko.Mebibyte},
+		{"512m", 512 * disko.Mebibyte},
+		{"1.5GiB", 1536 * disko.Mebibyte},
+		{"1GB", 954 * disko.Mebibyte},
+		{"25%", 25 * gib},
+		{"50%FREE", 20 * gib},
+		{"50%free", 20 * gib},
+		{"rest", 10 * gib},
+		{"", 10 * gib},
+	}
+
+	for _, v := range values {
+		found, err := v.expr.Resolve(100*gib, 40*gib, 10*gib, disko.Mebibyte)
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", v.expr, err)
+			continue
+		}
+
+		if found != v.expected {
+			t.Errorf("%q: found %d, expected %d", v.expr, found, v.expected)
+		}
+	}
+}
+
+func TestSizeExprInvalid(t *testing.T) {
+	for _, expr := range []disko.SizeExpr{"1.2.3G", "12XB", "MiB", "0%", "101%", "%FREE", "-5"} {
+		if err := expr.Validate(); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+
+	if _, err := disko.SizeExpr("10%").Resolve(disko.Mebibyte, 0, 0, disko.Mebibyte); !errors.Is(err, disko.ErrNoSpace) {
+		t.Errorf("expected ErrNoSpace for a size that rounds to 0, got %v", err)
+	}
+}
+
+func TestSizeExprForLV(t *testing.T) {
+	vg := disko.VG{Size: 100 * disko.ExtentSize, FreeSpace: 11 * disko.ExtentSize}
+
+	found, err := disko.SizeExpr("50%FREE").ForLV(vg)
+	if err != nil || found != 5*disko.ExtentSize {
+		t.Errorf("50%%FREE gave %d, %v", found, err)
+	}
+
+	found, err = disko.SizeExpr("1MiB").ForLV(vg)
+	if err != nil || found != disko.ExtentSize {
+		t.Errorf("1MiB gave %d, %v", found, err)
+	}
+}
+
+func TestSizeExprJSON(t *testing.T) {
+	var s struct {
+		A, B, C disko.SizeExpr
+	}
+
+	if err := json.Unmarshal([]byte(`{"A": 4096, "B": "10GiB", "C": 0}`), &s); err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+
+	if s.A != "4096" || s.B != "10GiB" || s.C != "" {
+		t.Errorf("unexpected %#v", s)
+	}
+
+	if err := json.Unmarshal([]byte(`{"A": "ten"}`), &s); err == nil {
+		t.Errorf("expected error for invalid size")
+	}
+}
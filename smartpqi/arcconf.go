@@ -2,13 +2,17 @@ package smartpqi
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/patrickmn/go-cache"
 	"machinerun.io/disko"
 )
 
@@ -402,12 +406,20 @@ func ArcConf() SmartPqi {
 
 // SmartPqi Interface Implementation
 func (ac *arcConf) List() ([]int, error) {
+	return ac.listContext(context.Background())
+}
+
+func (ac *arcConf) listContext(ctx context.Context) ([]int, error) {
 	var stdout, stderr []byte
 	var rc int
 	var controllerIDs []int
 
 	args := []string{"list", "nologs"}
-	if stdout, stderr, rc = arcconf(args...); rc != 0 {
+	if stdout, stderr, rc = arcconf(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return controllerIDs, err
+		}
+
 		var err error = ErrNoArcconf
 		if rc != noArcConfRC {
 			err = cmdError(args, stdout, stderr, rc)
@@ -425,29 +437,73 @@ func (ac *arcConf) List() ([]int, error) {
 }
 
 func (ac *arcConf) Query(cID int) (Controller, error) {
-	ctrlIDs, err := ac.List()
+	return ac.QueryContext(context.Background(), cID)
+}
+
+func (ac *arcConf) QueryContext(ctx context.Context, cID int) (Controller, error) {
+	return query(ctx, ac, cID)
+}
+
+func (ac *arcConf) GetDiskType(path string) (disko.DiskType, error) {
+	return ac.GetDiskTypeContext(context.Background(), path)
+}
+
+func (ac *arcConf) GetDiskTypeContext(ctx context.Context, path string) (disko.DiskType, error) {
+	return getDiskType(ctx, ac, path)
+}
+
+func (ac *arcConf) GetDiskIdentity(path string) (disko.DiskIdentity, error) {
+	return ac.GetDiskIdentityContext(context.Background(), path)
+}
+
+// arcconf does not report a serial or WWN for logical devices, so there is
+// nothing to add to what udev knows.
+func (ac *arcConf) GetDiskIdentityContext(ctx context.Context, path string) (disko.DiskIdentity, error) {
+	return disko.DiskIdentity{}, nil
+}
+
+func (ac *arcConf) DriverSysfsPath() string {
+	return SysfsPCIDriversPath
+}
+
+// not implemented at the driver level
+func (ac *arcConf) IsSysPathRAID(path string) bool {
+	return false
+}
+
+// controllerQuerier is what controller and disk lookups need from arcconf.
+type controllerQuerier interface {
+	listContext(ctx context.Context) ([]int, error)
+	getConfigContext(ctx context.Context, cID int) (Controller, error)
+}
+
+func query(ctx context.Context, ac controllerQuerier, cID int) (Controller, error) {
+	ctrlIDs, err := ac.listContext(ctx)
 	if err != nil {
-		return Controller{}, fmt.Errorf("failed to enumerate controllers: %s", err)
+		return Controller{}, fmt.Errorf("failed to enumerate controllers: %w", err)
 	}
 
 	for _, ctrlID := range ctrlIDs {
 		if ctrlID == cID {
-			return ac.GetConfig(cID)
+			return ac.getConfigContext(ctx, cID)
 		}
 	}
 
 	return Controller{}, fmt.Errorf("unknown controller id %d", cID)
 }
 
-func (ac *arcConf) GetDiskType(path string) (disko.DiskType, error) {
-	cIDs, err := ac.List()
+func getDiskType(ctx context.Context, ac controllerQuerier, path string) (disko.DiskType, error) {
+	cIDs, err := ac.listContext(ctx)
 	if err != nil {
-		return disko.HDD, fmt.Errorf("failed to enumerate controllers: %s", err)
+		return disko.HDD, fmt.Errorf("failed to enumerate controllers: %w", err)
 	}
 
 	errors := []error{}
 	for _, cID := range cIDs {
-		ctrl, err := ac.GetConfig(cID)
+		ctrl, err := ac.getConfigContext(ctx, cID)
+		if err != nil && ctx.Err() != nil {
+			return disko.HDD, err
+		}
 		if err != nil {
 			errors = append(errors, fmt.Errorf("error while getting config for controller id:%d: %s", cID, err))
 		}
@@ -469,22 +525,21 @@ func (ac *arcConf) GetDiskType(path string) (disko.DiskType, error) {
 	return disko.HDD, fmt.Errorf("cannot determine disk type")
 }
 
-func (ac *arcConf) DriverSysfsPath() string {
-	return SysfsPCIDriversPath
-}
-
-// not implemented at the driver level
-func (ac *arcConf) IsSysPathRAID(path string) bool {
-	return false
+func (ac *arcConf) GetConfig(cID int) (Controller, error) {
+	return ac.getConfigContext(context.Background(), cID)
 }
 
-func (ac *arcConf) GetConfig(cID int) (Controller, error) {
+func (ac *arcConf) getConfigContext(ctx context.Context, cID int) (Controller, error) {
 	var stdout, stderr []byte
 	var rc int
 
 	// getconfig ID
 	args := []string{"getconfig", fmt.Sprintf("%d", cID), "nologs"}
-	if stdout, stderr, rc = arcconf(args...); rc != 0 {
+	if stdout, stderr, rc = arcconf(ctx, args...); rc != 0 {
+		if err := ctx.Err(); err != nil {
+			return Controller{}, err
+		}
+
 		var err error = ErrNoArcconf
 		if rc != noArcConfRC {
 			err = cmdError(args, stdout, stderr, rc)
@@ -498,6 +553,118 @@ func (ac *arcConf) GetConfig(cID int) (Controller, error) {
 	return newController(cID, getConfigOut)
 }
 
+type cachingArcConf struct {
+	ac    controllerQuerier
+	cache *cache.Cache
+
+	// mutex makes concurrent queries that miss the cache wait for the one
+	// that is running arcconf instead of all running it.
+	mutex sync.Mutex
+}
+
+// CachingArcConf - just a cache for an arcconf SmartPqi
+func CachingArcConf() SmartPqi {
+	const longTime = 5 * time.Minute
+
+	return &cachingArcConf{
+		ac:    &arcConf{},
+		cache: cache.New(longTime, longTime),
+	}
+}
+
+func (cac *cachingArcConf) List() ([]int, error) {
+	return cac.listContext(context.Background())
+}
+
+func (cac *cachingArcConf) listContext(ctx context.Context) ([]int, error) {
+	type lresult struct {
+		cIDs []int
+		err  error
+	}
+
+	const cacheName = "list"
+
+	cac.mutex.Lock()
+	defer cac.mutex.Unlock()
+
+	cached, found := cac.cache.Get(cacheName)
+
+	if found {
+		ret := cached.(lresult)
+		return ret.cIDs, ret.err
+	}
+
+	cIDs, err := cac.ac.listContext(ctx)
+
+	// An interrupted list says nothing about the controllers.
+	if ctx.Err() == nil {
+		cac.cache.Set(cacheName, lresult{cIDs: cIDs, err: err}, cache.DefaultExpiration)
+	}
+
+	return cIDs, err
+}
+
+func (cac *cachingArcConf) getConfigContext(ctx context.Context, cID int) (Controller, error) {
+	type qresult struct {
+		ctrl Controller
+		err  error
+	}
+
+	cacheName := fmt.Sprintf("config-%d", cID)
+
+	cac.mutex.Lock()
+	defer cac.mutex.Unlock()
+
+	cached, found := cac.cache.Get(cacheName)
+
+	if found {
+		ret := cached.(qresult)
+		return ret.ctrl, ret.err
+	}
+
+	ctrl, err := cac.ac.getConfigContext(ctx, cID)
+
+	if ctx.Err() == nil {
+		cac.cache.Set(cacheName, qresult{ctrl: ctrl, err: err}, cache.DefaultExpiration)
+	}
+
+	return ctrl, err
+}
+
+func (cac *cachingArcConf) Query(cID int) (Controller, error) {
+	return cac.QueryContext(context.Background(), cID)
+}
+
+func (cac *cachingArcConf) QueryContext(ctx context.Context, cID int) (Controller, error) {
+	return query(ctx, cac, cID)
+}
+
+func (cac *cachingArcConf) GetDiskType(path string) (disko.DiskType, error) {
+	return cac.GetDiskTypeContext(context.Background(), path)
+}
+
+func (cac *cachingArcConf) GetDiskTypeContext(ctx context.Context, path string) (disko.DiskType, error) {
+	return getDiskType(ctx, cac, path)
+}
+
+func (cac *cachingArcConf) GetDiskIdentity(path string) (disko.DiskIdentity, error) {
+	return cac.GetDiskIdentityContext(context.Background(), path)
+}
+
+// arcconf does not report a serial or WWN for logical devices.
+func (cac *cachingArcConf) GetDiskIdentityContext(ctx context.Context, path string) (disko.DiskIdentity, error) {
+	return disko.DiskIdentity{}, nil
+}
+
+func (cac *cachingArcConf) DriverSysfsPath() string {
+	return SysfsPCIDriversPath
+}
+
+// not implemented at the driver level
+func (cac *cachingArcConf) IsSysPathRAID(path string) bool {
+	return false
+}
+
 func newController(cID int, arcGetConfigOut string) (Controller, error) {
 	ctrl := Controller{
 		ID: cID,
@@ -532,8 +699,8 @@ func newController(cID int, arcGetConfigOut string) (Controller, error) {
 	return ctrl, nil
 }
 
-func arcconf(args ...string) ([]byte, []byte, int) {
-	cmd := exec.Command("arcconf", args...)
+func arcconf(ctx context.Context, args ...string) ([]byte, []byte, int) {
+	cmd := exec.CommandContext(ctx, "arcconf", args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
@@ -1,10 +1,18 @@
 package smartpqi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"machinerun.io/disko"
 )
 
 var arcConfGetConfig = `
@@ -1157,3 +1165,95 @@ func TestSmartPqiNewControllerBadInput(t *testing.T) {
 		}
 	}
 }
+
+func TestQueryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := ArcConf().QueryContext(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if _, err := ArcConf().GetDiskTypeContext(ctx, "/dev/sda"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestCachingQueryContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cac := CachingArcConf()
+
+	if _, err := cac.QueryContext(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if _, err := cac.GetDiskTypeContext(ctx, "/dev/sda"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// the interrupted list must not be cached.
+	if _, found := cac.(*cachingArcConf).cache.Get("list"); found {
+		t.Errorf("interrupted list result was cached")
+	}
+}
+
+// countingArcConf is an arcconf with one controller whose lists and
+// getconfigs take a while and are counted.
+type countingArcConf struct {
+	lists   int32
+	configs int32
+}
+
+func (c *countingArcConf) listContext(ctx context.Context) ([]int, error) {
+	atomic.AddInt32(&c.lists, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	return []int{1}, nil
+}
+
+func (c *countingArcConf) getConfigContext(ctx context.Context, cID int) (Controller, error) {
+	atomic.AddInt32(&c.configs, 1)
+	time.Sleep(10 * time.Millisecond)
+
+	ld := &LogicalDevice{ID: 0, DiskName: "/dev/sda", Devices: []*PhysicalDevice{{Type: SSD}}}
+
+	return Controller{ID: cID, LogicalDrives: LogicalDriveSet{0: ld}}, nil
+}
+
+func TestCachingArcConfConcurrent(t *testing.T) {
+	ac := &countingArcConf{}
+	cac := &cachingArcConf{ac: ac, cache: cache.New(time.Minute, time.Minute)}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			dType, err := cac.GetDiskType("/dev/sda")
+			if err != nil {
+				t.Errorf("GetDiskType failed: %s", err)
+			} else if dType != disko.SSD {
+				t.Errorf("expected SSD, got %s", dType)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if _, err := cac.Query(1); err != nil {
+		t.Errorf("Query failed: %s", err)
+	}
+
+	if n := atomic.LoadInt32(&ac.lists); n != 1 {
+		t.Errorf("expected 1 arcconf list for 11 callers, got %d", n)
+	}
+
+	if n := atomic.LoadInt32(&ac.configs); n != 1 {
+		t.Errorf("expected 1 arcconf getconfig for 11 callers, got %d", n)
+	}
+}
@@ -1,6 +1,7 @@
 package smartpqi
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strings"
@@ -119,9 +120,21 @@ type SmartPqi interface {
 	// Query - Query the controller provided
 	Query(int) (Controller, error)
 
+	// QueryContext - Query with a context.Context that bounds the arcconf calls
+	QueryContext(context.Context, int) (Controller, error)
+
 	// GetDiskType - Determine the disk type if controller owns disk
 	GetDiskType(string) (disko.DiskType, error)
 
+	// GetDiskTypeContext - GetDiskType with a context.Context that bounds the arcconf calls
+	GetDiskTypeContext(context.Context, string) (disko.DiskType, error)
+
+	// GetDiskIdentity - Return the identity the controller reports for the disk
+	GetDiskIdentity(string) (disko.DiskIdentity, error)
+
+	// GetDiskIdentityContext - GetDiskIdentity with a context.Context that bounds the arcconf calls
+	GetDiskIdentityContext(context.Context, string) (disko.DiskIdentity, error)
+
 	// DriverSysfsPath - Return the sysfs path to the linux driver for this controller
 	DriverSysfsPath() string
 
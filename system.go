@@ -1,5 +1,7 @@
 package disko
 
+import "context"
+
 // DiskFilter is filter function that returns true if the matching disk is
 // accepted false otherwise.
 type DiskFilter func(Disk) bool
@@ -38,16 +40,101 @@ type System interface {
 	// CreatePartitions creates multiple partitions on disk.
 	CreatePartitions(Disk, PartitionSet) error
 
-	// UpdatePartition updates multiple existing partitions on a disk.
+	// UpdatePartition updates an existing partition on a disk.  Only the
+	// ID, Type, Name and Attributes change, and only those that are not
+	// empty or zero in the given partition.  SetPartitionAttributes clears
+	// the attributes.
 	UpdatePartition(Disk, Partition) error
 
 	// UpdatePartitions updates multiple existing partitions on a disk.
 	UpdatePartitions(Disk, PartitionSet) error
 
+	// SetPartitionAttributes sets the GPT attribute flags of an existing
+	// partition to attrs, clearing them all if attrs is zero.
+	SetPartitionAttributes(d Disk, number uint, attrs PartAttrs) error
+
 	// DeletePartition deletes the specified partition.
 	DeletePartition(Disk, uint) error
 
+	// ResizePartition changes the Last of the specified partition, growing
+	// it into the free space that follows it or shrinking it.  Its start
+	// and data are left as they are.
+	ResizePartition(d Disk, number uint, last uint64) error
+
+	// SetDiskGUID changes the GUID of a disk with a GPT partition table.  A
+	// zero GUID is replaced with a random one.
+	SetDiskGUID(d Disk, id GUID) error
+
+	// RelocateBackupGPT moves the backup GPT header and partition entries
+	// of a disk that has grown to the new end of the disk, and extends the
+	// last usable LBA so that the added space can be partitioned.  The
+	// partitions are left as they are.
+	RelocateBackupGPT(d Disk) error
+
+	// RepairPartitionTable rebuilds the GPT of a disk from the copy of it
+	// that is valid, the primary if both are, fixing the TableProblems
+	// that are Repairable.  The partitions are left as they are.
+	RepairPartitionTable(d Disk) error
+
+	// RestorePartitionTable writes the partition table saved in b back
+	// onto a disk, replacing the table it has.  The disk must be the one
+	// the backup was taken from or one of the same size and sector size.
+	RestorePartitionTable(d Disk, b TableBackup) error
+
 	// Wipe wipes the disk to make it a clean disk. All partitions and data
 	// on the disk will be lost.
 	Wipe(Disk) error
 }
+
+// ContextSystem is a System whose methods have variants that take a
+// context.Context. Cancelling the context, or reaching its deadline, stops
+// the operation and kills any command it has started.  The System methods
+// behave as the Context variants called with context.Background().
+type ContextSystem interface {
+	System
+
+	// ScanAllDisksContext is ScanAllDisks with a context.
+	ScanAllDisksContext(ctx context.Context, filter DiskFilter) (DiskSet, error)
+
+	// ScanDisksContext is ScanDisks with a context.
+	ScanDisksContext(ctx context.Context, filter DiskFilter, paths ...string) (DiskSet, error)
+
+	// ScanDiskContext is ScanDisk with a context.
+	ScanDiskContext(ctx context.Context, path string) (Disk, error)
+
+	// CreatePartitionContext is CreatePartition with a context.
+	CreatePartitionContext(context.Context, Disk, Partition) error
+
+	// CreatePartitionsContext is CreatePartitions with a context.
+	CreatePartitionsContext(context.Context, Disk, PartitionSet) error
+
+	// UpdatePartitionContext is UpdatePartition with a context.
+	UpdatePartitionContext(context.Context, Disk, Partition) error
+
+	// UpdatePartitionsContext is UpdatePartitions with a context.
+	UpdatePartitionsContext(context.Context, Disk, PartitionSet) error
+
+	// SetPartitionAttributesContext is SetPartitionAttributes with a context.
+	SetPartitionAttributesContext(ctx context.Context, d Disk, number uint, attrs PartAttrs) error
+
+	// DeletePartitionContext is DeletePartition with a context.
+	DeletePartitionContext(context.Context, Disk, uint) error
+
+	// ResizePartitionContext is ResizePartition with a context.
+	ResizePartitionContext(ctx context.Context, d Disk, number uint, last uint64) error
+
+	// SetDiskGUIDContext is SetDiskGUID with a context.
+	SetDiskGUIDContext(ctx context.Context, d Disk, id GUID) error
+
+	// RelocateBackupGPTContext is RelocateBackupGPT with a context.
+	RelocateBackupGPTContext(ctx context.Context, d Disk) error
+
+	// RepairPartitionTableContext is RepairPartitionTable with a context.
+	RepairPartitionTableContext(ctx context.Context, d Disk) error
+
+	// RestorePartitionTableContext is RestorePartitionTable with a context.
+	RestorePartitionTableContext(ctx context.Context, d Disk, b TableBackup) error
+
+	// WipeContext is Wipe with a context.
+	WipeContext(context.Context, Disk) error
+}
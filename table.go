@@ -0,0 +1,124 @@
+package disko
+
+import "fmt"
+
+// TableProblemKind enumerates the problems a partition table can have.
+type TableProblemKind string
+
+const (
+	// ProblemPrimaryHeader is a primary GPT header that is missing or has a
+	// bad crc.
+	ProblemPrimaryHeader TableProblemKind = "primary-header"
+
+	// ProblemPrimaryEntries is a primary GPT partition entry array that has
+	// a bad crc or cannot be read.
+	ProblemPrimaryEntries TableProblemKind = "primary-entries"
+
+	// ProblemBackupHeader is a backup GPT header that is missing or has a
+	// bad crc.
+	ProblemBackupHeader TableProblemKind = "backup-header"
+
+	// ProblemBackupEntries is a backup GPT partition entry array that has a
+	// bad crc or cannot be read.
+	ProblemBackupEntries TableProblemKind = "backup-entries"
+
+	// ProblemBackupLocation is a backup GPT that is not at the end of the
+	// disk, as after the disk was grown.
+	ProblemBackupLocation TableProblemKind = "backup-location"
+
+	// ProblemMismatch is a primary and backup GPT that are both valid but
+	// describe different tables.
+	ProblemMismatch TableProblemKind = "mismatch"
+
+	// ProblemProtectiveMBR is a GPT disk whose MBR does not protect it.
+	ProblemProtectiveMBR TableProblemKind = "protective-mbr"
+
+	// ProblemOverlap is a partition that overlaps another.
+	ProblemOverlap TableProblemKind = "overlap"
+
+	// ProblemOutOfBounds is a partition that is not within the usable
+	// sectors of the disk.
+	ProblemOutOfBounds TableProblemKind = "out-of-bounds"
+)
+
+// TableProblem is something wrong with the partition table of a disk.
+type TableProblem struct {
+	// Kind is the kind of problem.
+	Kind TableProblemKind `json:"kind"`
+
+	// Partition is the number of the partition with the problem, or 0 if
+	// the problem is not with a partition.
+	Partition uint `json:"partition,omitempty"`
+
+	// Detail describes the problem.
+	Detail string `json:"detail"`
+}
+
+func (p TableProblem) String() string {
+	if p.Partition != 0 {
+		return fmt.Sprintf("%s: partition %d: %s", p.Kind, p.Partition, p.Detail)
+	}
+
+	return fmt.Sprintf("%s: %s", p.Kind, p.Detail)
+}
+
+// Repairable returns true if the problem is with the structure of the
+// table, which can be rebuilt from the copy that is valid.  Overlapping and
+// out of bounds partitions need the partitions changed instead.
+func (p TableProblem) Repairable() bool {
+	return p.Kind != ProblemOverlap && p.Kind != ProblemOutOfBounds
+}
+
+// ProblemsAfterRepair returns the TableProblems of d that are left once its
+// table is repaired, those that are not Repairable.  It returns an error
+// wrapping ErrBadPartitionTable if neither copy of the GPT is valid, so
+// there is nothing to repair the table from.
+func (d *Disk) ProblemsAfterRepair() ([]TableProblem, error) {
+	primary, backup := false, false
+	left := []TableProblem{}
+
+	for _, p := range d.TableProblems {
+		switch p.Kind {
+		case ProblemPrimaryHeader, ProblemPrimaryEntries:
+			primary = true
+		case ProblemBackupHeader, ProblemBackupEntries:
+			backup = true
+		}
+
+		if !p.Repairable() {
+			left = append(left, p)
+		}
+	}
+
+	if primary && backup {
+		return nil, fmt.Errorf("%s: %w: neither copy of the GPT is valid", d.Path, ErrBadPartitionTable)
+	}
+
+	return left, nil
+}
+
+// The size of the partition entry array of a new GPT.
+const (
+	gptDefaultEntries   = 128
+	gptDefaultEntrySize = 128
+)
+
+// GPTEntrySectors returns the number of sectors of the partition entry
+// array of the GPT of d, or of a new GPT if the header is not known.
+func (d *Disk) GPTEntrySectors() uint64 {
+	entries, entrySize := d.GPT.PartitionEntries, d.GPT.PartitionEntrySize
+	if entries == 0 || entrySize == 0 {
+		entries, entrySize = gptDefaultEntries, gptDefaultEntrySize
+	}
+
+	ssize := uint64(d.SectorSize)
+
+	return (uint64(entries)*uint64(entrySize) + ssize - 1) / ssize
+}
+
+// RelocatedLastUsableLBA returns the last usable LBA of the GPT of d once its
+// backup is at the end of the disk: the backup header is in the last sector
+// and its partition entries are just before it.
+func (d *Disk) RelocatedLastUsableLBA() uint64 {
+	return d.Size/uint64(d.SectorSize) - 2 - d.GPTEntrySectors()
+}